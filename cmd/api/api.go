@@ -13,7 +13,7 @@ import (
 
 	"consult_app.cedrickewi/internal/mailer"
 	"consult_app.cedrickewi/internal/mtgschelduler"
-	"consult_app.cedrickewi/internal/payunit"
+	"consult_app.cedrickewi/internal/payment"
 	"consult_app.cedrickewi/internal/store"
 	"go.uber.org/zap"
 )
@@ -26,7 +26,7 @@ type application struct {
 	logger *zap.SugaredLogger
 	mailer mailer.Mailer
 	wg     sync.WaitGroup
-	payunit payunit.Payunit  
+	payments *payment.Service
 	mtgschelduler *mtgschelduler.MeetingScheduler
 }
 
@@ -38,6 +38,9 @@ type config struct {
 	smtp        smtp
 	frontendURL string
 	apiURL      string
+	// caldavKey encrypts external calendar passwords; calendar sync is
+	// unavailable without it
+	caldavKey []byte
 }
 
 type dbConfig struct {
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"consult_app.cedrickewi/internal/mailer"
+	"consult_app.cedrickewi/internal/store"
+	"consult_app.cedrickewi/internal/validator"
+)
+
+// requestBooking turns a new booking of an expert who vets their clients
+// into a request, to be answered before the rules' deadline. The booking is
+// not held for payment until it is accepted.
+func requestBooking(bk *store.Booking, rules *store.SchedulingRules, start time.Time) {
+	deadline := rules.ApprovalDeadline(time.Now(), start).UTC()
+	bk.BKStatus = string(store.StatusRequested)
+	bk.ApprovalDeadline = &deadline
+	bk.HoldExpiresAt = nil
+}
+
+// scheduleRequestExpiry queues the job that declines a request left
+// unanswered and tells the expert a request is waiting for them
+func (app *application) scheduleRequestExpiry(ctx context.Context, bk *store.Booking) {
+	if bk.ApprovalDeadline == nil {
+		return
+	}
+	if _, err := app.mtgschelduler.ScheduleExpireRequest(ctx, bk.ID, *bk.ApprovalDeadline); err != nil {
+		app.logger.Errorw("failed to schedule booking request expiry", "booking_id", bk.ID, "error", err)
+	}
+
+	id, deadline := bk.ID, *bk.ApprovalDeadline
+	app.background(func() {
+		details, err := app.store.Booking.GetBookingDetails(context.Background(), id)
+		if err != nil {
+			app.logger.Errorln(err)
+			return
+		}
+
+		data := map[string]any{
+			"name":       details.Expert.Name,
+			"clientName": details.UserDetails.Name,
+			"bookingID":  id,
+			"topic":      details.Booking.Topic,
+			"startTime":  details.Booking.StartTime,
+			"endTime":    details.Booking.EndTime,
+			"deadline":   deadline.In(store.LoadLocation(details.Expert.Timezone)).Format(time.RFC1123),
+		}
+
+		if err := mailer.NewResend(details.Expert.Email, "booking_request_received.tmpl", data); err != nil {
+			app.logger.Errorln(err)
+		}
+	})
+}
+
+// acceptBookingHandler lets the expert accept a booking request, which the
+// client can then pay for
+func (app *application) acceptBookingHandler(w http.ResponseWriter, r *http.Request) {
+	app.decideBooking(w, r, true)
+}
+
+// declineBookingHandler lets the expert decline a booking request, releasing its slot
+func (app *application) declineBookingHandler(w http.ResponseWriter, r *http.Request) {
+	app.decideBooking(w, r, false)
+}
+
+// decideBooking answers a booking request, and the rest of its series, with
+// an optional message for the client
+func (app *application) decideBooking(w http.ResponseWriter, r *http.Request, accept bool) {
+	booking := app.expertBooking(w, r)
+	if booking == nil {
+		return
+	}
+
+	var input struct {
+		Message string `json:"message"`
+	}
+
+	if err := app.readJSON(w, r, &input); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+	v.Check(len(input.Message) <= 1000, "message", "must not be more than 1000 bytes long")
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	ctx := r.Context()
+
+	rules, err := app.store.Expert.GetSchedulingRules(ctx, booking.ExpertID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	answered, err := app.store.Booking.Decide(ctx, booking.ID, accept, app.contextGetUser(r).ID, input.Message, rules.Hold())
+	if err != nil {
+		switch {
+		case errors.Is(err, store.ErrInvalidTransition):
+			app.errorResponse(w, r, http.StatusConflict, "only a requested booking can be accepted or declined")
+		case errors.Is(err, store.ErrApprovalExpired):
+			app.errorResponse(w, r, http.StatusConflict, err.Error())
+		case errors.Is(err, store.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	for i := range answered {
+		bk := &answered[i]
+		if accept {
+			app.scheduleHoldExpiry(ctx, bk)
+			continue
+		}
+		if start, end, err := bk.Times(); err == nil {
+			app.offerFreedSlots(ctx, bk.ExpertID, start, end)
+		}
+	}
+
+	app.notifyDecision(answered[0].ID, accept, input.Message, answered[0].HoldExpiresAt)
+
+	loc := app.userLocation(r)
+	for i := range answered {
+		answered[i].InLocation(loc)
+	}
+
+	if err = app.writeJSON(w, http.StatusOK, envelope{"bookings": answered}, nil); err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// notifyDecision tells the client the expert's answer to their request
+func (app *application) notifyDecision(bookingID int64, accept bool, message string, payBy *time.Time) {
+	app.background(func() {
+		details, err := app.store.Booking.GetBookingDetails(context.Background(), bookingID)
+		if err != nil {
+			app.logger.Errorln(err)
+			return
+		}
+
+		data := map[string]any{
+			"name":       details.UserDetails.Name,
+			"expertName": details.Expert.Name,
+			"bookingID":  bookingID,
+			"startTime":  details.Booking.StartTime,
+			"endTime":    details.Booking.EndTime,
+			"message":    message,
+		}
+
+		template := "booking_declined.tmpl"
+		if accept {
+			template = "booking_accepted.tmpl"
+			if payBy != nil {
+				data["payBy"] = payBy.In(store.LoadLocation(details.UserDetails.Timezone)).Format(time.RFC1123)
+			}
+		}
+
+		if err := mailer.NewResend(details.UserDetails.Email, template, data); err != nil {
+			app.logger.Errorln(err)
+		}
+	})
+}
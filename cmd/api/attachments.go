@@ -0,0 +1,230 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"consult_app.cedrickewi/internal/aws"
+	"consult_app.cedrickewi/internal/store"
+	"github.com/google/uuid"
+)
+
+// maxAttachmentSize caps a single booking attachment (20MB)
+const maxAttachmentSize = 20 << 20
+
+// attachmentURLExpiry is how long a presigned download URL stays valid
+const attachmentURLExpiry = 5 * time.Minute
+
+// allowedAttachmentMIMEs are the types detectMIME may report for an
+// attachment. Office documents are zip archives to it.
+var allowedAttachmentMIMEs = map[string]struct{}{
+	"application/pdf":           {},
+	"image/jpeg":                {},
+	"image/png":                 {},
+	"text/plain; charset=utf-8": {},
+	"application/zip":           {},
+}
+
+// uploadAttachmentHandler shares a file on a booking with its other participant.
+// Expects a multipart form with the file under "file".
+func (app *application) uploadAttachmentHandler(w http.ResponseWriter, r *http.Request) {
+	booking, actor := app.participantBooking(w, r)
+	if booking == nil {
+		return
+	}
+
+	ctx := r.Context()
+
+	count, err := app.store.Attachment.Count(ctx, booking.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	if count >= store.MaxAttachmentsPerBooking {
+		app.errorResponse(w, r, http.StatusConflict, store.ErrTooManyAttachments.Error())
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxAttachmentSize+1<<20)
+
+	file, header, err := r.FormFile("file")
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	defer file.Close()
+
+	if header.Size == 0 {
+		app.badRequestResponse(w, r, errors.New("cannot upload empty file"))
+		return
+	}
+
+	if header.Size > maxAttachmentSize {
+		app.badRequestResponse(w, r, errors.New("file must not be larger than 20MB"))
+		return
+	}
+
+	filetype, err := detectMIME(file)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if _, ok := allowedAttachmentMIMEs[filetype]; !ok {
+		app.badRequestResponse(w, r, errors.New("file must be a PDF, JPEG, PNG, text or Office document"))
+		return
+	}
+
+	// Reset file pointer back to beginning
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	filename := filepath.Clean(filepath.Base(header.Filename))
+	filename = strings.ReplaceAll(filename, " ", "_")
+	if len(filename) > 200 {
+		filename = filename[len(filename)-200:]
+	}
+
+	user := app.contextGetUser(r)
+	attachment := store.Attachment{
+		BookingID:    booking.ID,
+		UploadedBy:   user.ID,
+		UploaderRole: actor,
+		Key:          fmt.Sprintf("bookings/%d/attachments/%s-%s", booking.ID, uuid.NewString(), filename),
+		Filename:     filename,
+		ContentType:  filetype,
+		SizeBytes:    header.Size,
+	}
+
+	if _, err := aws.UploadToS3(file, attachment.Key, filetype); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.store.Attachment.Insert(ctx, &attachment); err != nil {
+		if err := aws.DeleteFromS3(ctx, attachment.Key); err != nil {
+			app.logger.Errorw("failed to remove orphaned attachment", "key", attachment.Key, "error", err)
+		}
+
+		switch {
+		case errors.Is(err, store.ErrTooManyAttachments):
+			app.errorResponse(w, r, http.StatusConflict, err.Error())
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	if err = app.writeJSON(w, http.StatusCreated, envelope{"attachment": attachment}, nil); err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// getAttachmentsHandler lists the files shared on a booking
+func (app *application) getAttachmentsHandler(w http.ResponseWriter, r *http.Request) {
+	booking, _ := app.participantBooking(w, r)
+	if booking == nil {
+		return
+	}
+
+	attachments, err := app.store.Attachment.GetForBooking(r.Context(), booking.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if err = app.writeJSON(w, http.StatusOK, envelope{"attachments": attachments}, nil); err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// participantAttachment loads the attachment in the URL from a booking the
+// caller takes part in. It writes the error response itself and returns nil otherwise.
+func (app *application) participantAttachment(w http.ResponseWriter, r *http.Request) *store.Attachment {
+	booking, _ := app.participantBooking(w, r)
+	if booking == nil {
+		return nil
+	}
+
+	attachmentID, err := app.readIDParam(r, "attachmentID")
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return nil
+	}
+
+	attachment, err := app.store.Attachment.GetByID(r.Context(), booking.ID, attachmentID)
+	if err != nil {
+		switch {
+		case errors.Is(err, store.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return nil
+	}
+
+	return attachment
+}
+
+// downloadAttachmentHandler returns a short-lived presigned URL for a file
+// shared on a booking
+func (app *application) downloadAttachmentHandler(w http.ResponseWriter, r *http.Request) {
+	attachment := app.participantAttachment(w, r)
+	if attachment == nil {
+		return
+	}
+
+	url, err := aws.PresignDownload(r.Context(), attachment.Key, attachment.Filename, attachmentURLExpiry)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if err = app.writeJSON(w, http.StatusOK, envelope{
+		"attachment":   attachment,
+		"download_url": url,
+		"expires_at":   time.Now().Add(attachmentURLExpiry).In(app.userLocation(r)),
+	}, nil); err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// deleteAttachmentHandler lets the participant who shared a file remove it
+func (app *application) deleteAttachmentHandler(w http.ResponseWriter, r *http.Request) {
+	attachment := app.participantAttachment(w, r)
+	if attachment == nil {
+		return
+	}
+
+	if attachment.UploadedBy != app.contextGetUser(r).ID {
+		app.notPermittedResponse(w, r)
+		return
+	}
+
+	ctx := r.Context()
+
+	if err := app.store.Attachment.Delete(ctx, attachment.ID); err != nil {
+		switch {
+		case errors.Is(err, store.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	if err := aws.DeleteFromS3(ctx, attachment.Key); err != nil {
+		app.logger.Errorw("failed to delete attachment object", "attachment_id", attachment.ID, "key", attachment.Key, "error", err)
+	}
+
+	if err := app.writeJSON(w, http.StatusOK, envelope{"message": "attachment deleted"}, nil); err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
@@ -0,0 +1,32 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+
+	"consult_app.cedrickewi/internal/store"
+)
+
+// getAttendanceHandler returns how long each participant attended a session
+// and the outcome settled from it
+func (app *application) getAttendanceHandler(w http.ResponseWriter, r *http.Request) {
+	booking, _ := app.participantBooking(w, r)
+	if booking == nil {
+		return
+	}
+
+	attendance, err := app.store.Attendance.GetForBooking(r.Context(), booking.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, store.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	if err = app.writeJSON(w, http.StatusOK, envelope{"attendance": attendance}, nil); err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
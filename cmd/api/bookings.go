@@ -1,7 +1,7 @@
 package main
 
 import (
-	"bytes"
+	"context"
 	"crypto/hmac"
 	"crypto/sha256"
 	"database/sql"
@@ -16,9 +16,11 @@ import (
 	"strings"
 	"time"
 
-	"consult_app.cedrickewi/internal/payunit"
+	"consult_app.cedrickewi/internal/data"
+	"consult_app.cedrickewi/internal/payment"
 	"consult_app.cedrickewi/internal/store"
 	"consult_app.cedrickewi/internal/twillio"
+	"consult_app.cedrickewi/internal/validator"
 	"consult_app.cedrickewi/internal/zoom"
 )
 
@@ -28,6 +30,11 @@ type ZoomPayload struct {
 	Topic     string `json:"topic" example:"Project Progress Review"`
 	StartTime string `json:"start_time" example:"2023-10-01T10:00:00Z"`
 	EndTime   string `json:"end_time" example:"2023-10-01T11:00:00Z"`
+	// ServiceID books an entry of the expert's catalogue; the end time and
+	// price then come from the service.
+	ServiceID int64 `json:"service_id" example:"12"`
+	// Intake answers the expert's intake form, keyed by field key
+	Intake map[string]string `json:"intake"`
 }
 
 // Handler to create a new booking
@@ -39,7 +46,6 @@ func (app *application) createBookingHandler(w http.ResponseWriter, r *http.Requ
 	}
 
 	ctx := r.Context()
-	user := app.contextGetUser(r)
 
 	payload := ZoomPayload{}
 	if err := app.readJSON(w, r, &payload); err != nil {
@@ -54,6 +60,53 @@ func (app *application) createBookingHandler(w http.ResponseWriter, r *http.Requ
 
 	// save everthing in the booking table, this will contain all booked events
 
+	bk, _ := app.newBooking(w, r, expertID, &payload)
+	if bk == nil {
+		return
+	}
+
+	rules, err := app.store.Expert.GetSchedulingRules(ctx, expertID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	// the slot is held for the client until the hold runs out unpaid, or,
+	// when the expert vets their clients, until the request is answered
+	holdExpiresAt := time.Now().Add(rules.Hold()).UTC()
+	bk.HoldExpiresAt = &holdExpiresAt
+	if rules.RequiresApproval {
+		start, _, err := bk.Times()
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+		requestBooking(bk, rules, start)
+	}
+
+	if err = app.store.Booking.Insert(ctx, bk); err != nil {
+		app.bookingTimeErrorResponse(w, r, err)
+		return
+	}
+
+	app.scheduleHoldExpiry(ctx, bk)
+	app.scheduleRequestExpiry(ctx, bk)
+	app.claimWaitlistOffer(ctx, bk)
+
+	bk.InLocation(app.userLocation(r))
+
+	if err = app.writeJSON(w, http.StatusOK, envelope{"booking_created": bk}, nil); err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// newBooking checks that the expert and service of a booking request can be
+// booked and prices the session. It writes the error response itself and
+// returns a nil booking when the request cannot be booked.
+func (app *application) newBooking(w http.ResponseWriter, r *http.Request, expertID int64, payload *ZoomPayload) (*store.Booking, *store.Expert) {
+	ctx := r.Context()
+	user := app.contextGetUser(r)
+
 	expertInfo, err := app.store.Expert.GetExpertByID(ctx, expertID)
 	if err != nil {
 		switch {
@@ -62,21 +115,72 @@ func (app *application) createBookingHandler(w http.ResponseWriter, r *http.Requ
 		default:
 			app.serverErrorResponse(w, r, err)
 		}
-		return
+		return nil, nil
+	}
+
+	if expertInfo.OnboardingStatus != store.OnboardingActive {
+		app.errorResponse(w, r, http.StatusBadRequest, "❌ This expert is not accepting bookings yet.")
+		return nil, nil
+	}
+
+	var service *store.ExpertService
+	if payload.ServiceID != 0 {
+		service, err = app.store.Service.GetByID(ctx, payload.ServiceID)
+		if err != nil {
+			switch {
+			case errors.Is(err, store.ErrRecordNotFound):
+				app.badRequestResponse(w, r, errors.New("service not found"))
+			default:
+				app.serverErrorResponse(w, r, err)
+			}
+			return nil, nil
+		}
+		if service.ExpertID != expertInfo.ID || !service.IsActive {
+			app.badRequestResponse(w, r, errors.New("service is not offered by this expert"))
+			return nil, nil
+		}
 	}
 
 	startTime, err := time.Parse(time.RFC3339, payload.StartTime)
 	if err != nil {
 		app.badRequestResponse(w, r, errors.New("invalid start time format, must be RFC3339"))
-		return
+		return nil, nil
+	}
+
+	var endTime time.Time
+	if service != nil {
+		endTime = startTime.Add(time.Duration(service.DurationMinutes) * time.Minute)
+		if payload.EndTime != "" {
+			requested, err := time.Parse(time.RFC3339, payload.EndTime)
+			if err != nil || !requested.Equal(endTime) {
+				app.badRequestResponse(w, r, fmt.Errorf("end time must match the %d minute service duration", service.DurationMinutes))
+				return nil, nil
+			}
+		}
+		payload.EndTime = endTime.Format(time.RFC3339)
+	} else {
+		endTime, err = time.Parse(time.RFC3339, payload.EndTime)
+		if err != nil {
+			app.badRequestResponse(w, r, errors.New("invalid end time format, must be RFC3339"))
+			return nil, nil
+		}
 	}
-	endTime, err := time.Parse(time.RFC3339, payload.EndTime)
+
+	intake, ok := app.intakeAnswers(w, r, expertID, payload.Intake)
+	if !ok {
+		return nil, nil
+	}
+
+	// a slot offered to a waitlisted client is theirs until the offer expires
+	held, err := app.heldForAnother(ctx, user.ID, expertID, startTime, endTime)
 	if err != nil {
-		app.badRequestResponse(w, r, errors.New("invalid end time format, must be RFC3339"))
-		return
+		app.serverErrorResponse(w, r, err)
+		return nil, nil
+	}
+	if held != nil {
+		app.errorResponse(w, r, http.StatusConflict, fmt.Sprintf("❌ This slot is held for a waitlisted client until %s.", held.ExpiresAt.In(app.userLocation(r)).Format(time.RFC3339)))
+		return nil, nil
 	}
-	duration := endTime.Sub(startTime).Hours()
-	totalAmount := int(expertInfo.FeesPerHr*duration) + payunit.PlatformFees // adding platform fees
 
 	bk := store.Booking{
 		UserID:          user.ID,
@@ -85,43 +189,97 @@ func (app *application) createBookingHandler(w http.ResponseWriter, r *http.Requ
 		EndTime:         payload.EndTime,
 		Topic:           payload.Topic,
 		AdditionalNotes: payload.Agenda,
-		TotalAmount:     totalAmount,
+		Intake:          intake,
 	}
 
-	if err = app.store.Booking.Insert(ctx, &bk); err != nil {
-		switch err.Error() {
-		case "pq: ❌ Booking duration must be at least 30 minutes.":
-			app.errorResponse(w, r, http.StatusBadRequest, "❌ Booking duration must be at least 30 minutes.")
-			return
-		case "booking overlaps with existing user booking":
-			app.errorResponse(w, r, http.StatusConflict, "❌ You already have a booking that overlaps this time range.")
-			return
-		case "booking overlaps with expert's schedule":
-			app.errorResponse(w, r, http.StatusConflict, "❌ This expert already has a booking during that time.")
-			return
-		case "pq: ❌ End time must be after start time.":
-			app.errorResponse(w, r, http.StatusBadRequest, "❌ End time must be after start time.")
-			return
-		case "the selected time is outside the expert’s available hours":
-			app.errorResponse(w, r, http.StatusBadRequest, "❌ The selected time is outside the expert’s available hours.")
-			return
+	if service != nil {
+		// snapshot the service price so later catalogue edits don't change this booking
+		bk.ServiceID = sql.NullInt64{Int64: service.ID, Valid: true}
+		bk.ServicePrice = sql.NullInt64{Int64: int64(service.Price), Valid: true}
+		bk.Currency = service.Currency
+		bk.TotalAmount = service.Price
+	} else {
+		duration := endTime.Sub(startTime).Hours()
+		bk.TotalAmount = int(expertInfo.FeesPerHr * duration)
+	}
+
+	// the platform fee is charged in the booking's currency
+	fee, ok := payment.PlatformFee(bk.Currency)
+	if !ok {
+		app.errorResponse(w, r, http.StatusUnprocessableEntity, fmt.Sprintf("❌ Bookings in %s cannot be paid for.", bk.Currency))
+		return nil, nil
+	}
+	bk.PlatformFee = fee
+	bk.TotalAmount += fee
+
+	return &bk, expertInfo
+}
+
+// scheduleHoldExpiry queues the job that releases a booking left unpaid
+func (app *application) scheduleHoldExpiry(ctx context.Context, bk *store.Booking) {
+	if bk.HoldExpiresAt == nil {
+		return
+	}
+	if _, err := app.mtgschelduler.ScheduleExpireHold(ctx, bk.ID, *bk.HoldExpiresAt); err != nil {
+		app.logger.Errorw("failed to schedule booking hold expiry", "booking_id", bk.ID, "error", err)
+	}
+}
+
+// bookingTimeErrorResponse reports why a booking could not be written at the
+// requested time (overlaps, availability, scheduling rules)
+func (app *application) bookingTimeErrorResponse(w http.ResponseWriter, r *http.Request, err error) {
+	switch err.Error() {
+	case "booking overlaps with existing user booking":
+		app.errorResponse(w, r, http.StatusConflict, "❌ You already have a booking that overlaps this time range.")
+	case "booking overlaps with expert's schedule":
+		app.errorResponse(w, r, http.StatusConflict, "❌ This expert already has a booking during that time.")
+	case "pq: ❌ End time must be after start time.":
+		app.errorResponse(w, r, http.StatusBadRequest, "❌ End time must be after start time.")
+	case "the selected time is outside the expert’s available hours":
+		app.errorResponse(w, r, http.StatusBadRequest, "❌ The selected time is outside the expert’s available hours.")
+	default:
+		switch {
+		case errors.Is(err, store.ErrSchedulingRule):
+			app.errorResponse(w, r, http.StatusBadRequest, err.Error())
+		case errors.Is(err, store.ErrExpertNotBookable):
+			app.errorResponse(w, r, http.StatusBadRequest, "❌ This expert is not accepting bookings yet.")
 		default:
 			app.serverErrorResponse(w, r, err)
-			return
 		}
 	}
-
-	if err = app.writeJSON(w, http.StatusOK, envelope{"booking_created": bk}, nil); err != nil {
-		app.serverErrorResponse(w, r, err)
-	}
 }
 
 type updateBookingStatusInput struct {
-	BKStatus string `json:"bk_status"`
+	BKStatus string `json:"bk_status" validate:"required"`
+	Reason   string `json:"reason" validate:"max=500"`
+}
+
+// bookingActor tells whether the user is the client or the expert of a booking.
+// ok is false when the user takes no part in it.
+func (app *application) bookingActor(ctx context.Context, user *store.User, booking *store.Booking) (actor store.Actor, ok bool, err error) {
+	if booking.UserID == user.ID {
+		return store.ActorUser, true, nil
+	}
+
+	expert, err := app.store.Expert.GetExpertByUserID(ctx, user.ID)
+	if err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			return "", false, nil
+		}
+		return "", false, err
+	}
+
+	if expert.ID == booking.ExpertID {
+		return store.ActorExpert, true, nil
+	}
+
+	return "", false, nil
 }
 
-// Handler to approve a booking
-func (app *application) approveBookingHandler(w http.ResponseWriter, r *http.Request) {
+// updateBookingStatusHandler moves a booking to a new status, as allowed by the
+// booking state machine for the caller's role in the booking. Cancellations
+// and no-shows have their own paths, which refund the client and free the slot.
+func (app *application) updateBookingStatusHandler(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 	// Get booking ID from URL
 	id, err := app.readIDParam(r, "id")
@@ -141,70 +299,105 @@ func (app *application) approveBookingHandler(w http.ResponseWriter, r *http.Req
 		return
 	}
 
+	status := store.BookingStatus(strings.ToLower(payload.BKStatus))
+	if !status.IsValid() {
+		app.badRequestResponse(w, r, fmt.Errorf("invalid booking status %q", payload.BKStatus))
+		return
+	}
+
+	switch status {
+	case store.StatusCancelledByUser, store.StatusCancelledByExpert:
+		app.errorResponse(w, r, http.StatusConflict, "use the cancel endpoint to cancel a booking")
+		return
+	case store.StatusNoShow:
+		app.errorResponse(w, r, http.StatusConflict, "no-shows are decided from the session's attendance")
+		return
+	}
+
 	user := app.contextGetUser(r)
 
-	expert, err := app.store.Expert.GetExpertByUserID(ctx, user.ID)
+	booking, err := app.store.Booking.GetByID(ctx, id)
 	if err != nil {
 		switch {
 		case errors.Is(err, store.ErrRecordNotFound):
-			app.notPermittedResponse(w, r)
-			return
+			app.notFoundResponse(w, r)
 		default:
-
-			app.serverErrorResponse(w, r, err)
-			return
+			app.internalServerError(w, r, err)
 		}
-	}
-
-	if user.ID != expert.UserID {
-		app.notPermittedResponse(w, r)
 		return
 	}
 
-	// check if expert owns meeting
-	isOwner, err := app.store.Booking.IsExpertMeeting(ctx, id, expert.ID)
+	actor, ok, err := app.bookingActor(ctx, user, booking)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 		return
 	}
-
-	if !isOwner {
+	if !ok {
 		app.notPermittedResponse(w, r)
 		return
 	}
 
-	// Get the booking from database
-	booking, err := app.store.Booking.GetByID(ctx, id)
+	// requests are answered through accept/decline, which hold the slot for
+	// payment and tell the client
+	if actor == store.ActorExpert && store.BookingStatus(booking.BKStatus) == store.StatusRequested {
+		app.errorResponse(w, r, http.StatusConflict, "use the accept or decline endpoints to answer a booking request")
+		return
+	}
+
+	event, err := app.store.Booking.Transition(ctx, booking.ID, status, actor, user.ID, payload.Reason)
 	if err != nil {
 		switch {
+		case errors.Is(err, store.ErrInvalidTransition):
+			app.errorResponse(w, r, http.StatusConflict, fmt.Sprintf("a %s booking cannot be moved to %s", booking.BKStatus, status))
+		case errors.Is(err, store.ErrTransitionNotAllowed):
+			app.notPermittedResponse(w, r)
 		case errors.Is(err, store.ErrRecordNotFound):
 			app.notFoundResponse(w, r)
 		default:
-			app.internalServerError(w, r, err)
+			app.serverErrorResponse(w, r, err)
 		}
 		return
 	}
 
-	// Update the booking status to approved
-	booking.BKStatus = payload.BKStatus
+	if err = app.writeJSON(w, http.StatusOK, envelope{"event": event}, nil); err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
 
-	if payload.BKStatus != "pending" && payload.BKStatus != "confirmed" && payload.BKStatus != "cancelled" && payload.BKStatus != "completed" {
-		app.badRequestResponse(w, r, errors.New("invalid booking status - must be 'pending', 'confirmed', 'cancelled', or 'completed'"))
+// getBookingHistoryHandler lists every status change of a booking
+func (app *application) getBookingHistoryHandler(w http.ResponseWriter, r *http.Request) {
+	booking, _ := app.participantBooking(w, r)
+	if booking == nil {
 		return
 	}
-	if err = app.store.Booking.UpdateBookingStatus(ctx, booking.ID, booking.BKStatus); err != nil {
-		app.internalServerError(w, r, err)
+
+	events, err := app.store.Booking.GetEvents(r.Context(), booking.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
 		return
 	}
 
-	// Return success response
-	if err = app.writeJSON(w, http.StatusOK, envelope{"message": "booking approved successfully"}, nil); err != nil {
+	if err = app.writeJSON(w, http.StatusOK, envelope{"booking_id": booking.ID, "status": booking.BKStatus, "history": events}, nil); err != nil {
 		app.serverErrorResponse(w, r, err)
 	}
 }
 
+// payableBooking reports whether a booking can be paid for, writing the
+// error response when it cannot. A booking request must be accepted by the
+// expert first.
+func (app *application) payableBooking(w http.ResponseWriter, r *http.Request, bk *store.Booking) bool {
+	switch store.BookingStatus(bk.BKStatus) {
+	case store.StatusAwaitingPayment:
+		return true
+	case store.StatusRequested:
+		app.errorResponse(w, r, http.StatusConflict, "❌ The expert has not accepted this booking yet.")
+	default:
+		app.errorResponse(w, r, http.StatusConflict, fmt.Sprintf("❌ A %s booking cannot be paid for.", bk.BKStatus))
+	}
+	return false
+}
+
 type initializePaymentInput struct {
-	Currency       string `json:"currency" example:"XAF"`
 	PaymentCountry string `json:"payment_country" example:"CM"`
 }
 
@@ -253,26 +446,23 @@ func (app *application) initializeBookingPaymentHandler(w http.ResponseWriter, r
 		return
 	}
 
-	//allow user to make payment using payunit
-	paymentInitiale := payunit.PayUnitRequest{
-		Currency:       payload.Currency,
-		PaymentCountry: payload.PaymentCountry,
+	if !app.payableBooking(w, r, bk) {
+		return
 	}
 
 	// prevent inititating multiple transactions for the same booking
-	if bk.PayunitTransactionInitID != (sql.NullInt64{}) && bk.PayunitTransactionInitID.Valid {
+	if bk.TransactionID.Valid {
 		app.badRequestResponse(w, r, errors.New("payment transaction already initialized for this booking"))
 		return
 	}
 
-	// if payment is successful, update payment_status in database
-	payunitResp, err := app.payunit.InitializePayUnitTransaction(ctx, paymentInitiale, bk.ID, user.ID)
+	txn, err := app.payments.Initialize(ctx, bk, user.ID, payload.PaymentCountry)
 	if err != nil {
 		app.internalServerError(w, r, err)
 		return
 	}
 
-	if err := app.writeJSON(w, http.StatusOK, envelope{"message": payunitResp}, nil); err != nil {
+	if err := app.writeJSON(w, http.StatusOK, envelope{"message": txn.Response, "payment": txn}, nil); err != nil {
 		app.serverErrorResponse(w, r, err)
 	}
 }
@@ -327,15 +517,18 @@ func (app *application) makePaymentHandler(w http.ResponseWriter, r *http.Reques
 		return
 	}
 
-	paymentRequest := payunit.PaymentRequest{
-		Gateway:     payload.Gateway,
-		PhoneNumber: payload.PhoneNumber,
+	if !app.payableBooking(w, r, bk) {
+		return
 	}
 
 	// make payment
-	_, err = app.payunit.MakePayment(ctx, paymentRequest, bk.ID, user.ID)
-	if err != nil {
-		app.internalServerError(w, r, err)
+	if _, err = app.payments.Charge(ctx, bk, payload.Gateway, payload.PhoneNumber); err != nil {
+		switch {
+		case errors.Is(err, payment.ErrNotInitialized):
+			app.errorResponse(w, r, http.StatusConflict, err.Error())
+		default:
+			app.internalServerError(w, r, err)
+		}
 		return
 	}
 
@@ -344,7 +537,11 @@ func (app *application) makePaymentHandler(w http.ResponseWriter, r *http.Reques
 	}
 }
 
-func (app *application) rescheduleBookingHandler(w http.ResponseWriter, r *http.Request) {
+// updateBookingMeetingHandler edits the topic, agenda and duration of a
+// booking's Zoom meeting, and with the "following" scope those of the later
+// occurrences of its series. Moving a booking to a new time goes through the
+// reschedule proposals instead.
+func (app *application) updateBookingMeetingHandler(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 	user := app.contextGetUser(r)
 
@@ -378,6 +575,12 @@ func (app *application) rescheduleBookingHandler(w http.ResponseWriter, r *http.
 		return
 	}
 
+	// A seat shares its group session's meeting, which only the expert edits
+	if booking.GroupSessionID.Valid {
+		app.notPermittedResponse(w, r)
+		return
+	}
+
 	// Get the Zoom meeting details
 	if !booking.ZoomMeetingID.Valid {
 		app.notFoundResponse(w, r)
@@ -399,6 +602,7 @@ func (app *application) rescheduleBookingHandler(w http.ResponseWriter, r *http.
 		Topic    string `json:"topic"`
 		Agenda   string `json:"agenda"`
 		Duration int64  `json:"duration"`
+		Scope    string `json:"scope"`
 	}
 
 	err = app.readJSON(w, r, &input)
@@ -407,6 +611,14 @@ func (app *application) rescheduleBookingHandler(w http.ResponseWriter, r *http.
 		return
 	}
 
+	v := validator.New()
+	v.Check(validator.In(input.Scope, "", store.ScopeThis, store.ScopeFollowing), "scope", "must be this or following")
+	v.Check(input.Scope != store.ScopeFollowing || booking.SeriesID.Valid, "scope", "booking is not part of a series")
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
 	// Update the meeting details
 	meeting.Topic = &input.Topic
 	meeting.Agenda = &input.Agenda
@@ -431,6 +643,13 @@ func (app *application) rescheduleBookingHandler(w http.ResponseWriter, r *http.
 		return
 	}
 
+	if input.Scope == store.ScopeFollowing {
+		if err := app.updateFollowingMeetings(ctx, booking, meeting); err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+	}
+
 	// Return the updated meeting
 	err = app.writeJSON(w, http.StatusOK, envelope{"meeting": meeting}, nil)
 	if err != nil {
@@ -438,22 +657,161 @@ func (app *application) rescheduleBookingHandler(w http.ResponseWriter, r *http.
 	}
 }
 
-// Get all booking for a user
-func (app *application) getAllBookingsForUser(w http.ResponseWriter, r *http.Request) {
-	// id, err := app.readIDParam(r, "id")
-	user := app.contextGetUser(r)
-	ctx := r.Context()
-	bookx, err := app.store.Booking.GetAllUserBookings(ctx, user.ID)
+// updateFollowingMeetings copies the topic, agenda and duration of an edited
+// meeting to the Zoom meetings of the later occurrences of its series
+func (app *application) updateFollowingMeetings(ctx context.Context, booking *store.Booking, edited *store.ZoomMeeting) error {
+	following, err := app.store.Series.GetFollowing(ctx, booking.SeriesID.Int64, booking.SeriesIndex+1)
+	if err != nil {
+		return err
+	}
+
+	for _, occurrence := range following {
+		if !occurrence.ZoomMeetingID.Valid {
+			continue
+		}
+
+		meeting, err := app.store.ZoomMeeting.GetByID(ctx, occurrence.ZoomMeetingID.Int64)
+		if err != nil {
+			return err
+		}
+
+		meeting.Topic = edited.Topic
+		meeting.Agenda = edited.Agenda
+		meeting.Duration = edited.Duration
+
+		if err := zoom.UpdateZoomMeeting(meeting.MeetingID, *meeting); err != nil {
+			return err
+		}
+
+		if err := app.store.ZoomMeeting.Update(ctx, meeting); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// readBookingFilters reads the filters, sort and page of a booking list from
+// the query string: status, payment_status (comma separated), from, to, sort,
+// page and page_size
+func (app *application) readBookingFilters(r *http.Request, v *validator.Validator) (store.BookingFilter, data.Filters) {
+	qs := r.URL.Query()
+	loc := app.userLocation(r)
+
+	filter := store.BookingFilter{
+		Statuses:        app.readCSV(qs, "status", []string{}),
+		PaymentStatuses: app.readCSV(qs, "payment_status", []string{}),
+		From:            app.readTimeParam(qs, "from", time.Time{}, loc, v),
+		To:              app.readTimeParam(qs, "to", time.Time{}, loc, v),
+	}
+
+	filters := data.Filters{
+		Page:     app.readInt(qs, "page", 1, v),
+		PageSize: app.readInt(qs, "page_size", 20, v),
+		Sort:     app.readStrings(qs, "sort", "-start_time"),
+		SortSafe: store.BookingSortSafe,
+	}
+
+	for _, status := range filter.Statuses {
+		v.Check(store.BookingStatus(status).IsValid(), "status", "must only contain booking statuses")
+	}
+	for _, status := range filter.PaymentStatuses {
+		v.Check(validator.In(status, store.PaymentPending, store.PaymentSuccess, store.PaymentRefunded, store.PaymentCancelled, store.PaymentFailed),
+			"payment_status", "must only contain pending, success, refunded, cancelled or failed")
+	}
+	if !filter.From.IsZero() && !filter.To.IsZero() {
+		v.Check(filter.From.Before(filter.To), "to", "must be after from")
+	}
+
+	data.ValidateFilters(v, filters)
+
+	return filter, filters
+}
+
+// writeBookingList writes a page of bookings in the caller's timezone
+func (app *application) writeBookingList(w http.ResponseWriter, r *http.Request, filter store.BookingFilter, filters data.Filters) {
+	bookings, metadata, err := app.store.Booking.List(r.Context(), filter, filters)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 		return
 	}
 
-	if err := app.writeJSON(w, http.StatusOK, envelope{"bookings": bookx}, nil); err != nil {
+	loc := app.userLocation(r)
+	for i := range bookings {
+		bookings[i].InLocation(loc)
+	}
+
+	if err := app.writeJSON(w, http.StatusOK, envelope{"bookings": bookings, "metadata": metadata}, nil); err != nil {
 		app.serverErrorResponse(w, r, err)
 	}
 }
 
+// getAllBookingsForUser lists the bookings of the logged-in client.
+// GET /v1/bookings/me?status=&payment_status=&from=&to=&expert_id=&sort=&page=&page_size=
+func (app *application) getAllBookingsForUser(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
+	v := validator.New()
+
+	filter, filters := app.readBookingFilters(r, v)
+	filter.UserID = user.ID
+	filter.ExpertID = int64(app.readInt(r.URL.Query(), "expert_id", 0, v))
+
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	app.writeBookingList(w, r, filter, filters)
+}
+
+// getAllBookingsForExpert lists the bookings of the logged-in expert.
+// GET /v1/bookings/expert?status=&payment_status=&from=&to=&user_id=&sort=&page=&page_size=
+func (app *application) getAllBookingsForExpert(w http.ResponseWriter, r *http.Request) {
+	expert := app.currentExpert(w, r)
+	if expert == nil {
+		return
+	}
+
+	v := validator.New()
+
+	filter, filters := app.readBookingFilters(r, v)
+	filter.ExpertID = expert.ID
+	filter.UserID = int64(app.readInt(r.URL.Query(), "user_id", 0, v))
+
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	app.writeBookingList(w, r, filter, filters)
+}
+
+// getOrganisationBookingsHandler lists the bookings of the experts of an
+// organisation, or of one of its branches, to its owner.
+// GET /v1/organisations/{id}/bookings?branch_id=&expert_id=&user_id=&status=&payment_status=&from=&to=&sort=&page=&page_size=
+func (app *application) getOrganisationBookingsHandler(w http.ResponseWriter, r *http.Request) {
+	orgID := app.ownOrganisation(w, r)
+	if orgID == 0 {
+		return
+	}
+
+	qs := r.URL.Query()
+	v := validator.New()
+
+	filter, filters := app.readBookingFilters(r, v)
+	filter.OrganisationID = orgID
+	filter.BranchID = int64(app.readInt(qs, "branch_id", 0, v))
+	filter.ExpertID = int64(app.readInt(qs, "expert_id", 0, v))
+	filter.UserID = int64(app.readInt(qs, "user_id", 0, v))
+
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	app.writeBookingList(w, r, filter, filters)
+}
+
 func (app *application) getABookingForUser(w http.ResponseWriter, r *http.Request) {
 	user := app.contextGetUser(r)
 
@@ -483,6 +841,8 @@ func (app *application) getABookingForUser(w http.ResponseWriter, r *http.Reques
 
 	// TODO: check if payment have been made
 
+	bookx.InLocation(app.userLocation(r))
+
 	if err := app.writeJSON(w, http.StatusOK, envelope{"booking": bookx}, nil); err != nil {
 		app.serverErrorResponse(w, r, err)
 		return
@@ -549,6 +909,8 @@ func (app *application) getABookingForExpert(w http.ResponseWriter, r *http.Requ
 		return
 	}
 
+	bookx.InLocation(app.userLocation(r))
+
 	if err := app.writeJSON(w, http.StatusOK, envelope{"booking": bookx}, nil); err != nil {
 		app.serverErrorResponse(w, r, err)
 		return
@@ -556,114 +918,55 @@ func (app *application) getABookingForExpert(w http.ResponseWriter, r *http.Requ
 
 }
 
-// PayunitWebhookHandler handles Payunit payment status webhooks
-// payunitGetPaymentStatusHandler handles retrieving and updating payment status for a booking.
+// payunitWebHookHandler receives PayUnit's notifications that a transaction
+// changed. Notifications are authenticated by the gateway, recorded, and each
+// one processed once: the transaction's state is asked from PayUnit and
+// applied to its booking.
 func (app *application) payunitWebHookHandler(w http.ResponseWriter, r *http.Request) {
-	ctx := r.Context()
-
-	app.logger.Infof("📥 Received PayUnit webhook from %s", r.RemoteAddr)
-
-	// STEP 1️⃣ — Log request headers
-	for name, values := range r.Header {
-		app.logger.Infof("Header %s: %v", name, values)
-	}
-
-	// STEP 2️⃣ — Read and log raw body for debugging
-	bodyBytes, err := io.ReadAll(r.Body)
+	notification, err := app.payments.Notification(r)
 	if err != nil {
-		app.logger.Errorf("❌ Failed to read webhook body: %v", err)
-		app.badRequestResponse(w, r, fmt.Errorf("failed to read webhook body"))
-		return
-	}
-	app.logger.Infof("📦 Raw webhook body: %s", string(bodyBytes))
-	r.Body = io.NopCloser(bytes.NewBuffer(bodyBytes)) // reset for decoding
-
-	// STEP 3️⃣ — Decode JSON payload
-	var payload struct {
-		TransactionStatus   string  `json:"transaction_status"`
-		TransactionGateway  string  `json:"transaction_gateway"`
-		TransactionAmount   float64 `json:"transaction_amount"`
-		TransactionID       string  `json:"transaction_id"`
-		Message             string  `json:"message"`
-		TransactionCurrency string  `json:"transaction_currency"`
-		NotifyURL           string  `json:"notify_url"`
-		CallbackURL         string  `json:"callback_url"`
-	}
-	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
-		app.logger.Errorf("❌ Invalid webhook payload: %v", err)
-		app.badRequestResponse(w, r, fmt.Errorf("invalid webhook payload"))
+		if errors.Is(err, payment.ErrInvalidWebhook) {
+			app.logger.Warnw("rejected payment notification", "remote_addr", r.RemoteAddr, "error", err)
+			app.errorResponse(w, r, http.StatusUnauthorized, "invalid or missing webhook signature")
+			return
+		}
+		app.badRequestResponse(w, r, err)
 		return
 	}
 
-	app.logger.Infof("✅ Decoded PayUnit Payload: %+v", payload)
+	app.logger.Infow("received payment notification", "transaction_id", notification.TransactionID, "refund_id", notification.RefundID, "state", notification.State)
 
-	// STEP 4️⃣ — Get bookingID from query param
-	bookingIDStr := r.URL.Query().Get("bookingID")
-	if bookingIDStr == "" {
-		app.badRequestResponse(w, r, fmt.Errorf("missing bookingID in webhook URL"))
-		return
-	}
-	_, err = strconv.ParseInt(bookingIDStr, 10, 64)
+	status, err := app.payments.Process(r.Context(), notification)
 	if err != nil {
-		app.badRequestResponse(w, r, fmt.Errorf("invalid bookingID format"))
-		return
-	}
-
-	// STEP 5️⃣ — Environment-based security
-	appMode := os.Getenv("PAYUNIT_MODE") // "sandbox" or "live"
-
-	if strings.ToLower(appMode) == "live" {
-		// Verify request IP (PayUnit’s servers usually use DigitalOcean IPs)
-		if !strings.HasPrefix(r.RemoteAddr, "138.197.") {
-			app.logger.Warnf("🚨 Unauthorized IP: %s (expected PayUnit server)", r.RemoteAddr)
-			http.Error(w, "unauthorized webhook source", http.StatusUnauthorized)
-			return
+		switch {
+		case errors.Is(err, payment.ErrInvalidWebhook):
+			app.logger.Warnw("rejected payment notification", "transaction_id", notification.TransactionID, "error", err)
+			app.errorResponse(w, r, http.StatusUnauthorized, "invalid or missing webhook signature")
+		case errors.Is(err, payment.ErrUnknownTransaction), errors.Is(err, payment.ErrUnknownRefund):
+			app.badRequestResponse(w, r, err)
+		default:
+			app.serverErrorResponse(w, r, fmt.Errorf("failed to process payment notification: %w", err))
 		}
-		app.logger.Info("✅ Valid webhook source detected (live mode)")
-	} else {
-		app.logger.Info("⚠️ Sandbox mode — skipping strict verification")
-	}
-
-	// STEP 6️⃣ — Verify transaction in DB
-	booking, err := app.store.Booking.GetByTransactionID(ctx, payload.TransactionID)
-	if err != nil {
-		app.logger.Errorf("❌ Booking not found for transaction ID %s: %v", payload.TransactionID, err)
-		app.badRequestResponse(w, r, fmt.Errorf("booking not found for transaction ID %s", payload.TransactionID))
 		return
 	}
 
-	if !booking.TransactionID.Valid || booking.TransactionID.String != payload.TransactionID {
-		app.logger.Errorf("🚫 Transaction mismatch for booking %d", booking.ID)
-		app.badRequestResponse(w, r, fmt.Errorf("transaction mismatch"))
-		return
+	message := "notification already processed"
+	switch {
+	case status != nil && notification.RefundID != "":
+		message = fmt.Sprintf("refund is %s", strings.ToLower(string(status.State)))
+	case status != nil:
+		message = fmt.Sprintf("payment is %s", strings.ToLower(string(status.State)))
 	}
 
-	app.logger.Infof("✅ Verified booking #%d for transaction %s", booking.ID, payload.TransactionID)
-
-	// STEP 7️⃣ — Trigger status verification (updates DB + creates Zoom)
-	result, err := app.payunit.GetPaymentStatus(ctx, booking.ID)
-	if err != nil {
-		app.logger.Errorf("❌ Failed to verify payment status: %v", err)
-		app.serverErrorResponse(w, r, fmt.Errorf("failed to verify payment status: %v", err))
-		return
+	if err := app.writeJSON(w, http.StatusOK, envelope{"status": "success", "message": message}, nil); err != nil {
+		app.serverErrorResponse(w, r, err)
 	}
-
-	app.logger.Infof("💰 Payment verification complete for booking #%d — Status: %s",
-		booking.ID, result.Data.TransactionStatus)
-
-	// STEP 8️⃣ — Return success response to PayUnit
-	app.writeJSON(w, http.StatusOK, envelope{
-		"status":  "success",
-		"message": fmt.Sprintf("Webhook processed successfully for booking %d", booking.ID),
-	}, nil)
 }
 
 func (app *application) zoomWebhookHandler(w http.ResponseWriter, r *http.Request) {
 	signature := r.Header.Get("X-Zm-Signature")
 	timestamp := r.Header.Get("X-Zm-Request-Timestamp")
 
-	app.logger.Infof("Received Headers: %+v", r.Header)
-
 	if signature == "" || timestamp == "" {
 		app.logger.Warnln("Missing signature or timestamp header")
 		http.Error(w, "invalid or missing authentication token", http.StatusUnauthorized)
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"consult_app.cedrickewi/internal/ical"
+	"consult_app.cedrickewi/internal/store"
+)
+
+// feedEvents turns a user's bookings into calendar events. The seats of a
+// group session the user hosts make a single event with every attendee.
+func feedEvents(entries []store.CalendarEntry, userID int64) []ical.Event {
+	events := []ical.Event{}
+	sessions := map[int64]int{}
+
+	for i := range entries {
+		e := &entries[i]
+		if !e.GroupSessionID.Valid || e.ExpertUserID != userID {
+			events = append(events, e.Event(userID))
+			continue
+		}
+
+		attending := store.CalendarStatus(e.Status) != ical.StatusCancelled
+
+		idx, ok := sessions[e.GroupSessionID.Int64]
+		if !ok {
+			event := e.Event(userID)
+			event.UID = fmt.Sprintf("group-session-%d@%s", e.GroupSessionID.Int64, ical.UIDDomain)
+			event.Summary = e.Topic
+			event.Attendees = nil
+			events = append(events, event)
+			idx = len(events) - 1
+			sessions[e.GroupSessionID.Int64] = idx
+		}
+
+		event := &events[idx]
+		if e.Sequence > event.Sequence {
+			event.Sequence = e.Sequence
+		}
+		if e.UpdatedAt.After(event.LastModified) {
+			event.LastModified = e.UpdatedAt
+		}
+		if attending {
+			event.Status = store.CalendarStatus(e.Status)
+			event.Attendees = append(event.Attendees, ical.Person{Name: e.ClientName, Email: e.ClientEmail})
+		}
+	}
+
+	return events
+}
+
+// writeCalendar writes a calendar as text/calendar
+func (app *application) writeCalendar(w http.ResponseWriter, r *http.Request, cal *ical.Calendar, filename string) {
+	w.Header().Set("Content-Type", "text/calendar; charset=utf-8")
+	if filename != "" {
+		w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, filename))
+	}
+	w.WriteHeader(http.StatusOK)
+
+	if err := cal.Encode(w); err != nil {
+		app.logger.Errorw("failed to write calendar", "path", r.URL.Path, "error", err)
+	}
+}
+
+// getBookingCalendarHandler exports a booking as an .ics file for either participant
+func (app *application) getBookingCalendarHandler(w http.ResponseWriter, r *http.Request) {
+	booking, _ := app.participantBooking(w, r)
+	if booking == nil {
+		return
+	}
+
+	entry, err := app.store.Calendar.GetCalendarEntry(r.Context(), booking.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, store.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	cal := ical.Calendar{
+		Method: "PUBLISH",
+		Events: []ical.Event{entry.Event(app.contextGetUser(r).ID)},
+	}
+
+	app.writeCalendar(w, r, &cal, fmt.Sprintf("booking-%d.ics", booking.ID))
+}
+
+// createCalendarFeedHandler creates the logged-in user's calendar feed and
+// returns its secret URL. Calling it again replaces the URL; the old one stops working.
+func (app *application) createCalendarFeedHandler(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
+
+	token, err := app.store.Calendar.NewFeedToken(r.Context(), user.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if err = app.writeJSON(w, http.StatusCreated, envelope{"calendar_feed": map[string]string{
+		"url": fmt.Sprintf("%s/v1/calendar/%s.ics", app.config.apiURL, token),
+	}}, nil); err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// deleteCalendarFeedHandler stops the logged-in user's calendar feed
+func (app *application) deleteCalendarFeedHandler(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
+
+	if err := app.store.Calendar.DeleteFeedToken(r.Context(), user.ID); err != nil {
+		switch {
+		case errors.Is(err, store.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	if err := app.writeJSON(w, http.StatusOK, envelope{"message": "calendar feed deleted"}, nil); err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// calendarFeedHandler serves a user's sessions to calendar apps subscribed to
+// their feed. The token in the URL is the only credential.
+func (app *application) calendarFeedHandler(w http.ResponseWriter, r *http.Request) {
+	token, err := app.readIDParamStr(r, "token")
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	ctx := r.Context()
+
+	userID, err := app.store.Calendar.GetFeedUser(ctx, token)
+	if err != nil {
+		switch {
+		case errors.Is(err, store.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	entries, err := app.store.Calendar.GetFeedEntries(ctx, userID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	cal := ical.Calendar{
+		Name:   "Consult-Out sessions",
+		Method: "PUBLISH",
+		Events: feedEvents(entries, userID),
+	}
+
+	app.writeCalendar(w, r, &cal, "")
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+	"time"
+
+	"consult_app.cedrickewi/internal/caldav"
+	"consult_app.cedrickewi/internal/store"
+	"consult_app.cedrickewi/internal/validator"
+)
+
+// calendarCheckTimeout bounds the check of a calendar being connected
+const calendarCheckTimeout = 15 * time.Second
+
+// connectCalendarHandler connects the logged-in expert's external CalDAV
+// calendar, or replaces its settings. The calendar is checked before it is
+// saved, then synced in the background: its busy time blocks bookings and
+// confirmed bookings are written into it.
+func (app *application) connectCalendarHandler(w http.ResponseWriter, r *http.Request) {
+	if app.config.caldavKey == nil {
+		app.errorResponse(w, r, http.StatusServiceUnavailable, "calendar sync is not available")
+		return
+	}
+
+	expert := app.currentExpert(w, r)
+	if expert == nil {
+		return
+	}
+
+	var input struct {
+		CalendarURL string `json:"calendar_url"`
+		Username    string `json:"username"`
+		Password    string `json:"password"`
+	}
+
+	if err := app.readJSON(w, r, &input); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+	u, err := url.Parse(input.CalendarURL)
+	v.Check(err == nil && u.Host != "", "calendar_url", "must be a valid URL")
+	if err == nil {
+		v.Check(u.Scheme == "https" || (u.Scheme == "http" && app.config.env == "development"), "calendar_url", "must use https")
+	}
+	v.Check(input.Username != "", "username", "must be provided")
+	v.Check(input.Password != "", "password", "must be provided")
+
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), calendarCheckTimeout)
+	defer cancel()
+
+	if err := caldav.New(input.CalendarURL, input.Username, input.Password).Check(ctx); err != nil {
+		switch {
+		case errors.Is(err, caldav.ErrUnauthorized):
+			v.AddError("password", "was rejected by the calendar server")
+		case errors.Is(err, caldav.ErrNotCalendar):
+			v.AddError("calendar_url", "is not a calendar")
+		default:
+			v.AddError("calendar_url", "could not be reached")
+		}
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	sealed, err := caldav.Seal(app.config.caldavKey, input.Password)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	conn := store.CalendarConnection{
+		ExpertID:    expert.ID,
+		CalendarURL: input.CalendarURL,
+		Username:    input.Username,
+		Password:    sealed,
+	}
+
+	if err := app.store.CalendarSync.SaveConnection(r.Context(), &conn); err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if _, err := app.mtgschelduler.ScheduleCalendarSync(r.Context(), expert.ID); err != nil {
+		app.logger.Errorw("failed to schedule calendar sync", "expert_id", expert.ID, "error", err)
+	}
+
+	if err := app.writeJSON(w, http.StatusOK, envelope{"calendar_connection": conn}, nil); err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// getCalendarConnectionHandler shows the logged-in expert's calendar
+// connection and how its last sync went
+func (app *application) getCalendarConnectionHandler(w http.ResponseWriter, r *http.Request) {
+	expert := app.currentExpert(w, r)
+	if expert == nil {
+		return
+	}
+
+	conn, err := app.store.CalendarSync.GetConnection(r.Context(), expert.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, store.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	if err := app.writeJSON(w, http.StatusOK, envelope{"calendar_connection": conn}, nil); err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// disconnectCalendarHandler disconnects the logged-in expert's calendar. The
+// busy time imported from it stops blocking bookings and is offered to the
+// waitlist; events already written to it stay there.
+func (app *application) disconnectCalendarHandler(w http.ResponseWriter, r *http.Request) {
+	expert := app.currentExpert(w, r)
+	if expert == nil {
+		return
+	}
+
+	if err := app.store.CalendarSync.DeleteConnection(r.Context(), expert.ID); err != nil {
+		switch {
+		case errors.Is(err, store.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	now := time.Now()
+	if _, err := app.mtgschelduler.ScheduleWaitlistOffers(r.Context(), expert.ID, now, now.Add(store.CalendarSyncWindow)); err != nil {
+		app.logger.Errorw("failed to schedule waitlist offers", "expert_id", expert.ID, "error", err)
+	}
+
+	if err := app.writeJSON(w, http.StatusOK, envelope{"message": "calendar disconnected"}, nil); err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
@@ -0,0 +1,335 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"consult_app.cedrickewi/internal/mailer"
+	"consult_app.cedrickewi/internal/store"
+	"consult_app.cedrickewi/internal/validator"
+	"consult_app.cedrickewi/internal/zoom"
+)
+
+// cancelBookingHandler lets the client or the expert cancel a booking.
+// A client cancelling a paid booking is refunded according to the expert's
+// cancellation policy; when the expert cancels, the client is refunded in full.
+// For a booking of a series, the "following" scope also cancels every later
+// occurrence that is still active.
+func (app *application) cancelBookingHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Reason string `json:"reason"`
+		Scope  string `json:"scope"`
+	}
+
+	if err := app.readJSON(w, r, &input); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+	v.Check(len(input.Reason) <= 500, "reason", "must not be more than 500 bytes long")
+	v.Check(validator.In(input.Scope, "", store.ScopeThis, store.ScopeFollowing), "scope", "must be this or following")
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	booking, actor := app.participantBooking(w, r)
+	if booking == nil {
+		return
+	}
+
+	ctx := r.Context()
+	user := app.contextGetUser(r)
+
+	to := store.StatusCancelledByUser
+	if actor == store.ActorExpert {
+		to = store.StatusCancelledByExpert
+	}
+
+	if err := store.CheckTransition(store.BookingStatus(booking.BKStatus), to, actor); err != nil {
+		app.errorResponse(w, r, http.StatusConflict, fmt.Sprintf("a %s booking cannot be cancelled", booking.BKStatus))
+		return
+	}
+
+	targets := []store.Booking{*booking}
+	if input.Scope == store.ScopeFollowing {
+		if !booking.SeriesID.Valid {
+			v.AddError("scope", "booking is not part of a series")
+			app.failedValidationResponse(w, r, v.Errors)
+			return
+		}
+
+		following, err := app.store.Series.GetFollowing(ctx, booking.SeriesID.Int64, booking.SeriesIndex)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+		targets = following
+	}
+
+	policy, err := app.store.Cancellation.GetPolicy(ctx, booking.ExpertID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	var cancelled []cancellation
+	for i := range targets {
+		target := &targets[i]
+
+		// later occurrences that already started or ended are left alone
+		if store.CheckTransition(store.BookingStatus(target.BKStatus), to, actor) != nil {
+			continue
+		}
+
+		refund, err := app.cancellationRefund(target, actor, to, user.ID, policy)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+
+		event, err := app.store.Cancellation.Cancel(ctx, target.ID, to, actor, user.ID, input.Reason, refund)
+		if err != nil {
+			switch {
+			case errors.Is(err, store.ErrInvalidTransition), errors.Is(err, store.ErrTransitionNotAllowed):
+				if target.ID != booking.ID {
+					continue
+				}
+				app.editConflictResponse(w, r)
+			default:
+				app.serverErrorResponse(w, r, err)
+			}
+			return
+		}
+		if refund != nil && refund.Amount == 0 {
+			refund = nil
+		}
+
+		cancelled = append(cancelled, cancellation{BookingID: target.ID, Event: event, Refund: refund, shared: target.GroupSessionID.Valid})
+	}
+
+	// Releasing the Zoom meetings and notifying the other party does not
+	// need to hold up the response.
+	app.background(func() {
+		app.afterCancellation(cancelled, actor, input.Reason)
+	})
+
+	if input.Scope == store.ScopeFollowing {
+		err = app.writeJSON(w, http.StatusOK, envelope{"cancellations": cancelled, "policy": policy}, nil)
+	} else {
+		err = app.writeJSON(w, http.StatusOK, envelope{"event": cancelled[0].Event, "refund": cancelled[0].Refund, "policy": policy}, nil)
+	}
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// cancellation is one booking cancelled by a cancel request
+type cancellation struct {
+	BookingID int64               `json:"booking_id"`
+	Event     *store.BookingEvent `json:"event"`
+	Refund    *store.Refund       `json:"refund"`
+	// shared is set for group session seats, whose Zoom meeting is kept
+	shared bool
+}
+
+// cancellationRefund works out what a paid booking gives back when it is
+// cancelled, or nil when nothing is owed
+func (app *application) cancellationRefund(booking *store.Booking, actor store.Actor, to store.BookingStatus, requestedBy int64, policy *store.CancellationPolicy) (*store.Refund, error) {
+	if booking.PaymentStatus != store.PaymentSuccess || booking.TotalAmount <= 0 {
+		return nil, nil
+	}
+
+	amount, percent, err := policy.Refund(booking, actor, time.Now())
+	if err != nil || amount <= 0 {
+		return nil, err
+	}
+
+	return &store.Refund{
+		Amount:      amount,
+		Currency:    booking.Currency,
+		Reason:      fmt.Sprintf("%s (%d%% refund)", to, percent),
+		RequestedBy: requestedBy,
+	}, nil
+}
+
+// afterCancellation deletes the Zoom meetings of cancelled bookings and emails
+// the party that did not cancel, once for the whole request.
+func (app *application) afterCancellation(cancelled []cancellation, actor store.Actor, reason string) {
+	ctx := context.Background()
+
+	var first *store.CustomBooking
+	refundAmount := 0
+	for _, c := range cancelled {
+		details, err := app.store.Booking.GetBookingDetails(ctx, c.BookingID)
+		if err != nil {
+			app.logger.Errorln(err)
+			continue
+		}
+
+		if details.ZoomMeeting.MeetingID != 0 && !c.shared {
+			if err := zoom.DeleteZoomMeeting(details.ZoomMeeting.MeetingID); err != nil {
+				app.logger.Errorw("failed to delete zoom meeting", "booking_id", c.BookingID, "error", err)
+			}
+		}
+
+		// The freed slot goes to the expert's waitlist first
+		if start, end, err := details.Booking.Times(); err == nil && !c.shared {
+			app.offerFreedSlots(ctx, details.Booking.ExpertID, start, end)
+		}
+
+		if first == nil {
+			first = details
+		}
+		if c.Refund != nil {
+			refundAmount += c.Refund.Amount
+		}
+	}
+
+	if first == nil {
+		return
+	}
+
+	recipient, cancelledBy := first.Expert, first.UserDetails.Name
+	if actor == store.ActorExpert {
+		recipient, cancelledBy = first.UserDetails, first.Expert.Name
+	}
+
+	data := map[string]any{
+		"name":        recipient.Name,
+		"cancelledBy": cancelledBy,
+		"bookingID":   first.Booking.ID,
+		"startTime":   first.Booking.StartTime,
+		"endTime":     first.Booking.EndTime,
+		"reason":      reason,
+		"following":   len(cancelled) - 1,
+	}
+	// Only the client receives the refund
+	if refundAmount > 0 && actor == store.ActorExpert {
+		data["refundAmount"] = refundAmount
+		data["currency"] = first.Booking.Currency
+	}
+
+	if err := mailer.NewResend(recipient.Email, "booking_cancelled.tmpl", data); err != nil {
+		app.logger.Errorln(err)
+	}
+}
+
+// getCancellationPolicyHandler returns the policy that applies to an expert's bookings
+func (app *application) getCancellationPolicyHandler(w http.ResponseWriter, r *http.Request) {
+	expertID, err := app.readIDParam(r, "id")
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	policy, err := app.store.Cancellation.GetPolicy(r.Context(), expertID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if err = app.writeJSON(w, http.StatusOK, envelope{"cancellation_policy": policy}, nil); err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+type cancellationPolicyInput struct {
+	FullRefundHours      int `json:"full_refund_hours"`
+	PartialRefundPercent int `json:"partial_refund_percent"`
+}
+
+// updateExpertCancellationPolicyHandler sets the logged-in expert's own policy
+func (app *application) updateExpertCancellationPolicyHandler(w http.ResponseWriter, r *http.Request) {
+	var input cancellationPolicyInput
+	if err := app.readJSON(w, r, &input); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	expert := app.currentExpert(w, r)
+	if expert == nil {
+		return
+	}
+
+	policy := store.CancellationPolicy{
+		ExpertID:             expert.ID,
+		FullRefundHours:      input.FullRefundHours,
+		PartialRefundPercent: input.PartialRefundPercent,
+	}
+
+	v := validator.New()
+	if store.ValidateCancellationPolicy(v, &policy); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	if err := app.store.Cancellation.UpsertExpertPolicy(r.Context(), &policy); err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if err := app.writeJSON(w, http.StatusOK, envelope{"cancellation_policy": policy}, nil); err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// updateBranchCancellationPolicyHandler sets the policy for every expert of a
+// branch that has no policy of their own. Only the organisation owner can set it.
+func (app *application) updateBranchCancellationPolicyHandler(w http.ResponseWriter, r *http.Request) {
+	branchID, err := app.readIDParam(r, "id")
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	var input cancellationPolicyInput
+	if err := app.readJSON(w, r, &input); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	ctx := r.Context()
+	user := app.contextGetUser(r)
+
+	isOwner, err := app.store.Branch.IsOwner(ctx, user.ID, branchID)
+	if err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	if !isOwner {
+		app.notPermittedResponse(w, r)
+		return
+	}
+
+	policy := store.CancellationPolicy{
+		BranchID:             branchID,
+		FullRefundHours:      input.FullRefundHours,
+		PartialRefundPercent: input.PartialRefundPercent,
+	}
+
+	v := validator.New()
+	if store.ValidateCancellationPolicy(v, &policy); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	if err := app.store.Cancellation.UpsertBranchPolicy(ctx, &policy); err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if err := app.writeJSON(w, http.StatusOK, envelope{"cancellation_policy": policy}, nil); err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
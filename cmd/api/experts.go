@@ -4,9 +4,12 @@ import (
 	"errors"
 	"fmt"
 	"net/http"
+	"net/url"
 	"strings"
+	"time"
 
 	"consult_app.cedrickewi/internal/data"
+	"consult_app.cedrickewi/internal/slots"
 	"consult_app.cedrickewi/internal/store"
 	"consult_app.cedrickewi/internal/validator"
 )
@@ -17,6 +20,7 @@ func (app *application) createExpertHandler(w http.ResponseWriter, r *http.Reque
 		Bio       string  `json:"bio"`
 		FeesPerHr float64 `json:"fees_per_hr"`
 		Language  string  `json:"language"`
+		Timezone  string  `json:"timezone"`
 	}
 
 	user := app.contextGetUser(r)
@@ -32,12 +36,25 @@ func (app *application) createExpertHandler(w http.ResponseWriter, r *http.Reque
 		return
 	}
 
+	// Weekly availability is interpreted in this zone; default to the
+	// user's own zone when none is given.
+	if input.Timezone == "" {
+		input.Timezone = user.Timezone
+	}
+
+	v := validator.New()
+	if store.ValidateTimezone(v, input.Timezone); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
 	expert := store.Expert{
 		UserID:    user.ID,
 		Expertise: input.Expertise,
 		Bio:       input.Bio,
 		FeesPerHr: input.FeesPerHr,
 		Language:  input.Language,
+		Timezone:  input.Timezone,
 	}
 
 	ctx := r.Context()
@@ -163,8 +180,75 @@ func (app *application) showExpertsHandler(w http.ResponseWriter, r *http.Reques
 
 }
 
+// updateExpertsHander lets an expert change their profile. Changing the
+// timezone moves the weekly availability with it, as it is interpreted in
+// the expert's zone.
 func (app *application) updateExpertsHander(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r, "id")
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	var input struct {
+		Expertise *string  `json:"expertise"`
+		Bio       *string  `json:"bio"`
+		FeesPerHr *float64 `json:"fees_per_hr"`
+		Timezone  *string  `json:"timezone"`
+	}
+
+	if err := app.readJSON(w, r, &input); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	ctx := r.Context()
+	user := app.contextGetUser(r)
+
+	expert, err := app.store.Expert.GetExpertByID(ctx, id)
+	if err != nil {
+		switch {
+		case errors.Is(err, store.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	if expert.UserID != user.ID {
+		app.notPermittedResponse(w, r)
+		return
+	}
+
+	if input.Expertise != nil {
+		expert.Expertise = *input.Expertise
+	}
+	if input.Bio != nil {
+		expert.Bio = *input.Bio
+	}
+	if input.FeesPerHr != nil {
+		expert.FeesPerHr = *input.FeesPerHr
+	}
+	if input.Timezone != nil {
+		expert.Timezone = *input.Timezone
+	}
+
+	v := validator.New()
+	v.Check(expert.FeesPerHr >= 0, "fees_per_hr", "must not be negative")
+	if store.ValidateTimezone(v, expert.Timezone); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
 
+	if err := app.store.Expert.UpdateExpert(ctx, expert); err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if err = app.writeJSON(w, http.StatusOK, envelope{"expert": expert}, nil); err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
 }
 
 func (app *application) getExpertAvailabilityHandler(w http.ResponseWriter, r *http.Request) {
@@ -186,7 +270,7 @@ func (app *application) getExpertAvailabilityHandler(w http.ResponseWriter, r *h
 		return
 	}
 
-	if err = app.writeJSON(w, http.StatusOK, envelope{"availability": availability}, nil); err != nil {
+	if err = app.writeJSON(w, http.StatusOK, envelope{"availability": availability, "timezone": expert.Timezone}, nil); err != nil {
 		app.internalServerError(w, r, err)
 	}
 }
@@ -242,6 +326,11 @@ func (app *application) getAllConsultationsForExpertHandler(w http.ResponseWrite
 		return
 	}
 
+	loc := app.userLocation(r)
+	for i := range *consultations {
+		(*consultations)[i].InLocation(loc)
+	}
+
 	if err = app.writeJSON(w, http.StatusOK, envelope{"consultations": consultations}, nil); err != nil {
 		app.internalServerError(w, r, err)
 	}
@@ -307,8 +396,408 @@ func (app *application) createExpertAvailabilityHandler(w http.ResponseWriter, r
 		return
 	}
 
+	// New hours may fit clients waiting for this expert
+	now := time.Now()
+	app.offerFreedSlots(ctx, expert.ID, now, now.Add(store.WaitlistLookahead))
+
 	// Return the newly added availabilities
-	if err = app.writeJSON(w, http.StatusCreated, envelope{"availabilities": availabilities}, nil); err != nil {
+	if err = app.writeJSON(w, http.StatusCreated, envelope{"availabilities": availabilities, "timezone": expert.Timezone}, nil); err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// maxSlotSearchRange bounds a single slot query
+const maxSlotSearchRange = 31 * 24 * time.Hour
+
+// readTimeParam reads an RFC3339 timestamp or a plain date (2006-01-02),
+// interpreting dates as midnight in loc.
+func (app *application) readTimeParam(qs url.Values, key string, defaultValue time.Time, loc *time.Location, v *validator.Validator) time.Time {
+	s := qs.Get(key)
+	if s == "" {
+		return defaultValue
+	}
+
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t
+	}
+	if t, err := time.ParseInLocation("2006-01-02", s, loc); err == nil {
+		return t
+	}
+
+	v.AddError(key, "must be an RFC3339 timestamp or a YYYY-MM-DD date")
+	return defaultValue
+}
+
+// getExpertSlotsHandler returns the free, bookable slots of an expert
+// GET /v1/experts/{id}/slots?from=&to=&duration=
+func (app *application) getExpertSlotsHandler(w http.ResponseWriter, r *http.Request) {
+	expertID, err := app.readIDParam(r, "id")
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	ctx := r.Context()
+	loc := app.userLocation(r)
+	qs := r.URL.Query()
+	v := validator.New()
+
+	now := time.Now()
+	from := app.readTimeParam(qs, "from", now, loc, v)
+	to := app.readTimeParam(qs, "to", from.Add(7*24*time.Hour), loc, v)
+	duration := app.readInt(qs, "duration", slots.DefaultDuration, v)
+
+	v.Check(from.Before(to), "to", "must be after from")
+	v.Check(to.Sub(from) <= maxSlotSearchRange, "to", "must be within 31 days of from")
+
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	expert, err := app.store.Expert.GetExpertByID(ctx, expertID)
+	if err != nil {
+		switch {
+		case errors.Is(err, store.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	if expert.OnboardingStatus != store.OnboardingActive {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	rules, err := app.store.Expert.GetSchedulingRules(ctx, expert.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if !rules.AllowsDuration(int64(duration)) {
+		v.AddError("duration", fmt.Sprintf("must be one of %v minutes", rules.AllowedDurations))
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	// Clamp the search to the expert's notice period and booking horizon
+	if earliest := now.Add(rules.MinNotice()); from.Before(earliest) {
+		from = earliest
+	}
+	if latest := now.Add(rules.Horizon()); to.After(latest) {
+		to = latest
+	}
+
+	availability, err := app.store.Expert.GetExpertAvailability(ctx, expert.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	busy, err := app.store.Booking.GetExpertBusyRanges(ctx, expert.ID, from.Add(-24*time.Hour), to.Add(24*time.Hour))
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	exceptions, err := app.store.Expert.GetAvailabilityExceptions(ctx, expert.ID, from, to)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	params := slots.Params{
+		From:         from,
+		To:           to,
+		Now:          now,
+		Duration:     time.Duration(duration) * time.Minute,
+		BufferBefore: rules.BufferBefore(),
+		BufferAfter:  rules.BufferAfter(),
+		MaxPerDay:    rules.MaxSessionsPerDay,
+		Location:     store.LoadLocation(expert.Timezone),
+	}
+	for _, a := range *availability {
+		params.Weekly = append(params.Weekly, slots.Window{Day: a.Day, Start: a.StartTime, End: a.EndTime})
+	}
+	for _, b := range busy {
+		params.Busy = append(params.Busy, slots.Range{Start: b.Start, End: b.End})
+	}
+	for _, e := range exceptions {
+		params.Blocked = append(params.Blocked, slots.Range{Start: e.StartTime, End: e.EndTime})
+	}
+
+	// Slots held for other waitlisted clients are not free to the caller
+	offers, err := app.store.Waitlist.GetLiveOffers(ctx, expert.ID, from, to)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	for _, o := range offers {
+		if o.UserID != app.contextGetUser(r).ID {
+			params.Blocked = append(params.Blocked, slots.Range{Start: o.StartTime, End: o.EndTime})
+		}
+	}
+
+	free := []slots.Slot{}
+	if from.Before(to) {
+		free = slots.Generate(params)
+	}
+	for i := range free {
+		free[i].StartTime = free[i].StartTime.In(loc)
+		free[i].EndTime = free[i].EndTime.In(loc)
+	}
+
+	if err = app.writeJSON(w, http.StatusOK, envelope{
+		"slots":           free,
+		"duration":        duration,
+		"timezone":        loc.String(),
+		"expert_timezone": expert.Timezone,
+	}, nil); err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+type availabilityExceptionInput struct {
+	StartTime string `json:"start_time" validate:"required"`
+	EndTime   string `json:"end_time" validate:"required"`
+	Reason    string `json:"reason"`
+}
+
+// createAvailabilityExceptionHandler blocks a one-off period for the logged-in expert
+func (app *application) createAvailabilityExceptionHandler(w http.ResponseWriter, r *http.Request) {
+	var input availabilityExceptionInput
+
+	if err := app.readJSON(w, r, &input); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if err := Validate.Struct(input); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	startTime, err := time.Parse(time.RFC3339, input.StartTime)
+	if err != nil {
+		app.badRequestResponse(w, r, errors.New("invalid start time format, must be RFC3339"))
+		return
+	}
+	endTime, err := time.Parse(time.RFC3339, input.EndTime)
+	if err != nil {
+		app.badRequestResponse(w, r, errors.New("invalid end time format, must be RFC3339"))
+		return
+	}
+	if !startTime.Before(endTime) {
+		app.badRequestResponse(w, r, errors.New("end time must be after start time"))
+		return
+	}
+
+	user := app.contextGetUser(r)
+
+	expert, err := app.store.Expert.GetExpertByUserID(r.Context(), user.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			app.notPermittedResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	exception := store.AvailabilityException{
+		ExpertID:  expert.ID,
+		StartTime: startTime,
+		EndTime:   endTime,
+		Reason:    input.Reason,
+	}
+
+	if err := app.store.Expert.AddAvailabilityException(r.Context(), &exception); err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if err = app.writeJSON(w, http.StatusCreated, envelope{"exception": exception}, nil); err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// getAvailabilityExceptionsHandler lists an expert's exceptions in a range
+func (app *application) getAvailabilityExceptionsHandler(w http.ResponseWriter, r *http.Request) {
+	expertID, err := app.readIDParam(r, "id")
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	loc := app.userLocation(r)
+	qs := r.URL.Query()
+	v := validator.New()
+
+	from := app.readTimeParam(qs, "from", time.Now(), loc, v)
+	to := app.readTimeParam(qs, "to", from.Add(maxSlotSearchRange), loc, v)
+	v.Check(from.Before(to), "to", "must be after from")
+
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	exceptions, err := app.store.Expert.GetAvailabilityExceptions(r.Context(), expertID, from, to)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	for i := range exceptions {
+		exceptions[i].StartTime = exceptions[i].StartTime.In(loc)
+		exceptions[i].EndTime = exceptions[i].EndTime.In(loc)
+	}
+
+	if err = app.writeJSON(w, http.StatusOK, envelope{"exceptions": exceptions}, nil); err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// deleteAvailabilityExceptionHandler removes one of the logged-in expert's exceptions
+func (app *application) deleteAvailabilityExceptionHandler(w http.ResponseWriter, r *http.Request) {
+	exceptionID, err := app.readIDParam(r, "exceptionID")
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	user := app.contextGetUser(r)
+
+	expert, err := app.store.Expert.GetExpertByUserID(r.Context(), user.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			app.notPermittedResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	if err := app.store.Expert.DeleteAvailabilityException(r.Context(), expert.ID, exceptionID); err != nil {
+		switch {
+		case errors.Is(err, store.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	now := time.Now()
+	app.offerFreedSlots(r.Context(), expert.ID, now, now.Add(store.WaitlistLookahead))
+
+	if err = app.writeJSON(w, http.StatusOK, envelope{"message": "availability exception deleted"}, nil); err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// getSchedulingRulesHandler returns an expert's scheduling rules
+func (app *application) getSchedulingRulesHandler(w http.ResponseWriter, r *http.Request) {
+	expertID, err := app.readIDParam(r, "id")
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	rules, err := app.store.Expert.GetSchedulingRules(r.Context(), expertID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if err = app.writeJSON(w, http.StatusOK, envelope{"rules": rules}, nil); err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// updateSchedulingRulesHandler replaces the logged-in expert's scheduling rules
+func (app *application) updateSchedulingRulesHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		BufferBeforeMinutes int     `json:"buffer_before_minutes"`
+		BufferAfterMinutes  int     `json:"buffer_after_minutes"`
+		MinNoticeMinutes    int     `json:"min_notice_minutes"`
+		MaxHorizonDays      int     `json:"max_horizon_days"`
+		MaxSessionsPerDay   int     `json:"max_sessions_per_day"`
+		AllowedDurations    []int64 `json:"allowed_durations"`
+		MaxReschedules      *int    `json:"max_reschedules"`
+		HoldMinutes         *int    `json:"hold_minutes"`
+		RequiresApproval    *bool   `json:"requires_approval"`
+		ApprovalHours       *int    `json:"approval_hours"`
+	}
+
+	if err := app.readJSON(w, r, &input); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	user := app.contextGetUser(r)
+
+	expert, err := app.store.Expert.GetExpertByUserID(r.Context(), user.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			app.notPermittedResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	// the optional settings keep their stored values when left out
+	stored, err := app.store.Expert.GetSchedulingRules(r.Context(), expert.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	rules := store.SchedulingRules{
+		ExpertID:            expert.ID,
+		BufferBeforeMinutes: input.BufferBeforeMinutes,
+		BufferAfterMinutes:  input.BufferAfterMinutes,
+		MinNoticeMinutes:    input.MinNoticeMinutes,
+		MaxHorizonDays:      input.MaxHorizonDays,
+		MaxSessionsPerDay:   input.MaxSessionsPerDay,
+		AllowedDurations:    input.AllowedDurations,
+		MaxReschedules:      stored.MaxReschedules,
+		HoldMinutes:         stored.HoldMinutes,
+		RequiresApproval:    stored.RequiresApproval,
+		ApprovalHours:       stored.ApprovalHours,
+	}
+	if input.MaxReschedules != nil {
+		rules.MaxReschedules = *input.MaxReschedules
+	}
+	if input.HoldMinutes != nil {
+		rules.HoldMinutes = *input.HoldMinutes
+	}
+	if input.RequiresApproval != nil {
+		rules.RequiresApproval = *input.RequiresApproval
+	}
+	if input.ApprovalHours != nil {
+		rules.ApprovalHours = *input.ApprovalHours
+	}
+
+	v := validator.New()
+	if store.ValidateSchedulingRules(v, &rules); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	if err := app.store.Expert.UpsertSchedulingRules(r.Context(), &rules); err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if err = app.writeJSON(w, http.StatusOK, envelope{"rules": rules}, nil); err != nil {
 		app.serverErrorResponse(w, r, err)
 	}
 }
@@ -0,0 +1,339 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"consult_app.cedrickewi/internal/payment"
+	"consult_app.cedrickewi/internal/store"
+	"consult_app.cedrickewi/internal/validator"
+	"consult_app.cedrickewi/internal/zoom"
+)
+
+// groupSessionErrorResponse maps the errors of the group session store
+func (app *application) groupSessionErrorResponse(w http.ResponseWriter, r *http.Request, err error) {
+	switch {
+	case errors.Is(err, store.ErrRecordNotFound):
+		app.notFoundResponse(w, r)
+	case errors.Is(err, store.ErrGroupSessionFull), errors.Is(err, store.ErrGroupSessionClosed),
+		errors.Is(err, store.ErrGroupSessionConflict):
+		app.errorResponse(w, r, http.StatusConflict, err.Error())
+	default:
+		app.bookingTimeErrorResponse(w, r, err)
+	}
+}
+
+// createGroupSessionHandler lets the logged-in expert publish a group session.
+// It blocks the expert's calendar like a single booking.
+func (app *application) createGroupSessionHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Title       string    `json:"title"`
+		Description string    `json:"description"`
+		StartTime   time.Time `json:"start_time"`
+		EndTime     time.Time `json:"end_time"`
+		Capacity    int       `json:"capacity"`
+		SeatPrice   int       `json:"seat_price"`
+		Currency    string    `json:"currency"`
+	}
+
+	if err := app.readJSON(w, r, &input); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	expert := app.currentExpert(w, r)
+	if expert == nil {
+		return
+	}
+
+	session := store.GroupSession{
+		ExpertID:    expert.ID,
+		Title:       input.Title,
+		Description: input.Description,
+		StartTime:   input.StartTime,
+		EndTime:     input.EndTime,
+		Capacity:    input.Capacity,
+		SeatPrice:   input.SeatPrice,
+		Currency:    input.Currency,
+	}
+
+	v := validator.New()
+	if store.ValidateGroupSession(v, &session); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	if err := app.store.GroupSession.Create(r.Context(), &session); err != nil {
+		app.groupSessionErrorResponse(w, r, err)
+		return
+	}
+
+	if err := app.writeJSON(w, http.StatusCreated, envelope{"group_session": session}, nil); err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// getExpertGroupSessionsHandler lists an expert's upcoming group sessions
+func (app *application) getExpertGroupSessionsHandler(w http.ResponseWriter, r *http.Request) {
+	expertID, err := app.readIDParam(r, "id")
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	sessions, err := app.store.GroupSession.GetUpcomingForExpert(r.Context(), expertID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if err = app.writeJSON(w, http.StatusOK, envelope{"group_sessions": sessions}, nil); err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// getGroupSessionHandler returns a group session and how many seats are left
+func (app *application) getGroupSessionHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r, "id")
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	session, err := app.store.GroupSession.GetByID(r.Context(), id)
+	if err != nil {
+		app.groupSessionErrorResponse(w, r, err)
+		return
+	}
+
+	if err = app.writeJSON(w, http.StatusOK, envelope{"group_session": session, "seats_left": session.SeatsLeft()}, nil); err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// reserveSeatHandler reserves a seat for the caller. The seat is a booking
+// held until its payment hold runs out; it is paid like any other booking.
+func (app *application) reserveSeatHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r, "id")
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	var input struct {
+		Intake map[string]string `json:"intake"`
+	}
+
+	if err := app.readJSON(w, r, &input); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	ctx := r.Context()
+	user := app.contextGetUser(r)
+
+	session, err := app.store.GroupSession.GetByID(ctx, id)
+	if err != nil {
+		app.groupSessionErrorResponse(w, r, err)
+		return
+	}
+
+	intake, ok := app.intakeAnswers(w, r, session.ExpertID, input.Intake)
+	if !ok {
+		return
+	}
+
+	rules, err := app.store.Expert.GetSchedulingRules(ctx, session.ExpertID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	fee, ok := payment.PlatformFee(session.Currency)
+	if !ok {
+		app.errorResponse(w, r, http.StatusUnprocessableEntity, fmt.Sprintf("seats priced in %s cannot be paid for", session.Currency))
+		return
+	}
+
+	holdExpiresAt := time.Now().Add(rules.Hold()).UTC()
+	seat := store.Booking{
+		UserID:          user.ID,
+		ExpertID:        session.ExpertID,
+		StartTime:       session.StartTime.UTC().Format(time.RFC3339),
+		EndTime:         session.EndTime.UTC().Format(time.RFC3339),
+		Topic:           session.Title,
+		AdditionalNotes: session.Description,
+		Currency:        session.Currency,
+		TotalAmount:     session.SeatPrice + fee,
+		PlatformFee:     fee,
+		HoldExpiresAt:   &holdExpiresAt,
+		Intake:          intake,
+	}
+
+	if err := app.store.GroupSession.ReserveSeat(ctx, session.ID, &seat); err != nil {
+		app.groupSessionErrorResponse(w, r, err)
+		return
+	}
+
+	app.scheduleHoldExpiry(ctx, &seat)
+
+	seat.InLocation(app.userLocation(r))
+
+	if err = app.writeJSON(w, http.StatusCreated, envelope{"seat": seat}, nil); err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// ownGroupSession loads the group session in the URL when the logged-in
+// expert runs it. It writes the error response itself and returns nil otherwise.
+func (app *application) ownGroupSession(w http.ResponseWriter, r *http.Request) *store.GroupSession {
+	id, err := app.readIDParam(r, "id")
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return nil
+	}
+
+	expert := app.currentExpert(w, r)
+	if expert == nil {
+		return nil
+	}
+
+	session, err := app.store.GroupSession.GetByID(r.Context(), id)
+	if err != nil {
+		app.groupSessionErrorResponse(w, r, err)
+		return nil
+	}
+
+	if session.ExpertID != expert.ID {
+		app.notPermittedResponse(w, r)
+		return nil
+	}
+
+	return session
+}
+
+// getAttendeesHandler lists the seats of a group session for its expert
+func (app *application) getAttendeesHandler(w http.ResponseWriter, r *http.Request) {
+	session := app.ownGroupSession(w, r)
+	if session == nil {
+		return
+	}
+
+	attendees, err := app.store.GroupSession.GetAttendees(r.Context(), session.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if err = app.writeJSON(w, http.StatusOK, envelope{"group_session": session, "attendees": attendees}, nil); err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// cancelGroupSessionHandler withdraws a group session. Every active seat is
+// cancelled by the expert, so paid seats are refunded in full.
+func (app *application) cancelGroupSessionHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Reason string `json:"reason"`
+	}
+
+	if err := app.readJSON(w, r, &input); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+	if v.Check(len(input.Reason) <= 500, "reason", "must not be more than 500 bytes long"); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	session := app.ownGroupSession(w, r)
+	if session == nil {
+		return
+	}
+
+	ctx := r.Context()
+	user := app.contextGetUser(r)
+
+	if err := app.store.GroupSession.Cancel(ctx, session.ID); err != nil {
+		app.groupSessionErrorResponse(w, r, err)
+		return
+	}
+
+	attendees, err := app.store.GroupSession.GetAttendees(ctx, session.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	policy, err := app.store.Cancellation.GetPolicy(ctx, session.ExpertID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	var cancelled []cancellation
+	for _, a := range attendees {
+		if store.CheckTransition(store.BookingStatus(a.BKStatus), store.StatusCancelledByExpert, store.ActorExpert) != nil {
+			continue
+		}
+
+		seat, err := app.store.Booking.GetByID(ctx, a.BookingID)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+
+		refund, err := app.cancellationRefund(seat, store.ActorExpert, store.StatusCancelledByExpert, user.ID, policy)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+
+		event, err := app.store.Cancellation.Cancel(ctx, seat.ID, store.StatusCancelledByExpert, store.ActorExpert, user.ID, input.Reason, refund)
+		if err != nil {
+			switch {
+			case errors.Is(err, store.ErrInvalidTransition), errors.Is(err, store.ErrTransitionNotAllowed):
+				continue
+			default:
+				app.serverErrorResponse(w, r, err)
+			}
+			return
+		}
+
+		cancelled = append(cancelled, cancellation{BookingID: seat.ID, Event: event, Refund: refund, shared: true})
+	}
+
+	app.background(func() {
+		app.afterGroupSessionCancelled(session, cancelled, input.Reason)
+	})
+
+	if err = app.writeJSON(w, http.StatusOK, envelope{"cancellations": cancelled}, nil); err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// afterGroupSessionCancelled deletes the shared Zoom meeting and tells every
+// attendee whose seat was cancelled
+func (app *application) afterGroupSessionCancelled(session *store.GroupSession, cancelled []cancellation, reason string) {
+	ctx := context.Background()
+
+	if session.ZoomMeetingID.Valid {
+		meeting, err := app.store.ZoomMeeting.GetByID(ctx, session.ZoomMeetingID.Int64)
+		if err != nil {
+			app.logger.Errorln(err)
+		} else if err := zoom.DeleteZoomMeeting(meeting.MeetingID); err != nil {
+			app.logger.Errorw("failed to delete zoom meeting", "group_session_id", session.ID, "error", err)
+		}
+	}
+
+	app.offerFreedSlots(ctx, session.ExpertID, session.StartTime, session.EndTime)
+
+	for _, c := range cancelled {
+		app.afterCancellation([]cancellation{c}, store.ActorExpert, reason)
+	}
+}
@@ -10,7 +10,9 @@ import (
 	"net/url"
 	"strconv"
 	"strings"
+	"time"
 
+	"consult_app.cedrickewi/internal/store"
 	"consult_app.cedrickewi/internal/validator"
 	"github.com/go-chi/chi/v5"
 )
@@ -30,6 +32,12 @@ func (app *application) readIDParamStr(r *http.Request, key string) (string, err
 	return params, nil
 }
 
+// userLocation returns the timezone of the authenticated user, used to
+// render booking times in responses.
+func (app *application) userLocation(r *http.Request) *time.Location {
+	return store.LoadLocation(app.contextGetUser(r).Timezone)
+}
+
 type envelope map[string]interface{}
 
 func (app *application) writeJSON(w http.ResponseWriter, status int, data envelope, headers http.Header) error {
@@ -0,0 +1,307 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"path/filepath"
+	"strings"
+
+	"consult_app.cedrickewi/internal/aws"
+	"consult_app.cedrickewi/internal/store"
+	"consult_app.cedrickewi/internal/validator"
+	"github.com/google/uuid"
+)
+
+// maxIntakeFileSize caps the files clients attach to an intake form (10MB)
+const maxIntakeFileSize = 10 << 20
+
+type intakeFormInput struct {
+	Title  string              `json:"title"`
+	Fields []store.IntakeField `json:"fields"`
+}
+
+// saveExpertIntakeFormHandler creates or edits the logged-in expert's intake form
+func (app *application) saveExpertIntakeFormHandler(w http.ResponseWriter, r *http.Request) {
+	expert := app.currentExpert(w, r)
+	if expert == nil {
+		return
+	}
+
+	app.saveIntakeForm(w, r, sql.NullInt64{Int64: expert.ID, Valid: true}, sql.NullInt64{})
+}
+
+// saveOrganisationIntakeFormHandler creates or edits the intake form used by
+// every expert of an organisation who has no form of their own
+func (app *application) saveOrganisationIntakeFormHandler(w http.ResponseWriter, r *http.Request) {
+	orgID := app.ownOrganisation(w, r)
+	if orgID == 0 {
+		return
+	}
+
+	app.saveIntakeForm(w, r, sql.NullInt64{}, sql.NullInt64{Int64: orgID, Valid: true})
+}
+
+// saveIntakeForm stores a new version of the form of an expert or organisation
+func (app *application) saveIntakeForm(w http.ResponseWriter, r *http.Request, expertID, orgID sql.NullInt64) {
+	var input intakeFormInput
+
+	if err := app.readJSON(w, r, &input); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	form := store.IntakeForm{
+		ExpertID:       expertID,
+		OrganisationID: orgID,
+		Title:          input.Title,
+		Fields:         input.Fields,
+	}
+
+	v := validator.New()
+	if store.ValidateIntakeForm(v, &form); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	if err := app.store.IntakeForm.Save(r.Context(), &form); err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if err := app.writeJSON(w, http.StatusOK, envelope{"intake_form": form}, nil); err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// getMyIntakeFormHandler returns the logged-in expert's own form, active or not
+func (app *application) getMyIntakeFormHandler(w http.ResponseWriter, r *http.Request) {
+	expert := app.currentExpert(w, r)
+	if expert == nil {
+		return
+	}
+
+	app.getOwnIntakeForm(w, r, sql.NullInt64{Int64: expert.ID, Valid: true}, sql.NullInt64{})
+}
+
+// getOrganisationIntakeFormHandler returns an organisation's form to its owner
+func (app *application) getOrganisationIntakeFormHandler(w http.ResponseWriter, r *http.Request) {
+	orgID := app.ownOrganisation(w, r)
+	if orgID == 0 {
+		return
+	}
+
+	app.getOwnIntakeForm(w, r, sql.NullInt64{}, sql.NullInt64{Int64: orgID, Valid: true})
+}
+
+func (app *application) getOwnIntakeForm(w http.ResponseWriter, r *http.Request, expertID, orgID sql.NullInt64) {
+	form, err := app.store.IntakeForm.GetOwn(r.Context(), expertID, orgID)
+	if err != nil {
+		switch {
+		case errors.Is(err, store.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	if err = app.writeJSON(w, http.StatusOK, envelope{"intake_form": form}, nil); err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// deleteExpertIntakeFormHandler stops asking the logged-in expert's clients to
+// fill in their form
+func (app *application) deleteExpertIntakeFormHandler(w http.ResponseWriter, r *http.Request) {
+	expert := app.currentExpert(w, r)
+	if expert == nil {
+		return
+	}
+
+	app.deactivateIntakeForm(w, r, sql.NullInt64{Int64: expert.ID, Valid: true}, sql.NullInt64{})
+}
+
+// deleteOrganisationIntakeFormHandler stops using an organisation's form
+func (app *application) deleteOrganisationIntakeFormHandler(w http.ResponseWriter, r *http.Request) {
+	orgID := app.ownOrganisation(w, r)
+	if orgID == 0 {
+		return
+	}
+
+	app.deactivateIntakeForm(w, r, sql.NullInt64{}, sql.NullInt64{Int64: orgID, Valid: true})
+}
+
+// deactivateIntakeForm deactivates a form. Its versions are kept so the
+// answers already given still render.
+func (app *application) deactivateIntakeForm(w http.ResponseWriter, r *http.Request, expertID, orgID sql.NullInt64) {
+	ctx := r.Context()
+
+	form, err := app.store.IntakeForm.GetOwn(ctx, expertID, orgID)
+	if err == nil {
+		err = app.store.IntakeForm.Deactivate(ctx, form.ID)
+	}
+	if err != nil {
+		switch {
+		case errors.Is(err, store.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	if err = app.writeJSON(w, http.StatusOK, envelope{"message": "intake form deactivated"}, nil); err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// ownOrganisation reads the organisation in the URL and checks the caller
+// owns it. It writes the error response itself and returns 0 otherwise.
+func (app *application) ownOrganisation(w http.ResponseWriter, r *http.Request) int64 {
+	orgID, err := app.readIDParam(r, "id")
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return 0
+	}
+
+	isOwner, err := app.store.Organisation.IsOwner(r.Context(), app.contextGetUser(r).ID, orgID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return 0
+	}
+
+	if !isOwner {
+		app.notPermittedResponse(w, r)
+		return 0
+	}
+
+	return orgID
+}
+
+// getExpertIntakeFormHandler returns the form a client fills in when booking an expert
+func (app *application) getExpertIntakeFormHandler(w http.ResponseWriter, r *http.Request) {
+	expertID, err := app.readIDParam(r, "id")
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	form, err := app.store.IntakeForm.GetForExpert(r.Context(), expertID)
+	if err != nil {
+		switch {
+		case errors.Is(err, store.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	if err = app.writeJSON(w, http.StatusOK, envelope{"intake_form": form}, nil); err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// intakeAnswers checks the answers given to the expert's intake form when
+// booking. It returns nil answers when the expert has no form, and writes the
+// error response itself and reports false when the answers are invalid.
+func (app *application) intakeAnswers(w http.ResponseWriter, r *http.Request, expertID int64, answers map[string]string) (*store.IntakeAnswers, bool) {
+	form, err := app.store.IntakeForm.GetForExpert(r.Context(), expertID)
+	if err != nil {
+		switch {
+		case errors.Is(err, store.ErrRecordNotFound):
+			return nil, true
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return nil, false
+	}
+
+	v := validator.New()
+	if store.ValidateIntakeAnswers(v, form, answers, expertID, app.contextGetUser(r).ID); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return nil, false
+	}
+
+	if answers == nil {
+		answers = map[string]string{}
+	}
+
+	return &store.IntakeAnswers{FormVersionID: form.VersionID, Answers: answers}, true
+}
+
+// uploadIntakeFileHandler uploads a file for a file field of an expert's
+// intake form. The returned url is the answer to give for the field.
+// Expects a multipart form with the file under "file".
+func (app *application) uploadIntakeFileHandler(w http.ResponseWriter, r *http.Request) {
+	expertID, err := app.readIDParam(r, "id")
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxIntakeFileSize+1<<20)
+
+	file, header, err := r.FormFile("file")
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	defer file.Close()
+
+	if header.Size == 0 {
+		app.badRequestResponse(w, r, errors.New("cannot upload empty file"))
+		return
+	}
+
+	if header.Size > maxIntakeFileSize {
+		app.badRequestResponse(w, r, errors.New("file must not be larger than 10MB"))
+		return
+	}
+
+	filetype, err := detectMIME(file)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	var allowedMIMEs = map[string]struct{}{
+		"image/jpeg":      {},
+		"image/png":       {},
+		"application/pdf": {},
+	}
+
+	if _, ok := allowedMIMEs[filetype]; !ok {
+		app.badRequestResponse(w, r, errors.New("file must be a JPEG, PNG or PDF file"))
+		return
+	}
+
+	// Reset file pointer back to beginning
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	user := app.contextGetUser(r)
+	filename := filepath.Clean(filepath.Base(header.Filename))
+	filename = strings.ReplaceAll(filename, " ", "_")
+	key := fmt.Sprintf("%s%s-%s", store.IntakeFilePrefix(expertID, user.ID), uuid.NewString(), filename)
+
+	location, err := aws.UploadToS3(file, key, filetype)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err = app.writeJSON(w, http.StatusCreated, envelope{"file": map[string]any{
+		"url":          location,
+		"name":         filename,
+		"content_type": filetype,
+		"size":         header.Size,
+	}}, nil); err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
@@ -6,15 +6,19 @@ import (
 	"os"
 
 
+	"consult_app.cedrickewi/internal/caldav"
 	"consult_app.cedrickewi/internal/db"
 	"consult_app.cedrickewi/internal/env"
 	"consult_app.cedrickewi/internal/mailer"
 	"consult_app.cedrickewi/internal/mtgschelduler"
+	"consult_app.cedrickewi/internal/payment"
 	"consult_app.cedrickewi/internal/payunit"
 	"consult_app.cedrickewi/internal/store"
 	"go.uber.org/zap"
 
 	_ "github.com/lib/pq"
+	// embed the IANA database so timezone lookups work in minimal images
+	_ "time/tzdata"
 )
 
 func main() {
@@ -47,6 +51,20 @@ func main() {
 	logger := zap.Must(zap.NewProduction()).Sugar()
 	defer logger.Sync()
 
+	if key := os.Getenv("CALDAV_SECRET_KEY"); key != "" {
+		caldavKey, err := caldav.ParseKey(key)
+		if err != nil {
+			logger.Fatal(err)
+		}
+		cfg.caldavKey = caldavKey
+	}
+
+	// a misconfigured payment gateway stops the API before it takes bookings
+	payunitCfg, err := payunit.LoadConfig()
+	if err != nil {
+		logger.Fatal(err)
+	}
+
 	// creating new instance of our database by calling the new function in internals, db
 	db, err := db.New(
 		cfg.db.addr,
@@ -63,7 +81,7 @@ func main() {
 	logger.Info("database connection pool established")
 
 	store := store.NewStorage(db)
-	payunit := payunit.NewPayunit(db)
+	payments := payment.NewService(payunit.NewPayunit(payunitCfg), store)
 
 	// Initialize meeting scheduler with Redis address
 	redisAddr := os.Getenv("REDIS_ADDR")
@@ -74,7 +92,7 @@ func main() {
 		store:         store,
 		logger:        logger,
 		mailer:        mailer.New(cfg.smtp.host, cfg.smtp.port, cfg.smtp.username, cfg.smtp.password, cfg.smtp.sender),
-		payunit:       payunit,
+		payments:      payments,
 		mtgschelduler: meetingScheduler,
 	}
 
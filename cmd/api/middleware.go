@@ -6,6 +6,7 @@ import (
 	"net/http"
 	"strings"
 
+	"consult_app.cedrickewi/internal/payment"
 	"consult_app.cedrickewi/internal/store"
 	"consult_app.cedrickewi/internal/validator"
 	"golang.org/x/time/rate"
@@ -170,6 +171,15 @@ func (app *application) userOwnsBooking(next http.Handler) http.Handler {
 	})
 }
 
+// keepPeerAddr records the address of the TCP peer before RealIP rewrites
+// RemoteAddr, so that checks by source address cannot be spoofed with
+// forwarded headers
+func (app *application) keepPeerAddr(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		next.ServeHTTP(w, payment.WithPeer(r))
+	})
+}
+
 func (app *application) secureHeaders(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Cross-Origin-Opener-Policy", "same-origin")
@@ -0,0 +1,359 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"net/http"
+	"slices"
+	"time"
+
+	"consult_app.cedrickewi/internal/mailer"
+	"consult_app.cedrickewi/internal/store"
+	"consult_app.cedrickewi/internal/validator"
+)
+
+// summaryStatuses are the statuses of a held session an expert can summarise
+var summaryStatuses = []store.BookingStatus{store.StatusConfirmed, store.StatusInProgress, store.StatusCompleted}
+
+type noteInput struct {
+	Body string `json:"body"`
+}
+
+// expertBooking loads the booking in the URL and checks the caller is its
+// expert. It writes the error response itself and returns nil otherwise.
+func (app *application) expertBooking(w http.ResponseWriter, r *http.Request) *store.Booking {
+	booking, actor := app.participantBooking(w, r)
+	if booking == nil {
+		return nil
+	}
+
+	if actor != store.ActorExpert {
+		app.notPermittedResponse(w, r)
+		return nil
+	}
+
+	return booking
+}
+
+// createSessionNoteHandler adds a private note about the client of a booking,
+// attached to that session
+func (app *application) createSessionNoteHandler(w http.ResponseWriter, r *http.Request) {
+	booking := app.expertBooking(w, r)
+	if booking == nil {
+		return
+	}
+
+	app.createNote(w, r, &store.Note{
+		ExpertID:  booking.ExpertID,
+		UserID:    booking.UserID,
+		BookingID: sql.NullInt64{Int64: booking.ID, Valid: true},
+	})
+}
+
+// createClientNoteHandler adds a private note about one of the logged-in
+// expert's clients
+func (app *application) createClientNoteHandler(w http.ResponseWriter, r *http.Request) {
+	expert, userID := app.expertClient(w, r)
+	if expert == nil {
+		return
+	}
+
+	app.createNote(w, r, &store.Note{ExpertID: expert.ID, UserID: userID})
+}
+
+func (app *application) createNote(w http.ResponseWriter, r *http.Request, note *store.Note) {
+	var input noteInput
+
+	if err := app.readJSON(w, r, &input); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	note.Body = input.Body
+
+	v := validator.New()
+	if store.ValidateNote(v, note); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	if err := app.store.Note.Insert(r.Context(), note); err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if err := app.writeJSON(w, http.StatusCreated, envelope{"note": note}, nil); err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// expertClient reads the client in the URL and checks they have booked the
+// logged-in expert. It writes the error response itself and returns a nil
+// expert otherwise.
+func (app *application) expertClient(w http.ResponseWriter, r *http.Request) (*store.Expert, int64) {
+	userID, err := app.readIDParam(r, "userID")
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return nil, 0
+	}
+
+	expert := app.currentExpert(w, r)
+	if expert == nil {
+		return nil, 0
+	}
+
+	isClient, err := app.store.Note.IsClient(r.Context(), expert.ID, userID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return nil, 0
+	}
+
+	if !isClient {
+		app.notFoundResponse(w, r)
+		return nil, 0
+	}
+
+	return expert, userID
+}
+
+// ownNote loads one of the logged-in expert's notes. It writes the error
+// response itself and returns nil otherwise.
+func (app *application) ownNote(w http.ResponseWriter, r *http.Request) *store.Note {
+	noteID, err := app.readIDParam(r, "noteID")
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return nil
+	}
+
+	expert := app.currentExpert(w, r)
+	if expert == nil {
+		return nil
+	}
+
+	note, err := app.store.Note.GetByID(r.Context(), expert.ID, noteID)
+	if err != nil {
+		switch {
+		case errors.Is(err, store.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return nil
+	}
+
+	return note
+}
+
+// updateNoteHandler edits one of the logged-in expert's notes
+func (app *application) updateNoteHandler(w http.ResponseWriter, r *http.Request) {
+	note := app.ownNote(w, r)
+	if note == nil {
+		return
+	}
+
+	var input noteInput
+
+	if err := app.readJSON(w, r, &input); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	note.Body = input.Body
+
+	v := validator.New()
+	if store.ValidateNote(v, note); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	if err := app.store.Note.Update(r.Context(), note); err != nil {
+		switch {
+		case errors.Is(err, store.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	if err := app.writeJSON(w, http.StatusOK, envelope{"note": note}, nil); err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// deleteNoteHandler removes one of the logged-in expert's notes
+func (app *application) deleteNoteHandler(w http.ResponseWriter, r *http.Request) {
+	note := app.ownNote(w, r)
+	if note == nil {
+		return
+	}
+
+	if err := app.store.Note.Delete(r.Context(), note.ExpertID, note.ID); err != nil {
+		switch {
+		case errors.Is(err, store.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	if err := app.writeJSON(w, http.StatusOK, envelope{"message": "note deleted"}, nil); err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// getClientTimelineHandler returns the past bookings of one of the logged-in
+// expert's clients together with the expert's notes and summaries, newest first
+func (app *application) getClientTimelineHandler(w http.ResponseWriter, r *http.Request) {
+	expert, userID := app.expertClient(w, r)
+	if expert == nil {
+		return
+	}
+
+	timeline, err := app.store.Note.Timeline(r.Context(), expert.ID, userID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	loc := app.userLocation(r)
+	for i := range timeline {
+		if timeline[i].Booking != nil {
+			timeline[i].Booking.InLocation(loc)
+		}
+		timeline[i].At = timeline[i].At.In(loc)
+	}
+
+	if err = app.writeJSON(w, http.StatusOK, envelope{"timeline": timeline}, nil); err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+type summaryInput struct {
+	Summary      string   `json:"summary"`
+	ActionItems  []string `json:"action_items"`
+	AttachmentID *int64   `json:"attachment_id"`
+}
+
+// saveSummaryHandler shares a summary of a held session with the client, who
+// is emailed about it. Saving again replaces the summary.
+func (app *application) saveSummaryHandler(w http.ResponseWriter, r *http.Request) {
+	booking := app.expertBooking(w, r)
+	if booking == nil {
+		return
+	}
+
+	_, end, err := booking.Times()
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if !slices.Contains(summaryStatuses, store.BookingStatus(booking.BKStatus)) || time.Now().Before(end) {
+		app.errorResponse(w, r, http.StatusConflict, "a summary can only be shared once the session has taken place")
+		return
+	}
+
+	var input summaryInput
+
+	if err := app.readJSON(w, r, &input); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	summary := store.Summary{
+		BookingID:   booking.ID,
+		ExpertID:    booking.ExpertID,
+		Summary:     input.Summary,
+		ActionItems: input.ActionItems,
+	}
+
+	v := validator.New()
+	if store.ValidateSummary(v, &summary); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	ctx := r.Context()
+
+	if input.AttachmentID != nil {
+		if _, err := app.store.Attachment.GetByID(ctx, booking.ID, *input.AttachmentID); err != nil {
+			switch {
+			case errors.Is(err, store.ErrRecordNotFound):
+				v.AddError("attachment_id", "must be a file shared on this booking")
+				app.failedValidationResponse(w, r, v.Errors)
+			default:
+				app.serverErrorResponse(w, r, err)
+			}
+			return
+		}
+		summary.AttachmentID = sql.NullInt64{Int64: *input.AttachmentID, Valid: true}
+	}
+
+	created, err := app.store.Note.SaveSummary(ctx, &summary)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	app.background(func() {
+		app.notifySummary(&summary, !created)
+	})
+
+	status := http.StatusOK
+	if created {
+		status = http.StatusCreated
+	}
+
+	if err = app.writeJSON(w, status, envelope{"summary": summary}, nil); err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// getSummaryHandler returns the summary shared after a session to either participant
+func (app *application) getSummaryHandler(w http.ResponseWriter, r *http.Request) {
+	booking, _ := app.participantBooking(w, r)
+	if booking == nil {
+		return
+	}
+
+	summary, err := app.store.Note.GetSummary(r.Context(), booking.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, store.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	if err = app.writeJSON(w, http.StatusOK, envelope{"summary": summary}, nil); err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// notifySummary emails the client the summary of their session
+func (app *application) notifySummary(summary *store.Summary, updated bool) {
+	details, err := app.store.Booking.GetBookingDetails(context.Background(), summary.BookingID)
+	if err != nil {
+		app.logger.Errorln(err)
+		return
+	}
+
+	data := map[string]any{
+		"name":          details.UserDetails.Name,
+		"expertName":    details.Expert.Name,
+		"bookingID":     summary.BookingID,
+		"summary":       summary.Summary,
+		"actionItems":   summary.ActionItems,
+		"hasAttachment": summary.AttachmentID.Valid,
+		"updated":       updated,
+	}
+
+	if err := mailer.NewResend(details.UserDetails.Email, "session_summary.tmpl", data); err != nil {
+		app.logger.Errorln(err)
+	}
+}
@@ -0,0 +1,347 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"consult_app.cedrickewi/internal/aws"
+	"consult_app.cedrickewi/internal/mailer"
+	"consult_app.cedrickewi/internal/store"
+	"consult_app.cedrickewi/internal/validator"
+	"github.com/google/uuid"
+)
+
+// maxCertificationSize caps certification uploads (5MB)
+const maxCertificationSize = 5 << 20
+
+// currentExpert loads the expert profile of the logged-in user. It writes the
+// error response itself and returns nil when there is none.
+func (app *application) currentExpert(w http.ResponseWriter, r *http.Request) *store.Expert {
+	user := app.contextGetUser(r)
+
+	expert, err := app.store.Expert.GetExpertByUserID(r.Context(), user.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			app.notPermittedResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return nil
+	}
+
+	return expert
+}
+
+// getOnboardingHandler returns the onboarding checklist of the logged-in expert
+func (app *application) getOnboardingHandler(w http.ResponseWriter, r *http.Request) {
+	expert := app.currentExpert(w, r)
+	if expert == nil {
+		return
+	}
+
+	progress, err := app.store.Expert.GetOnboardingProgress(r.Context(), expert.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if err = app.writeJSON(w, http.StatusOK, envelope{"onboarding": progress}, nil); err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// submitOnboardingHandler sends a complete draft (or rejected) profile for review
+func (app *application) submitOnboardingHandler(w http.ResponseWriter, r *http.Request) {
+	expert := app.currentExpert(w, r)
+	if expert == nil {
+		return
+	}
+
+	ctx := r.Context()
+
+	progress, err := app.store.Expert.GetOnboardingProgress(ctx, expert.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if !progress.CanSubmit() {
+		v := validator.New()
+		for _, step := range progress.MissingSteps {
+			v.AddError(step, "must be completed before submitting")
+		}
+		if v.Valid() {
+			v.AddError("status", fmt.Sprintf("cannot submit while %s", progress.Status))
+		}
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.store.Expert.UpdateOnboardingStatus(ctx, expert.ID,
+		[]store.OnboardingStatus{store.OnboardingDraft, store.OnboardingRejected},
+		store.OnboardingSubmitted, "", 0)
+	if err != nil {
+		switch {
+		case errors.Is(err, store.ErrInvalidTransition):
+			app.editConflictResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	progress.Status = store.OnboardingSubmitted
+	progress.RejectionReason = ""
+
+	if err = app.writeJSON(w, http.StatusOK, envelope{"onboarding": progress}, nil); err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// updatePayoutDetailsHandler sets where the logged-in expert gets paid
+func (app *application) updatePayoutDetailsHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		PayoutMethod  string `json:"payout_method"`
+		Provider      string `json:"provider"`
+		AccountName   string `json:"account_name"`
+		AccountNumber string `json:"account_number"`
+	}
+
+	if err := app.readJSON(w, r, &input); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	expert := app.currentExpert(w, r)
+	if expert == nil {
+		return
+	}
+
+	payout := store.PayoutDetails{
+		ExpertID:      expert.ID,
+		PayoutMethod:  input.PayoutMethod,
+		Provider:      input.Provider,
+		AccountName:   input.AccountName,
+		AccountNumber: input.AccountNumber,
+	}
+
+	v := validator.New()
+	if store.ValidatePayoutDetails(v, &payout); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	if err := app.store.Expert.UpsertPayoutDetails(r.Context(), &payout); err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if err := app.writeJSON(w, http.StatusOK, envelope{"payout_details": payout}, nil); err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// createCertificationHandler uploads a certification document for the logged-in expert.
+// Expects a multipart form with cert_name, institution, cert_date (YYYY-MM-DD) and picture.
+func (app *application) createCertificationHandler(w http.ResponseWriter, r *http.Request) {
+	r.Body = http.MaxBytesReader(w, r.Body, maxCertificationSize+1<<20)
+
+	file, header, err := r.FormFile("picture")
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	defer file.Close()
+
+	if header.Size == 0 {
+		app.badRequestResponse(w, r, errors.New("cannot upload empty file"))
+		return
+	}
+
+	if header.Size > maxCertificationSize {
+		app.badRequestResponse(w, r, errors.New("file must not be larger than 5MB"))
+		return
+	}
+
+	expert := app.currentExpert(w, r)
+	if expert == nil {
+		return
+	}
+
+	cert := store.Certification{
+		ExpertID:    expert.ID,
+		Name:        r.FormValue("cert_name"),
+		Institution: r.FormValue("institution"),
+	}
+
+	v := validator.New()
+	if certDate := r.FormValue("cert_date"); certDate != "" {
+		cert.CertDate, err = time.Parse("2006-01-02", certDate)
+		v.Check(err == nil, "cert_date", "must be a date in the YYYY-MM-DD format")
+	}
+
+	if store.ValidateCertification(v, &cert); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	filetype, err := detectMIME(file)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	var allowedMIMEs = map[string]struct{}{
+		"image/jpeg":      {},
+		"image/png":       {},
+		"application/pdf": {},
+	}
+
+	if _, ok := allowedMIMEs[filetype]; !ok {
+		app.badRequestResponse(w, r, errors.New("certification must be a JPEG, PNG or PDF file"))
+		return
+	}
+
+	// Reset file pointer back to beginning
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	filename := filepath.Clean(filepath.Base(header.Filename))
+	filename = strings.ReplaceAll(filename, " ", "_")
+	key := fmt.Sprintf("certifications/%d/%s-%s", expert.ID, uuid.NewString(), filename)
+
+	location, err := aws.UploadToS3(file, key, filetype)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+	cert.Picture = location
+
+	if err = app.store.Expert.AddCertification(r.Context(), &cert); err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if err = app.writeJSON(w, http.StatusCreated, envelope{"certification": cert}, nil); err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// getCertificationsHandler lists an expert's certifications
+func (app *application) getCertificationsHandler(w http.ResponseWriter, r *http.Request) {
+	expertID, err := app.readIDParam(r, "id")
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	certs, err := app.store.Expert.GetCertifications(r.Context(), expertID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if err = app.writeJSON(w, http.StatusOK, envelope{"certifications": certs}, nil); err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// reviewExpertHandler lets a reviewer move an expert application forward:
+// start_review (submitted -> under_review), approve (under_review -> active)
+// or reject (under_review -> rejected, reason required).
+func (app *application) reviewExpertHandler(w http.ResponseWriter, r *http.Request) {
+	expertID, err := app.readIDParam(r, "id")
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	var input struct {
+		Action string `json:"action"`
+		Reason string `json:"reason"`
+	}
+
+	if err := app.readJSON(w, r, &input); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+	v.Check(validator.In(input.Action, "start_review", "approve", "reject"), "action", "must be start_review, approve or reject")
+	if input.Action == "reject" {
+		v.Check(strings.TrimSpace(input.Reason) != "", "reason", "must be provided when rejecting")
+	}
+	v.Check(len(input.Reason) <= 1000, "reason", "must not be more than 1000 bytes long")
+
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	ctx := r.Context()
+	reviewer := app.contextGetUser(r)
+
+	expert, err := app.store.Expert.GetExpertByID(ctx, expertID)
+	if err != nil {
+		switch {
+		case errors.Is(err, store.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	from := []store.OnboardingStatus{store.OnboardingUnderReview}
+	var to store.OnboardingStatus
+	switch input.Action {
+	case "start_review":
+		from = []store.OnboardingStatus{store.OnboardingSubmitted}
+		to = store.OnboardingUnderReview
+		input.Reason = ""
+	case "approve":
+		to = store.OnboardingActive
+		input.Reason = ""
+	case "reject":
+		to = store.OnboardingRejected
+	}
+
+	err = app.store.Expert.UpdateOnboardingStatus(ctx, expert.ID, from, to, input.Reason, reviewer.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, store.ErrInvalidTransition):
+			app.errorResponse(w, r, http.StatusConflict,
+				fmt.Sprintf("cannot %s an expert whose onboarding is %s", strings.ReplaceAll(input.Action, "_", " "), expert.OnboardingStatus))
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	if to == store.OnboardingActive || to == store.OnboardingRejected {
+		app.background(func() {
+			data := map[string]any{
+				"name":     expert.Name,
+				"approved": to == store.OnboardingActive,
+				"reason":   input.Reason,
+			}
+			if err := mailer.NewResend(expert.Email, "expert_review.tmpl", data); err != nil {
+				app.logger.Errorln(err)
+			}
+		})
+	}
+
+	expert.OnboardingStatus = to
+
+	if err = app.writeJSON(w, http.StatusOK, envelope{"expert": expert}, nil); err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
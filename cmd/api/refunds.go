@@ -0,0 +1,166 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+
+	"consult_app.cedrickewi/internal/payment"
+	"consult_app.cedrickewi/internal/store"
+	"consult_app.cedrickewi/internal/validator"
+)
+
+// refundBookingHandler lets an admin refund a paid booking, in full when no
+// amount is given. The refund is issued through the gateway by the worker.
+func (app *application) refundBookingHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r, "id")
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	var input struct {
+		Amount *int   `json:"amount"`
+		Reason string `json:"reason"`
+	}
+
+	if err := app.readJSON(w, r, &input); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+	v.Check(input.Reason != "", "reason", "must be provided")
+	v.Check(len(input.Reason) <= 500, "reason", "must not be more than 500 bytes long")
+	if input.Amount != nil {
+		v.Check(*input.Amount > 0, "amount", "must be greater than zero")
+	}
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	ctx := r.Context()
+
+	booking, err := app.store.Booking.GetByID(ctx, id)
+	if err != nil {
+		switch {
+		case errors.Is(err, store.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	refund := &store.Refund{
+		BookingID:   booking.ID,
+		Currency:    booking.Currency,
+		Reason:      input.Reason,
+		RequestedBy: app.contextGetUser(r).ID,
+	}
+
+	if input.Amount != nil {
+		refund.Amount = *input.Amount
+	} else {
+		refund.Amount, err = app.store.Refund.Refundable(ctx, booking.ID)
+		if err == nil && refund.Amount <= 0 {
+			err = store.ErrRefundTooLarge
+		}
+	}
+	if err == nil {
+		err = app.store.Refund.Create(ctx, refund)
+	}
+	if err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotRefundable), errors.Is(err, store.ErrRefundTooLarge):
+			app.errorResponse(w, r, http.StatusConflict, err.Error())
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	app.logger.Infow("refund requested", "refund_id", refund.ID, "booking_id", booking.ID, "amount", refund.Amount, "requested_by", refund.RequestedBy)
+
+	if err = app.writeJSON(w, http.StatusCreated, envelope{"refund": refund}, nil); err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// getBookingRefundsHandler lists the refunds of a booking to its client and expert
+func (app *application) getBookingRefundsHandler(w http.ResponseWriter, r *http.Request) {
+	booking, _ := app.participantBooking(w, r)
+	if booking == nil {
+		return
+	}
+
+	refunds, err := app.store.Refund.GetAllForBooking(r.Context(), booking.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if err = app.writeJSON(w, http.StatusOK, envelope{"booking_id": booking.ID, "payment_status": booking.PaymentStatus, "refunds": refunds}, nil); err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// getManualRefundsHandler lists to staff the refunds the gateway could not
+// issue, waiting to be paid out by hand
+func (app *application) getManualRefundsHandler(w http.ResponseWriter, r *http.Request) {
+	refunds, err := app.store.Refund.GetManual(r.Context())
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if err = app.writeJSON(w, http.StatusOK, envelope{"refunds": refunds}, nil); err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// payOutRefundHandler lets staff record that they paid out a manual refund,
+// under the reference of their payout, which settles it
+func (app *application) payOutRefundHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r, "id")
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	var input struct {
+		Reference string `json:"reference"`
+	}
+
+	if err := app.readJSON(w, r, &input); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+	v.Check(input.Reference != "", "reference", "must be provided")
+	v.Check(len(input.Reference) <= 150, "reference", "must not be more than 150 bytes long")
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	refund, err := app.payments.PayOutRefund(r.Context(), id, input.Reference)
+	if err != nil {
+		switch {
+		case errors.Is(err, store.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		case errors.Is(err, payment.ErrNotManualRefund):
+			app.errorResponse(w, r, http.StatusConflict, err.Error())
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	app.logger.Infow("refund paid out by hand", "refund_id", refund.ID, "booking_id", refund.BookingID, "amount", refund.Amount, "reference", refund.ProviderReference, "paid_by", app.contextGetUser(r).ID)
+
+	if err = app.writeJSON(w, http.StatusOK, envelope{"refund": refund}, nil); err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
@@ -0,0 +1,326 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"consult_app.cedrickewi/internal/mailer"
+	"consult_app.cedrickewi/internal/store"
+	"consult_app.cedrickewi/internal/validator"
+	"consult_app.cedrickewi/internal/zoom"
+)
+
+// participantBooking loads the booking in the "id" URL parameter and the
+// caller's role in it. It writes the error response itself and returns nil
+// when the booking is missing or the caller takes no part in it.
+func (app *application) participantBooking(w http.ResponseWriter, r *http.Request) (*store.Booking, store.Actor) {
+	id, err := app.readIDParam(r, "id")
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return nil, ""
+	}
+
+	ctx := r.Context()
+
+	booking, err := app.store.Booking.GetByID(ctx, id)
+	if err != nil {
+		switch {
+		case errors.Is(err, store.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return nil, ""
+	}
+
+	actor, ok, err := app.bookingActor(ctx, app.contextGetUser(r), booking)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return nil, ""
+	}
+	if !ok {
+		app.notPermittedResponse(w, r)
+		return nil, ""
+	}
+
+	return booking, actor
+}
+
+// rescheduleErrorResponse maps the errors of the reschedule store
+func (app *application) rescheduleErrorResponse(w http.ResponseWriter, r *http.Request, err error) {
+	switch {
+	case errors.Is(err, store.ErrRecordNotFound):
+		app.notFoundResponse(w, r)
+	case errors.Is(err, store.ErrInvalidTransition):
+		app.errorResponse(w, r, http.StatusConflict, "this booking can no longer be rescheduled")
+	case errors.Is(err, store.ErrRescheduleLimit), errors.Is(err, store.ErrRescheduleOpen), errors.Is(err, store.ErrNotInSeries):
+		app.errorResponse(w, r, http.StatusConflict, err.Error())
+	default:
+		app.bookingTimeErrorResponse(w, r, err)
+	}
+}
+
+// proposeRescheduleHandler lets either party propose a new time for a booking.
+// The session length cannot change so the payment stays valid; end_time may
+// be omitted. For a booking of a series, the "following" scope moves it and
+// every later occurrence by the same offset.
+func (app *application) proposeRescheduleHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		StartTime time.Time `json:"start_time"`
+		EndTime   time.Time `json:"end_time"`
+		Reason    string    `json:"reason"`
+		Scope     string    `json:"scope"`
+	}
+
+	if err := app.readJSON(w, r, &input); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	booking, actor := app.participantBooking(w, r)
+	if booking == nil {
+		return
+	}
+
+	if booking.GroupSessionID.Valid {
+		app.errorResponse(w, r, http.StatusConflict, "a group session seat follows its session and cannot be rescheduled")
+		return
+	}
+
+	ctx := r.Context()
+	user := app.contextGetUser(r)
+
+	start, end, err := booking.Times()
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	duration := end.Sub(start)
+
+	if input.EndTime.IsZero() && !input.StartTime.IsZero() {
+		input.EndTime = input.StartTime.Add(duration)
+	}
+
+	v := validator.New()
+	v.Check(!input.StartTime.IsZero(), "start_time", "must be provided")
+	v.Check(input.EndTime.Sub(input.StartTime) == duration, "end_time", "must keep the booked session length")
+	v.Check(!input.StartTime.Equal(start), "start_time", "must differ from the current start time")
+	v.Check(input.StartTime.After(time.Now()), "start_time", "must be in the future")
+	v.Check(len(input.Reason) <= 500, "reason", "must not be more than 500 bytes long")
+	v.Check(validator.In(input.Scope, "", store.ScopeThis, store.ScopeFollowing), "scope", "must be this or following")
+	v.Check(input.Scope != store.ScopeFollowing || booking.SeriesID.Valid, "scope", "booking is not part of a series")
+
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	rules, err := app.store.Expert.GetSchedulingRules(ctx, booking.ExpertID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	req := store.RescheduleRequest{
+		BookingID:  booking.ID,
+		ProposedBy: user.ID,
+		Proposer:   actor,
+		StartTime:  input.StartTime,
+		EndTime:    input.EndTime,
+		Reason:     input.Reason,
+		Scope:      input.Scope,
+	}
+
+	if err := app.store.Reschedule.Propose(ctx, &req, rules.MaxReschedules); err != nil {
+		app.rescheduleErrorResponse(w, r, err)
+		return
+	}
+
+	app.background(func() {
+		app.notifyReschedule(&req, actor, user.Name)
+	})
+
+	if err = app.writeJSON(w, http.StatusCreated, envelope{"reschedule": req}, nil); err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// getReschedulesHandler lists the reschedule proposals of a booking
+func (app *application) getReschedulesHandler(w http.ResponseWriter, r *http.Request) {
+	booking, _ := app.participantBooking(w, r)
+	if booking == nil {
+		return
+	}
+
+	requests, err := app.store.Reschedule.GetAllForBooking(r.Context(), booking.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if err = app.writeJSON(w, http.StatusOK, envelope{"reschedules": requests}, nil); err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// openReschedule loads the reschedule request in the URL for a booking
+func (app *application) openReschedule(w http.ResponseWriter, r *http.Request, booking *store.Booking) *store.RescheduleRequest {
+	requestID, err := app.readIDParam(r, "requestID")
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return nil
+	}
+
+	req, err := app.store.Reschedule.GetByID(r.Context(), booking.ID, requestID)
+	if err != nil {
+		app.rescheduleErrorResponse(w, r, err)
+		return nil
+	}
+
+	if req.Status != store.RescheduleProposed {
+		app.errorResponse(w, r, http.StatusConflict, "this proposal is already "+req.Status)
+		return nil
+	}
+
+	return req
+}
+
+// acceptRescheduleHandler lets the other party accept a proposed time. The
+// booking moves, its Zoom meeting follows and the payment stays attached.
+func (app *application) acceptRescheduleHandler(w http.ResponseWriter, r *http.Request) {
+	booking, actor := app.participantBooking(w, r)
+	if booking == nil {
+		return
+	}
+
+	req := app.openReschedule(w, r, booking)
+	if req == nil {
+		return
+	}
+
+	if req.Proposer == actor {
+		app.errorResponse(w, r, http.StatusForbidden, "the other party must accept your proposal")
+		return
+	}
+
+	ctx := r.Context()
+	user := app.contextGetUser(r)
+
+	rules, err := app.store.Expert.GetSchedulingRules(ctx, booking.ExpertID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if err := app.store.Reschedule.Accept(ctx, req, actor, user.ID, rules.MaxReschedules); err != nil {
+		app.rescheduleErrorResponse(w, r, err)
+		return
+	}
+
+	for _, m := range req.Moves {
+		if err := app.moveZoomMeeting(ctx, m); err != nil {
+			// The booking has moved; a stale Zoom time is fixed by the host
+			app.logger.Errorw("failed to move zoom meeting", "booking_id", m.BookingID, "error", err)
+		}
+	}
+
+	app.background(func() {
+		app.notifyReschedule(req, actor, user.Name)
+	})
+
+	if err = app.writeJSON(w, http.StatusOK, envelope{"reschedule": req}, nil); err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// declineRescheduleHandler closes an open proposal: the other party declines
+// it, the proposer withdraws it.
+func (app *application) declineRescheduleHandler(w http.ResponseWriter, r *http.Request) {
+	booking, actor := app.participantBooking(w, r)
+	if booking == nil {
+		return
+	}
+
+	req := app.openReschedule(w, r, booking)
+	if req == nil {
+		return
+	}
+
+	status := store.RescheduleDeclined
+	if req.Proposer == actor {
+		status = store.RescheduleWithdrawn
+	}
+
+	user := app.contextGetUser(r)
+
+	if err := app.store.Reschedule.Close(r.Context(), req, status, user.ID); err != nil {
+		app.rescheduleErrorResponse(w, r, err)
+		return
+	}
+
+	if status == store.RescheduleDeclined {
+		app.background(func() {
+			app.notifyReschedule(req, actor, user.Name)
+		})
+	}
+
+	if err := app.writeJSON(w, http.StatusOK, envelope{"reschedule": req}, nil); err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// moveZoomMeeting updates the start time of a moved booking's Zoom meeting
+func (app *application) moveZoomMeeting(ctx context.Context, m store.RescheduleMove) error {
+	booking, err := app.store.Booking.GetByID(ctx, m.BookingID)
+	if err != nil {
+		return err
+	}
+	if !booking.ZoomMeetingID.Valid {
+		return nil
+	}
+
+	meeting, err := app.store.ZoomMeeting.GetByID(ctx, booking.ZoomMeetingID.Int64)
+	if err != nil {
+		return err
+	}
+
+	meeting.StartTime = m.StartTime
+	meeting.Duration = int64(m.EndTime.Sub(m.StartTime).Minutes())
+
+	if err := zoom.UpdateZoomMeeting(meeting.MeetingID, *meeting); err != nil {
+		return err
+	}
+
+	return app.store.ZoomMeeting.Update(ctx, meeting)
+}
+
+// notifyReschedule emails the party that did not act on a reschedule request
+func (app *application) notifyReschedule(req *store.RescheduleRequest, actor store.Actor, actorName string) {
+	details, err := app.store.Booking.GetBookingDetails(context.Background(), req.BookingID)
+	if err != nil {
+		app.logger.Errorln(err)
+		return
+	}
+
+	recipient := details.Expert
+	if actor == store.ActorExpert {
+		recipient = details.UserDetails
+	}
+
+	data := map[string]any{
+		"name":      recipient.Name,
+		"actorName": actorName,
+		"bookingID": req.BookingID,
+		"status":    req.Status,
+		"startTime": req.StartTime.UTC().Format(time.RFC1123),
+		"endTime":   req.EndTime.UTC().Format(time.RFC1123),
+		"reason":    req.Reason,
+		"following": req.Scope == store.ScopeFollowing,
+	}
+
+	if err := mailer.NewResend(recipient.Email, "booking_reschedule.tmpl", data); err != nil {
+		app.logger.Errorln(err)
+	}
+}
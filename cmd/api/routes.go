@@ -19,6 +19,7 @@ func (app *application) routes() http.Handler {
 
 	// Global middlewares applied to all routes
 	r.Use(middleware.RequestID)
+	r.Use(app.keepPeerAddr)
 	r.Use(middleware.RealIP)
 	r.Use(middleware.Logger)
 	r.Use(middleware.Recoverer)
@@ -46,6 +47,7 @@ func (app *application) routes() http.Handler {
 		r.Post("/v1/webhook", app.zoomWebhookHandler)
 		r.Post("/api/v1/payunit/notify", app.payunitWebHookHandler)
 		r.Get("/v1/health", app.healthCheckHandler)
+		r.Get("/v1/calendar/{token}.ics", app.calendarFeedHandler)
 		r.Route("/v1/auth", func(r chi.Router) {
 			r.Post("/register", app.registerUserHandler)
 			r.Post("/activate", app.activateUserHandler)
@@ -75,12 +77,25 @@ func (app *application) routes() http.Handler {
 			r.Get("/", app.requireAuthenticatedUser(app.getAllOrganisations))
 			r.Get("/{id}", app.requireAuthenticatedUser(app.getAnOrganisationDetails))
 			r.Post("/", app.requiredPermission("organisations:write", app.createOrganisationHandler))
+			r.Get("/{id}/bookings", app.requiredPermission("organisations:write", app.getOrganisationBookingsHandler))
+			r.Get("/{id}/intake-form", app.requiredPermission("organisations:write", app.getOrganisationIntakeFormHandler))
+			r.Put("/{id}/intake-form", app.requiredPermission("organisations:write", app.saveOrganisationIntakeFormHandler))
+			r.Delete("/{id}/intake-form", app.requiredPermission("organisations:write", app.deleteOrganisationIntakeFormHandler))
 		})  
 
 		// Experts Routes
 		r.Route("/experts", func(r chi.Router) {
 			r.Get("/", app.requireAuthenticatedUser(app.getAllExpertsHandler))
 			r.Get("/{id}/availability", app.requireAuthenticatedUser(app.getExpertAvailabilityHandler))
+			r.Get("/{id}/availability/exceptions", app.requireAuthenticatedUser(app.getAvailabilityExceptionsHandler))
+			r.Get("/{id}/slots", app.requireAuthenticatedUser(app.getExpertSlotsHandler))
+			r.Get("/{id}/rules", app.requireAuthenticatedUser(app.getSchedulingRulesHandler))
+			r.Get("/{id}/services", app.requireAuthenticatedUser(app.getExpertServicesHandler))
+			r.Get("/{id}/cancellation-policy", app.requireAuthenticatedUser(app.getCancellationPolicyHandler))
+			r.Get("/{id}/group-sessions", app.requireAuthenticatedUser(app.getExpertGroupSessionsHandler))
+			r.Post("/{id}/waitlist", app.requiredPermission("bookings:write", app.joinWaitlistHandler))
+			r.Get("/{id}/intake-form", app.requireAuthenticatedUser(app.getExpertIntakeFormHandler))
+			r.Post("/{id}/intake-form/files", app.requiredPermission("bookings:write", app.uploadIntakeFileHandler))
 			r.Get("/me/{id}", app.requireAuthenticatedUser(app.getExpertByUserIDHandler))
 			r.Post("/", app.requiredPermission("experts:read", app.createExpertHandler))
 			r.Post("/add", app.requiredPermission("experts:write", app.expertToBranchHandler))
@@ -89,17 +104,63 @@ func (app *application) routes() http.Handler {
 			r.Put("/{id}", app.requiredPermission("experts:write", app.updateExpertsHander))
 			r.Delete("/{id}", app.requiredPermission("experts:write", app.removeExpertFromBranch))
 			r.Post("/availability/create", app.requiredPermission("experts:write", app.createExpertAvailabilityHandler))
+			r.Post("/availability/exceptions", app.requiredPermission("experts:write", app.createAvailabilityExceptionHandler))
+			r.Delete("/availability/exceptions/{exceptionID}", app.requiredPermission("experts:write", app.deleteAvailabilityExceptionHandler))
+			r.Put("/rules", app.requiredPermission("experts:write", app.updateSchedulingRulesHandler))
+			r.Post("/services", app.requiredPermission("experts:write", app.createExpertServiceHandler))
+			r.Put("/services/{serviceID}", app.requiredPermission("experts:write", app.updateExpertServiceHandler))
+			r.Put("/cancellation-policy", app.requiredPermission("experts:write", app.updateExpertCancellationPolicyHandler))
+			r.Get("/me/intake-form", app.requiredPermission("experts:write", app.getMyIntakeFormHandler))
+			r.Put("/intake-form", app.requiredPermission("experts:write", app.saveExpertIntakeFormHandler))
+			r.Delete("/intake-form", app.requiredPermission("experts:write", app.deleteExpertIntakeFormHandler))
+			r.Get("/clients/{userID}/timeline", app.requiredPermission("experts:write", app.getClientTimelineHandler))
+			r.Post("/clients/{userID}/notes", app.requiredPermission("experts:write", app.createClientNoteHandler))
+			r.Put("/notes/{noteID}", app.requiredPermission("experts:write", app.updateNoteHandler))
+			r.Delete("/notes/{noteID}", app.requiredPermission("experts:write", app.deleteNoteHandler))
+			r.Get("/me/calendar", app.requiredPermission("experts:write", app.getCalendarConnectionHandler))
+			r.Put("/me/calendar", app.requiredPermission("experts:write", app.connectCalendarHandler))
+			r.Delete("/me/calendar", app.requiredPermission("experts:write", app.disconnectCalendarHandler))
+
+			// Onboarding
+			r.Get("/{id}/certifications", app.requireAuthenticatedUser(app.getCertificationsHandler))
+			r.Get("/me/onboarding", app.requiredPermission("experts:write", app.getOnboardingHandler))
+			r.Post("/me/onboarding/submit", app.requiredPermission("experts:write", app.submitOnboardingHandler))
+			r.Put("/me/payout", app.requiredPermission("experts:write", app.updatePayoutDetailsHandler))
+			r.Post("/me/certifications", app.requiredPermission("experts:write", app.createCertificationHandler))
+			r.Post("/{id}/review", app.requiredPermission("experts:review", app.reviewExpertHandler))
 		})
 
 		// Bookings Routes
 		r.Route("/bookings", func(r chi.Router) {
 			r.Post("/{id}", app.requiredPermission("bookings:write", app.createBookingHandler))
-			r.Put("/{id}", app.requiredPermission("bookings:write", app.rescheduleBookingHandler))
+			r.Put("/{id}", app.requiredPermission("bookings:write", app.updateBookingMeetingHandler))
+			r.Post("/{id}/series", app.requiredPermission("bookings:write", app.createBookingSeriesHandler))
+			r.Get("/series/{id}", app.requiredPermission("bookings:read", app.getBookingSeriesHandler))
 
 			r.Get("/me", app.requiredPermission("bookings:read", app.getAllBookingsForUser))
 			r.Get("/me/{id}", app.requiredPermission("bookings:read", app.getABookingForUser))
+			r.Get("/expert", app.requiredPermission("experts:write", app.getAllBookingsForExpert))
 			r.Get("/expert/{id}", app.requiredPermission("bookings:read", app.getABookingForExpert))
-			r.Patch("/{id}/status", app.requiredPermission("bookings:read", app.approveBookingHandler))
+			r.Patch("/{id}/status", app.requiredPermission("bookings:write", app.updateBookingStatusHandler))
+			r.Post("/{id}/accept", app.requiredPermission("experts:write", app.acceptBookingHandler))
+			r.Post("/{id}/decline", app.requiredPermission("experts:write", app.declineBookingHandler))
+			r.Get("/{id}/history", app.requiredPermission("bookings:read", app.getBookingHistoryHandler))
+			r.Post("/{id}/cancel", app.requiredPermission("bookings:write", app.cancelBookingHandler))
+			r.Get("/{id}/refunds", app.requiredPermission("bookings:read", app.getBookingRefundsHandler))
+			r.Post("/{id}/refunds", app.requiredPermission("payments:refund", app.refundBookingHandler))
+			r.Get("/{id}/reschedule", app.requiredPermission("bookings:read", app.getReschedulesHandler))
+			r.Post("/{id}/reschedule", app.requiredPermission("bookings:write", app.proposeRescheduleHandler))
+			r.Post("/{id}/reschedule/{requestID}/accept", app.requiredPermission("bookings:write", app.acceptRescheduleHandler))
+			r.Post("/{id}/reschedule/{requestID}/decline", app.requiredPermission("bookings:write", app.declineRescheduleHandler))
+			r.Get("/{id}/attachments", app.requiredPermission("bookings:read", app.getAttachmentsHandler))
+			r.Post("/{id}/attachments", app.requiredPermission("bookings:write", app.uploadAttachmentHandler))
+			r.Get("/{id}/attachments/{attachmentID}", app.requiredPermission("bookings:read", app.downloadAttachmentHandler))
+			r.Delete("/{id}/attachments/{attachmentID}", app.requiredPermission("bookings:write", app.deleteAttachmentHandler))
+			r.Post("/{id}/notes", app.requiredPermission("experts:write", app.createSessionNoteHandler))
+			r.Get("/{id}/summary", app.requiredPermission("bookings:read", app.getSummaryHandler))
+			r.Put("/{id}/summary", app.requiredPermission("experts:write", app.saveSummaryHandler))
+			r.Get("/{id}/attendance", app.requiredPermission("bookings:read", app.getAttendanceHandler))
+			r.Get("/{id}/calendar.ics", app.requiredPermission("bookings:read", app.getBookingCalendarHandler))
 			r.Post("/api/signature", app.requiredPermission("bookings:read", app.getSignatureHandler))
 
 			// Payment Routes within Bookings
@@ -112,9 +173,37 @@ func (app *application) routes() http.Handler {
 			r.Post("/{id}/send_user", app.requiredPermission("bookings:write", app.sendBookingReminderToUserHandler))
 		})
 
+		// Group Sessions Routes
+		r.Route("/group-sessions", func(r chi.Router) {
+			r.Post("/", app.requiredPermission("experts:write", app.createGroupSessionHandler))
+			r.Get("/{id}", app.requireAuthenticatedUser(app.getGroupSessionHandler))
+			r.Post("/{id}/seats", app.requiredPermission("bookings:write", app.reserveSeatHandler))
+			r.Get("/{id}/attendees", app.requiredPermission("experts:write", app.getAttendeesHandler))
+			r.Post("/{id}/cancel", app.requiredPermission("experts:write", app.cancelGroupSessionHandler))
+		})
+
+		// Calendar Routes
+		r.Route("/calendar", func(r chi.Router) {
+			r.Post("/feed", app.requireAuthenticatedUser(app.createCalendarFeedHandler))
+			r.Delete("/feed", app.requireAuthenticatedUser(app.deleteCalendarFeedHandler))
+		})
+
+		// Waitlist Routes
+		r.Route("/waitlist", func(r chi.Router) {
+			r.Get("/me", app.requiredPermission("bookings:read", app.getMyWaitlistsHandler))
+			r.Delete("/{id}", app.requiredPermission("bookings:write", app.leaveWaitlistHandler))
+		})
+
+		// Refunds Routes
+		r.Route("/refunds", func(r chi.Router) {
+			r.Get("/manual", app.requiredPermission("payments:refund", app.getManualRefundsHandler))
+			r.Post("/{id}/payout", app.requiredPermission("payments:refund", app.payOutRefundHandler))
+		})
+
 		// Branches Routes
 		r.Route("/branches", func(r chi.Router) {
 			r.Post("/", app.requiredPermission("branches:write", app.createBranchHandler))
+			r.Put("/{id}/cancellation-policy", app.requiredPermission("branches:write", app.updateBranchCancellationPolicyHandler))
 		})
 	})
 
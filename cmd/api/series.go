@@ -0,0 +1,171 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"consult_app.cedrickewi/internal/store"
+	"consult_app.cedrickewi/internal/validator"
+)
+
+// createBookingSeriesHandler books the same session with an expert every week
+// or every two weeks. Every occurrence must fit the expert's availability and
+// rules; if one does not, nothing is booked.
+func (app *application) createBookingSeriesHandler(w http.ResponseWriter, r *http.Request) {
+	expertID, err := app.readIDParam(r, "id")
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	var input struct {
+		ZoomPayload
+		Frequency     string `json:"frequency"`
+		Occurrences   int    `json:"occurrences"`
+		SinglePayment bool   `json:"single_payment"`
+	}
+
+	if err := app.readJSON(w, r, &input); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if err := Validate.Struct(&input.ZoomPayload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	ctx := r.Context()
+	user := app.contextGetUser(r)
+
+	series := store.BookingSeries{
+		UserID:        user.ID,
+		ExpertID:      expertID,
+		Frequency:     input.Frequency,
+		Occurrences:   input.Occurrences,
+		SinglePayment: input.SinglePayment,
+	}
+
+	v := validator.New()
+	if store.ValidateBookingSeries(v, &series); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	first, expert := app.newBooking(w, r, expertID, &input.ZoomPayload)
+	if first == nil {
+		return
+	}
+
+	start, end, err := first.Times()
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	rules, err := app.store.Expert.GetSchedulingRules(ctx, expertID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	// Occurrences keep the same wall-clock time in the expert's zone across
+	// daylight saving changes
+	loc := store.LoadLocation(expert.Timezone)
+	firstHold := time.Now().Add(rules.Hold()).UTC()
+
+	bookings := make([]*store.Booking, series.Occurrences)
+	for i := range bookings {
+		bk := *first
+		occStart := start.In(loc).AddDate(0, 0, i*series.IntervalDays())
+		bk.StartTime = occStart.Format(time.RFC3339)
+		bk.EndTime = occStart.Add(end.Sub(start)).Format(time.RFC3339)
+
+		hold := series.OccurrenceHold(i+1, occStart, firstHold).UTC()
+		bk.HoldExpiresAt = &hold
+
+		// the whole series is one request, answered before the first occurrence
+		if rules.RequiresApproval {
+			requestBooking(&bk, rules, start)
+		}
+
+		bookings[i] = &bk
+	}
+
+	if err := app.store.Series.Create(ctx, &series, bookings); err != nil {
+		var occErr *store.OccurrenceError
+		switch {
+		case errors.As(err, &occErr):
+			app.errorResponse(w, r, http.StatusConflict, occErr.Error())
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	for _, bk := range bookings {
+		app.scheduleHoldExpiry(ctx, bk)
+		app.claimWaitlistOffer(ctx, bk)
+	}
+	app.scheduleRequestExpiry(ctx, bookings[0])
+
+	loc = app.userLocation(r)
+	for i := range series.Bookings {
+		series.Bookings[i].InLocation(loc)
+	}
+
+	if err = app.writeJSON(w, http.StatusCreated, envelope{"series": series}, nil); err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// getBookingSeriesHandler returns a series and its occurrences to its client
+// or expert, with what is left to pay when the series is paid at once
+func (app *application) getBookingSeriesHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r, "id")
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	ctx := r.Context()
+
+	series, err := app.store.Series.GetByID(ctx, id)
+	if err != nil {
+		switch {
+		case errors.Is(err, store.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	_, ok, err := app.bookingActor(ctx, app.contextGetUser(r), &store.Booking{UserID: series.UserID, ExpertID: series.ExpertID})
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	if !ok {
+		app.notPermittedResponse(w, r)
+		return
+	}
+
+	outstanding := 0
+	if series.SinglePayment {
+		if outstanding, err = app.store.Series.OutstandingAmount(ctx, series.ID); err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+	}
+
+	loc := app.userLocation(r)
+	for i := range series.Bookings {
+		series.Bookings[i].InLocation(loc)
+	}
+
+	if err = app.writeJSON(w, http.StatusOK, envelope{"series": series, "outstanding_amount": outstanding}, nil); err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
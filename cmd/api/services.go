@@ -0,0 +1,213 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+
+	"consult_app.cedrickewi/internal/store"
+	"consult_app.cedrickewi/internal/validator"
+)
+
+// getExpertServicesHandler lists an expert's catalogue. The expert sees
+// inactive services too, everyone else only the bookable ones.
+func (app *application) getExpertServicesHandler(w http.ResponseWriter, r *http.Request) {
+	expertID, err := app.readIDParam(r, "id")
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	user := app.contextGetUser(r)
+
+	expert, err := app.store.Expert.GetExpertByID(r.Context(), expertID)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	services, err := app.store.Service.GetAllForExpert(r.Context(), expert.ID, expert.UserID != user.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if err = app.writeJSON(w, http.StatusOK, envelope{"services": services}, nil); err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// createExpertServiceHandler adds a service to the logged-in expert's catalogue
+func (app *application) createExpertServiceHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Name            string `json:"name"`
+		Description     string `json:"description"`
+		DurationMinutes int    `json:"duration_minutes"`
+		Price           int    `json:"price"`
+		Currency        string `json:"currency"`
+	}
+
+	if err := app.readJSON(w, r, &input); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	user := app.contextGetUser(r)
+
+	expert, err := app.store.Expert.GetExpertByUserID(r.Context(), user.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			app.notPermittedResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	if input.Currency == "" {
+		input.Currency = "XAF"
+	}
+
+	service := store.ExpertService{
+		ExpertID:        expert.ID,
+		Name:            input.Name,
+		Description:     input.Description,
+		DurationMinutes: input.DurationMinutes,
+		Price:           input.Price,
+		Currency:        input.Currency,
+	}
+
+	v := validator.New()
+	if store.ValidateService(v, &service); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	if err := app.validateServiceDuration(r, expert.ID, service.DurationMinutes, v); err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	if err := app.store.Service.Insert(r.Context(), &service); err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if err = app.writeJSON(w, http.StatusCreated, envelope{"service": service}, nil); err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// updateExpertServiceHandler partially updates one of the logged-in expert's services
+func (app *application) updateExpertServiceHandler(w http.ResponseWriter, r *http.Request) {
+	serviceID, err := app.readIDParam(r, "serviceID")
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	var input struct {
+		Name            *string `json:"name"`
+		Description     *string `json:"description"`
+		DurationMinutes *int    `json:"duration_minutes"`
+		Price           *int    `json:"price"`
+		Currency        *string `json:"currency"`
+		IsActive        *bool   `json:"is_active"`
+	}
+
+	if err := app.readJSON(w, r, &input); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	user := app.contextGetUser(r)
+
+	expert, err := app.store.Expert.GetExpertByUserID(r.Context(), user.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			app.notPermittedResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	service, err := app.store.Service.GetByID(r.Context(), serviceID)
+	if err != nil {
+		switch {
+		case errors.Is(err, store.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	if service.ExpertID != expert.ID {
+		app.notPermittedResponse(w, r)
+		return
+	}
+
+	if input.Name != nil {
+		service.Name = *input.Name
+	}
+	if input.Description != nil {
+		service.Description = *input.Description
+	}
+	if input.DurationMinutes != nil {
+		service.DurationMinutes = *input.DurationMinutes
+	}
+	if input.Price != nil {
+		service.Price = *input.Price
+	}
+	if input.Currency != nil {
+		service.Currency = *input.Currency
+	}
+	if input.IsActive != nil {
+		service.IsActive = *input.IsActive
+	}
+
+	v := validator.New()
+	if store.ValidateService(v, service); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	if err := app.validateServiceDuration(r, expert.ID, service.DurationMinutes, v); err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	if err := app.store.Service.Update(r.Context(), service); err != nil {
+		switch {
+		case errors.Is(err, store.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	if err = app.writeJSON(w, http.StatusOK, envelope{"service": service}, nil); err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// validateServiceDuration checks the service length against the expert's allowed session lengths
+func (app *application) validateServiceDuration(r *http.Request, expertID int64, minutes int, v *validator.Validator) error {
+	rules, err := app.store.Expert.GetSchedulingRules(r.Context(), expertID)
+	if err != nil {
+		return err
+	}
+	v.Check(rules.AllowsDuration(int64(minutes)), "duration_minutes", "must be one of the expert's allowed durations")
+	return nil
+}
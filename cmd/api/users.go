@@ -11,6 +11,7 @@ import (
 
 	"consult_app.cedrickewi/internal/aws"
 	"consult_app.cedrickewi/internal/mailer"
+	"consult_app.cedrickewi/internal/payment"
 	"consult_app.cedrickewi/internal/store"
 	"consult_app.cedrickewi/internal/validator"
 	"github.com/google/uuid"
@@ -220,6 +221,15 @@ func (app *application) updateUserHandler(w http.ResponseWriter, r *http.Request
 	name := r.FormValue("username")
 	email := r.FormValue("email")
 	phone := r.FormValue("phone")
+	timezone := r.FormValue("timezone")
+
+	if timezone != "" {
+		v := validator.New()
+		if store.ValidateTimezone(v, timezone); !v.Valid() {
+			app.failedValidationResponse(w, r, v.Errors)
+			return
+		}
+	}
 
 	if name != "" {
 		user.Name = name
@@ -263,6 +273,14 @@ func (app *application) updateUserHandler(w http.ResponseWriter, r *http.Request
 		return
 	}
 
+	if timezone != "" {
+		if err := app.store.User.UpdateTimezone(r.Context(), user.ID, timezone); err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+		user.Timezone = timezone
+	}
+
 	app.contextSetUser(r, user)
 
 	// ✅ Response
@@ -394,14 +412,11 @@ func (app *application) getPayunitPaymentProvidersHandler(w http.ResponseWriter,
 		return
 	}
 
-	providers, err := app.payunit.GetProviders(ctx, booking.ID)
+	providers, err := app.payments.Methods(ctx, booking)
 	if err != nil {
 		switch {
-		case errors.Is(err, store.ErrRecordNotFound):
-			app.notFoundResponse(w, r)
-		case strings.Contains(err.Error(), "no PayUnit initialization found"):
+		case errors.Is(err, store.ErrRecordNotFound), errors.Is(err, payment.ErrNotInitialized):
 			app.notFoundResponse(w, r)
-
 		default:
 			app.serverErrorResponse(w, r, err)
 		}
@@ -0,0 +1,188 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"consult_app.cedrickewi/internal/store"
+	"consult_app.cedrickewi/internal/validator"
+)
+
+// joinWaitlistHandler puts the caller on an expert's waitlist. They are
+// offered freed slots matching their preferred days and times, in turn.
+func (app *application) joinWaitlistHandler(w http.ResponseWriter, r *http.Request) {
+	expertID, err := app.readIDParam(r, "id")
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	var input struct {
+		DurationMinutes int      `json:"duration_minutes"`
+		PreferredDays   []string `json:"preferred_days"`
+		PreferredFrom   string   `json:"preferred_from"`
+		PreferredTo     string   `json:"preferred_to"`
+	}
+
+	if err := app.readJSON(w, r, &input); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	ctx := r.Context()
+	user := app.contextGetUser(r)
+
+	expert, err := app.store.Expert.GetExpertByID(ctx, expertID)
+	if err != nil {
+		switch {
+		case errors.Is(err, store.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	if expert.OnboardingStatus != store.OnboardingActive {
+		app.errorResponse(w, r, http.StatusBadRequest, "❌ This expert is not accepting bookings yet.")
+		return
+	}
+
+	rules, err := app.store.Expert.GetSchedulingRules(ctx, expertID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	entry := store.WaitlistEntry{
+		UserID:          user.ID,
+		ExpertID:        expertID,
+		DurationMinutes: input.DurationMinutes,
+		PreferredDays:   input.PreferredDays,
+		PreferredFrom:   input.PreferredFrom,
+		PreferredTo:     input.PreferredTo,
+		Timezone:        app.userLocation(r).String(),
+	}
+
+	v := validator.New()
+	store.ValidateWaitlistEntry(v, &entry)
+	if entry.DurationMinutes > 0 && !rules.AllowsDuration(int64(entry.DurationMinutes)) {
+		v.AddError("duration_minutes", fmt.Sprintf("must be one of %v minutes", rules.AllowedDurations))
+	}
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	if err := app.store.Waitlist.Join(ctx, &entry); err != nil {
+		switch {
+		case errors.Is(err, store.ErrAlreadyWaitlisted):
+			app.errorResponse(w, r, http.StatusConflict, err.Error())
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	// Slots that are free right now go to the queue straight away
+	now := time.Now()
+	app.offerFreedSlots(ctx, expertID, now, now.Add(store.WaitlistLookahead))
+
+	if err = app.writeJSON(w, http.StatusCreated, envelope{"waitlist_entry": entry}, nil); err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// getMyWaitlistsHandler lists the waitlists the caller is on and the slots held for them
+func (app *application) getMyWaitlistsHandler(w http.ResponseWriter, r *http.Request) {
+	entries, err := app.store.Waitlist.GetForUser(r.Context(), app.contextGetUser(r).ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	loc := app.userLocation(r)
+	for i := range entries {
+		if o := entries[i].Offer; o != nil {
+			o.StartTime, o.EndTime, o.ExpiresAt = o.StartTime.In(loc), o.EndTime.In(loc), o.ExpiresAt.In(loc)
+		}
+	}
+
+	if err = app.writeJSON(w, http.StatusOK, envelope{"waitlist_entries": entries}, nil); err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// leaveWaitlistHandler takes the caller off a waitlist. A slot held for them
+// is passed on to the next client.
+func (app *application) leaveWaitlistHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r, "id")
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	ctx := r.Context()
+	user := app.contextGetUser(r)
+
+	entries, err := app.store.Waitlist.GetForUser(ctx, user.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if err := app.store.Waitlist.Leave(ctx, user.ID, id); err != nil {
+		switch {
+		case errors.Is(err, store.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	for _, e := range entries {
+		if e.ID == id && e.Offer != nil {
+			app.offerFreedSlots(ctx, e.ExpertID, e.Offer.StartTime, e.Offer.EndTime)
+		}
+	}
+
+	if err = app.writeJSON(w, http.StatusOK, envelope{"message": "you have left the waitlist"}, nil); err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// offerFreedSlots queues the job that offers an expert's free slots between
+// from and to to the clients on their waitlist
+func (app *application) offerFreedSlots(ctx context.Context, expertID int64, from, to time.Time) {
+	if _, err := app.mtgschelduler.ScheduleWaitlistOffers(ctx, expertID, from, to); err != nil {
+		app.logger.Errorw("failed to schedule waitlist offers", "expert_id", expertID, "error", err)
+	}
+}
+
+// heldForAnother reports whether part of a requested slot is held for a
+// waitlisted client other than the caller
+func (app *application) heldForAnother(ctx context.Context, userID, expertID int64, start, end time.Time) (*store.WaitlistOffer, error) {
+	offers, err := app.store.Waitlist.GetLiveOffers(ctx, expertID, start, end)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range offers {
+		if offers[i].UserID != userID {
+			return &offers[i], nil
+		}
+	}
+
+	return nil, nil
+}
+
+// claimWaitlistOffer records that a client booked the slot held for them
+func (app *application) claimWaitlistOffer(ctx context.Context, bk *store.Booking) {
+	if err := app.store.Waitlist.Claim(ctx, bk); err != nil {
+		app.logger.Errorw("failed to claim waitlist offer", "booking_id", bk.ID, "error", err)
+	}
+}
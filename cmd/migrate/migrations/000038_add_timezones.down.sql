@@ -0,0 +1,56 @@
+-- Restore the UTC-only availability check from 000029
+CREATE OR REPLACE FUNCTION enforce_booking_rules()
+RETURNS TRIGGER AS $$
+DECLARE
+    v_available_start TIME;
+    v_available_end TIME;
+    v_day TEXT;
+BEGIN
+    IF NEW.user_id = (SELECT user_id FROM experts WHERE id = NEW.expert_id) THEN
+    RAISE EXCEPTION
+        'An expert cannot book himself. The user (ID: %) is the same as the expert’s user (ID: %).',
+        NEW.user_id, (SELECT user_id FROM experts WHERE id = NEW.expert_id);
+    END IF;
+
+    IF NEW.start_time < NOW() THEN
+        RAISE EXCEPTION 'Cannot book a session in the past.';
+    END IF;
+
+    IF NEW.end_time <= NEW.start_time THEN
+        RAISE EXCEPTION 'End time must be after start time.';
+    END IF;
+
+    IF (NEW.end_time - NEW.start_time) < INTERVAL '30 minutes' THEN
+        RAISE EXCEPTION 'Booking duration must be at least 30 minutes.';
+    END IF;
+
+    SELECT ea.start_time, ea.end_time
+    INTO v_available_start, v_available_end
+    FROM expert_availabilities ea
+    WHERE ea.expert_id = NEW.expert_id
+      AND TRIM(LOWER(ea.day_of_week)) =
+          TRIM(LOWER(TO_CHAR(NEW.start_time AT TIME ZONE 'UTC', 'FMday')))
+      AND (NEW.start_time::TIME >= ea.start_time AND NEW.end_time::TIME <= ea.end_time)
+    LIMIT 1;
+
+    IF v_available_start IS NULL THEN
+        SELECT TRIM(LOWER(TO_CHAR(NEW.start_time AT TIME ZONE 'UTC', 'FMday')))
+        INTO v_day;
+
+        RAISE EXCEPTION
+            'Booking time (%, %) is outside expert available hours for %. Expert availability not found (Expert ID: %)',
+            NEW.start_time::time,
+            NEW.end_time::time,
+            v_day,
+            NEW.expert_id;
+    END IF;
+
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+ALTER TABLE IF EXISTS experts
+DROP COLUMN IF EXISTS timezone;
+
+ALTER TABLE IF EXISTS users
+DROP COLUMN IF EXISTS timezone;
@@ -0,0 +1,3 @@
+DROP TRIGGER IF EXISTS trg_enforce_availability_exceptions ON bookings;
+DROP FUNCTION IF EXISTS enforce_availability_exceptions();
+DROP TABLE IF EXISTS expert_availability_exceptions;
@@ -0,0 +1,41 @@
+-- ==========================================================
+-- Migration: Expert availability exceptions
+-- Description:
+--   - One-off blocks (holidays, appointments) on top of weekly availability
+--   - Reject bookings that overlap an exception
+-- ==========================================================
+
+CREATE TABLE IF NOT EXISTS expert_availability_exceptions (
+    id BIGSERIAL PRIMARY KEY,
+    expert_id INT NOT NULL REFERENCES experts(id) ON DELETE CASCADE,
+    start_time TIMESTAMPTZ NOT NULL,
+    end_time TIMESTAMPTZ NOT NULL,
+    reason TEXT NOT NULL DEFAULT '',
+    source VARCHAR(20) NOT NULL DEFAULT 'manual',
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    CONSTRAINT valid_exception_range CHECK (start_time < end_time)
+);
+
+CREATE INDEX IF NOT EXISTS idx_availability_exceptions_expert_time
+ON expert_availability_exceptions (expert_id, start_time, end_time);
+
+CREATE OR REPLACE FUNCTION enforce_availability_exceptions()
+RETURNS TRIGGER AS $$
+BEGIN
+    IF EXISTS (
+        SELECT 1 FROM expert_availability_exceptions ex
+        WHERE ex.expert_id = NEW.expert_id
+          AND tstzrange(ex.start_time, ex.end_time, '[)') && tstzrange(NEW.start_time, NEW.end_time, '[)')
+    ) THEN
+        RAISE EXCEPTION 'Booking overlaps an expert availability exception (Expert ID: %)', NEW.expert_id;
+    END IF;
+
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS trg_enforce_availability_exceptions ON bookings;
+CREATE TRIGGER trg_enforce_availability_exceptions
+BEFORE INSERT OR UPDATE OF start_time, end_time, expert_id ON bookings
+FOR EACH ROW
+EXECUTE FUNCTION enforce_availability_exceptions();
@@ -0,0 +1,130 @@
+-- Restore the timezone-aware rules from 000038
+CREATE OR REPLACE FUNCTION enforce_booking_rules()
+RETURNS TRIGGER AS $$
+DECLARE
+    v_tz TEXT;
+    v_local_start TIMESTAMP;
+    v_local_end TIMESTAMP;
+    v_day TEXT;
+    v_next_day TEXT;
+    v_found BOOLEAN;
+BEGIN
+    ------------------------------------------------------------------
+    -- Prevent expert from booking himself
+    ------------------------------------------------------------------
+    IF NEW.user_id = (SELECT user_id FROM experts WHERE id = NEW.expert_id) THEN
+    RAISE EXCEPTION
+        'An expert cannot book himself. The user (ID: %) is the same as the expert’s user (ID: %).',
+        NEW.user_id, (SELECT user_id FROM experts WHERE id = NEW.expert_id);
+    END IF;
+
+    ------------------------------------------------------------------
+    -- Prevent booking in the past
+    ------------------------------------------------------------------
+    IF NEW.start_time < NOW() THEN
+        RAISE EXCEPTION 'Cannot book a session in the past.';
+    END IF;
+
+    ------------------------------------------------------------------
+    -- Prevent end_time before start_time
+    ------------------------------------------------------------------
+    IF NEW.end_time <= NEW.start_time THEN
+        RAISE EXCEPTION 'End time must be after start time.';
+    END IF;
+
+    ------------------------------------------------------------------
+    -- Enforce minimum booking duration (≥ 30 minutes)
+    ------------------------------------------------------------------
+    IF (NEW.end_time - NEW.start_time) < INTERVAL '30 minutes' THEN
+        RAISE EXCEPTION 'Booking duration must be at least 30 minutes.';
+    END IF;
+
+    ------------------------------------------------------------------
+    -- Convert the booking into the expert's local wall-clock time.
+    -- AT TIME ZONE with an IANA name applies the DST offset in force
+    -- at that instant.
+    ------------------------------------------------------------------
+    SELECT COALESCE(NULLIF(timezone, ''), 'UTC') INTO v_tz
+    FROM experts WHERE id = NEW.expert_id;
+
+    v_local_start := NEW.start_time AT TIME ZONE v_tz;
+    v_local_end := NEW.end_time AT TIME ZONE v_tz;
+    v_day := TRIM(LOWER(TO_CHAR(v_local_start, 'FMday')));
+
+    IF v_local_end::DATE = v_local_start::DATE
+       OR (v_local_end::DATE = v_local_start::DATE + 1 AND v_local_end::TIME = TIME '00:00') THEN
+        -- Booking fits inside a single local day
+        SELECT TRUE INTO v_found
+        FROM expert_availabilities ea
+        WHERE ea.expert_id = NEW.expert_id
+          AND TRIM(LOWER(ea.day_of_week)) = v_day
+          AND v_local_start::TIME >= ea.start_time
+          AND (CASE WHEN v_local_end::TIME = TIME '00:00' THEN TIME '23:59' ELSE v_local_end::TIME END) <= ea.end_time
+        LIMIT 1;
+    ELSIF v_local_end::DATE = v_local_start::DATE + 1 THEN
+        -- Booking crosses local midnight: the start day must run until
+        -- midnight and the next day must start at midnight.
+        v_next_day := TRIM(LOWER(TO_CHAR(v_local_end, 'FMday')));
+
+        SELECT TRUE INTO v_found
+        FROM expert_availabilities ea_start
+        JOIN expert_availabilities ea_end
+          ON ea_end.expert_id = ea_start.expert_id
+         AND TRIM(LOWER(ea_end.day_of_week)) = v_next_day
+        WHERE ea_start.expert_id = NEW.expert_id
+          AND TRIM(LOWER(ea_start.day_of_week)) = v_day
+          AND v_local_start::TIME >= ea_start.start_time
+          AND ea_start.end_time >= TIME '23:59'
+          AND ea_end.start_time = TIME '00:00'
+          AND v_local_end::TIME <= ea_end.end_time
+        LIMIT 1;
+    END IF;
+
+    IF v_found IS NULL THEN
+        RAISE EXCEPTION
+            'Booking time (%, %) is outside expert available hours for % (%). Expert availability not found (Expert ID: %)',
+            v_local_start::time,
+            v_local_end::time,
+            v_day,
+            v_tz,
+            NEW.expert_id;
+    END IF;
+
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS validate_booking_time ON bookings;
+
+CREATE TRIGGER validate_booking_time
+BEFORE INSERT OR UPDATE ON bookings
+FOR EACH ROW
+EXECUTE FUNCTION enforce_booking_rules();
+
+DO $$
+BEGIN
+    IF NOT EXISTS (
+        SELECT 1 FROM pg_constraint
+        WHERE conrelid = 'bookings'::regclass AND conname = 'minimum_duration'
+    ) THEN
+        ALTER TABLE bookings ADD CONSTRAINT minimum_duration CHECK (end_time >= start_time + INTERVAL '30 minutes') NOT VALID;
+    END IF;
+END
+$$;
+
+CREATE OR REPLACE FUNCTION enforce_availability_exceptions()
+RETURNS TRIGGER AS $$
+BEGIN
+    IF EXISTS (
+        SELECT 1 FROM expert_availability_exceptions ex
+        WHERE ex.expert_id = NEW.expert_id
+          AND tstzrange(ex.start_time, ex.end_time, '[)') && tstzrange(NEW.start_time, NEW.end_time, '[)')
+    ) THEN
+        RAISE EXCEPTION 'Booking overlaps an expert availability exception (Expert ID: %)', NEW.expert_id;
+    END IF;
+
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TABLE IF EXISTS expert_scheduling_rules;
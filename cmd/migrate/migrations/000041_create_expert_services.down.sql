@@ -0,0 +1,6 @@
+ALTER TABLE IF EXISTS bookings
+DROP COLUMN IF EXISTS currency,
+DROP COLUMN IF EXISTS service_price,
+DROP COLUMN IF EXISTS service_id;
+
+DROP TABLE IF EXISTS expert_services;
@@ -0,0 +1,32 @@
+-- ==========================================================
+-- Migration: Expert service catalogue
+-- Description:
+--   - Services with their own duration, fixed price and currency
+--   - Bookings reference a service and snapshot its price
+-- ==========================================================
+
+CREATE TABLE IF NOT EXISTS expert_services (
+    id BIGSERIAL PRIMARY KEY,
+    expert_id INT NOT NULL REFERENCES experts(id) ON DELETE CASCADE,
+    name VARCHAR(120) NOT NULL,
+    description TEXT NOT NULL DEFAULT '',
+    duration_minutes INT NOT NULL CHECK (duration_minutes > 0),
+    price INT NOT NULL CHECK (price >= 0),
+    currency VARCHAR(3) NOT NULL DEFAULT 'XAF',
+    is_active BOOLEAN NOT NULL DEFAULT TRUE,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    version INT NOT NULL DEFAULT 1
+);
+
+CREATE INDEX IF NOT EXISTS idx_expert_services_expert ON expert_services (expert_id) WHERE is_active;
+
+ALTER TABLE IF EXISTS bookings
+ADD COLUMN IF NOT EXISTS service_id BIGINT REFERENCES expert_services(id) ON DELETE SET NULL;
+
+-- Price of the service at booking time, excluding platform fees
+ALTER TABLE IF EXISTS bookings
+ADD COLUMN IF NOT EXISTS service_price INT;
+
+ALTER TABLE IF EXISTS bookings
+ADD COLUMN IF NOT EXISTS currency VARCHAR(3) NOT NULL DEFAULT 'XAF';
@@ -0,0 +1,15 @@
+DROP TRIGGER IF EXISTS trg_enforce_expert_active ON bookings;
+DROP FUNCTION IF EXISTS enforce_expert_active();
+
+DELETE FROM permissions WHERE code = 'experts:review';
+
+DROP INDEX IF EXISTS idx_certifications_expert;
+DROP TABLE IF EXISTS expert_payout_details;
+DROP INDEX IF EXISTS idx_experts_onboarding_status;
+
+ALTER TABLE IF EXISTS experts
+DROP COLUMN IF EXISTS reviewed_by,
+DROP COLUMN IF EXISTS reviewed_at,
+DROP COLUMN IF EXISTS submitted_at,
+DROP COLUMN IF EXISTS rejection_reason,
+DROP COLUMN IF EXISTS onboarding_status;
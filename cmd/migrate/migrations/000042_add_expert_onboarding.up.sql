@@ -0,0 +1,63 @@
+-- ==========================================================
+-- Migration: Expert onboarding workflow
+-- Description:
+--   - draft -> submitted -> under_review -> active | rejected
+--   - Payout details required before submission
+--   - Only active experts can be booked
+-- ==========================================================
+
+-- Existing experts were already bookable: backfill them as active,
+-- then make new experts start as drafts.
+ALTER TABLE IF EXISTS experts
+ADD COLUMN IF NOT EXISTS onboarding_status VARCHAR(20) NOT NULL DEFAULT 'active'
+    CHECK (onboarding_status IN ('draft', 'submitted', 'under_review', 'active', 'rejected'));
+
+ALTER TABLE IF EXISTS experts
+ALTER COLUMN onboarding_status SET DEFAULT 'draft';
+
+ALTER TABLE IF EXISTS experts
+ADD COLUMN IF NOT EXISTS rejection_reason TEXT NOT NULL DEFAULT '',
+ADD COLUMN IF NOT EXISTS submitted_at TIMESTAMPTZ,
+ADD COLUMN IF NOT EXISTS reviewed_at TIMESTAMPTZ,
+ADD COLUMN IF NOT EXISTS reviewed_by BIGINT REFERENCES users(id) ON DELETE SET NULL;
+
+CREATE INDEX IF NOT EXISTS idx_experts_onboarding_status ON experts (onboarding_status);
+
+CREATE TABLE IF NOT EXISTS expert_payout_details (
+    expert_id INT PRIMARY KEY REFERENCES experts(id) ON DELETE CASCADE,
+    payout_method VARCHAR(20) NOT NULL CHECK (payout_method IN ('mobile_money', 'bank_transfer')),
+    provider VARCHAR(50) NOT NULL,
+    account_name TEXT NOT NULL,
+    account_number TEXT NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_certifications_expert ON certifications (expert_id);
+
+INSERT INTO permissions (code)
+SELECT 'experts:review'
+WHERE NOT EXISTS (SELECT 1 FROM permissions WHERE code = 'experts:review');
+
+-- ==========================================================
+-- Reject bookings for experts that are not active
+-- ==========================================================
+CREATE OR REPLACE FUNCTION enforce_expert_active()
+RETURNS TRIGGER AS $$
+BEGIN
+    IF NOT EXISTS (
+        SELECT 1 FROM experts
+        WHERE id = NEW.expert_id AND onboarding_status = 'active'
+    ) THEN
+        RAISE EXCEPTION 'Expert is not accepting bookings (Expert ID: %)', NEW.expert_id;
+    END IF;
+
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS trg_enforce_expert_active ON bookings;
+CREATE TRIGGER trg_enforce_expert_active
+BEFORE INSERT OR UPDATE OF expert_id ON bookings
+FOR EACH ROW
+EXECUTE FUNCTION enforce_expert_active();
@@ -0,0 +1,208 @@
+DROP TABLE IF EXISTS booking_events;
+
+ALTER TABLE IF EXISTS bookings
+DROP CONSTRAINT IF EXISTS bookings_bk_status_check;
+
+ALTER TABLE IF EXISTS bookings
+DROP CONSTRAINT IF EXISTS no_expert_overlap;
+
+ALTER TABLE IF EXISTS bookings
+DROP CONSTRAINT IF EXISTS no_user_overlap;
+
+UPDATE bookings SET bk_status = 'pending' WHERE bk_status IN ('requested', 'awaiting_payment');
+UPDATE bookings SET bk_status = 'confirmed' WHERE bk_status = 'in_progress';
+UPDATE bookings SET bk_status = 'cancelled' WHERE bk_status IN ('cancelled_by_user', 'cancelled_by_expert', 'no_show', 'refunded');
+
+ALTER TABLE IF EXISTS bookings
+ALTER COLUMN bk_status DROP NOT NULL,
+ALTER COLUMN bk_status SET DEFAULT 'pending';
+
+ALTER TABLE IF EXISTS bookings
+ADD CONSTRAINT bookings_bk_status_check
+CHECK (bk_status IN ('pending', 'confirmed', 'cancelled', 'completed'));
+
+ALTER TABLE IF EXISTS bookings
+ADD CONSTRAINT no_expert_overlap
+EXCLUDE USING gist (
+    expert_id WITH =,
+    time_range WITH &&
+)
+WHERE (bk_status IN ('pending', 'confirmed'));
+
+ALTER TABLE IF EXISTS bookings
+ADD CONSTRAINT no_user_overlap
+EXCLUDE USING gist (
+    user_id WITH =,
+    time_range WITH &&
+)
+WHERE (bk_status IN ('pending', 'confirmed'));
+
+CREATE OR REPLACE FUNCTION enforce_booking_rules()
+RETURNS TRIGGER AS $$
+DECLARE
+    v_tz TEXT;
+    v_local_start TIMESTAMP;
+    v_local_end TIMESTAMP;
+    v_day TEXT;
+    v_next_day TEXT;
+    v_found BOOLEAN;
+    v_duration INT;
+    v_allowed INT[];
+    v_before INTERVAL;
+    v_after INTERVAL;
+    v_notice INT;
+    v_horizon INT;
+    v_max_per_day INT;
+    v_count INT;
+BEGIN
+    ------------------------------------------------------------------
+    -- Status/payment updates keep the original booking time: skip
+    ------------------------------------------------------------------
+    IF TG_OP = 'UPDATE'
+       AND NEW.start_time IS NOT DISTINCT FROM OLD.start_time
+       AND NEW.end_time IS NOT DISTINCT FROM OLD.end_time
+       AND NEW.expert_id IS NOT DISTINCT FROM OLD.expert_id THEN
+        RETURN NEW;
+    END IF;
+
+    ------------------------------------------------------------------
+    -- Prevent expert from booking himself
+    ------------------------------------------------------------------
+    IF NEW.user_id = (SELECT user_id FROM experts WHERE id = NEW.expert_id) THEN
+    RAISE EXCEPTION
+        'An expert cannot book himself. The user (ID: %) is the same as the expert’s user (ID: %).',
+        NEW.user_id, (SELECT user_id FROM experts WHERE id = NEW.expert_id);
+    END IF;
+
+    ------------------------------------------------------------------
+    -- Prevent booking in the past
+    ------------------------------------------------------------------
+    IF NEW.start_time < NOW() THEN
+        RAISE EXCEPTION 'Cannot book a session in the past.';
+    END IF;
+
+    ------------------------------------------------------------------
+    -- Prevent end_time before start_time
+    ------------------------------------------------------------------
+    IF NEW.end_time <= NEW.start_time THEN
+        RAISE EXCEPTION 'End time must be after start time.';
+    END IF;
+
+    ------------------------------------------------------------------
+    -- Load the expert's rules, falling back to the column defaults
+    ------------------------------------------------------------------
+    SELECT allowed_durations,
+           make_interval(mins => buffer_before_minutes),
+           make_interval(mins => buffer_after_minutes),
+           min_notice_minutes,
+           max_horizon_days,
+           max_sessions_per_day
+    INTO v_allowed, v_before, v_after, v_notice, v_horizon, v_max_per_day
+    FROM expert_scheduling_rules
+    WHERE expert_id = NEW.expert_id;
+
+    v_allowed := COALESCE(v_allowed, ARRAY[30, 45, 60, 90]);
+    v_before := COALESCE(v_before, INTERVAL '0');
+    v_after := COALESCE(v_after, INTERVAL '0');
+    v_notice := COALESCE(v_notice, 0);
+    v_horizon := COALESCE(v_horizon, 60);
+
+    ------------------------------------------------------------------
+    -- Allowed session lengths
+    ------------------------------------------------------------------
+    v_duration := (EXTRACT(EPOCH FROM (NEW.end_time - NEW.start_time)) / 60)::INT;
+    IF NOT (v_duration = ANY (v_allowed)) THEN
+        RAISE EXCEPTION 'Booking duration of % minutes is not allowed. Allowed durations: %.',
+            v_duration, array_to_string(v_allowed, ', ');
+    END IF;
+
+    ------------------------------------------------------------------
+    -- Minimum notice and maximum horizon
+    ------------------------------------------------------------------
+    IF NEW.start_time < NOW() + make_interval(mins => v_notice) THEN
+        RAISE EXCEPTION 'Booking does not respect the expert minimum notice of % minutes.', v_notice;
+    END IF;
+
+    IF NEW.start_time > NOW() + make_interval(days => v_horizon) THEN
+        RAISE EXCEPTION 'Booking is beyond the expert booking horizon of % days.', v_horizon;
+    END IF;
+
+    ------------------------------------------------------------------
+    -- Convert the booking into the expert's local wall-clock time.
+    ------------------------------------------------------------------
+    SELECT COALESCE(NULLIF(timezone, ''), 'UTC') INTO v_tz
+    FROM experts WHERE id = NEW.expert_id;
+
+    v_local_start := NEW.start_time AT TIME ZONE v_tz;
+    v_local_end := NEW.end_time AT TIME ZONE v_tz;
+    v_day := TRIM(LOWER(TO_CHAR(v_local_start, 'FMday')));
+
+    IF v_local_end::DATE = v_local_start::DATE
+       OR (v_local_end::DATE = v_local_start::DATE + 1 AND v_local_end::TIME = TIME '00:00') THEN
+        SELECT TRUE INTO v_found
+        FROM expert_availabilities ea
+        WHERE ea.expert_id = NEW.expert_id
+          AND TRIM(LOWER(ea.day_of_week)) = v_day
+          AND v_local_start::TIME >= ea.start_time
+          AND (CASE WHEN v_local_end::TIME = TIME '00:00' THEN TIME '23:59' ELSE v_local_end::TIME END) <= ea.end_time
+        LIMIT 1;
+    ELSIF v_local_end::DATE = v_local_start::DATE + 1 THEN
+        v_next_day := TRIM(LOWER(TO_CHAR(v_local_end, 'FMday')));
+
+        SELECT TRUE INTO v_found
+        FROM expert_availabilities ea_start
+        JOIN expert_availabilities ea_end
+          ON ea_end.expert_id = ea_start.expert_id
+         AND TRIM(LOWER(ea_end.day_of_week)) = v_next_day
+        WHERE ea_start.expert_id = NEW.expert_id
+          AND TRIM(LOWER(ea_start.day_of_week)) = v_day
+          AND v_local_start::TIME >= ea_start.start_time
+          AND ea_start.end_time >= TIME '23:59'
+          AND ea_end.start_time = TIME '00:00'
+          AND v_local_end::TIME <= ea_end.end_time
+        LIMIT 1;
+    END IF;
+
+    IF v_found IS NULL THEN
+        RAISE EXCEPTION
+            'Booking time (%, %) is outside expert available hours for % (%). Expert availability not found (Expert ID: %)',
+            v_local_start::time,
+            v_local_end::time,
+            v_day,
+            v_tz,
+            NEW.expert_id;
+    END IF;
+
+    ------------------------------------------------------------------
+    -- Maximum sessions per local day
+    ------------------------------------------------------------------
+    IF v_max_per_day IS NOT NULL THEN
+        SELECT COUNT(*) INTO v_count
+        FROM bookings b
+        WHERE b.expert_id = NEW.expert_id
+          AND b.id IS DISTINCT FROM NEW.id
+          AND b.bk_status IN ('pending', 'confirmed')
+          AND (b.start_time AT TIME ZONE v_tz)::DATE = v_local_start::DATE;
+
+        IF v_count >= v_max_per_day THEN
+            RAISE EXCEPTION 'Expert has reached the maximum of % sessions on %.', v_max_per_day, v_local_start::DATE;
+        END IF;
+    END IF;
+
+    ------------------------------------------------------------------
+    -- Buffers: padded sessions must not overlap
+    ------------------------------------------------------------------
+    IF v_before + v_after > INTERVAL '0' AND EXISTS (
+        SELECT 1 FROM bookings b
+        WHERE b.expert_id = NEW.expert_id
+          AND b.id IS DISTINCT FROM NEW.id
+          AND b.bk_status IN ('pending', 'confirmed')
+          AND tstzrange(b.start_time - v_before, b.end_time + v_after, '[)')
+              && tstzrange(NEW.start_time - v_before, NEW.end_time + v_after, '[)')
+    ) THEN
+        RAISE EXCEPTION 'Booking does not respect the expert buffer between sessions.';
+    END IF;
+
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
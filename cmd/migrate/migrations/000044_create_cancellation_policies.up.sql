@@ -0,0 +1,37 @@
+-- ==========================================================
+-- Migration: Cancellation policies and refunds
+-- Description:
+--   - A policy belongs to either an expert or a branch; the expert's
+--     own policy wins over a branch policy
+--   - Full refund more than full_refund_hours before the start,
+--     partial_refund_percent inside that window, nothing after start
+--   - refunds records every refund owed to a client
+-- ==========================================================
+
+CREATE TABLE IF NOT EXISTS cancellation_policies (
+    id SERIAL PRIMARY KEY,
+    expert_id INT UNIQUE REFERENCES experts(id) ON DELETE CASCADE,
+    branch_id INT UNIQUE REFERENCES branches(id) ON DELETE CASCADE,
+    full_refund_hours INT NOT NULL DEFAULT 24 CHECK (full_refund_hours >= 0),
+    partial_refund_percent INT NOT NULL DEFAULT 50 CHECK (partial_refund_percent BETWEEN 0 AND 100),
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    CONSTRAINT cancellation_policy_owner CHECK ((expert_id IS NULL) <> (branch_id IS NULL))
+);
+
+CREATE TABLE IF NOT EXISTS refunds (
+    id BIGSERIAL PRIMARY KEY,
+    booking_id INT NOT NULL REFERENCES bookings(id) ON DELETE CASCADE,
+    amount BIGINT NOT NULL CHECK (amount > 0),
+    currency VARCHAR(3) NOT NULL DEFAULT 'XAF',
+    status VARCHAR(20) NOT NULL DEFAULT 'pending'
+        CHECK (status IN ('pending', 'processing', 'succeeded', 'failed')),
+    reason TEXT NOT NULL DEFAULT '',
+    requested_by BIGINT REFERENCES users(id) ON DELETE SET NULL,
+    provider_reference VARCHAR(150) NOT NULL DEFAULT '',
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_refunds_booking ON refunds (booking_id);
+CREATE INDEX IF NOT EXISTS idx_refunds_status ON refunds (status);
@@ -0,0 +1,7 @@
+DROP TABLE IF EXISTS booking_reschedule_requests;
+
+ALTER TABLE IF EXISTS expert_scheduling_rules
+DROP COLUMN IF EXISTS max_reschedules;
+
+ALTER TABLE IF EXISTS bookings
+DROP COLUMN IF EXISTS reschedule_count;
@@ -0,0 +1,33 @@
+-- ==========================================================
+-- Migration: Booking reschedules
+-- Description:
+--   - Either party proposes a new time, the other accepts or declines
+--   - At most one open proposal per booking
+--   - Experts cap how many times a booking can be moved
+-- ==========================================================
+
+ALTER TABLE IF EXISTS bookings
+ADD COLUMN IF NOT EXISTS reschedule_count INT NOT NULL DEFAULT 0;
+
+ALTER TABLE IF EXISTS expert_scheduling_rules
+ADD COLUMN IF NOT EXISTS max_reschedules INT NOT NULL DEFAULT 2 CHECK (max_reschedules >= 0);
+
+CREATE TABLE IF NOT EXISTS booking_reschedule_requests (
+    id BIGSERIAL PRIMARY KEY,
+    booking_id INT NOT NULL REFERENCES bookings(id) ON DELETE CASCADE,
+    proposed_by BIGINT REFERENCES users(id) ON DELETE SET NULL,
+    proposer VARCHAR(20) NOT NULL CHECK (proposer IN ('user', 'expert')),
+    start_time TIMESTAMPTZ NOT NULL,
+    end_time TIMESTAMPTZ NOT NULL,
+    reason TEXT NOT NULL DEFAULT '',
+    status VARCHAR(20) NOT NULL DEFAULT 'proposed'
+        CHECK (status IN ('proposed', 'accepted', 'declined', 'withdrawn')),
+    responded_by BIGINT REFERENCES users(id) ON DELETE SET NULL,
+    responded_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    CONSTRAINT valid_reschedule_time CHECK (end_time > start_time)
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS one_open_reschedule_per_booking
+ON booking_reschedule_requests (booking_id)
+WHERE status = 'proposed';
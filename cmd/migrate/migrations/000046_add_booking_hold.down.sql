@@ -0,0 +1,7 @@
+DROP INDEX IF EXISTS idx_bookings_hold_expires_at;
+
+ALTER TABLE IF EXISTS bookings
+DROP COLUMN IF EXISTS hold_expires_at;
+
+ALTER TABLE IF EXISTS expert_scheduling_rules
+DROP COLUMN IF EXISTS hold_minutes;
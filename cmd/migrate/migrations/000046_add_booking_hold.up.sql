@@ -0,0 +1,16 @@
+-- ==========================================================
+-- Migration: Payment hold on new bookings
+-- Description:
+--   - An unpaid booking holds its slot until hold_expires_at
+--   - Experts choose the hold length (default 15 minutes)
+-- ==========================================================
+
+ALTER TABLE IF EXISTS expert_scheduling_rules
+ADD COLUMN IF NOT EXISTS hold_minutes INT NOT NULL DEFAULT 15 CHECK (hold_minutes BETWEEN 5 AND 1440);
+
+ALTER TABLE IF EXISTS bookings
+ADD COLUMN IF NOT EXISTS hold_expires_at TIMESTAMPTZ;
+
+CREATE INDEX IF NOT EXISTS idx_bookings_hold_expires_at
+ON bookings (hold_expires_at)
+WHERE bk_status = 'awaiting_payment';
@@ -0,0 +1,10 @@
+ALTER TABLE IF EXISTS booking_reschedule_requests
+DROP COLUMN IF EXISTS scope;
+
+DROP INDEX IF EXISTS idx_bookings_series;
+
+ALTER TABLE IF EXISTS bookings
+DROP COLUMN IF EXISTS series_index,
+DROP COLUMN IF EXISTS series_id;
+
+DROP TABLE IF EXISTS booking_series;
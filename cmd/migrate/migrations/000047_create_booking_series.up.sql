@@ -0,0 +1,29 @@
+-- ==========================================================
+-- Migration: Recurring booking series
+-- Description:
+--   - A client books the same expert weekly or every two weeks
+--   - Every occurrence is a regular booking linked to its series
+--   - A series can be paid once for all its occurrences
+--   - Reschedule proposals can move one occurrence or it and the following ones
+-- ==========================================================
+
+CREATE TABLE IF NOT EXISTS booking_series (
+    id BIGSERIAL PRIMARY KEY,
+    user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    expert_id BIGINT NOT NULL REFERENCES experts(id) ON DELETE CASCADE,
+    frequency VARCHAR(20) NOT NULL CHECK (frequency IN ('weekly', 'biweekly')),
+    occurrences INT NOT NULL CHECK (occurrences BETWEEN 2 AND 52),
+    single_payment BOOLEAN NOT NULL DEFAULT FALSE,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+ALTER TABLE IF EXISTS bookings
+ADD COLUMN IF NOT EXISTS series_id BIGINT REFERENCES booking_series(id) ON DELETE SET NULL,
+ADD COLUMN IF NOT EXISTS series_index INT;
+
+CREATE INDEX IF NOT EXISTS idx_bookings_series
+ON bookings (series_id, series_index)
+WHERE series_id IS NOT NULL;
+
+ALTER TABLE IF EXISTS booking_reschedule_requests
+ADD COLUMN IF NOT EXISTS scope VARCHAR(20) NOT NULL DEFAULT 'this' CHECK (scope IN ('this', 'following'));
@@ -0,0 +1,56 @@
+-- ==========================================================
+-- Migration: Waitlist
+-- Description:
+--   - Clients join an expert's waitlist, optionally with the days
+--     and times of day they prefer
+--   - When a slot frees up, matching entries are offered it in the
+--     order they joined; an offer holds the slot for that client
+--     alone until it expires
+-- ==========================================================
+
+CREATE TABLE IF NOT EXISTS waitlist_entries (
+    id BIGSERIAL PRIMARY KEY,
+    user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    expert_id BIGINT NOT NULL REFERENCES experts(id) ON DELETE CASCADE,
+    duration_minutes INT NOT NULL CHECK (duration_minutes > 0),
+    preferred_days TEXT[] NOT NULL DEFAULT '{}',
+    preferred_from TIME,
+    preferred_to TIME,
+    timezone TEXT NOT NULL DEFAULT 'UTC',
+    status VARCHAR(20) NOT NULL DEFAULT 'waiting'
+        CHECK (status IN ('waiting', 'fulfilled', 'left')),
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    CONSTRAINT valid_preferred_times CHECK (
+        preferred_from IS NULL OR preferred_to IS NULL OR preferred_to > preferred_from
+    )
+);
+
+-- A client waits at most once per expert
+CREATE UNIQUE INDEX IF NOT EXISTS idx_waitlist_entries_waiting
+    ON waitlist_entries (user_id, expert_id)
+    WHERE status = 'waiting';
+
+CREATE INDEX IF NOT EXISTS idx_waitlist_entries_queue
+    ON waitlist_entries (expert_id, created_at)
+    WHERE status = 'waiting';
+
+CREATE TABLE IF NOT EXISTS waitlist_offers (
+    id BIGSERIAL PRIMARY KEY,
+    entry_id BIGINT NOT NULL REFERENCES waitlist_entries(id) ON DELETE CASCADE,
+    expert_id BIGINT NOT NULL REFERENCES experts(id) ON DELETE CASCADE,
+    start_time TIMESTAMPTZ NOT NULL,
+    end_time TIMESTAMPTZ NOT NULL,
+    expires_at TIMESTAMPTZ NOT NULL,
+    status VARCHAR(20) NOT NULL DEFAULT 'offered'
+        CHECK (status IN ('offered', 'claimed', 'lapsed')),
+    booking_id BIGINT REFERENCES bookings(id) ON DELETE SET NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    CONSTRAINT valid_waitlist_offer_time CHECK (end_time > start_time),
+    -- A slot is offered to one client at a time
+    CONSTRAINT no_waitlist_offer_overlap EXCLUDE USING gist (
+        expert_id WITH =,
+        tstzrange(start_time, end_time, '[)') WITH &&
+    ) WHERE (status = 'offered')
+);
+
+CREATE INDEX IF NOT EXISTS idx_waitlist_offers_entry ON waitlist_offers (entry_id);
@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS booking_intake_answers;
+DROP TABLE IF EXISTS intake_form_versions;
+DROP TABLE IF EXISTS intake_forms;
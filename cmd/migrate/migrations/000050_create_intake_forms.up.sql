@@ -0,0 +1,43 @@
+-- ==========================================================
+-- Migration: Intake forms
+-- Description:
+--   - Experts, or organisations for all of their experts, define a
+--     questionnaire clients fill in when they book
+--   - Every edit of a form is kept as a new version, so answers
+--     given to an older version still render with its fields
+--   - Answers are stored with the booking
+-- ==========================================================
+
+CREATE TABLE IF NOT EXISTS intake_forms (
+    id BIGSERIAL PRIMARY KEY,
+    expert_id BIGINT REFERENCES experts(id) ON DELETE CASCADE,
+    organisation_id BIGINT REFERENCES organisations(id) ON DELETE CASCADE,
+    title VARCHAR(255) NOT NULL,
+    current_version INT NOT NULL DEFAULT 1,
+    is_active BOOLEAN NOT NULL DEFAULT TRUE,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    CONSTRAINT intake_form_owner CHECK ((expert_id IS NULL) <> (organisation_id IS NULL))
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_intake_forms_expert
+    ON intake_forms (expert_id) WHERE expert_id IS NOT NULL;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_intake_forms_organisation
+    ON intake_forms (organisation_id) WHERE organisation_id IS NOT NULL;
+
+CREATE TABLE IF NOT EXISTS intake_form_versions (
+    id BIGSERIAL PRIMARY KEY,
+    form_id BIGINT NOT NULL REFERENCES intake_forms(id) ON DELETE CASCADE,
+    version INT NOT NULL,
+    title VARCHAR(255) NOT NULL,
+    fields JSONB NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    UNIQUE (form_id, version)
+);
+
+CREATE TABLE IF NOT EXISTS booking_intake_answers (
+    booking_id BIGINT PRIMARY KEY REFERENCES bookings(id) ON DELETE CASCADE,
+    form_version_id BIGINT NOT NULL REFERENCES intake_form_versions(id),
+    answers JSONB NOT NULL,
+    submitted_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
@@ -0,0 +1,22 @@
+-- ==========================================================
+-- Migration: Booking attachments
+-- Description:
+--   - Files shared between the client and the expert of a booking,
+--     such as contracts before a session and deliverables after it
+--   - Objects are private in S3 and downloaded through short-lived
+--     presigned URLs
+-- ==========================================================
+
+CREATE TABLE IF NOT EXISTS booking_attachments (
+    id BIGSERIAL PRIMARY KEY,
+    booking_id BIGINT NOT NULL REFERENCES bookings(id) ON DELETE CASCADE,
+    uploaded_by BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    uploader_role VARCHAR(10) NOT NULL CHECK (uploader_role IN ('user', 'expert')),
+    s3_key TEXT NOT NULL UNIQUE,
+    filename VARCHAR(255) NOT NULL,
+    content_type VARCHAR(100) NOT NULL,
+    size_bytes BIGINT NOT NULL CHECK (size_bytes > 0),
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_booking_attachments_booking ON booking_attachments (booking_id, created_at);
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS session_summaries;
+DROP TABLE IF EXISTS expert_notes;
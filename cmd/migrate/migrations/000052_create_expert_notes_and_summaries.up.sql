@@ -0,0 +1,31 @@
+-- ==========================================================
+-- Migration: Expert notes and session summaries
+-- Description:
+--   - Experts keep private notes about a client, optionally tied to
+--     one of the client's sessions; clients never see them
+--   - After a session the expert can share a summary with action
+--     items and an optional attached document with the client
+-- ==========================================================
+
+CREATE TABLE IF NOT EXISTS expert_notes (
+    id BIGSERIAL PRIMARY KEY,
+    expert_id BIGINT NOT NULL REFERENCES experts(id) ON DELETE CASCADE,
+    user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    booking_id BIGINT REFERENCES bookings(id) ON DELETE CASCADE,
+    body TEXT NOT NULL CHECK (char_length(body) BETWEEN 1 AND 20000),
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_expert_notes_client ON expert_notes (expert_id, user_id, created_at);
+
+CREATE TABLE IF NOT EXISTS session_summaries (
+    id BIGSERIAL PRIMARY KEY,
+    booking_id BIGINT NOT NULL UNIQUE REFERENCES bookings(id) ON DELETE CASCADE,
+    expert_id BIGINT NOT NULL REFERENCES experts(id) ON DELETE CASCADE,
+    summary TEXT NOT NULL CHECK (char_length(summary) BETWEEN 1 AND 20000),
+    action_items TEXT[] NOT NULL DEFAULT '{}',
+    attachment_id BIGINT REFERENCES booking_attachments(id) ON DELETE SET NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS expert_earnings;
+DROP TABLE IF EXISTS session_attendance;
@@ -0,0 +1,30 @@
+-- ==========================================================
+-- Migration: Session attendance and expert earnings
+-- Description:
+--   - The outcome of every held session, settled by the worker
+--     after the session ends, from the Zoom attendance of the
+--     client and the expert
+--   - What the expert earned from a booking, pending payout.
+--     A session the expert missed earns nothing and is refunded
+-- ==========================================================
+
+CREATE TABLE IF NOT EXISTS session_attendance (
+    booking_id BIGINT PRIMARY KEY REFERENCES bookings(id) ON DELETE CASCADE,
+    client_seconds INT NOT NULL DEFAULT 0 CHECK (client_seconds >= 0),
+    expert_seconds INT NOT NULL DEFAULT 0 CHECK (expert_seconds >= 0),
+    outcome VARCHAR(20) NOT NULL CHECK (outcome IN ('completed', 'no_show_client', 'no_show_expert')),
+    settled_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE TABLE IF NOT EXISTS expert_earnings (
+    id BIGSERIAL PRIMARY KEY,
+    expert_id BIGINT NOT NULL REFERENCES experts(id) ON DELETE CASCADE,
+    booking_id BIGINT NOT NULL UNIQUE REFERENCES bookings(id) ON DELETE CASCADE,
+    amount INT NOT NULL CHECK (amount >= 0),
+    currency VARCHAR(3) NOT NULL DEFAULT 'XAF',
+    status VARCHAR(20) NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'paid', 'cancelled')),
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_expert_earnings_expert ON expert_earnings (expert_id, status);
@@ -0,0 +1,8 @@
+DROP TABLE IF EXISTS calendar_feeds;
+
+DROP TRIGGER IF EXISTS trg_bump_booking_ical_sequence ON bookings;
+DROP FUNCTION IF EXISTS bump_booking_ical_sequence();
+
+ALTER TABLE IF EXISTS bookings
+DROP COLUMN IF EXISTS calendar_updated_at,
+DROP COLUMN IF EXISTS ical_sequence;
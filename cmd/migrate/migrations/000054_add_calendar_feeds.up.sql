@@ -0,0 +1,38 @@
+-- ==========================================================
+-- Migration: Calendar export
+-- Description:
+--   - Every booking keeps an iCalendar SEQUENCE, bumped whenever
+--     its time or status changes, so subscribed calendars update
+--     the event instead of adding another
+--   - One secret feed token per user; only its hash is stored
+-- ==========================================================
+
+ALTER TABLE IF EXISTS bookings
+ADD COLUMN IF NOT EXISTS ical_sequence INT NOT NULL DEFAULT 0,
+ADD COLUMN IF NOT EXISTS calendar_updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW();
+
+CREATE OR REPLACE FUNCTION bump_booking_ical_sequence()
+RETURNS TRIGGER AS $$
+BEGIN
+    IF NEW.start_time IS DISTINCT FROM OLD.start_time
+       OR NEW.end_time IS DISTINCT FROM OLD.end_time
+       OR NEW.bk_status IS DISTINCT FROM OLD.bk_status THEN
+        NEW.ical_sequence := OLD.ical_sequence + 1;
+        NEW.calendar_updated_at := NOW();
+    END IF;
+
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS trg_bump_booking_ical_sequence ON bookings;
+CREATE TRIGGER trg_bump_booking_ical_sequence
+BEFORE UPDATE OF start_time, end_time, bk_status ON bookings
+FOR EACH ROW
+EXECUTE FUNCTION bump_booking_ical_sequence();
+
+CREATE TABLE IF NOT EXISTS calendar_feeds (
+    user_id BIGINT PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+    hash BYTEA NOT NULL UNIQUE,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
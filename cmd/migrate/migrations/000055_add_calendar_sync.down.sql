@@ -0,0 +1,7 @@
+DROP TABLE IF EXISTS calendar_pushed_bookings;
+
+DROP INDEX IF EXISTS idx_availability_exceptions_expert_source;
+
+DELETE FROM expert_availability_exceptions WHERE source = 'caldav';
+
+DROP TABLE IF EXISTS expert_calendar_connections;
@@ -0,0 +1,33 @@
+-- ==========================================================
+-- Migration: CalDAV calendar sync
+-- Description:
+--   - One external CalDAV calendar per expert; the password is
+--     stored encrypted by the application
+--   - Busy time imported from it is kept as availability
+--     exceptions with source 'caldav', replaced on every sync
+--   - Bookings written into it are remembered with the SEQUENCE
+--     pushed, so only changed bookings are written again
+-- ==========================================================
+
+CREATE TABLE IF NOT EXISTS expert_calendar_connections (
+    id BIGSERIAL PRIMARY KEY,
+    expert_id INT NOT NULL UNIQUE REFERENCES experts(id) ON DELETE CASCADE,
+    calendar_url TEXT NOT NULL,
+    username TEXT NOT NULL,
+    password_sealed TEXT NOT NULL,
+    last_synced_at TIMESTAMPTZ,
+    last_error TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_availability_exceptions_expert_source
+ON expert_availability_exceptions (expert_id, source);
+
+CREATE TABLE IF NOT EXISTS calendar_pushed_bookings (
+    booking_id INT PRIMARY KEY REFERENCES bookings(id) ON DELETE CASCADE,
+    connection_id BIGINT NOT NULL REFERENCES expert_calendar_connections(id) ON DELETE CASCADE,
+    href TEXT NOT NULL,
+    sequence INT NOT NULL,
+    pushed_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
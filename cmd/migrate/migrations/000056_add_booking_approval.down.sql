@@ -0,0 +1,8 @@
+DROP INDEX IF EXISTS idx_bookings_approval_deadline;
+
+ALTER TABLE IF EXISTS bookings
+DROP COLUMN IF EXISTS approval_deadline;
+
+ALTER TABLE IF EXISTS expert_scheduling_rules
+DROP COLUMN IF EXISTS approval_hours,
+DROP COLUMN IF EXISTS requires_approval;
@@ -0,0 +1,18 @@
+-- ==========================================================
+-- Migration: Booking requests needing expert approval
+-- Description:
+--   - Experts may require approval of new bookings, which then
+--     start as 'requested' and can only be paid once accepted
+--   - An unanswered request is declined at approval_deadline
+-- ==========================================================
+
+ALTER TABLE IF EXISTS expert_scheduling_rules
+ADD COLUMN IF NOT EXISTS requires_approval BOOLEAN NOT NULL DEFAULT FALSE,
+ADD COLUMN IF NOT EXISTS approval_hours INT NOT NULL DEFAULT 24 CHECK (approval_hours BETWEEN 1 AND 168);
+
+ALTER TABLE IF EXISTS bookings
+ADD COLUMN IF NOT EXISTS approval_deadline TIMESTAMPTZ;
+
+CREATE INDEX IF NOT EXISTS idx_bookings_approval_deadline
+ON bookings (approval_deadline)
+WHERE bk_status = 'requested';
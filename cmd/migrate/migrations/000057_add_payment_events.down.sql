@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_payment_events_transaction;
+
+DROP TABLE IF EXISTS payment_events;
@@ -0,0 +1,28 @@
+-- ==========================================================
+-- Migration: payment gateway notifications
+-- Description:
+--   - Every authenticated notification from a payment gateway
+--     is kept as received
+--   - The dedupe key is unique per gateway, so a notification
+--     sent again is recorded once and processed once
+--   - claimed_at marks a notification being processed; a claim
+--     left by a crashed request can be taken over after a while
+-- ==========================================================
+
+CREATE TABLE IF NOT EXISTS payment_events (
+    id BIGSERIAL PRIMARY KEY,
+    provider TEXT NOT NULL,
+    dedupe_key TEXT NOT NULL,
+    transaction_id TEXT NOT NULL,
+    state TEXT NOT NULL,
+    payload BYTEA NOT NULL,
+    received_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    claimed_at TIMESTAMPTZ,
+    processed_at TIMESTAMPTZ,
+    attempts INT NOT NULL DEFAULT 0,
+    last_error TEXT NOT NULL DEFAULT '',
+    UNIQUE (provider, dedupe_key)
+);
+
+CREATE INDEX IF NOT EXISTS idx_payment_events_transaction
+ON payment_events (transaction_id);
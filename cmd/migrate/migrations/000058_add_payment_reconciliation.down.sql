@@ -0,0 +1,8 @@
+DROP TABLE IF EXISTS payment_reconciliation_mismatches;
+
+DROP TABLE IF EXISTS payment_reconciliation_reports;
+
+DROP INDEX IF EXISTS idx_bookings_pending_transactions;
+
+ALTER TABLE bookings
+DROP COLUMN IF EXISTS transaction_started_at;
@@ -0,0 +1,48 @@
+-- ==========================================================
+-- Migration: payment reconciliation
+-- Description:
+--   - Bookings remember when their payment transaction was
+--     started, so the worker can poll the gateway for those
+--     left pending
+--   - A daily report records the transactions where the
+--     gateway and our records disagree
+-- ==========================================================
+
+ALTER TABLE bookings
+ADD COLUMN IF NOT EXISTS transaction_started_at TIMESTAMPTZ;
+
+UPDATE bookings b
+SET transaction_started_at = pti.created_at
+FROM payunit_transactions_init pti
+WHERE b.payunit_transactions_init_id = pti.id
+  AND b.transaction_started_at IS NULL;
+
+UPDATE bookings
+SET transaction_started_at = created_at
+WHERE transaction_id IS NOT NULL AND transaction_started_at IS NULL;
+
+CREATE INDEX IF NOT EXISTS idx_bookings_pending_transactions
+ON bookings (transaction_started_at)
+WHERE transaction_id IS NOT NULL AND payment_status = 'pending';
+
+CREATE TABLE IF NOT EXISTS payment_reconciliation_reports (
+    id BIGSERIAL PRIMARY KEY,
+    report_date DATE NOT NULL UNIQUE,
+    provider TEXT NOT NULL,
+    transactions_checked INT NOT NULL,
+    mismatches_found INT NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE TABLE IF NOT EXISTS payment_reconciliation_mismatches (
+    id BIGSERIAL PRIMARY KEY,
+    report_id BIGINT NOT NULL REFERENCES payment_reconciliation_reports(id) ON DELETE CASCADE,
+    booking_id INT REFERENCES bookings(id) ON DELETE SET NULL,
+    transaction_id TEXT NOT NULL,
+    kind TEXT NOT NULL,
+    gateway_value TEXT NOT NULL,
+    recorded_value TEXT NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_payment_reconciliation_mismatches_report
+ON payment_reconciliation_mismatches (report_id);
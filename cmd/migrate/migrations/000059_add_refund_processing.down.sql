@@ -0,0 +1,13 @@
+DELETE FROM permissions WHERE code = 'payments:refund';
+
+ALTER TABLE expert_earnings
+DROP COLUMN IF EXISTS refunded_amount;
+
+DROP INDEX IF EXISTS idx_refunds_provider_reference;
+
+ALTER TABLE refunds
+DROP COLUMN IF EXISTS settled_at,
+DROP COLUMN IF EXISTS issued_at,
+DROP COLUMN IF EXISTS last_error,
+DROP COLUMN IF EXISTS attempts,
+DROP COLUMN IF EXISTS transaction_id;
@@ -0,0 +1,29 @@
+-- ==========================================================
+-- Migration: refunds issued through the payment gateway
+-- Description:
+--   - A refund is linked to the transaction that paid for its
+--     booking and moves pending -> processing -> succeeded or
+--     failed as the gateway handles it
+--   - Refunds that succeed reduce the expert's earnings of the
+--     booking; refunded_amount records what was taken back,
+--     from a payout already made as well
+--   - payments:refund lets staff refund a booking directly
+-- ==========================================================
+
+ALTER TABLE refunds
+ADD COLUMN IF NOT EXISTS transaction_id VARCHAR(150),
+ADD COLUMN IF NOT EXISTS attempts INT NOT NULL DEFAULT 0,
+ADD COLUMN IF NOT EXISTS last_error TEXT NOT NULL DEFAULT '',
+ADD COLUMN IF NOT EXISTS issued_at TIMESTAMPTZ,
+ADD COLUMN IF NOT EXISTS settled_at TIMESTAMPTZ;
+
+CREATE INDEX IF NOT EXISTS idx_refunds_provider_reference
+ON refunds (provider_reference)
+WHERE provider_reference <> '';
+
+ALTER TABLE expert_earnings
+ADD COLUMN IF NOT EXISTS refunded_amount INT NOT NULL DEFAULT 0 CHECK (refunded_amount >= 0);
+
+INSERT INTO permissions (code)
+SELECT 'payments:refund'
+WHERE NOT EXISTS (SELECT 1 FROM permissions WHERE code = 'payments:refund');
@@ -0,0 +1,2 @@
+ALTER TABLE bookings
+DROP COLUMN IF EXISTS platform_fee;
@@ -0,0 +1,15 @@
+-- ==========================================================
+-- Migration: platform fee kept on each booking
+-- Description:
+--   - The fee depends on the booking's currency, so the amount
+--     charged is recorded with the booking; the expert earns
+--     amount_to_pay less this fee
+--   - Bookings made so far were charged a flat 1000
+-- ==========================================================
+
+ALTER TABLE bookings
+ADD COLUMN IF NOT EXISTS platform_fee INT NOT NULL DEFAULT 0 CHECK (platform_fee >= 0);
+
+UPDATE bookings
+SET platform_fee = LEAST(1000, amount_to_pay)
+WHERE COALESCE(amount_to_pay, 0) > 0;
@@ -0,0 +1,8 @@
+ALTER TABLE bookings
+DROP COLUMN IF EXISTS payment_state,
+DROP COLUMN IF EXISTS payment_charge_id,
+DROP COLUMN IF EXISTS payment_details,
+DROP COLUMN IF EXISTS payment_amount,
+DROP COLUMN IF EXISTS payment_url,
+DROP COLUMN IF EXISTS payment_reference,
+DROP COLUMN IF EXISTS payment_provider;
@@ -0,0 +1,52 @@
+-- ==========================================================
+-- Migration: gateway-neutral payment transaction on bookings
+-- Description:
+--   - The transaction a booking is paid with is recorded on
+--     the booking whatever the gateway, instead of in
+--     payunit_* tables written by the PayUnit provider
+--   - payment_details holds what the gateway needs later about
+--     the transaction, as it gave it
+--   - payment_state is the last state the gateway reported,
+--     compared by the reconciliation report
+--   - Transactions made so far are copied from the payunit_*
+--     tables, which are kept for their history
+-- ==========================================================
+
+ALTER TABLE bookings
+ADD COLUMN IF NOT EXISTS payment_provider TEXT,
+ADD COLUMN IF NOT EXISTS payment_reference TEXT,
+ADD COLUMN IF NOT EXISTS payment_url TEXT,
+ADD COLUMN IF NOT EXISTS payment_amount BIGINT,
+ADD COLUMN IF NOT EXISTS payment_details JSONB,
+ADD COLUMN IF NOT EXISTS payment_charge_id TEXT,
+ADD COLUMN IF NOT EXISTS payment_state TEXT;
+
+UPDATE bookings b
+SET payment_provider = 'payunit',
+    payment_reference = pti.payunit_t_id,
+    payment_url = pti.transaction_url,
+    payment_amount = CASE WHEN pti.payunit_t_sum ~ '^[0-9]+$' THEN pti.payunit_t_sum::BIGINT END,
+    payment_details = jsonb_build_object(
+        't_id', pti.payunit_t_id,
+        't_sum', pti.payunit_t_sum,
+        't_url', pti.payunit_t_url
+    )
+FROM payunit_transactions_init pti
+WHERE b.payunit_transactions_init_id = pti.id
+  AND b.payment_provider IS NULL;
+
+UPDATE bookings b
+SET payment_charge_id = pp.payunit_id
+FROM payunit_payments pp
+WHERE b.payunit_payment_id = pp.id
+  AND b.payment_charge_id IS NULL;
+
+UPDATE bookings b
+SET payment_state = pps.transaction_status
+FROM (
+    SELECT DISTINCT ON (transaction_id) transaction_id, transaction_status
+    FROM payunit_payment_status
+    ORDER BY transaction_id, updated_at DESC, id DESC
+) pps
+WHERE pps.transaction_id = b.transaction_id
+  AND b.payment_state IS NULL;
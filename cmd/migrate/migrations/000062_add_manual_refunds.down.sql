@@ -0,0 +1,12 @@
+DROP INDEX IF EXISTS idx_refunds_manual;
+
+UPDATE refunds
+SET status = 'pending', updated_at = NOW()
+WHERE status = 'manual';
+
+ALTER TABLE refunds
+DROP CONSTRAINT IF EXISTS refunds_status_check;
+
+ALTER TABLE refunds
+ADD CONSTRAINT refunds_status_check
+CHECK (status IN ('pending', 'processing', 'succeeded', 'failed'));
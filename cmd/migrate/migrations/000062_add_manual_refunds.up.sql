@@ -0,0 +1,18 @@
+-- ==========================================================
+-- Migration: refunds paid out by hand
+-- Description:
+--   - A gateway that cannot issue refunds leaves them
+--     'manual': staff pay them out outside the gateway and
+--     record the payout's reference, which settles them
+-- ==========================================================
+
+ALTER TABLE refunds
+DROP CONSTRAINT IF EXISTS refunds_status_check;
+
+ALTER TABLE refunds
+ADD CONSTRAINT refunds_status_check
+CHECK (status IN ('pending', 'processing', 'manual', 'succeeded', 'failed'));
+
+CREATE INDEX IF NOT EXISTS idx_refunds_manual
+ON refunds (created_at)
+WHERE status = 'manual';
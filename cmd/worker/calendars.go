@@ -0,0 +1,153 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"consult_app.cedrickewi/internal/caldav"
+	"consult_app.cedrickewi/internal/mtgschelduler"
+	"consult_app.cedrickewi/internal/store"
+	"github.com/hibiken/asynq"
+)
+
+// handleSyncCalendars syncs every connected calendar. A calendar that fails
+// is recorded on its connection and tried again on the next run.
+func (w *worker) handleSyncCalendars(ctx context.Context, t *asynq.Task) error {
+	if w.calendarKey == nil {
+		return nil
+	}
+
+	connections, err := w.store.CalendarSync.GetConnections(ctx)
+	if err != nil {
+		return err
+	}
+
+	for i := range connections {
+		if err := w.syncCalendar(ctx, &connections[i]); err != nil {
+			w.logger.Errorw("failed to sync calendar", "expert_id", connections[i].ExpertID, "error", err)
+		}
+	}
+
+	return nil
+}
+
+// handleSyncExpertCalendar syncs one expert's calendar
+func (w *worker) handleSyncExpertCalendar(ctx context.Context, t *asynq.Task) error {
+	var payload mtgschelduler.SyncCalendarPayload
+	if err := json.Unmarshal(t.Payload(), &payload); err != nil {
+		return fmt.Errorf("failed to unmarshal payload: %w", err)
+	}
+
+	if w.calendarKey == nil {
+		return nil
+	}
+
+	conn, err := w.store.CalendarSync.GetConnection(ctx, payload.ExpertID)
+	if err != nil {
+		if errors.Is(err, store.ErrRecordNotFound) {
+			return nil
+		}
+		return err
+	}
+
+	return w.syncCalendar(ctx, conn)
+}
+
+// syncCalendar imports the busy time of an expert's calendar as availability
+// exceptions, offering the time that freed up to the waitlist, then writes
+// the expert's confirmed bookings into it. The outcome is recorded on the
+// connection so the expert can see when the last sync ran and why it failed.
+func (w *worker) syncCalendar(ctx context.Context, conn *store.CalendarConnection) error {
+	err := w.syncCalendarOnce(ctx, conn)
+
+	syncErr := ""
+	if err != nil {
+		syncErr = err.Error()
+	}
+	if markErr := w.store.CalendarSync.MarkSynced(ctx, conn.ID, syncErr); markErr != nil && err == nil {
+		err = markErr
+	}
+
+	return err
+}
+
+func (w *worker) syncCalendarOnce(ctx context.Context, conn *store.CalendarConnection) error {
+	password, err := caldav.Open(w.calendarKey, conn.Password)
+	if err != nil {
+		return fmt.Errorf("cannot decrypt calendar password: %w", err)
+	}
+
+	client := caldav.New(conn.CalendarURL, conn.Username, password)
+
+	from := time.Now().UTC()
+	to := from.Add(store.CalendarSyncWindow)
+
+	busy, err := client.BusyBlocks(ctx, from, to, store.LoadLocation(conn.Timezone))
+	if err != nil {
+		return err
+	}
+
+	blocks := make([]store.TimeRange, 0, len(busy))
+	for _, b := range busy {
+		blocks = append(blocks, store.TimeRange{Start: b.Start, End: b.End})
+	}
+
+	freed, err := w.store.CalendarSync.ReplaceImported(ctx, conn.ExpertID, from, blocks)
+	if err != nil {
+		return err
+	}
+
+	for _, r := range freed {
+		if err := w.offerWaitlistSlots(ctx, conn.ExpertID, r.Start, r.End); err != nil {
+			w.logger.Errorw("failed to offer freed calendar time", "expert_id", conn.ExpertID, "error", err)
+		}
+	}
+
+	return w.pushBookings(ctx, client, conn)
+}
+
+// pushBookings writes the expert's new and changed bookings to their
+// calendar and deletes the events of the ones cancelled since
+func (w *worker) pushBookings(ctx context.Context, client *caldav.Client, conn *store.CalendarConnection) error {
+	pushes, err := w.store.CalendarSync.GetPendingPushes(ctx, conn.ExpertID)
+	if err != nil {
+		return err
+	}
+
+	for _, p := range pushes {
+		if p.Remove {
+			if err := client.DeleteEvent(ctx, p.Href.String); err != nil {
+				return err
+			}
+			if err := w.store.CalendarSync.DeletePush(ctx, p.BookingID); err != nil {
+				return err
+			}
+			continue
+		}
+
+		entry, err := w.store.Calendar.GetCalendarEntry(ctx, p.BookingID)
+		if err != nil {
+			if errors.Is(err, store.ErrRecordNotFound) {
+				continue
+			}
+			return err
+		}
+
+		href := p.Href.String
+		if !p.Href.Valid {
+			href = client.EventURL(fmt.Sprintf("booking-%d", p.BookingID))
+		}
+
+		if err := client.PutEvent(ctx, href, entry.Event(conn.ExpertUserID)); err != nil {
+			return err
+		}
+		if err := w.store.CalendarSync.SavePush(ctx, p.BookingID, conn.ID, href, entry.Sequence); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"consult_app.cedrickewi/internal/mailer"
+	"consult_app.cedrickewi/internal/mtgschelduler"
+	"consult_app.cedrickewi/internal/payment"
+	"consult_app.cedrickewi/internal/store"
+	"github.com/hibiken/asynq"
+	"go.uber.org/zap"
+)
+
+// worker holds the dependencies of the task handlers that need the database
+type worker struct {
+	store      store.Storage
+	payments   *payment.Service
+	scheduler  *mtgschelduler.MeetingScheduler
+	attendance store.AttendanceThresholds
+	// calendarKey decrypts external calendar passwords; calendars are not
+	// synced without it
+	calendarKey []byte
+	// reconcileAfter is how long a payment stays pending before the gateway
+	// is polled about it
+	reconcileAfter time.Duration
+	logger         *zap.SugaredLogger
+}
+
+// handleExpireBookingHold cancels a booking that is still unpaid when its hold
+// runs out, which frees the slot, and tells the client. A payment started but
+// not yet reported is checked with the gateway first so a late success is kept.
+func (w *worker) handleExpireBookingHold(ctx context.Context, t *asynq.Task) error {
+	var payload mtgschelduler.ExpireHoldPayload
+	if err := json.Unmarshal(t.Payload(), &payload); err != nil {
+		return fmt.Errorf("failed to unmarshal payload: %w", err)
+	}
+
+	booking, err := w.store.Booking.GetByID(ctx, payload.BookingID)
+	if err != nil {
+		if errors.Is(err, store.ErrRecordNotFound) {
+			return nil
+		}
+		return err
+	}
+
+	if store.BookingStatus(booking.BKStatus) != store.StatusAwaitingPayment || booking.PaymentStatus == store.PaymentSuccess {
+		return nil
+	}
+
+	// A series paid at once is paid through whichever occurrence started the payment
+	paidThrough := booking
+	if booking.SeriesID.Valid {
+		series, err := w.store.Series.GetByID(ctx, booking.SeriesID.Int64)
+		if err != nil {
+			return err
+		}
+		if series.SinglePayment {
+			for i := range series.Bookings {
+				if series.Bookings[i].TransactionID.Valid {
+					paidThrough = &series.Bookings[i]
+					break
+				}
+			}
+		}
+	}
+
+	if paidThrough.TransactionID.Valid {
+		result, err := w.payments.Sync(ctx, paidThrough.ID)
+		if err != nil {
+			return fmt.Errorf("failed to check payment of booking %d: %w", paidThrough.ID, err)
+		}
+		if result.State == payment.StateSuccess {
+			return nil
+		}
+	}
+
+	expired, err := w.store.Booking.ExpireHold(ctx, booking.ID)
+	if err != nil {
+		return err
+	}
+	if !expired {
+		return nil
+	}
+
+	w.logger.Infow("booking hold expired", "booking_id", booking.ID)
+
+	// The released slot goes to the expert's waitlist first
+	if start, end, err := booking.Times(); err == nil {
+		if err := w.offerWaitlistSlots(ctx, booking.ExpertID, start, end); err != nil {
+			w.logger.Errorw("failed to offer released slot to waitlist", "booking_id", booking.ID, "error", err)
+		}
+	}
+
+	details, err := w.store.Booking.GetBookingDetails(ctx, booking.ID)
+	if err != nil {
+		w.logger.Errorln(err)
+		return nil
+	}
+
+	data := map[string]any{
+		"name":       details.UserDetails.Name,
+		"expertName": details.Expert.Name,
+		"bookingID":  booking.ID,
+		"startTime":  details.Booking.StartTime,
+		"endTime":    details.Booking.EndTime,
+	}
+
+	if err := mailer.NewResend(details.UserDetails.Email, "booking_hold_expired.tmpl", data); err != nil {
+		w.logger.Errorln(err)
+	}
+
+	return nil
+}
+
+// handleExpireBookingRequest declines a booking request, with the rest of its
+// series, that the expert did not answer before its deadline, frees the slots
+// for the waitlist and tells the client.
+func (w *worker) handleExpireBookingRequest(ctx context.Context, t *asynq.Task) error {
+	var payload mtgschelduler.ExpireHoldPayload
+	if err := json.Unmarshal(t.Payload(), &payload); err != nil {
+		return fmt.Errorf("failed to unmarshal payload: %w", err)
+	}
+
+	declined, err := w.store.Booking.ExpireRequest(ctx, payload.BookingID)
+	if err != nil {
+		if errors.Is(err, store.ErrRecordNotFound) {
+			return nil
+		}
+		return err
+	}
+	if len(declined) == 0 {
+		return nil
+	}
+
+	w.logger.Infow("booking request expired", "booking_id", payload.BookingID, "bookings", len(declined))
+
+	for _, bk := range declined {
+		if start, end, err := bk.Times(); err == nil {
+			if err := w.offerWaitlistSlots(ctx, bk.ExpertID, start, end); err != nil {
+				w.logger.Errorw("failed to offer released slot to waitlist", "booking_id", bk.ID, "error", err)
+			}
+		}
+	}
+
+	details, err := w.store.Booking.GetBookingDetails(ctx, declined[0].ID)
+	if err != nil {
+		w.logger.Errorln(err)
+		return nil
+	}
+
+	data := map[string]any{
+		"name":       details.UserDetails.Name,
+		"expertName": details.Expert.Name,
+		"bookingID":  details.Booking.ID,
+		"startTime":  details.Booking.StartTime,
+		"endTime":    details.Booking.EndTime,
+		"expired":    true,
+	}
+
+	if err := mailer.NewResend(details.UserDetails.Email, "booking_declined.tmpl", data); err != nil {
+		w.logger.Errorln(err)
+	}
+
+	return nil
+}
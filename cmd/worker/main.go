@@ -5,17 +5,76 @@ import (
 	"encoding/json"
 	"log"
 	"os"
+	"time"
 
+	"consult_app.cedrickewi/internal/caldav"
+	"consult_app.cedrickewi/internal/db"
+	"consult_app.cedrickewi/internal/env"
 	"consult_app.cedrickewi/internal/mtgschelduler"
+	"consult_app.cedrickewi/internal/payment"
+	"consult_app.cedrickewi/internal/payunit"
+	"consult_app.cedrickewi/internal/store"
 	"consult_app.cedrickewi/internal/zoom"
 	"github.com/hibiken/asynq"
 	"go.uber.org/zap"
+
+	_ "github.com/lib/pq"
 )
 
 func main() {
 	logger, _ := zap.NewProduction()
 	logg := logger.Sugar()
 
+	db, err := db.New(
+		os.Getenv("DB_ADDR"),
+		env.GetInt("DB_MAX_OPEN_CONNS", 10),
+		env.GetInt("DB_MAX_IDLE_CONNS", 10),
+		env.GetString("DB_MAX_IDLE_TIME", "15m"),
+	)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer db.Close()
+
+	grace, err := time.ParseDuration(env.GetString("SESSION_GRACE_PERIOD", "15m"))
+	if err != nil {
+		log.Fatal(err)
+	}
+	minPresence, err := time.ParseDuration(env.GetString("SESSION_MIN_PRESENCE", "5m"))
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	var calendarKey []byte
+	if s := os.Getenv("CALDAV_SECRET_KEY"); s != "" {
+		if calendarKey, err = caldav.ParseKey(s); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	reconcileAfter, err := time.ParseDuration(env.GetString("RECONCILE_PAYMENTS_AFTER", "15m"))
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	payunitCfg, err := payunit.LoadConfig()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	storage := store.NewStorage(db)
+	w := &worker{
+		store:     storage,
+		payments:  payment.NewService(payunit.NewPayunit(payunitCfg), storage),
+		scheduler: mtgschelduler.NewMeetingScheduler(storage, os.Getenv("REDIS_ADDR"), logg),
+		attendance: store.AttendanceThresholds{
+			Grace:       grace,
+			MinPresence: minPresence,
+		},
+		calendarKey:    calendarKey,
+		reconcileAfter: reconcileAfter,
+		logger:         logg,
+	}
 
 	opt, err := asynq.ParseRedisURI(os.Getenv("REDIS_ADDR"))
 	if err != nil {
@@ -28,6 +87,7 @@ func main() {
 			Concurrency: 10,
 			Queues: map[string]int{
 				mtgschelduler.QueueMeetings: 10,
+				mtgschelduler.QueueBookings: 10,
 			},
 		},
 	)
@@ -41,6 +101,37 @@ func main() {
 		}
 		return zoom.EndZoomMeeting(payload.MeetingID)
 	})
+	mux.HandleFunc(mtgschelduler.TaskExpireBookingHold, w.handleExpireBookingHold)
+	mux.HandleFunc(mtgschelduler.TaskExpireBookingRequest, w.handleExpireBookingRequest)
+	mux.HandleFunc(mtgschelduler.TaskOfferWaitlistSlots, w.handleOfferWaitlistSlots)
+	mux.HandleFunc(mtgschelduler.TaskLapseWaitlistOffer, w.handleLapseWaitlistOffer)
+	mux.HandleFunc(mtgschelduler.TaskSettleSessions, w.handleSettleSessions)
+	mux.HandleFunc(mtgschelduler.TaskSyncCalendars, w.handleSyncCalendars)
+	mux.HandleFunc(mtgschelduler.TaskSyncExpertCalendar, w.handleSyncExpertCalendar)
+	mux.HandleFunc(mtgschelduler.TaskReconcilePayments, w.handleReconcilePayments)
+	mux.HandleFunc(mtgschelduler.TaskReportPayments, w.handleReportPayments)
+	mux.HandleFunc(mtgschelduler.TaskIssueRefunds, w.handleIssueRefunds)
+
+	scheduler := asynq.NewScheduler(opt, nil)
+	if _, err := scheduler.Register(mtgschelduler.SettleSessionsSpec, mtgschelduler.SettleSessionsTask()); err != nil {
+		log.Fatal(err)
+	}
+	if _, err := scheduler.Register(mtgschelduler.SyncCalendarsSpec, mtgschelduler.SyncCalendarsTask()); err != nil {
+		log.Fatal(err)
+	}
+	if _, err := scheduler.Register(mtgschelduler.ReconcilePaymentsSpec, mtgschelduler.ReconcilePaymentsTask()); err != nil {
+		log.Fatal(err)
+	}
+	if _, err := scheduler.Register(mtgschelduler.ReportPaymentsSpec, mtgschelduler.ReportPaymentsTask()); err != nil {
+		log.Fatal(err)
+	}
+	if _, err := scheduler.Register(mtgschelduler.IssueRefundsSpec, mtgschelduler.IssueRefundsTask()); err != nil {
+		log.Fatal(err)
+	}
+	if err := scheduler.Start(); err != nil {
+		log.Fatal(err)
+	}
+	defer scheduler.Shutdown()
 
 	logg.Info("Starting Asynq worker...")
 	if err := server.Run(mux); err != nil {
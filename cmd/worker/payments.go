@@ -0,0 +1,106 @@
+package main
+
+import (
+	"context"
+	"time"
+
+	"consult_app.cedrickewi/internal/payment"
+	"consult_app.cedrickewi/internal/store"
+	"github.com/hibiken/asynq"
+)
+
+// reconcileLookback is how far back payments left pending are polled; older
+// ones are left to the daily report
+const reconcileLookback = 7 * 24 * time.Hour
+
+// handleReconcilePayments polls the gateway about the payments still pending
+// reconcileAfter after they started, in case its notification never came,
+// and applies their state as the webhook would
+func (w *worker) handleReconcilePayments(ctx context.Context, t *asynq.Task) error {
+	now := time.Now()
+	ids, err := w.store.Reconciliation.GetPendingPayments(ctx, now.Add(-reconcileLookback), now.Add(-w.reconcileAfter))
+	if err != nil {
+		return err
+	}
+
+	for _, id := range ids {
+		status, err := w.payments.Sync(ctx, id)
+		if err != nil {
+			w.logger.Errorw("failed to reconcile payment", "booking_id", id, "error", err)
+			continue
+		}
+		if status.State != payment.StatePending {
+			w.logger.Infow("payment reconciled", "booking_id", id, "transaction_id", status.TransactionID, "state", status.State)
+		}
+	}
+
+	return nil
+}
+
+// refundBatchSize is how many refunds are worked through per run
+const refundBatchSize = 100
+
+// handleIssueRefunds sends the refunds waiting to the gateway and asks it
+// about those still in processing
+func (w *worker) handleIssueRefunds(ctx context.Context, t *asynq.Task) error {
+	refunds, err := w.store.Refund.GetDue(ctx, refundBatchSize)
+	if err != nil {
+		return err
+	}
+
+	for i := range refunds {
+		r := &refunds[i]
+		if err := w.payments.IssueRefund(ctx, r); err != nil {
+			w.logger.Errorw("failed to issue refund", "refund_id", r.ID, "booking_id", r.BookingID, "error", err)
+		}
+	}
+
+	return nil
+}
+
+// handleReportPayments compares the transactions started the day before
+// with what the gateway says about them, and stores the disagreements as the
+// day's reconciliation report
+func (w *worker) handleReportPayments(ctx context.Context, t *asynq.Task) error {
+	day := time.Now().UTC().Truncate(24 * time.Hour).Add(-24 * time.Hour)
+
+	records, err := w.store.Reconciliation.GetPaymentRecords(ctx, day, day.Add(24*time.Hour))
+	if err != nil {
+		return err
+	}
+
+	provider := w.payments.Provider()
+	report := store.ReconciliationReport{
+		Date:     day,
+		Provider: provider.Name(),
+		Checked:  len(records),
+	}
+
+	for i := range records {
+		r := &records[i]
+		status, err := provider.Status(ctx, r.TransactionID)
+		if err != nil {
+			report.Mismatches = append(report.Mismatches, store.PaymentMismatch{
+				BookingID:     r.BookingID,
+				TransactionID: r.TransactionID,
+				Kind:          payment.MismatchGateway,
+				GatewayValue:  err.Error(),
+				RecordedValue: r.PaymentStatus,
+			})
+			continue
+		}
+		report.Mismatches = append(report.Mismatches, payment.Compare(r, status)...)
+	}
+
+	if err := w.store.Reconciliation.SaveReport(ctx, &report); err != nil {
+		return err
+	}
+
+	if len(report.Mismatches) > 0 {
+		w.logger.Warnw("payment reconciliation found mismatches", "date", day.Format(time.DateOnly), "checked", report.Checked, "mismatches", len(report.Mismatches), "report_id", report.ID)
+	} else {
+		w.logger.Infow("payment reconciliation clean", "date", day.Format(time.DateOnly), "checked", report.Checked)
+	}
+
+	return nil
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"context"
+	"errors"
+
+	"consult_app.cedrickewi/internal/mailer"
+	"consult_app.cedrickewi/internal/store"
+	"github.com/hibiken/asynq"
+)
+
+// settleBatchSize caps how many sessions one run settles
+const settleBatchSize = 100
+
+// handleSettleSessions settles the sessions that ended more than the grace
+// period ago. A session that fails is logged and retried on the next run.
+func (w *worker) handleSettleSessions(ctx context.Context, t *asynq.Task) error {
+	ids, err := w.store.Attendance.GetDue(ctx, w.attendance.Grace, settleBatchSize)
+	if err != nil {
+		return err
+	}
+
+	for _, id := range ids {
+		if err := w.settleSession(ctx, id); err != nil {
+			w.logger.Errorw("failed to settle session", "booking_id", id, "error", err)
+		}
+	}
+
+	return nil
+}
+
+// settleSession decides the outcome of a booking's session from the Zoom
+// attendance. A booking the expert already closed keeps its status, and the
+// outcome follows it.
+func (w *worker) settleSession(ctx context.Context, bookingID int64) error {
+	booking, err := w.store.Booking.GetByID(ctx, bookingID)
+	if err != nil {
+		if errors.Is(err, store.ErrRecordNotFound) {
+			return nil
+		}
+		return err
+	}
+
+	attendance, err := w.store.Attendance.Measure(ctx, booking.ID)
+	if err != nil {
+		return err
+	}
+
+	switch store.BookingStatus(booking.BKStatus) {
+	case store.StatusCompleted:
+		attendance.Outcome = store.OutcomeCompleted
+	case store.StatusNoShow:
+		attendance.Outcome = store.OutcomeNoShowClient
+	default:
+		attendance.Decide(w.attendance)
+	}
+
+	settled, err := w.store.Attendance.Settle(ctx, booking, attendance)
+	if err != nil || !settled {
+		return err
+	}
+
+	w.logger.Infow("session settled", "booking_id", booking.ID, "outcome", attendance.Outcome,
+		"client_seconds", attendance.ClientSeconds, "expert_seconds", attendance.ExpertSeconds)
+
+	if attendance.Outcome != store.OutcomeCompleted {
+		w.notifyNoShow(ctx, booking, attendance.Outcome)
+	}
+
+	return nil
+}
+
+// notifyNoShow tells the client and the expert that a session was missed and
+// what happens to the payment
+func (w *worker) notifyNoShow(ctx context.Context, booking *store.Booking, outcome string) {
+	details, err := w.store.Booking.GetBookingDetails(ctx, booking.ID)
+	if err != nil {
+		w.logger.Errorln(err)
+		return
+	}
+
+	paid := booking.PaymentStatus == store.PaymentSuccess
+	recipients := []struct {
+		user store.User
+		role store.Actor
+	}{
+		{details.UserDetails, store.ActorUser},
+		{details.Expert, store.ActorExpert},
+	}
+
+	for _, recipient := range recipients {
+		data := map[string]any{
+			"name":       recipient.user.Name,
+			"clientName": details.UserDetails.Name,
+			"expertName": details.Expert.Name,
+			"bookingID":  booking.ID,
+			"startTime":  details.Booking.StartTime,
+			"isExpert":   recipient.role == store.ActorExpert,
+			"expertMiss": outcome == store.OutcomeNoShowExpert,
+			"paid":       paid,
+		}
+
+		if err := mailer.NewResend(recipient.user.Email, "session_no_show.tmpl", data); err != nil {
+			w.logger.Errorln(err)
+		}
+	}
+}
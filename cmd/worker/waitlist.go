@@ -0,0 +1,229 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"consult_app.cedrickewi/internal/mailer"
+	"consult_app.cedrickewi/internal/mtgschelduler"
+	"consult_app.cedrickewi/internal/slots"
+	"consult_app.cedrickewi/internal/store"
+	"github.com/hibiken/asynq"
+)
+
+// waitlistSlotStep spaces the candidate start times of offered slots so a
+// freed booking that does not start on the hour can still be offered
+const waitlistSlotStep = 15 * time.Minute
+
+// handleOfferWaitlistSlots offers the free slots of an expert in the range of
+// the task to the clients on their waitlist
+func (w *worker) handleOfferWaitlistSlots(ctx context.Context, t *asynq.Task) error {
+	var payload mtgschelduler.WaitlistSlotsPayload
+	if err := json.Unmarshal(t.Payload(), &payload); err != nil {
+		return fmt.Errorf("failed to unmarshal payload: %w", err)
+	}
+
+	return w.offerWaitlistSlots(ctx, payload.ExpertID, payload.From, payload.To)
+}
+
+// handleLapseWaitlistOffer passes an offer nobody claimed in time on to the
+// next matching client
+func (w *worker) handleLapseWaitlistOffer(ctx context.Context, t *asynq.Task) error {
+	var payload mtgschelduler.LapseOfferPayload
+	if err := json.Unmarshal(t.Payload(), &payload); err != nil {
+		return fmt.Errorf("failed to unmarshal payload: %w", err)
+	}
+
+	offer, lapsed, err := w.store.Waitlist.Lapse(ctx, payload.OfferID)
+	if err != nil {
+		return err
+	}
+	if !lapsed {
+		return nil
+	}
+
+	w.logger.Infow("waitlist offer lapsed", "offer_id", offer.ID, "expert_id", offer.ExpertID)
+
+	return w.offerWaitlistSlots(ctx, offer.ExpertID, offer.StartTime, offer.EndTime)
+}
+
+// offerWaitlistSlots walks the expert's waitlist in the order clients joined
+// and holds the first free slot between from and to matching each client's
+// preferences for them, for store.WaitlistClaimWindow.
+func (w *worker) offerWaitlistSlots(ctx context.Context, expertID int64, from, to time.Time) error {
+	if err := w.store.Waitlist.LapseExpired(ctx, expertID); err != nil {
+		return err
+	}
+
+	entries, err := w.store.Waitlist.GetWaiting(ctx, expertID)
+	if err != nil {
+		return err
+	}
+	if len(entries) == 0 {
+		return nil
+	}
+
+	expert, err := w.store.Expert.GetExpertByID(ctx, expertID)
+	if err != nil {
+		if errors.Is(err, store.ErrRecordNotFound) {
+			return nil
+		}
+		return err
+	}
+	if expert.OnboardingStatus != store.OnboardingActive {
+		return nil
+	}
+
+	rules, err := w.store.Expert.GetSchedulingRules(ctx, expertID)
+	if err != nil {
+		return err
+	}
+
+	// Only slots the expert's rules let a client book are offered
+	now := time.Now()
+	if earliest := now.Add(rules.MinNotice()); from.Before(earliest) {
+		from = earliest
+	}
+	if latest := now.Add(rules.Horizon()); to.After(latest) {
+		to = latest
+	}
+	if !from.Before(to) {
+		return nil
+	}
+
+	params, err := w.slotParams(ctx, expert, rules, from, to)
+	if err != nil {
+		return err
+	}
+
+	free := make(map[int][]slots.Slot)
+	var held []slots.Range
+	for i := range entries {
+		entry := &entries[i]
+		if !rules.AllowsDuration(int64(entry.DurationMinutes)) {
+			continue
+		}
+
+		if _, ok := free[entry.DurationMinutes]; !ok {
+			p := params
+			p.Now = now
+			p.Duration = time.Duration(entry.DurationMinutes) * time.Minute
+			p.Step = waitlistSlotStep
+			free[entry.DurationMinutes] = slots.Generate(p)
+		}
+
+		for _, slot := range free[entry.DurationMinutes] {
+			if !entry.Matches(slot.StartTime, slot.EndTime) || overlapsAny(slot, held) {
+				continue
+			}
+
+			offer := store.WaitlistOffer{
+				EntryID:   entry.ID,
+				UserID:    entry.UserID,
+				StartTime: slot.StartTime,
+				EndTime:   slot.EndTime,
+				ExpiresAt: time.Now().Add(store.WaitlistClaimWindow).UTC(),
+			}
+
+			offered, err := w.store.Waitlist.Offer(ctx, &offer)
+			if err != nil {
+				return err
+			}
+			if !offered {
+				continue
+			}
+
+			held = append(held, slots.Range{Start: slot.StartTime, End: slot.EndTime})
+
+			if _, err := w.scheduler.ScheduleLapseOffer(ctx, offer.ID, offer.ExpiresAt); err != nil {
+				w.logger.Errorw("failed to schedule waitlist offer lapse", "offer_id", offer.ID, "error", err)
+			}
+
+			w.notifyWaitlistOffer(ctx, entry, expert, &offer)
+			break
+		}
+	}
+
+	return nil
+}
+
+// slotParams gathers the expert's availability, sessions, exceptions and the
+// slots already held for waitlisted clients between from and to
+func (w *worker) slotParams(ctx context.Context, expert *store.Expert, rules *store.SchedulingRules, from, to time.Time) (slots.Params, error) {
+	params := slots.Params{
+		From:         from,
+		To:           to,
+		BufferBefore: rules.BufferBefore(),
+		BufferAfter:  rules.BufferAfter(),
+		MaxPerDay:    rules.MaxSessionsPerDay,
+		Location:     store.LoadLocation(expert.Timezone),
+	}
+
+	availability, err := w.store.Expert.GetExpertAvailability(ctx, expert.ID)
+	if err != nil {
+		return params, err
+	}
+	for _, a := range *availability {
+		params.Weekly = append(params.Weekly, slots.Window{Day: a.Day, Start: a.StartTime, End: a.EndTime})
+	}
+
+	busy, err := w.store.Booking.GetExpertBusyRanges(ctx, expert.ID, from.Add(-24*time.Hour), to.Add(24*time.Hour))
+	if err != nil {
+		return params, err
+	}
+	for _, b := range busy {
+		params.Busy = append(params.Busy, slots.Range{Start: b.Start, End: b.End})
+	}
+
+	exceptions, err := w.store.Expert.GetAvailabilityExceptions(ctx, expert.ID, from, to)
+	if err != nil {
+		return params, err
+	}
+	for _, e := range exceptions {
+		params.Blocked = append(params.Blocked, slots.Range{Start: e.StartTime, End: e.EndTime})
+	}
+
+	offers, err := w.store.Waitlist.GetLiveOffers(ctx, expert.ID, from, to)
+	if err != nil {
+		return params, err
+	}
+	for _, o := range offers {
+		params.Blocked = append(params.Blocked, slots.Range{Start: o.StartTime, End: o.EndTime})
+	}
+
+	return params, nil
+}
+
+func overlapsAny(slot slots.Slot, ranges []slots.Range) bool {
+	for _, r := range ranges {
+		if slot.StartTime.Before(r.End) && r.Start.Before(slot.EndTime) {
+			return true
+		}
+	}
+	return false
+}
+
+// notifyWaitlistOffer emails a client the slot held for them, in their timezone
+func (w *worker) notifyWaitlistOffer(ctx context.Context, entry *store.WaitlistEntry, expert *store.Expert, offer *store.WaitlistOffer) {
+	user, err := w.store.User.GetByID(ctx, entry.UserID)
+	if err != nil {
+		w.logger.Errorln(err)
+		return
+	}
+
+	loc := store.LoadLocation(entry.Timezone)
+	data := map[string]any{
+		"name":       user.Name,
+		"expertName": expert.Name,
+		"startTime":  offer.StartTime.In(loc).Format(time.RFC1123),
+		"endTime":    offer.EndTime.In(loc).Format(time.RFC1123),
+		"expiresAt":  offer.ExpiresAt.In(loc).Format(time.RFC1123),
+	}
+
+	if err := mailer.NewResend(user.Email, "waitlist_offer.tmpl", data); err != nil {
+		w.logger.Errorln(err)
+	}
+}
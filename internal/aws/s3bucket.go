@@ -6,6 +6,7 @@ import (
 	"log"
 	"mime/multipart"
 	"os"
+	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/config"
@@ -61,3 +62,62 @@ func UploadToS3(file multipart.File, key string, contentType string) (string, er
 
 	return result.Location, nil
 }
+
+// newS3Bucket loads the bucket settings and an S3 client from the environment
+func newS3Bucket(ctx context.Context) (*S3Bucket, error) {
+	s3Bucket := S3Bucket{
+		BucketName: os.Getenv("AWS_S3_BUCKET"),
+		Region:     os.Getenv("AWS_REGION"),
+	}
+
+	if s3Bucket.BucketName == "" || s3Bucket.Region == "" {
+		return nil, fmt.Errorf("aws s3 bucket and region must be provided")
+	}
+
+	cfg, err := config.LoadDefaultConfig(ctx, config.WithRegion(s3Bucket.Region))
+	if err != nil {
+		return nil, fmt.Errorf("failed to load aws config: %v", err)
+	}
+
+	s3Bucket.S3Client = s3.NewFromConfig(cfg)
+	return &s3Bucket, nil
+}
+
+// PresignDownload returns a URL that downloads a private object as filename
+// until it expires
+func PresignDownload(ctx context.Context, key, filename string, expires time.Duration) (string, error) {
+	s3Bucket, err := newS3Bucket(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	presigner := s3.NewPresignClient(s3Bucket.S3Client)
+	req, err := presigner.PresignGetObject(ctx, &s3.GetObjectInput{
+		Bucket:                     aws.String(s3Bucket.BucketName),
+		Key:                        aws.String(key),
+		ResponseContentDisposition: aws.String(fmt.Sprintf("attachment; filename=%q", filename)),
+	}, s3.WithPresignExpires(expires))
+	if err != nil {
+		return "", fmt.Errorf("failed to presign s3 download %v", err)
+	}
+
+	return req.URL, nil
+}
+
+// DeleteFromS3 removes an object from the bucket
+func DeleteFromS3(ctx context.Context, key string) error {
+	s3Bucket, err := newS3Bucket(ctx)
+	if err != nil {
+		return err
+	}
+
+	_, err = s3Bucket.S3Client.DeleteObject(ctx, &s3.DeleteObjectInput{
+		Bucket: aws.String(s3Bucket.BucketName),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to delete s3 object %v", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,229 @@
+// Package caldav talks to an external CalDAV calendar (RFC 4791): it reads
+// the busy time of a calendar and writes events into it.
+package caldav
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"consult_app.cedrickewi/internal/ical"
+)
+
+var (
+	// ErrUnauthorized is returned when the server rejects the credentials
+	ErrUnauthorized = errors.New("caldav: credentials rejected")
+	// ErrNotCalendar is returned when the URL is not a calendar collection
+	ErrNotCalendar = errors.New("caldav: not a calendar")
+)
+
+// maxResponseBytes bounds how much of a response is read
+const maxResponseBytes = 10 << 20
+
+// Client reads and writes one calendar collection
+type Client struct {
+	calendarURL string
+	username    string
+	password    string
+	http        *http.Client
+}
+
+// New returns a client for the calendar collection at calendarURL
+func New(calendarURL, username, password string) *Client {
+	return &Client{
+		calendarURL: strings.TrimSuffix(calendarURL, "/") + "/",
+		username:    username,
+		password:    password,
+		http:        &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+// StatusError is an unexpected response from the server
+type StatusError struct {
+	Method string
+	Status int
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("caldav: %s returned %d %s", e.Method, e.Status, http.StatusText(e.Status))
+}
+
+func (c *Client) do(ctx context.Context, method, target string, header http.Header, body []byte) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, target, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	req.SetBasicAuth(c.username, c.password)
+
+	res, err := c.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if res.StatusCode == http.StatusUnauthorized || res.StatusCode == http.StatusForbidden {
+		res.Body.Close()
+		return nil, ErrUnauthorized
+	}
+
+	return res, nil
+}
+
+type multistatus struct {
+	Responses []struct {
+		Href      string `xml:"DAV: href"`
+		Propstats []struct {
+			Status string `xml:"DAV: status"`
+			Prop   struct {
+				ResourceType struct {
+					Calendar *struct{} `xml:"urn:ietf:params:xml:ns:caldav calendar"`
+				} `xml:"DAV: resourcetype"`
+				CalendarData string `xml:"urn:ietf:params:xml:ns:caldav calendar-data"`
+			} `xml:"DAV: prop"`
+		} `xml:"DAV: propstat"`
+	} `xml:"DAV: response"`
+}
+
+func (c *Client) multistatus(ctx context.Context, method, depth, body string) (*multistatus, error) {
+	header := http.Header{}
+	header.Set("Content-Type", "application/xml; charset=utf-8")
+	header.Set("Depth", depth)
+
+	res, err := c.do(ctx, method, c.calendarURL, header, []byte(body))
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusMultiStatus {
+		return nil, &StatusError{Method: method, Status: res.StatusCode}
+	}
+
+	var ms multistatus
+	if err := xml.NewDecoder(io.LimitReader(res.Body, maxResponseBytes)).Decode(&ms); err != nil {
+		return nil, fmt.Errorf("caldav: decoding %s response: %w", method, err)
+	}
+
+	return &ms, nil
+}
+
+// Check verifies that the credentials are accepted and that the URL is a
+// calendar collection
+func (c *Client) Check(ctx context.Context) error {
+	ms, err := c.multistatus(ctx, "PROPFIND", "0", `<?xml version="1.0" encoding="utf-8"?>
+<D:propfind xmlns:D="DAV:"><D:prop><D:resourcetype/></D:prop></D:propfind>`)
+	if err != nil {
+		return err
+	}
+
+	for _, r := range ms.Responses {
+		for _, ps := range r.Propstats {
+			if ps.Prop.ResourceType.Calendar != nil {
+				return nil
+			}
+		}
+	}
+
+	return ErrNotCalendar
+}
+
+// BusyBlocks returns the time taken by the events of the calendar that
+// overlap [from, to). Recurring events are expanded by the server. Free
+// (transparent) and cancelled events are left out, as are the events this
+// application wrote itself. Floating and all-day times are read in loc.
+func (c *Client) BusyBlocks(ctx context.Context, from, to time.Time, loc *time.Location) ([]Busy, error) {
+	start, end := from.UTC().Format(timeLayout), to.UTC().Format(timeLayout)
+
+	ms, err := c.multistatus(ctx, "REPORT", "1", fmt.Sprintf(`<?xml version="1.0" encoding="utf-8"?>
+<C:calendar-query xmlns:D="DAV:" xmlns:C="urn:ietf:params:xml:ns:caldav">
+  <D:prop>
+    <C:calendar-data><C:expand start="%[1]s" end="%[2]s"/></C:calendar-data>
+  </D:prop>
+  <C:filter>
+    <C:comp-filter name="VCALENDAR">
+      <C:comp-filter name="VEVENT"><C:time-range start="%[1]s" end="%[2]s"/></C:comp-filter>
+    </C:comp-filter>
+  </C:filter>
+</C:calendar-query>`, start, end))
+	if err != nil {
+		return nil, err
+	}
+
+	blocks := []Busy{}
+	for _, r := range ms.Responses {
+		for _, ps := range r.Propstats {
+			if ps.Prop.CalendarData == "" {
+				continue
+			}
+			for _, b := range parseBusy(ps.Prop.CalendarData, loc) {
+				// clip to the window; the server returns whole events
+				if b.Start.Before(from) {
+					b.Start = from
+				}
+				if b.End.After(to) {
+					b.End = to
+				}
+				if b.Start.Before(b.End) {
+					blocks = append(blocks, b)
+				}
+			}
+		}
+	}
+
+	return blocks, nil
+}
+
+// EventURL is where the event with the given name is stored in the calendar
+func (c *Client) EventURL(name string) string {
+	return c.calendarURL + url.PathEscape(name) + ".ics"
+}
+
+// PutEvent creates or replaces the event stored at href
+func (c *Client) PutEvent(ctx context.Context, href string, event ical.Event) error {
+	var buf bytes.Buffer
+	cal := ical.Calendar{Events: []ical.Event{event}}
+	if err := cal.Encode(&buf); err != nil {
+		return err
+	}
+
+	header := http.Header{}
+	header.Set("Content-Type", "text/calendar; charset=utf-8")
+
+	res, err := c.do(ctx, http.MethodPut, href, header, buf.Bytes())
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	switch res.StatusCode {
+	case http.StatusOK, http.StatusCreated, http.StatusNoContent:
+		return nil
+	default:
+		return &StatusError{Method: http.MethodPut, Status: res.StatusCode}
+	}
+}
+
+// DeleteEvent removes the event stored at href. An event already gone is not an error.
+func (c *Client) DeleteEvent(ctx context.Context, href string) error {
+	res, err := c.do(ctx, http.MethodDelete, href, nil, nil)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	switch res.StatusCode {
+	case http.StatusOK, http.StatusNoContent, http.StatusNotFound, http.StatusGone:
+		return nil
+	default:
+		return &StatusError{Method: http.MethodDelete, Status: res.StatusCode}
+	}
+}
@@ -0,0 +1,318 @@
+package caldav
+
+import (
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"consult_app.cedrickewi/internal/ical"
+)
+
+// standIn is a minimal CalDAV server holding one calendar at /cal/. It
+// answers REPORT with every stored object, leaving the time-range filtering
+// to the client, as servers that ignore <C:expand> do.
+type standIn struct {
+	mu      sync.Mutex
+	objects map[string]string
+	reports []string
+}
+
+func newStandIn(t *testing.T) (*standIn, *httptest.Server) {
+	s := &standIn{objects: map[string]string{}}
+	srv := httptest.NewServer(s)
+	t.Cleanup(srv.Close)
+	return s, srv
+}
+
+func (s *standIn) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if user, pass, ok := r.BasicAuth(); !ok || user != "expert" || pass != "secret" {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	body, _ := io.ReadAll(r.Body)
+
+	switch {
+	case r.Method == "PROPFIND" && r.URL.Path == "/cal/":
+		w.WriteHeader(http.StatusMultiStatus)
+		fmt.Fprint(w, `<?xml version="1.0"?>
+<d:multistatus xmlns:d="DAV:" xmlns:cal="urn:ietf:params:xml:ns:caldav">
+  <d:response><d:href>/cal/</d:href><d:propstat>
+    <d:prop><d:resourcetype><d:collection/><cal:calendar/></d:resourcetype></d:prop>
+    <d:status>HTTP/1.1 200 OK</d:status>
+  </d:propstat></d:response>
+</d:multistatus>`)
+	case r.Method == "PROPFIND":
+		w.WriteHeader(http.StatusMultiStatus)
+		fmt.Fprintf(w, `<?xml version="1.0"?>
+<d:multistatus xmlns:d="DAV:"><d:response><d:href>%s</d:href><d:propstat>
+  <d:prop><d:resourcetype><d:collection/></d:resourcetype></d:prop>
+  <d:status>HTTP/1.1 200 OK</d:status>
+</d:propstat></d:response></d:multistatus>`, r.URL.Path)
+	case r.Method == "REPORT":
+		s.reports = append(s.reports, string(body))
+		w.WriteHeader(http.StatusMultiStatus)
+		fmt.Fprint(w, `<?xml version="1.0"?><d:multistatus xmlns:d="DAV:" xmlns:cal="urn:ietf:params:xml:ns:caldav">`)
+		for href, data := range s.objects {
+			fmt.Fprintf(w, `<d:response><d:href>%s</d:href><d:propstat><d:prop><cal:calendar-data>`, href)
+			xml.EscapeText(w, []byte(data))
+			fmt.Fprint(w, `</cal:calendar-data></d:prop><d:status>HTTP/1.1 200 OK</d:status></d:propstat></d:response>`)
+		}
+		fmt.Fprint(w, `</d:multistatus>`)
+	case r.Method == http.MethodPut:
+		_, exists := s.objects[r.URL.Path]
+		s.objects[r.URL.Path] = string(body)
+		if exists {
+			w.WriteHeader(http.StatusNoContent)
+		} else {
+			w.WriteHeader(http.StatusCreated)
+		}
+	case r.Method == http.MethodDelete:
+		if _, ok := s.objects[r.URL.Path]; !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		delete(s.objects, r.URL.Path)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func (s *standIn) put(href string, lines ...string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.objects[href] = strings.Join(append(append([]string{"BEGIN:VCALENDAR", "VERSION:2.0"}, lines...), "END:VCALENDAR"), "\r\n")
+}
+
+func TestCheck(t *testing.T) {
+	_, srv := newStandIn(t)
+	ctx := context.Background()
+
+	if err := New(srv.URL+"/cal", "expert", "secret").Check(ctx); err != nil {
+		t.Fatalf("Check() = %v, want nil", err)
+	}
+	if err := New(srv.URL+"/cal/", "expert", "wrong").Check(ctx); !errors.Is(err, ErrUnauthorized) {
+		t.Fatalf("Check() with a wrong password = %v, want ErrUnauthorized", err)
+	}
+	if err := New(srv.URL+"/other/", "expert", "secret").Check(ctx); !errors.Is(err, ErrNotCalendar) {
+		t.Fatalf("Check() on a plain collection = %v, want ErrNotCalendar", err)
+	}
+}
+
+func TestBusyBlocks(t *testing.T) {
+	s, srv := newStandIn(t)
+	douala, err := time.LoadLocation("Africa/Douala")
+	if err != nil {
+		t.Skip("no timezone database")
+	}
+
+	s.put("/cal/meeting.ics",
+		"BEGIN:VEVENT",
+		"UID:meeting",
+		"DTSTART:20300105T090000Z",
+		"DTEND:20300105T100000Z",
+		"BEGIN:VALARM",
+		"TRIGGER:-PT15M",
+		"DTSTART:20000101T000000Z",
+		"END:VALARM",
+		"END:VEVENT",
+	)
+	s.put("/cal/lunch.ics",
+		"BEGIN:VEVENT",
+		"UID:lunch",
+		`DTSTART;TZID="Europe/Paris":20300105T120000`,
+		"DURATION:PT1H30M",
+		"END:VEVENT",
+	)
+	s.put("/cal/holiday.ics",
+		"BEGIN:VEVENT",
+		"UID:holi",
+		" day",
+		"DTSTART;VALUE=DATE:20300107",
+		"END:VEVENT",
+	)
+	s.put("/cal/free.ics",
+		"BEGIN:VEVENT",
+		"UID:free",
+		"DTSTART:20300105T130000Z",
+		"DTEND:20300105T140000Z",
+		"TRANSP:TRANSPARENT",
+		"END:VEVENT",
+	)
+	s.put("/cal/cancelled.ics",
+		"BEGIN:VEVENT",
+		"UID:cancelled",
+		"DTSTART:20300105T150000Z",
+		"DTEND:20300105T160000Z",
+		"STATUS:CANCELLED",
+		"END:VEVENT",
+	)
+	s.put("/cal/booking-1.ics",
+		"BEGIN:VEVENT",
+		"UID:booking-1@"+ical.UIDDomain,
+		"DTSTART:20300105T170000Z",
+		"DTEND:20300105T180000Z",
+		"END:VEVENT",
+	)
+	s.put("/cal/late.ics",
+		"BEGIN:VEVENT",
+		"UID:late",
+		"DTSTART:20300109T230000Z",
+		"DTEND:20300110T020000Z",
+		"END:VEVENT",
+	)
+
+	from := time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC)
+	to := time.Date(2030, 1, 10, 0, 0, 0, 0, time.UTC)
+
+	blocks, err := New(srv.URL+"/cal/", "expert", "secret").BusyBlocks(context.Background(), from, to, douala)
+	if err != nil {
+		t.Fatalf("BusyBlocks() = %v", err)
+	}
+
+	want := map[string][2]time.Time{
+		"meeting": {time.Date(2030, 1, 5, 9, 0, 0, 0, time.UTC), time.Date(2030, 1, 5, 10, 0, 0, 0, time.UTC)},
+		"lunch":   {time.Date(2030, 1, 5, 11, 0, 0, 0, time.UTC), time.Date(2030, 1, 5, 12, 30, 0, 0, time.UTC)},
+		"holiday": {time.Date(2030, 1, 7, 0, 0, 0, 0, douala), time.Date(2030, 1, 8, 0, 0, 0, 0, douala)},
+		"late":    {time.Date(2030, 1, 9, 23, 0, 0, 0, time.UTC), to},
+	}
+
+	if len(blocks) != len(want) {
+		t.Fatalf("BusyBlocks() returned %d blocks, want %d: %+v", len(blocks), len(want), blocks)
+	}
+	for _, b := range blocks {
+		w, ok := want[b.UID]
+		if !ok {
+			t.Errorf("unexpected block %q", b.UID)
+			continue
+		}
+		if !b.Start.Equal(w[0]) || !b.End.Equal(w[1]) {
+			t.Errorf("block %q = [%v, %v), want [%v, %v)", b.UID, b.Start, b.End, w[0], w[1])
+		}
+	}
+
+	if len(s.reports) != 1 || !strings.Contains(s.reports[0], `<C:time-range start="20300101T000000Z" end="20300110T000000Z"/>`) {
+		t.Errorf("REPORT did not ask for the window: %v", s.reports)
+	}
+}
+
+func TestPutAndDeleteEvent(t *testing.T) {
+	s, srv := newStandIn(t)
+	c := New(srv.URL+"/cal", "expert", "secret")
+	ctx := context.Background()
+
+	href := c.EventURL("booking-7")
+	if want := srv.URL + "/cal/booking-7.ics"; href != want {
+		t.Fatalf("EventURL() = %q, want %q", href, want)
+	}
+
+	event := ical.Event{
+		UID:     "booking-7@" + ical.UIDDomain,
+		Start:   time.Date(2030, 1, 5, 9, 0, 0, 0, time.UTC),
+		End:     time.Date(2030, 1, 5, 10, 0, 0, 0, time.UTC),
+		Summary: "Session with Ada",
+	}
+	if err := c.PutEvent(ctx, href, event); err != nil {
+		t.Fatalf("PutEvent() = %v", err)
+	}
+
+	event.Sequence = 1
+	if err := c.PutEvent(ctx, href, event); err != nil {
+		t.Fatalf("PutEvent() replacing the event = %v", err)
+	}
+
+	stored := s.objects["/cal/booking-7.ics"]
+	for _, line := range []string{"UID:booking-7@" + ical.UIDDomain, "SEQUENCE:1", "DTSTART:20300105T090000Z"} {
+		if !strings.Contains(stored, line+"\r\n") {
+			t.Errorf("stored event lacks %q:\n%s", line, stored)
+		}
+	}
+	if strings.Contains(stored, "METHOD:") {
+		t.Errorf("stored event must not have a METHOD:\n%s", stored)
+	}
+
+	// the event written is not read back as busy time
+	blocks, err := c.BusyBlocks(ctx, event.Start.Add(-time.Hour), event.End.Add(time.Hour), time.UTC)
+	if err != nil {
+		t.Fatalf("BusyBlocks() = %v", err)
+	}
+	if len(blocks) != 0 {
+		t.Errorf("BusyBlocks() = %+v, want none", blocks)
+	}
+
+	if err := c.DeleteEvent(ctx, href); err != nil {
+		t.Fatalf("DeleteEvent() = %v", err)
+	}
+	if _, ok := s.objects["/cal/booking-7.ics"]; ok {
+		t.Error("event still stored after DeleteEvent()")
+	}
+	if err := c.DeleteEvent(ctx, href); err != nil {
+		t.Errorf("DeleteEvent() of a missing event = %v, want nil", err)
+	}
+}
+
+func TestParseDuration(t *testing.T) {
+	tests := []struct {
+		in   string
+		want time.Duration
+		ok   bool
+	}{
+		{"PT1H30M", 90 * time.Minute, true},
+		{"P1D", 24 * time.Hour, true},
+		{"P1W", 7 * 24 * time.Hour, true},
+		{"P1DT2H", 26 * time.Hour, true},
+		{"PT45S", 45 * time.Second, true},
+		{"1H", 0, false},
+		{"P1H", 0, false},
+		{"PT1", 0, false},
+	}
+
+	for _, tt := range tests {
+		got, ok := parseDuration(tt.in)
+		if ok != tt.ok || got != tt.want {
+			t.Errorf("parseDuration(%q) = %v, %v; want %v, %v", tt.in, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestSealOpen(t *testing.T) {
+	key, err := ParseKey("MDEyMzQ1Njc4OWFiY2RlZjAxMjM0NTY3ODlhYmNkZWY=")
+	if err != nil {
+		t.Fatalf("ParseKey() = %v", err)
+	}
+
+	sealed, err := Seal(key, "secret")
+	if err != nil {
+		t.Fatalf("Seal() = %v", err)
+	}
+	if strings.Contains(sealed, "secret") {
+		t.Fatal("sealed value contains the password")
+	}
+
+	got, err := Open(key, sealed)
+	if err != nil || got != "secret" {
+		t.Fatalf("Open() = %q, %v; want %q", got, err, "secret")
+	}
+
+	other := append([]byte{}, key...)
+	other[0] ^= 1
+	if _, err := Open(other, sealed); err == nil {
+		t.Error("Open() with another key succeeded")
+	}
+
+	if _, err := ParseKey("c2hvcnQ="); !errors.Is(err, ErrInvalidKey) {
+		t.Errorf("ParseKey() of a short key = %v, want ErrInvalidKey", err)
+	}
+}
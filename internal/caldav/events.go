@@ -0,0 +1,237 @@
+package caldav
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"consult_app.cedrickewi/internal/ical"
+)
+
+const (
+	timeLayout     = "20060102T150405Z"
+	floatingLayout = "20060102T150405"
+	dateLayout     = "20060102"
+)
+
+// Busy is time taken by an event of the external calendar
+type Busy struct {
+	UID   string
+	Start time.Time
+	End   time.Time
+}
+
+// property is a content line split into its name, parameters and value
+type property struct {
+	name   string
+	params map[string]string
+	value  string
+}
+
+// unfold joins the continuation lines of an iCalendar object
+func unfold(data string) []string {
+	data = strings.ReplaceAll(data, "\r\n", "\n")
+
+	var lines []string
+	for _, l := range strings.Split(data, "\n") {
+		if (strings.HasPrefix(l, " ") || strings.HasPrefix(l, "\t")) && len(lines) > 0 {
+			lines[len(lines)-1] += l[1:]
+			continue
+		}
+		lines = append(lines, strings.TrimRight(l, "\r"))
+	}
+
+	return lines
+}
+
+// parseProperty splits a content line. The value starts at the first colon
+// outside a quoted parameter value.
+func parseProperty(line string) (property, bool) {
+	quoted := false
+	colon := -1
+	for i, r := range line {
+		if r == '"' {
+			quoted = !quoted
+		}
+		if r == ':' && !quoted {
+			colon = i
+			break
+		}
+	}
+	if colon < 0 {
+		return property{}, false
+	}
+
+	parts := strings.Split(line[:colon], ";")
+	p := property{
+		name:   strings.ToUpper(parts[0]),
+		params: map[string]string{},
+		value:  line[colon+1:],
+	}
+	for _, param := range parts[1:] {
+		k, v, _ := strings.Cut(param, "=")
+		p.params[strings.ToUpper(k)] = strings.Trim(v, `"`)
+	}
+
+	return p, true
+}
+
+// parseTime reads a DATE-TIME or DATE value. It reports whether the value was
+// a whole day.
+func parseTime(p property, loc *time.Location) (time.Time, bool, error) {
+	if p.params["VALUE"] == "DATE" || len(p.value) == len(dateLayout) {
+		t, err := time.ParseInLocation(dateLayout, p.value, loc)
+		return t, true, err
+	}
+
+	if strings.HasSuffix(p.value, "Z") {
+		t, err := time.Parse(timeLayout, p.value)
+		return t, false, err
+	}
+
+	if tzid := p.params["TZID"]; tzid != "" {
+		if l, err := time.LoadLocation(tzid); err == nil {
+			loc = l
+		}
+	}
+
+	t, err := time.ParseInLocation(floatingLayout, p.value, loc)
+	return t, false, err
+}
+
+// parseDuration reads a DURATION value such as PT1H30M, P1D or P2W
+func parseDuration(s string) (time.Duration, bool) {
+	neg := strings.HasPrefix(s, "-")
+	s = strings.TrimLeft(s, "+-")
+	if !strings.HasPrefix(s, "P") {
+		return 0, false
+	}
+	s = s[1:]
+
+	var d time.Duration
+	inTime := false
+	num := ""
+	for _, r := range s {
+		switch {
+		case r >= '0' && r <= '9':
+			num += string(r)
+			continue
+		case r == 'T':
+			inTime = true
+			continue
+		}
+
+		n, err := strconv.Atoi(num)
+		if err != nil {
+			return 0, false
+		}
+		num = ""
+
+		switch {
+		case r == 'W':
+			d += time.Duration(n) * 7 * 24 * time.Hour
+		case r == 'D':
+			d += time.Duration(n) * 24 * time.Hour
+		case r == 'H' && inTime:
+			d += time.Duration(n) * time.Hour
+		case r == 'M' && inTime:
+			d += time.Duration(n) * time.Minute
+		case r == 'S' && inTime:
+			d += time.Duration(n) * time.Second
+		default:
+			return 0, false
+		}
+	}
+	if num != "" {
+		return 0, false
+	}
+
+	if neg {
+		d = -d
+	}
+	return d, true
+}
+
+// parseBusy returns the busy time of the events in an iCalendar object.
+// Events that cannot be read are skipped rather than failing the whole sync.
+func parseBusy(data string, loc *time.Location) []Busy {
+	var (
+		blocks []Busy
+		stack  []string
+		event  map[string]property
+	)
+
+	for _, line := range unfold(data) {
+		p, ok := parseProperty(line)
+		if !ok {
+			continue
+		}
+
+		switch p.name {
+		case "BEGIN":
+			stack = append(stack, strings.ToUpper(p.value))
+			if len(stack) > 0 && stack[len(stack)-1] == "VEVENT" {
+				event = map[string]property{}
+			}
+			continue
+		case "END":
+			if len(stack) > 0 {
+				if stack[len(stack)-1] == "VEVENT" && event != nil {
+					if b, ok := busyFromEvent(event, loc); ok {
+						blocks = append(blocks, b)
+					}
+					event = nil
+				}
+				stack = stack[:len(stack)-1]
+			}
+			continue
+		}
+
+		// properties of nested components such as VALARM are not the event's
+		if event != nil && len(stack) > 0 && stack[len(stack)-1] == "VEVENT" {
+			event[p.name] = p
+		}
+	}
+
+	return blocks
+}
+
+func busyFromEvent(event map[string]property, loc *time.Location) (Busy, bool) {
+	uid := event["UID"].value
+	if strings.HasSuffix(uid, "@"+ical.UIDDomain) {
+		return Busy{}, false
+	}
+	if strings.EqualFold(event["TRANSP"].value, "TRANSPARENT") || strings.EqualFold(event["STATUS"].value, "CANCELLED") {
+		return Busy{}, false
+	}
+
+	dtstart, ok := event["DTSTART"]
+	if !ok {
+		return Busy{}, false
+	}
+	start, allDay, err := parseTime(dtstart, loc)
+	if err != nil {
+		return Busy{}, false
+	}
+
+	var end time.Time
+	if dtend, ok := event["DTEND"]; ok {
+		if end, _, err = parseTime(dtend, loc); err != nil {
+			return Busy{}, false
+		}
+	} else if dur, ok := event["DURATION"]; ok {
+		d, ok := parseDuration(dur.value)
+		if !ok {
+			return Busy{}, false
+		}
+		end = start.Add(d)
+	} else if allDay {
+		end = start.AddDate(0, 0, 1)
+	}
+
+	if !start.Before(end) {
+		return Busy{}, false
+	}
+
+	return Busy{UID: uid, Start: start, End: end}, true
+}
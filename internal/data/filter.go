@@ -1,6 +1,11 @@
 package data
 
-import "consult_app.cedrickewi/internal/validator"
+import (
+	"math"
+	"strings"
+
+	"consult_app.cedrickewi/internal/validator"
+)
 
 type Filters struct {
 	Page     int
@@ -11,7 +16,63 @@ type Filters struct {
 
 func ValidateFilters(v *validator.Validator, f Filters) {
 	v.Check(f.Page > 0, "page", "must be greater than zero")
+	v.Check(f.Page <= 10_000_000, "page", "must be a maximum of 10 million")
 	v.Check(f.PageSize > 0, "page_size", "must be greater than zero")
 	v.Check(f.PageSize <= 100, "page_size", "must be no more than 100")
 	v.Check(validator.In(f.Sort, f.SortSafe...), "sort", "invalid sort value")
+}
+
+// SortColumn returns the column to sort on, without the "-" prefix. Sort must
+// have been validated against SortSafe; anything else panics, as a guard
+// against SQL injection.
+func (f Filters) SortColumn() string {
+	for _, safeValue := range f.SortSafe {
+		if f.Sort == safeValue {
+			return strings.TrimPrefix(f.Sort, "-")
+		}
+	}
+
+	panic("unsafe sort parameter: " + f.Sort)
+}
+
+// SortDirection returns DESC when Sort has a "-" prefix, ASC otherwise
+func (f Filters) SortDirection() string {
+	if strings.HasPrefix(f.Sort, "-") {
+		return "DESC"
+	}
+
+	return "ASC"
+}
+
+func (f Filters) Limit() int {
+	return f.PageSize
+}
+
+func (f Filters) Offset() int {
+	return (f.Page - 1) * f.PageSize
+}
+
+// Metadata describes the page of a paginated list
+type Metadata struct {
+	CurrentPage  int `json:"current_page,omitempty"`
+	PageSize     int `json:"page_size,omitempty"`
+	FirstPage    int `json:"first_page,omitempty"`
+	LastPage     int `json:"last_page,omitempty"`
+	TotalRecords int `json:"total_records,omitempty"`
+}
+
+// CalculateMetadata returns the metadata of a page out of totalRecords. It
+// is empty when there are no records.
+func CalculateMetadata(totalRecords, page, pageSize int) Metadata {
+	if totalRecords == 0 {
+		return Metadata{}
+	}
+
+	return Metadata{
+		CurrentPage:  page,
+		PageSize:     pageSize,
+		FirstPage:    1,
+		LastPage:     int(math.Ceil(float64(totalRecords) / float64(pageSize))),
+		TotalRecords: totalRecords,
+	}
 }
\ No newline at end of file
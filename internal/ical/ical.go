@@ -0,0 +1,161 @@
+// Package ical writes RFC 5545 iCalendar files.
+package ical
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// ProdID identifies the product that created the calendar
+const ProdID = "-//Consult-Out//Bookings//EN"
+
+// UIDDomain qualifies the UIDs of the events this application creates
+const UIDDomain = "consult-out"
+
+// Event statuses
+const (
+	StatusTentative = "TENTATIVE"
+	StatusConfirmed = "CONFIRMED"
+	StatusCancelled = "CANCELLED"
+)
+
+// maxLineOctets is the longest a content line may be before it is folded
+const maxLineOctets = 75
+
+const timeLayout = "20060102T150405Z"
+
+// Person is the organizer or an attendee of an event
+type Person struct {
+	Name  string
+	Email string
+}
+
+// Event is a VEVENT. UID must stay the same for the life of the event and
+// Sequence must grow every time its time or status changes, so calendar
+// clients update the copy they have instead of adding another.
+type Event struct {
+	UID          string
+	Sequence     int
+	Start        time.Time
+	End          time.Time
+	Summary      string
+	Description  string
+	Location     string
+	URL          string
+	Status       string
+	Organizer    *Person
+	Attendees    []Person
+	LastModified time.Time
+}
+
+// Calendar is a VCALENDAR. Name is shown by clients subscribing to a feed.
+type Calendar struct {
+	Name   string
+	Method string
+	Events []Event
+}
+
+// Encode writes the calendar in the iCalendar format
+func (c *Calendar) Encode(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	now := time.Now()
+
+	line := func(name, value string) {
+		writeLine(bw, name+":"+value)
+	}
+
+	line("BEGIN", "VCALENDAR")
+	line("VERSION", "2.0")
+	line("PRODID", ProdID)
+	line("CALSCALE", "GREGORIAN")
+	if c.Method != "" {
+		line("METHOD", c.Method)
+	}
+	if c.Name != "" {
+		line("X-WR-CALNAME", escapeText(c.Name))
+	}
+
+	for _, e := range c.Events {
+		line("BEGIN", "VEVENT")
+		line("UID", escapeText(e.UID))
+		line("SEQUENCE", fmt.Sprint(e.Sequence))
+		line("DTSTAMP", formatTime(now))
+		line("DTSTART", formatTime(e.Start))
+		line("DTEND", formatTime(e.End))
+		if !e.LastModified.IsZero() {
+			line("LAST-MODIFIED", formatTime(e.LastModified))
+		}
+		line("SUMMARY", escapeText(e.Summary))
+		if e.Description != "" {
+			line("DESCRIPTION", escapeText(e.Description))
+		}
+		if e.Location != "" {
+			line("LOCATION", escapeText(e.Location))
+		}
+		if e.URL != "" {
+			line("URL", e.URL)
+		}
+		if e.Status != "" {
+			line("STATUS", e.Status)
+		}
+		if e.Organizer != nil {
+			writeLine(bw, "ORGANIZER"+personParams(*e.Organizer)+":mailto:"+e.Organizer.Email)
+		}
+		for _, a := range e.Attendees {
+			writeLine(bw, "ATTENDEE;ROLE=REQ-PARTICIPANT"+personParams(a)+":mailto:"+a.Email)
+		}
+		line("END", "VEVENT")
+	}
+
+	line("END", "VCALENDAR")
+
+	return bw.Flush()
+}
+
+func formatTime(t time.Time) string {
+	return t.UTC().Format(timeLayout)
+}
+
+func personParams(p Person) string {
+	if p.Name == "" {
+		return ""
+	}
+	// parameter values are quoted and cannot contain quotes
+	return `;CN="` + strings.ReplaceAll(p.Name, `"`, "'") + `"`
+}
+
+// escapeText escapes a TEXT value (RFC 5545 section 3.3.11)
+func escapeText(s string) string {
+	r := strings.NewReplacer(
+		`\`, `\\`,
+		";", `\;`,
+		",", `\,`,
+		"\r\n", `\n`,
+		"\n", `\n`,
+		"\r", `\n`,
+	)
+	return r.Replace(s)
+}
+
+// writeLine writes a content line ending in CRLF, folded so that no line is
+// longer than 75 octets without splitting a UTF-8 character
+func writeLine(w *bufio.Writer, s string) {
+	limit := maxLineOctets
+	for len(s) > limit {
+		cut := limit
+		for cut > 0 && !utf8.RuneStart(s[cut]) {
+			cut--
+		}
+		w.WriteString(s[:cut])
+		w.WriteString("\r\n ")
+		s = s[cut:]
+		// the leading space of a continuation line counts towards its length
+		limit = maxLineOctets - 1
+	}
+	w.WriteString(s)
+	w.WriteString("\r\n")
+}
@@ -38,7 +38,7 @@ func NewResend(recipient, templateFile string, data interface{}) error {
 	params := &resend.SendEmailRequest{
 		From:    "Consult-Out <onboarding@consult-out.com>",
 		To:      []string{recipient},
-		Subject: "Welcome to Consult-Out!",
+		Subject: subject.String(),
 		Html:    htmlBody.String(),
 		Text:    plainBody.String(),
 		ReplyTo: "cedrickewi@gmail.com",
@@ -0,0 +1,61 @@
+package mtgschelduler
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/hibiken/asynq"
+)
+
+const (
+	// Task type for syncing every connected external calendar
+	TaskSyncCalendars = "calendar:sync"
+	// Task type for syncing one expert's external calendar
+	TaskSyncExpertCalendar = "calendar:sync:expert"
+	// SyncCalendarsSpec is how often the worker syncs external calendars
+	SyncCalendarsSpec = "@every 15m"
+)
+
+// SyncCalendarPayload represents the payload for syncing an expert's calendar
+type SyncCalendarPayload struct {
+	ExpertID int64 `json:"expert_id"`
+}
+
+// SyncCalendarsTask is the periodic task syncing every connected calendar
+func SyncCalendarsTask() *asynq.Task {
+	return asynq.NewTask(
+		TaskSyncCalendars,
+		nil,
+		asynq.Queue(QueueBookings),
+		asynq.MaxRetry(0),
+		asynq.Timeout(10*time.Minute),
+	)
+}
+
+// ScheduleCalendarSync queues a sync of the expert's calendar right away,
+// for instance once it has just been connected
+func (ms *MeetingScheduler) ScheduleCalendarSync(ctx context.Context, expertID int64) (string, error) {
+	payloadBytes, err := json.Marshal(SyncCalendarPayload{ExpertID: expertID})
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal payload: %w", err)
+	}
+
+	task := asynq.NewTask(
+		TaskSyncExpertCalendar,
+		payloadBytes,
+		asynq.Queue(QueueBookings),
+		asynq.MaxRetry(3),
+		asynq.Timeout(2*time.Minute),
+	)
+
+	info, err := ms.client.EnqueueContext(ctx, task)
+	if err != nil {
+		return "", fmt.Errorf("failed to enqueue task: %w", err)
+	}
+
+	ms.logger.Infof("Scheduled calendar sync for expert ID %d (task ID: %s)", expertID, info.ID)
+
+	return info.ID, nil
+}
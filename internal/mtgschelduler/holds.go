@@ -0,0 +1,81 @@
+package mtgschelduler
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/hibiken/asynq"
+)
+
+const (
+	// Task type for releasing unpaid booking holds
+	TaskExpireBookingHold = "expire:booking:hold"
+	// Queue name for booking-related tasks
+	QueueBookings = "bookings"
+)
+
+// ExpireHoldPayload represents the payload for expiring a booking hold
+type ExpireHoldPayload struct {
+	BookingID int64 `json:"booking_id"`
+}
+
+// ScheduleExpireHold schedules a task that cancels a booking left unpaid
+// once its hold runs out at expiresAt
+func (ms *MeetingScheduler) ScheduleExpireHold(ctx context.Context, bookingID int64, expiresAt time.Time) (string, error) {
+	payloadBytes, err := json.Marshal(ExpireHoldPayload{BookingID: bookingID})
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal payload: %w", err)
+	}
+
+	task := asynq.NewTask(
+		TaskExpireBookingHold,
+		payloadBytes,
+		asynq.Queue(QueueBookings),
+		asynq.ProcessAt(expiresAt.UTC()),
+		asynq.MaxRetry(5),
+		asynq.Timeout(30*time.Second),
+	)
+
+	info, err := ms.client.EnqueueContext(ctx, task)
+	if err != nil {
+		return "", fmt.Errorf("failed to enqueue task: %w", err)
+	}
+
+	ms.logger.Infof("Scheduled hold expiry for booking ID %d at %v (task ID: %s)",
+		bookingID, expiresAt, info.ID)
+
+	return info.ID, nil
+}
+
+// Task type for declining booking requests left unanswered
+const TaskExpireBookingRequest = "expire:booking:request"
+
+// ScheduleExpireRequest schedules a task that declines a booking request the
+// expert has not answered by deadline
+func (ms *MeetingScheduler) ScheduleExpireRequest(ctx context.Context, bookingID int64, deadline time.Time) (string, error) {
+	payloadBytes, err := json.Marshal(ExpireHoldPayload{BookingID: bookingID})
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal payload: %w", err)
+	}
+
+	task := asynq.NewTask(
+		TaskExpireBookingRequest,
+		payloadBytes,
+		asynq.Queue(QueueBookings),
+		asynq.ProcessAt(deadline.UTC()),
+		asynq.MaxRetry(5),
+		asynq.Timeout(30*time.Second),
+	)
+
+	info, err := ms.client.EnqueueContext(ctx, task)
+	if err != nil {
+		return "", fmt.Errorf("failed to enqueue task: %w", err)
+	}
+
+	ms.logger.Infof("Scheduled request expiry for booking ID %d at %v (task ID: %s)",
+		bookingID, deadline, info.ID)
+
+	return info.ID, nil
+}
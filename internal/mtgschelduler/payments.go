@@ -0,0 +1,58 @@
+package mtgschelduler
+
+import (
+	"time"
+
+	"github.com/hibiken/asynq"
+)
+
+const (
+	// Task type for polling the gateway about payments left pending
+	TaskReconcilePayments = "payment:reconcile"
+	// ReconcilePaymentsSpec is how often the worker polls pending payments
+	ReconcilePaymentsSpec = "@every 10m"
+	// Task type for the daily report of payments the gateway and our
+	// records disagree on
+	TaskReportPayments = "payment:report"
+	// ReportPaymentsSpec runs the report every day at 02:00 UTC, for the day before
+	ReportPaymentsSpec = "0 2 * * *"
+	// Task type for issuing pending refunds and polling the ones in processing
+	TaskIssueRefunds = "refund:issue"
+	// IssueRefundsSpec is how often the worker works through refunds
+	IssueRefundsSpec = "@every 5m"
+)
+
+// ReconcilePaymentsTask is the periodic task polling pending payments, for
+// the notifications the gateway never sent
+func ReconcilePaymentsTask() *asynq.Task {
+	return asynq.NewTask(
+		TaskReconcilePayments,
+		nil,
+		asynq.Queue(QueueBookings),
+		asynq.MaxRetry(0),
+		asynq.Timeout(5*time.Minute),
+	)
+}
+
+// ReportPaymentsTask is the periodic task making the daily reconciliation report
+func ReportPaymentsTask() *asynq.Task {
+	return asynq.NewTask(
+		TaskReportPayments,
+		nil,
+		asynq.Queue(QueueBookings),
+		asynq.MaxRetry(3),
+		asynq.Timeout(30*time.Minute),
+	)
+}
+
+// IssueRefundsTask is the periodic task sending refunds to the gateway and
+// settling the ones it has finished with
+func IssueRefundsTask() *asynq.Task {
+	return asynq.NewTask(
+		TaskIssueRefunds,
+		nil,
+		asynq.Queue(QueueBookings),
+		asynq.MaxRetry(0),
+		asynq.Timeout(5*time.Minute),
+	)
+}
@@ -0,0 +1,26 @@
+package mtgschelduler
+
+import (
+	"time"
+
+	"github.com/hibiken/asynq"
+)
+
+const (
+	// Task type for settling the attendance of the sessions that ended
+	TaskSettleSessions = "session:settle"
+	// SettleSessionsSpec is how often the worker settles ended sessions
+	SettleSessionsSpec = "@every 5m"
+)
+
+// SettleSessionsTask is the periodic task settling ended sessions. It is not
+// enqueued per booking, so sessions moved or confirmed late are still picked up.
+func SettleSessionsTask() *asynq.Task {
+	return asynq.NewTask(
+		TaskSettleSessions,
+		nil,
+		asynq.Queue(QueueBookings),
+		asynq.MaxRetry(0),
+		asynq.Timeout(2*time.Minute),
+	)
+}
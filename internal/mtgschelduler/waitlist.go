@@ -0,0 +1,85 @@
+package mtgschelduler
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/hibiken/asynq"
+)
+
+const (
+	// Task type for offering freed slots to waitlisted clients
+	TaskOfferWaitlistSlots = "waitlist:offer:slots"
+	// Task type for releasing a waitlist offer nobody claimed
+	TaskLapseWaitlistOffer = "waitlist:lapse:offer"
+)
+
+// WaitlistSlotsPayload represents the payload for offering the free slots of
+// an expert between From and To
+type WaitlistSlotsPayload struct {
+	ExpertID int64     `json:"expert_id"`
+	From     time.Time `json:"from"`
+	To       time.Time `json:"to"`
+}
+
+// LapseOfferPayload represents the payload for releasing a waitlist offer
+type LapseOfferPayload struct {
+	OfferID int64 `json:"offer_id"`
+}
+
+// ScheduleWaitlistOffers queues a task that offers the expert's free slots
+// between from and to to the clients on their waitlist
+func (ms *MeetingScheduler) ScheduleWaitlistOffers(ctx context.Context, expertID int64, from, to time.Time) (string, error) {
+	payloadBytes, err := json.Marshal(WaitlistSlotsPayload{ExpertID: expertID, From: from.UTC(), To: to.UTC()})
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal payload: %w", err)
+	}
+
+	task := asynq.NewTask(
+		TaskOfferWaitlistSlots,
+		payloadBytes,
+		asynq.Queue(QueueBookings),
+		asynq.MaxRetry(3),
+		asynq.Timeout(time.Minute),
+	)
+
+	info, err := ms.client.EnqueueContext(ctx, task)
+	if err != nil {
+		return "", fmt.Errorf("failed to enqueue task: %w", err)
+	}
+
+	ms.logger.Infof("Scheduled waitlist offers for expert ID %d between %v and %v (task ID: %s)",
+		expertID, from, to, info.ID)
+
+	return info.ID, nil
+}
+
+// ScheduleLapseOffer schedules a task that passes an unclaimed offer on to
+// the next client once its claim window closes at expiresAt
+func (ms *MeetingScheduler) ScheduleLapseOffer(ctx context.Context, offerID int64, expiresAt time.Time) (string, error) {
+	payloadBytes, err := json.Marshal(LapseOfferPayload{OfferID: offerID})
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal payload: %w", err)
+	}
+
+	task := asynq.NewTask(
+		TaskLapseWaitlistOffer,
+		payloadBytes,
+		asynq.Queue(QueueBookings),
+		asynq.ProcessAt(expiresAt.UTC()),
+		asynq.MaxRetry(5),
+		asynq.Timeout(time.Minute),
+	)
+
+	info, err := ms.client.EnqueueContext(ctx, task)
+	if err != nil {
+		return "", fmt.Errorf("failed to enqueue task: %w", err)
+	}
+
+	ms.logger.Infof("Scheduled lapse of waitlist offer ID %d at %v (task ID: %s)",
+		offerID, expiresAt, info.ID)
+
+	return info.ID, nil
+}
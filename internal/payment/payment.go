@@ -0,0 +1,206 @@
+// Package payment takes payments for bookings through a payment gateway.
+// Booking code talks to the gateway only through PaymentProvider, so another
+// gateway can be added next to PayUnit without touching it.
+package payment
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"consult_app.cedrickewi/internal/store"
+)
+
+// PlatformFees is added to the price of every booking, in the currency the
+// booking is priced in
+var PlatformFees = map[string]int{
+	"XAF": 1000,
+	"XOF": 1000,
+	"NGN": 2500,
+	"USD": 2,
+	"EUR": 2,
+}
+
+// PlatformFee is the fee added to a booking priced in currency; bookings
+// without a currency are in XAF. ok is false for a currency with no fee.
+func PlatformFee(currency string) (fee int, ok bool) {
+	if currency == "" {
+		currency = "XAF"
+	}
+	fee, ok = PlatformFees[currency]
+	return fee, ok
+}
+
+var (
+	// ErrInvalidWebhook is returned when a notification cannot be verified
+	// as coming from the gateway
+	ErrInvalidWebhook = errors.New("invalid payment notification")
+	// ErrNotInitialized is returned when a payment is made for a booking
+	// whose transaction was never initialised
+	ErrNotInitialized = errors.New("no payment transaction initialised for this booking")
+	// ErrRefundUnsupported is returned by a gateway that cannot issue
+	// refunds; they are left to be paid out by hand
+	ErrRefundUnsupported = errors.New("the payment gateway does not issue refunds")
+)
+
+type peerKey struct{}
+
+// WithPeer keeps the address of the TCP peer that sent r, before middleware
+// such as RealIP replaces RemoteAddr with what forwarded headers claim
+func WithPeer(r *http.Request) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), peerKey{}, r.RemoteAddr))
+}
+
+// Peer returns the address of the TCP peer kept by WithPeer, or RemoteAddr
+// when it was not kept
+func Peer(r *http.Request) string {
+	if addr, ok := r.Context().Value(peerKey{}).(string); ok {
+		return addr
+	}
+	return r.RemoteAddr
+}
+
+// State is the state of a transaction or refund at the gateway
+type State string
+
+const (
+	StatePending   State = "PENDING"
+	StateSuccess   State = "SUCCESS"
+	StateFailed    State = "FAILED"
+	StateCancelled State = "CANCELLED"
+)
+
+// PaymentStatus is the payment status of a booking whose transaction is in
+// state s; ok is false for a state this package does not know
+func (s State) PaymentStatus() (status string, ok bool) {
+	switch s {
+	case StatePending:
+		return store.PaymentPending, true
+	case StateSuccess:
+		return store.PaymentSuccess, true
+	case StateFailed:
+		return store.PaymentFailed, true
+	case StateCancelled:
+		return store.PaymentCancelled, true
+	default:
+		return "", false
+	}
+}
+
+// Checkout describes the payment of a booking to initialise
+type Checkout struct {
+	BookingID     int64
+	TransactionID string
+	Amount        int
+	Currency      string
+	Country       string
+}
+
+// Transaction is a payment initialised at the gateway. Response is the
+// gateway's own answer, passed through to clients that need its details.
+type Transaction struct {
+	TransactionID string `json:"transaction_id"`
+	// Reference is the gateway's own ID for the transaction
+	Reference  string `json:"-"`
+	PaymentURL string `json:"payment_url,omitempty"`
+	// Amount is what the gateway was asked to collect
+	Amount int `json:"-"`
+	// Details is what the gateway needs later about the transaction, such as
+	// to list its methods; it is stored as given and handed back unread
+	Details  []byte `json:"-"`
+	Response any    `json:"-"`
+}
+
+// Method is a way of paying offered by the gateway for a transaction
+type Method struct {
+	Code        string `json:"code"`
+	Name        string `json:"name"`
+	Logo        string `json:"logo,omitempty"`
+	CountryCode string `json:"country_code,omitempty"`
+}
+
+// ChargeRequest asks the gateway to collect an initialised transaction with
+// one of its methods
+type ChargeRequest struct {
+	BookingID     int64
+	TransactionID string
+	Method        string
+	PhoneNumber   string
+	Amount        int
+	Currency      string
+}
+
+// Charge is the gateway's answer to a charge, usually still pending
+type Charge struct {
+	ID                    string `json:"id"`
+	TransactionID         string `json:"transaction_id"`
+	State                 State  `json:"state"`
+	ProviderTransactionID string `json:"provider_transaction_id,omitempty"`
+}
+
+// Status is the state of a transaction as the gateway reports it
+type Status struct {
+	TransactionID string `json:"transaction_id"`
+	State         State  `json:"state"`
+	Amount        int    `json:"amount"`
+	Currency      string `json:"currency"`
+	Method        string `json:"method,omitempty"`
+	Message       string `json:"message,omitempty"`
+}
+
+// RefundRequest asks the gateway to give back some or all of a transaction
+type RefundRequest struct {
+	TransactionID string
+	// Reference identifies the refund on our side so that retrying it does
+	// not refund twice
+	Reference string
+	Amount    int
+	Currency  string
+	Reason    string
+}
+
+// Refund is a refund as the gateway reports it
+type Refund struct {
+	ID    string `json:"id"`
+	State State  `json:"state"`
+}
+
+// Notification is a verified notification from the gateway that a
+// transaction changed
+type Notification struct {
+	TransactionID string
+	State         State
+	// BookingID is the booking the notification was sent for, when the
+	// gateway says
+	BookingID int64
+	// RefundID is set when the notification is about a refund of the
+	// transaction, with the gateway's ID for it
+	RefundID string
+	// DedupeKey is the same for every delivery of one notification
+	DedupeKey string
+	// Payload is the body of the notification as received
+	Payload []byte
+}
+
+// PaymentProvider is a payment gateway
+type PaymentProvider interface {
+	// Name identifies the gateway, e.g. "payunit"
+	Name() string
+	// Initialize opens a transaction for a checkout. It only talks to the
+	// gateway: the transaction is recorded by the Service.
+	Initialize(ctx context.Context, c Checkout) (*Transaction, error)
+	// Methods lists the ways an initialised transaction can be paid
+	Methods(ctx context.Context, txn *Transaction) ([]Method, error)
+	// Charge collects an initialised transaction
+	Charge(ctx context.Context, req ChargeRequest) (*Charge, error)
+	// Status asks the gateway for the state of a transaction
+	Status(ctx context.Context, transactionID string) (*Status, error)
+	// Refund gives back some or all of a paid transaction, or returns
+	// ErrRefundUnsupported
+	Refund(ctx context.Context, req RefundRequest) (*Refund, error)
+	// RefundStatus asks the gateway for the state of a refund by its ID
+	RefundStatus(ctx context.Context, refundID string) (*Refund, error)
+	// VerifyWebhook checks that a notification comes from the gateway and
+	// reads it, returning ErrInvalidWebhook when it does not
+	VerifyWebhook(r *http.Request) (*Notification, error)
+}
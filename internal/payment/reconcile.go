@@ -0,0 +1,63 @@
+package payment
+
+import (
+	"strconv"
+
+	"consult_app.cedrickewi/internal/store"
+)
+
+// Kinds of disagreement between the gateway and our records
+const (
+	MismatchGateway       = "gateway_error"
+	MismatchPaymentStatus = "payment_status"
+	MismatchBookingStatus = "booking_status"
+	MismatchAmount        = "amount"
+	MismatchStatusRecord  = "status_record"
+)
+
+// Compare lists how our records of a transaction disagree with the
+// status the gateway reports for it
+func Compare(r *store.PaymentRecord, status *Status) []store.PaymentMismatch {
+	var mismatches []store.PaymentMismatch
+	add := func(kind, gateway, recorded string) {
+		mismatches = append(mismatches, store.PaymentMismatch{
+			BookingID:     r.BookingID,
+			TransactionID: r.TransactionID,
+			Kind:          kind,
+			GatewayValue:  gateway,
+			RecordedValue: recorded,
+		})
+	}
+
+	state := string(status.State)
+
+	// a refunded booking was paid; its refund is tracked on its own
+	expected, _ := status.State.PaymentStatus()
+	refunded := r.PaymentStatus == store.PaymentRefunded && status.State == StateSuccess
+	if r.PaymentStatus != expected && !refunded {
+		add(MismatchPaymentStatus, state, r.PaymentStatus)
+	}
+
+	// paid for but never confirmed
+	switch store.BookingStatus(r.BKStatus) {
+	case store.StatusRequested, store.StatusAwaitingPayment:
+		if status.State == StateSuccess {
+			add(MismatchBookingStatus, state, r.BKStatus)
+		}
+	}
+
+	if r.Amount.Valid && status.State == StateSuccess && int(r.Amount.Int64) != status.Amount {
+		add(MismatchAmount, strconv.Itoa(status.Amount), strconv.FormatInt(r.Amount.Int64, 10))
+	}
+
+	switch {
+	case !r.RecordedState.Valid:
+		if status.State != StatePending {
+			add(MismatchStatusRecord, state, "missing")
+		}
+	case r.RecordedState.String != state:
+		add(MismatchStatusRecord, state, r.RecordedState.String)
+	}
+
+	return mismatches
+}
@@ -0,0 +1,90 @@
+package payment
+
+import (
+	"database/sql"
+	"reflect"
+	"testing"
+
+	"consult_app.cedrickewi/internal/store"
+)
+
+func TestCompare(t *testing.T) {
+	valid := func(s string) sql.NullString { return sql.NullString{String: s, Valid: true} }
+	amount := func(n int64) sql.NullInt64 { return sql.NullInt64{Int64: n, Valid: true} }
+
+	tests := []struct {
+		name   string
+		record store.PaymentRecord
+		status Status
+		want   []string
+	}{
+		{
+			name:   "paid and confirmed",
+			record: store.PaymentRecord{PaymentStatus: store.PaymentSuccess, BKStatus: string(store.StatusConfirmed), Amount: amount(11000), RecordedState: valid("SUCCESS")},
+			status: Status{State: StateSuccess, Amount: 11000},
+		},
+		{
+			name:   "refunded after paying",
+			record: store.PaymentRecord{PaymentStatus: store.PaymentRefunded, BKStatus: string(store.StatusRefunded), Amount: amount(11000), RecordedState: valid("SUCCESS")},
+			status: Status{State: StateSuccess, Amount: 11000},
+		},
+		{
+			name:   "still pending",
+			record: store.PaymentRecord{PaymentStatus: store.PaymentPending, BKStatus: string(store.StatusAwaitingPayment), Amount: amount(11000)},
+			status: Status{State: StatePending},
+		},
+		{
+			name:   "paid but never applied",
+			record: store.PaymentRecord{PaymentStatus: store.PaymentPending, BKStatus: string(store.StatusAwaitingPayment), Amount: amount(11000), RecordedState: valid("PENDING")},
+			status: Status{State: StateSuccess, Amount: 11000},
+			want:   []string{MismatchPaymentStatus, MismatchBookingStatus, MismatchStatusRecord},
+		},
+		{
+			name:   "paid a different amount",
+			record: store.PaymentRecord{PaymentStatus: store.PaymentSuccess, BKStatus: string(store.StatusConfirmed), Amount: amount(11000), RecordedState: valid("SUCCESS")},
+			status: Status{State: StateSuccess, Amount: 10000},
+			want:   []string{MismatchAmount},
+		},
+		{
+			name:   "failed without a status record",
+			record: store.PaymentRecord{PaymentStatus: store.PaymentFailed, BKStatus: string(store.StatusAwaitingPayment), Amount: amount(11000)},
+			status: Status{State: StateFailed},
+			want:   []string{MismatchStatusRecord},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.record.BookingID, tt.record.TransactionID = 7, "txn_7"
+			mismatches := Compare(&tt.record, &tt.status)
+
+			var kinds []string
+			for _, m := range mismatches {
+				kinds = append(kinds, m.Kind)
+				if m.BookingID != 7 || m.TransactionID != "txn_7" {
+					t.Errorf("mismatch %q is for booking %d, transaction %q", m.Kind, m.BookingID, m.TransactionID)
+				}
+			}
+			if !reflect.DeepEqual(kinds, tt.want) {
+				t.Fatalf("Compare() kinds = %v, want %v", kinds, tt.want)
+			}
+		})
+	}
+}
+
+func TestCompareValues(t *testing.T) {
+	record := store.PaymentRecord{
+		PaymentStatus: store.PaymentSuccess,
+		BKStatus:      string(store.StatusConfirmed),
+		Amount:        sql.NullInt64{Int64: 11000, Valid: true},
+		RecordedState: sql.NullString{String: "SUCCESS", Valid: true},
+	}
+
+	mismatches := Compare(&record, &Status{State: StateSuccess, Amount: 10000})
+	if len(mismatches) != 1 {
+		t.Fatalf("Compare() = %+v, want one mismatch", mismatches)
+	}
+	if m := mismatches[0]; m.GatewayValue != "10000" || m.RecordedValue != "11000" {
+		t.Errorf("amount mismatch = gateway %q, recorded %q, want 10000 and 11000", m.GatewayValue, m.RecordedValue)
+	}
+}
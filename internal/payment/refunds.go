@@ -0,0 +1,224 @@
+package payment
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"consult_app.cedrickewi/internal/mailer"
+	"consult_app.cedrickewi/internal/store"
+)
+
+var (
+	// ErrUnknownRefund is returned for a notification about a refund we did
+	// not issue
+	ErrUnknownRefund = errors.New("no refund was issued with this reference")
+	// ErrNotManualRefund is returned when paying out by hand a refund that
+	// is not waiting for it
+	ErrNotManualRefund = errors.New("this refund is not waiting to be paid out by hand")
+)
+
+// refundReference identifies a refund at the gateway, so that issuing it
+// again does not refund twice
+func refundReference(refundID int64) string {
+	return fmt.Sprintf("refund_%d", refundID)
+}
+
+// IssueRefund sends a pending refund to the gateway, or asks the gateway
+// about a refund already issued, and settles it once the gateway has. A
+// refund the gateway keeps turning down is given up as failed after
+// store.MaxRefundAttempts; one the gateway cannot issue is left to be paid
+// out by hand.
+func (s *Service) IssueRefund(ctx context.Context, r *store.Refund) error {
+	if r.Status == store.RefundProcessing {
+		result, err := s.provider.RefundStatus(ctx, r.ProviderReference)
+		if errors.Is(err, ErrRefundUnsupported) {
+			return s.refundByHand(ctx, r)
+		}
+		if err != nil {
+			return err
+		}
+		return s.settleRefund(ctx, r, result)
+	}
+
+	if r.TransactionID == "" {
+		return s.refundAttemptFailed(ctx, r, errors.New("the booking has no payment transaction to refund"))
+	}
+
+	result, err := s.provider.Refund(ctx, RefundRequest{
+		TransactionID: r.TransactionID,
+		Reference:     refundReference(r.ID),
+		Amount:        r.Amount,
+		Currency:      r.Currency,
+		Reason:        r.Reason,
+	})
+	if errors.Is(err, ErrRefundUnsupported) {
+		return s.refundByHand(ctx, r)
+	}
+	if err != nil {
+		return s.refundAttemptFailed(ctx, r, err)
+	}
+
+	reference := result.ID
+	if reference == "" {
+		reference = refundReference(r.ID)
+	}
+	if err := s.store.Refund.MarkIssued(ctx, r.ID, r.TransactionID, reference); err != nil {
+		return err
+	}
+	r.Status, r.ProviderReference = store.RefundProcessing, reference
+
+	return s.settleRefund(ctx, r, result)
+}
+
+// refundByHand leaves a refund the gateway cannot issue to staff, who pay it
+// out with PayOutRefund
+func (s *Service) refundByHand(ctx context.Context, r *store.Refund) error {
+	reason := fmt.Sprintf("%s does not issue refunds; to be paid out by hand", s.provider.Name())
+	if err := s.store.Refund.MarkManual(ctx, r.ID, r.TransactionID, reason); err != nil {
+		return err
+	}
+	r.Status, r.LastError = store.RefundManual, reason
+	return nil
+}
+
+// PayOutRefund settles a refund that staff paid out by hand, under the
+// reference of their payout, and tells the parties
+func (s *Service) PayOutRefund(ctx context.Context, refundID int64, reference string) (*store.Refund, error) {
+	r, err := s.store.Refund.GetByID(ctx, refundID)
+	if err != nil {
+		return nil, err
+	}
+	if r.Status != store.RefundManual {
+		return nil, ErrNotManualRefund
+	}
+
+	if err := s.store.Refund.RecordPayout(ctx, r.ID, reference); err != nil {
+		if errors.Is(err, store.ErrRecordNotFound) {
+			return nil, ErrNotManualRefund
+		}
+		return nil, err
+	}
+
+	settled, err := s.store.Refund.Settle(ctx, r.ID, true, "")
+	if err != nil {
+		return nil, err
+	}
+	if !settled {
+		return nil, ErrNotManualRefund
+	}
+	r.Status, r.ProviderReference, r.LastError = store.RefundSucceeded, reference, ""
+
+	s.notifyRefund(ctx, r, true)
+	return r, nil
+}
+
+// refundAttemptFailed records a refund the gateway did not take
+func (s *Service) refundAttemptFailed(ctx context.Context, r *store.Refund, attemptErr error) error {
+	failed, err := s.store.Refund.RecordAttempt(ctx, r.ID, attemptErr.Error())
+	if err != nil {
+		return err
+	}
+	if failed {
+		s.notifyRefund(ctx, r, false)
+	}
+	return fmt.Errorf("failed to issue refund %d: %w", r.ID, attemptErr)
+}
+
+// settleRefund records the outcome of a refund the gateway has finished with
+// and tells the parties, once; a refund still pending is left as it is
+func (s *Service) settleRefund(ctx context.Context, r *store.Refund, result *Refund) error {
+	var succeeded bool
+	switch result.State {
+	case StateSuccess:
+		succeeded = true
+	case StateFailed, StateCancelled:
+	default:
+		return nil
+	}
+
+	reason := ""
+	if !succeeded {
+		reason = fmt.Sprintf("refused by %s", s.provider.Name())
+	}
+
+	settled, err := s.store.Refund.Settle(ctx, r.ID, succeeded, reason)
+	if err != nil || !settled {
+		return err
+	}
+
+	s.notifyRefund(ctx, r, succeeded)
+	return nil
+}
+
+// processRefund applies a verified notification about a refund. The refund's
+// state is asked from the gateway.
+func (s *Service) processRefund(ctx context.Context, n *Notification) (*Status, error) {
+	r, err := s.store.Refund.GetByProviderReference(ctx, n.RefundID)
+	if err != nil {
+		if errors.Is(err, store.ErrRecordNotFound) {
+			return nil, ErrUnknownRefund
+		}
+		return nil, err
+	}
+	if r.TransactionID != n.TransactionID || (n.BookingID != 0 && n.BookingID != r.BookingID) {
+		return nil, fmt.Errorf("%w: refund %s belongs to booking %d", ErrInvalidWebhook, n.RefundID, r.BookingID)
+	}
+
+	event := store.PaymentEvent{
+		Provider:      s.provider.Name(),
+		DedupeKey:     n.DedupeKey,
+		TransactionID: n.TransactionID,
+		State:         string(n.State),
+		Payload:       n.Payload,
+	}
+
+	claimed, err := s.store.PaymentEvent.Record(ctx, &event)
+	if err != nil || !claimed {
+		return nil, err
+	}
+
+	var applied State
+	result, err := s.provider.RefundStatus(ctx, r.ProviderReference)
+	if err == nil {
+		applied = result.State
+		err = s.settleRefund(ctx, r, result)
+	}
+
+	if err := s.finish(ctx, &event, n.State, applied, err); err != nil {
+		return nil, err
+	}
+
+	return &Status{TransactionID: n.TransactionID, State: result.State, Amount: r.Amount, Currency: r.Currency}, nil
+}
+
+// notifyRefund tells the client how their refund went and, when it was made,
+// the expert whose earnings it reduces
+func (s *Service) notifyRefund(ctx context.Context, r *store.Refund, succeeded bool) {
+	details, err := s.store.Booking.GetBookingDetails(ctx, r.BookingID)
+	if err != nil {
+		return
+	}
+
+	data := map[string]any{
+		"name":       details.UserDetails.Name,
+		"clientName": details.UserDetails.Name,
+		"bookingID":  r.BookingID,
+		"startTime":  details.Booking.StartTime,
+		"endTime":    details.Booking.EndTime,
+		"amount":     r.Amount,
+		"currency":   r.Currency,
+		"reason":     r.Reason,
+		"succeeded":  succeeded,
+	}
+
+	_ = mailer.NewResend(details.UserDetails.Email, "booking_refund.tmpl", data)
+
+	if !succeeded {
+		return
+	}
+
+	data["name"] = details.Expert.Name
+	data["forExpert"] = true
+	_ = mailer.NewResend(details.Expert.Email, "booking_refund.tmpl", data)
+}
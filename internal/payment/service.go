@@ -0,0 +1,148 @@
+package payment
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"consult_app.cedrickewi/internal/store"
+)
+
+// Service takes the payments of bookings through a provider and applies
+// their outcome to the bookings
+type Service struct {
+	provider PaymentProvider
+	store    store.Storage
+}
+
+// NewService returns a Service taking payments through provider
+func NewService(provider PaymentProvider, storage store.Storage) *Service {
+	return &Service{
+		provider: provider,
+		store:    storage,
+	}
+}
+
+// Provider returns the gateway the service takes payments through
+func (s *Service) Provider() PaymentProvider {
+	return s.provider
+}
+
+// Initialize opens the transaction paying for a booking and records it on
+// the booking
+func (s *Service) Initialize(ctx context.Context, booking *store.Booking, userID int64, country string) (*Transaction, error) {
+	amount, err := s.amountDue(ctx, booking)
+	if err != nil {
+		return nil, err
+	}
+
+	checkout := Checkout{
+		BookingID:     booking.ID,
+		TransactionID: fmt.Sprintf("txn_%d_%d_%d", time.Now().UnixNano(), userID, booking.ID),
+		Amount:        amount,
+		Currency:      booking.Currency,
+		Country:       country,
+	}
+
+	txn, err := s.provider.Initialize(ctx, checkout)
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.store.Payment.SaveTransaction(ctx, &store.PaymentTransaction{
+		BookingID:     booking.ID,
+		Provider:      s.provider.Name(),
+		TransactionID: checkout.TransactionID,
+		Reference:     txn.Reference,
+		URL:           txn.PaymentURL,
+		Amount:        txn.Amount,
+		Details:       txn.Details,
+	})
+	if err != nil {
+		return nil, err
+	}
+	booking.TransactionID.String, booking.TransactionID.Valid = checkout.TransactionID, true
+
+	return txn, nil
+}
+
+// Methods lists the ways the initialised transaction of a booking can be paid
+func (s *Service) Methods(ctx context.Context, booking *store.Booking) ([]Method, error) {
+	if !booking.TransactionID.Valid {
+		return nil, ErrNotInitialized
+	}
+
+	t, err := s.store.Payment.GetTransaction(ctx, booking.ID)
+	if err != nil {
+		if errors.Is(err, store.ErrRecordNotFound) {
+			return nil, ErrNotInitialized
+		}
+		return nil, err
+	}
+	if t.Provider != s.provider.Name() {
+		return nil, fmt.Errorf("booking %d is paid through %s, not %s", booking.ID, t.Provider, s.provider.Name())
+	}
+
+	return s.provider.Methods(ctx, &Transaction{
+		TransactionID: t.TransactionID,
+		Reference:     t.Reference,
+		PaymentURL:    t.URL,
+		Amount:        t.Amount,
+		Details:       t.Details,
+	})
+}
+
+// Charge collects the initialised transaction of a booking with method
+func (s *Service) Charge(ctx context.Context, booking *store.Booking, method, phoneNumber string) (*Charge, error) {
+	if !booking.TransactionID.Valid {
+		return nil, ErrNotInitialized
+	}
+
+	amount, err := s.amountDue(ctx, booking)
+	if err != nil {
+		return nil, err
+	}
+
+	charge, err := s.provider.Charge(ctx, ChargeRequest{
+		BookingID:     booking.ID,
+		TransactionID: booking.TransactionID.String,
+		Method:        method,
+		PhoneNumber:   phoneNumber,
+		Amount:        amount,
+		Currency:      booking.Currency,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.store.Payment.SaveCharge(ctx, booking.ID, charge.ID, string(charge.State)); err != nil {
+		return nil, err
+	}
+
+	return charge, nil
+}
+
+// Notification verifies and reads a notification sent by the gateway
+func (s *Service) Notification(r *http.Request) (*Notification, error) {
+	return s.provider.VerifyWebhook(r)
+}
+
+// amountDue is what paying for a booking costs: a series paid at once is
+// charged for all its unpaid occurrences
+func (s *Service) amountDue(ctx context.Context, booking *store.Booking) (int, error) {
+	if !booking.SeriesID.Valid {
+		return booking.TotalAmount, nil
+	}
+
+	series, err := s.store.Series.GetByID(ctx, booking.SeriesID.Int64)
+	if err != nil {
+		return 0, err
+	}
+	if !series.SinglePayment {
+		return booking.TotalAmount, nil
+	}
+
+	return s.store.Series.OutstandingAmount(ctx, series.ID)
+}
@@ -0,0 +1,223 @@
+package payment
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"consult_app.cedrickewi/internal/store"
+	"consult_app.cedrickewi/internal/zoom"
+)
+
+// Sync asks the gateway for the state of a booking's payment and applies it
+// to the booking
+func (s *Service) Sync(ctx context.Context, bookingID int64) (*Status, error) {
+	booking, err := s.store.Booking.GetByID(ctx, bookingID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to retrieve booking: %v", err)
+	}
+	if !booking.TransactionID.Valid {
+		return nil, ErrNotInitialized
+	}
+
+	status, err := s.provider.Status(ctx, booking.TransactionID.String)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.store.Payment.SaveState(ctx, booking.ID, booking.TransactionID.String, string(status.State)); err != nil {
+		return nil, err
+	}
+
+	if err := s.Apply(ctx, booking, status); err != nil {
+		return nil, err
+	}
+
+	return status, nil
+}
+
+// Apply records the state of a booking's payment. A successful payment
+// confirms the booking, and with a series paid at once the rest of the
+// series, and gives each confirmed booking its Zoom meeting. Apply is
+// idempotent: the same status applied again, or applied by the webhook and
+// the worker at once, confirms the booking once and creates one meeting, and
+// a payment already successful is not undone by a late status.
+func (s *Service) Apply(ctx context.Context, booking *store.Booking, status *Status) error {
+	paymentStatus, ok := status.State.PaymentStatus()
+	if !ok {
+		return fmt.Errorf("unknown payment status: %s", status.State)
+	}
+
+	if booking.PaymentStatus == store.PaymentSuccess && status.State != StateSuccess {
+		return nil
+	}
+
+	if booking.PaymentStatus != paymentStatus {
+		if err := s.store.Booking.UpdatePaymentStatus(ctx, booking.ID, paymentStatus, booking.UserID); err != nil {
+			return fmt.Errorf("failed to update booking: %v", err)
+		}
+		booking.PaymentStatus = paymentStatus
+	}
+
+	if status.State != StateSuccess {
+		return nil
+	}
+
+	switch store.BookingStatus(booking.BKStatus) {
+	case store.StatusAwaitingPayment, store.StatusConfirmed:
+	default:
+		// the booking was closed before its payment came through; the
+		// reconciliation report shows it for a refund
+		return nil
+	}
+
+	if !booking.ZoomMeetingID.Valid {
+		if err := s.attachZoomMeeting(ctx, booking); err != nil {
+			return err
+		}
+	}
+	if store.BookingStatus(booking.BKStatus) == store.StatusAwaitingPayment {
+		if err := s.confirm(ctx, booking.ID); err != nil {
+			return err
+		}
+	}
+	if booking.SeriesID.Valid {
+		if err := s.confirmSeries(ctx, booking.SeriesID.Int64); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// confirm moves a paid booking to confirmed. Losing the race to another
+// confirmation of the same payment is not an error.
+func (s *Service) confirm(ctx context.Context, bookingID int64) error {
+	_, err := s.store.Booking.Transition(ctx, bookingID, store.StatusConfirmed, store.ActorSystem, 0, "payment received")
+	if err == nil {
+		return nil
+	}
+	if errors.Is(err, store.ErrInvalidTransition) {
+		current, getErr := s.store.Booking.GetByID(ctx, bookingID)
+		if getErr == nil && store.BookingStatus(current.BKStatus) == store.StatusConfirmed {
+			return nil
+		}
+	}
+	return fmt.Errorf("failed to confirm booking: %v", err)
+}
+
+// attachZoomMeeting creates the Zoom meeting of a paid booking. A group
+// session seat joins the meeting shared by the whole session instead.
+func (s *Service) attachZoomMeeting(ctx context.Context, booking *store.Booking) error {
+	if booking.GroupSessionID.Valid {
+		return s.attachGroupMeeting(ctx, booking)
+	}
+
+	meeting, err := zoom.CreateZoomMeeting(booking)
+	if err != nil {
+		return fmt.Errorf("failed to create zoom meeting: %v", err)
+	}
+	zmtID, err := s.store.ZoomMeeting.Insert(ctx, meeting, booking.UserID)
+	if err != nil {
+		return fmt.Errorf("failed to insert zoom meeting: %v", err)
+	}
+
+	set, err := s.store.Booking.SetZoomMeeting(ctx, booking.ID, zmtID)
+	if err != nil {
+		return fmt.Errorf("failed to update booking with zoom meeting ID: %v", err)
+	}
+	if set {
+		booking.ZoomMeetingID = sql.NullInt64{Int64: zmtID, Valid: true}
+		return nil
+	}
+
+	// the same payment was applied at the same time and won; use its meeting
+	if err := zoom.DeleteZoomMeeting(meeting.MeetingID); err != nil {
+		return fmt.Errorf("failed to delete duplicate zoom meeting: %v", err)
+	}
+	current, err := s.store.Booking.GetByID(ctx, booking.ID)
+	if err != nil {
+		return fmt.Errorf("failed to retrieve booking: %v", err)
+	}
+	booking.ZoomMeetingID = current.ZoomMeetingID
+	return nil
+}
+
+// attachGroupMeeting links a paid seat to its session's Zoom meeting, creating
+// the meeting when the first seat is paid
+func (s *Service) attachGroupMeeting(ctx context.Context, booking *store.Booking) error {
+	session, err := s.store.GroupSession.GetByID(ctx, booking.GroupSessionID.Int64)
+	if err != nil {
+		return fmt.Errorf("failed to retrieve group session: %v", err)
+	}
+
+	if !session.ZoomMeetingID.Valid {
+		host := *booking
+		host.Topic = session.Title
+		host.AdditionalNotes = session.Description
+
+		meeting, err := zoom.CreateZoomMeeting(&host)
+		if err != nil {
+			return fmt.Errorf("failed to create zoom meeting: %v", err)
+		}
+		zmtID, err := s.store.ZoomMeeting.Insert(ctx, meeting, booking.UserID)
+		if err != nil {
+			return fmt.Errorf("failed to insert zoom meeting: %v", err)
+		}
+
+		set, err := s.store.GroupSession.SetZoomMeeting(ctx, session.ID, zmtID)
+		if err != nil {
+			return fmt.Errorf("failed to attach zoom meeting to group session: %v", err)
+		}
+		if set {
+			session.ZoomMeetingID = sql.NullInt64{Int64: zmtID, Valid: true}
+		} else {
+			// another seat was paid at the same time and won; use its meeting
+			if err := zoom.DeleteZoomMeeting(meeting.MeetingID); err != nil {
+				return fmt.Errorf("failed to delete duplicate zoom meeting: %v", err)
+			}
+			if session, err = s.store.GroupSession.GetByID(ctx, session.ID); err != nil {
+				return fmt.Errorf("failed to retrieve group session: %v", err)
+			}
+		}
+	}
+
+	if _, err = s.store.Booking.SetZoomMeeting(ctx, booking.ID, session.ZoomMeetingID.Int64); err != nil {
+		return fmt.Errorf("failed to update booking with zoom meeting ID: %v", err)
+	}
+	booking.ZoomMeetingID = session.ZoomMeetingID
+	return nil
+}
+
+// confirmSeries applies a single series payment to the other occurrences of
+// the series; each confirmed occurrence gets its own Zoom meeting
+func (s *Service) confirmSeries(ctx context.Context, seriesID int64) error {
+	series, err := s.store.Series.GetByID(ctx, seriesID)
+	if err != nil {
+		return fmt.Errorf("failed to retrieve booking series: %v", err)
+	}
+	if !series.SinglePayment {
+		return nil
+	}
+
+	confirmed, err := s.store.Series.MarkPaid(ctx, seriesID)
+	if err != nil {
+		return fmt.Errorf("failed to confirm booking series: %v", err)
+	}
+
+	for _, id := range confirmed {
+		occurrence, err := s.store.Booking.GetByID(ctx, id)
+		if err != nil {
+			return fmt.Errorf("failed to retrieve booking: %v", err)
+		}
+		if occurrence.ZoomMeetingID.Valid {
+			continue
+		}
+		if err := s.attachZoomMeeting(ctx, occurrence); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,83 @@
+package payment
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"consult_app.cedrickewi/internal/store"
+)
+
+// ErrUnknownTransaction is returned for a notification about a transaction
+// no booking was paid with
+var ErrUnknownTransaction = errors.New("no booking is paid with this transaction")
+
+// Process applies a verified notification to the booking paid with its
+// transaction, or to the refund it is about. Every notification is recorded
+// as received; a notification delivered again is processed only if its
+// earlier delivery failed or came before the gateway reported the state it
+// notified. Process returns the status applied, or nil for a notification
+// already processed.
+func (s *Service) Process(ctx context.Context, n *Notification) (*Status, error) {
+	if n.RefundID != "" {
+		return s.processRefund(ctx, n)
+	}
+
+	booking, err := s.store.Booking.GetByTransactionID(ctx, n.TransactionID)
+	if err != nil {
+		if errors.Is(err, store.ErrRecordNotFound) {
+			return nil, ErrUnknownTransaction
+		}
+		return nil, err
+	}
+	if n.BookingID != 0 && n.BookingID != booking.ID {
+		return nil, fmt.Errorf("%w: sent for booking %d, transaction belongs to booking %d", ErrInvalidWebhook, n.BookingID, booking.ID)
+	}
+
+	event := store.PaymentEvent{
+		Provider:      s.provider.Name(),
+		DedupeKey:     n.DedupeKey,
+		TransactionID: n.TransactionID,
+		State:         string(n.State),
+		Payload:       n.Payload,
+	}
+
+	claimed, err := s.store.PaymentEvent.Record(ctx, &event)
+	if err != nil || !claimed {
+		return nil, err
+	}
+
+	// the notification only says the transaction changed; its state is
+	// asked from the gateway
+	status, err := s.Sync(ctx, booking.ID)
+
+	var applied State
+	if status != nil {
+		applied = status.State
+	}
+	if err := s.finish(ctx, &event, n.State, applied, err); err != nil {
+		return nil, err
+	}
+
+	return status, nil
+}
+
+// finish records how processing a claimed notification went. A notification
+// whose state the gateway does not report yet is released unprocessed, so
+// that delivering it again once the gateway agrees is not dropped as a
+// duplicate.
+func (s *Service) finish(ctx context.Context, event *store.PaymentEvent, notified, applied State, err error) error {
+	processErr := ""
+	switch {
+	case err != nil:
+		processErr = err.Error()
+	case !strings.EqualFold(string(notified), string(applied)):
+		processErr = fmt.Sprintf("notified %s, gateway reports %s", notified, applied)
+	}
+
+	if markErr := s.store.PaymentEvent.MarkProcessed(ctx, event.ID, processErr); markErr != nil && err == nil {
+		err = markErr
+	}
+	return err
+}
@@ -0,0 +1,227 @@
+package payunit
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+
+	"consult_app.cedrickewi/internal/env"
+)
+
+const (
+	ModeSandbox = "sandbox"
+	ModeLive    = "live"
+)
+
+// Config is how the API and the worker reach PayUnit. It is loaded once at
+// startup.
+type Config struct {
+	// Mode is sandbox or live; it picks the API token sent to PayUnit
+	Mode         string
+	BaseURL      string
+	SandboxToken string
+	LiveToken    string
+	Username     string
+	Password     string
+	// ReturnURL is where clients land after paying
+	ReturnURL string
+	// NotifyURL is where PayUnit notifies transaction changes
+	NotifyURL string
+	// Timeout bounds every call to PayUnit
+	Timeout time.Duration
+	// WebhookSecret signs the notify URL of each transaction, binding it to
+	// the transaction and an expiry; notifications are not authenticated
+	// without it, which only sandbox mode allows
+	WebhookSecret string
+	// WebhookAllowlist restricts where notifications may come from; any
+	// source is accepted when it is empty
+	WebhookAllowlist []*net.IPNet
+	// TrustedProxies are the proxies whose X-Forwarded-For is believed when
+	// checking the source of a notification; without them the TCP peer is
+	// the source
+	TrustedProxies []*net.IPNet
+}
+
+// LoadConfig reads the PayUnit configuration from the environment and
+// validates it
+func LoadConfig() (Config, error) {
+	timeout, err := time.ParseDuration(env.GetString("PAYUNIT_TIMEOUT", "10s"))
+	if err != nil {
+		return Config{}, fmt.Errorf("invalid PAYUNIT_TIMEOUT: %w", err)
+	}
+
+	allowlist, err := parseAllowlist(env.GetString("PAYUNIT_WEBHOOK_IPS", ""))
+	if err != nil {
+		return Config{}, fmt.Errorf("invalid PAYUNIT_WEBHOOK_IPS: %w", err)
+	}
+
+	proxies, err := parseAllowlist(env.GetString("PAYUNIT_TRUSTED_PROXIES", ""))
+	if err != nil {
+		return Config{}, fmt.Errorf("invalid PAYUNIT_TRUSTED_PROXIES: %w", err)
+	}
+
+	frontendURL := strings.TrimSuffix(env.GetString("FRONTEND_URL", "http://localhost:4000"), "/")
+	backendURL := strings.TrimSuffix(env.GetString("BACKEND_URL", "http://localhost:8080"), "/")
+
+	cfg := Config{
+		Mode:         strings.ToLower(env.GetString("PAYUNIT_MODE", ModeSandbox)),
+		BaseURL:      strings.TrimSuffix(env.GetString("PAYUNIT_BASE_URL", "https://gateway.payunit.net"), "/"),
+		SandboxToken: env.GetString("PAYUNIT_API_TOKEN_SANDBOX", ""),
+		LiveToken:    env.GetString("PAYUNIT_API_TOKEN_LIVE", ""),
+		Username:     env.GetString("PAYUNIT_API_USERNAME", ""),
+		Password:     env.GetString("PAYUNIT_API_PASSWORD", ""),
+		ReturnURL:    env.GetString("PAYUNIT_RETURN_URL", frontendURL+"/dashboard/booking/paymentsuccess"),
+		NotifyURL:    env.GetString("PAYUNIT_NOTIFY_URL", backendURL+"/api/v1/payunit/notify"),
+		Timeout:      timeout,
+
+		WebhookSecret:    env.GetString("PAYUNIT_WEBHOOK_SECRET", ""),
+		WebhookAllowlist: allowlist,
+		TrustedProxies:   proxies,
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return Config{}, err
+	}
+
+	return cfg, nil
+}
+
+// Validate checks the configuration is usable. Live mode needs its token,
+// the API credentials and https URLs, so a misconfigured deployment fails at
+// startup rather than at a client's first payment.
+func (c Config) Validate() error {
+	var problems []string
+
+	switch c.Mode {
+	case ModeSandbox, ModeLive:
+	default:
+		problems = append(problems, fmt.Sprintf("PAYUNIT_MODE must be %q or %q", ModeSandbox, ModeLive))
+	}
+
+	if c.Timeout <= 0 {
+		problems = append(problems, "PAYUNIT_TIMEOUT must be positive")
+	}
+
+	live := c.Mode == ModeLive
+	for _, u := range []struct{ name, raw string }{
+		{"PAYUNIT_BASE_URL", c.BaseURL},
+		{"PAYUNIT_RETURN_URL", c.ReturnURL},
+		{"PAYUNIT_NOTIFY_URL", c.NotifyURL},
+	} {
+		parsed, err := url.Parse(u.raw)
+		switch {
+		case err != nil || parsed.Host == "":
+			problems = append(problems, u.name+" must be an absolute URL")
+		case live && parsed.Scheme != "https":
+			problems = append(problems, u.name+" must use https in live mode")
+		}
+	}
+
+	// the source address alone does not authenticate a notification
+	if len(c.WebhookAllowlist) > 0 && c.WebhookSecret == "" {
+		problems = append(problems, "PAYUNIT_WEBHOOK_SECRET must be set when PAYUNIT_WEBHOOK_IPS is")
+	}
+
+	if live {
+		if c.LiveToken == "" {
+			problems = append(problems, "PAYUNIT_API_TOKEN_LIVE must be set in live mode")
+		}
+		if c.Username == "" || c.Password == "" {
+			problems = append(problems, "PAYUNIT_API_USERNAME and PAYUNIT_API_PASSWORD must be set in live mode")
+		}
+		if len(c.WebhookSecret) < 32 {
+			problems = append(problems, "PAYUNIT_WEBHOOK_SECRET must be at least 32 characters in live mode")
+		}
+	}
+
+	if len(problems) > 0 {
+		return errors.New("invalid PayUnit configuration: " + strings.Join(problems, "; "))
+	}
+
+	return nil
+}
+
+// Token is the API token of the configured mode
+func (c Config) Token() string {
+	if c.Mode == ModeLive {
+		return c.LiveToken
+	}
+	return c.SandboxToken
+}
+
+// parseAllowlist reads a comma separated list of IP addresses and CIDR ranges
+func parseAllowlist(list string) ([]*net.IPNet, error) {
+	var nets []*net.IPNet
+	for _, entry := range strings.Split(list, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		if !strings.Contains(entry, "/") {
+			ip := net.ParseIP(entry)
+			if ip == nil {
+				return nil, fmt.Errorf("%q is not an IP address", entry)
+			}
+			bits := 8 * net.IPv6len
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 8*net.IPv4len
+			}
+			nets = append(nets, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+
+		_, ipNet, err := net.ParseCIDR(entry)
+		if err != nil {
+			return nil, err
+		}
+		nets = append(nets, ipNet)
+	}
+	return nets, nil
+}
+
+// source returns the address a notification came from: its TCP peer, or,
+// when the peer is a trusted proxy, the last address in X-Forwarded-For that
+// is not one
+func (c Config) source(peer, forwardedFor string) net.IP {
+	host, _, err := net.SplitHostPort(peer)
+	if err != nil {
+		host = peer
+	}
+	ip := net.ParseIP(host)
+
+	hops := strings.Split(forwardedFor, ",")
+	for i := len(hops) - 1; i >= 0 && contains(c.TrustedProxies, ip); i-- {
+		hop := net.ParseIP(strings.TrimSpace(hops[i]))
+		if hop == nil {
+			break
+		}
+		ip = hop
+	}
+
+	return ip
+}
+
+// contains reports whether ip is in one of nets
+func contains(nets []*net.IPNet, ip net.IP) bool {
+	if ip == nil {
+		return false
+	}
+	for _, n := range nets {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// allows reports whether a notification may come from ip
+func (c Config) allows(ip net.IP) bool {
+	if len(c.WebhookAllowlist) == 0 {
+		return true
+	}
+	return contains(c.WebhookAllowlist, ip)
+}
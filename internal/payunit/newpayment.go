@@ -3,29 +3,44 @@ package payunit
 import (
 	"bytes"
 	"context"
-	"database/sql"
+	"crypto/hmac"
+	"crypto/sha256"
 	"encoding/base64"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
-	"os"
+	"net/url"
+	"strconv"
+	"strings"
 	"time"
 
-	"consult_app.cedrickewi/internal/store"
-	"consult_app.cedrickewi/internal/zoom"
+	"consult_app.cedrickewi/internal/payment"
 )
 
 const (
-	CmOrange     = "CM_ORANGE"
-	CmMtn        = "CM_MTN"
-	PlatformFees = 1000
+	CmOrange = "CM_ORANGE"
+	CmMtn    = "CM_MTN"
 )
 
+// notifyURLLifetime is how long the signed notify URL of a transaction is
+// accepted; a transaction changing later is picked up by the worker, which
+// asks PayUnit about payments left pending
+const notifyURLLifetime = 24 * time.Hour
+
+// maxNotificationSize bounds the body of a notification read
+const maxNotificationSize = 1 << 20
+
+// Payunit takes payments through the PayUnit gateway. It only talks to
+// PayUnit; what it answers is recorded by the payment service.
 type Payunit struct {
-	store store.Storage
+	config Config
+	client *http.Client
 }
 
+var _ payment.PaymentProvider = (*Payunit)(nil)
+
 // PayUnitRequest defines the payload structure
 type PayUnitRequest struct {
 	TotalAmount    int    `json:"total_amount"`
@@ -47,309 +62,278 @@ type PaymentRequest struct {
 	NotifyURL     string `json:"notify_url"`
 }
 
-// InitializePayUnitTransaction sends a POST request to PayUnit
-func (p *Payunit) InitializePayUnitTransaction(ctx context.Context, requestBody PayUnitRequest, bookingID int64, userID int64) (*store.PayUnitResponse, error) {
-	PAYUNIT_API_USERNAME := os.Getenv("PAYUNIT_API_USERNAME")
-	PAYUNIT_API_PASSWORD := os.Getenv("PAYUNIT_API_PASSWORD")
-	PAYUNIT_API_TOKEN_SANDBOX := os.Getenv("PAYUNIT_API_TOKEN_SANDBOX")
-	// PAYUNIT_API_TOKEN_LIVE := os.Getenv("PAYUNIT_API_TOKEN_LIVE")
-	// PAYUNIT_BASE_URL := os.Getenv("PAYUNIT_BASE_URL")
-	// PAYUNIT_MODE := os.Getenv("PAYUNIT_MODE")
-	BackendURL := os.Getenv("BACKEND_URL")
-	NotifyURL := fmt.Sprintf("%s/api/v1/payunit/notify?bookingID=%d", BackendURL, bookingID)
-
-	url := "https://gateway.payunit.net/api/gateway/initialize"
+// Name identifies PayUnit among the payment gateways
+func (p *Payunit) Name() string {
+	return "payunit"
+}
 
-	booking, err := p.store.Booking.GetByID(ctx, bookingID)
-	if err != nil {
-		return nil, err
+// Initialize opens a PayUnit transaction for a checkout
+func (p *Payunit) Initialize(ctx context.Context, c payment.Checkout) (*payment.Transaction, error) {
+	country := c.Country
+	if country == "" {
+		country = "CM"
 	}
 
-	transactionID := fmt.Sprintf("txn_%d_%d_%d", time.Now().UnixNano(), userID, booking.ID)
-
 	payload := PayUnitRequest{
-		TotalAmount:    booking.TotalAmount,
-		Currency:       "XAF",
-		TransactionID:  transactionID,
-		ReturnURL:      "www.consult-out.com/dashboard/bookings",
-		NotifyURL:      NotifyURL, //TODO: change notify URL to server url endpoint
-		PaymentCountry: "CM",
+		TotalAmount:    c.Amount,
+		Currency:       c.Currency,
+		TransactionID:  c.TransactionID,
+		ReturnURL:      p.config.ReturnURL,
+		NotifyURL:      p.notifyURL(c.BookingID, c.TransactionID),
+		PaymentCountry: country,
 	}
 
-	jsonData, err := json.Marshal(payload)
-	if err != nil {
-		return nil, fmt.Errorf("failed to encode JSON: %v", err)
+	var result PayUnitResponse
+	if err := p.do(ctx, http.MethodPost, "/initialize", payload, &result); err != nil {
+		return nil, err
 	}
 
-	req, err := http.NewRequest("POST", url, bytes.NewBuffer(jsonData))
+	details, err := json.Marshal(transactionDetails{
+		TID:  result.Data.TID,
+		TSum: result.Data.TSum,
+		TURL: result.Data.TURL,
+	})
 	if err != nil {
-		return nil, fmt.Errorf("failed to create request: %v", err)
+		return nil, err
 	}
 
-	encodedValue := base64.StdEncoding.EncodeToString([]byte(fmt.Sprintf("%s:%s", PAYUNIT_API_USERNAME, PAYUNIT_API_PASSWORD)))
-
-	// Set headers
-	req.Header.Set("x-api-key", PAYUNIT_API_TOKEN_SANDBOX)
-	req.Header.Set("mode", "sandbox")
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("Authorization", fmt.Sprintf("Basic %s", encodedValue))
-
-	client := &http.Client{}
-	resp, err := client.Do(req)
+	amount, err := strconv.Atoi(result.Data.TSum)
 	if err != nil {
-		return nil, fmt.Errorf("failed to send request: %v", err)
+		amount = c.Amount
 	}
-	defer resp.Body.Close()
-
-	body, _ := io.ReadAll(resp.Body)
 
-	// Debug print raw response (optional)
+	return &payment.Transaction{
+		TransactionID: c.TransactionID,
+		Reference:     result.Data.TID,
+		PaymentURL:    result.Data.TransactionURL,
+		Amount:        amount,
+		Details:       details,
+		Response:      &result,
+	}, nil
+}
 
-	var result store.PayUnitResponse
-	if err := json.Unmarshal(body, &result); err != nil {
-		return nil, fmt.Errorf("failed to parse response: %v", err)
+// Methods lists the PayUnit gateways that can pay an initialised transaction
+func (p *Payunit) Methods(ctx context.Context, txn *payment.Transaction) ([]payment.Method, error) {
+	var details transactionDetails
+	if err := json.Unmarshal(txn.Details, &details); err != nil {
+		return nil, fmt.Errorf("unreadable PayUnit details for transaction %s: %v", txn.TransactionID, err)
 	}
 
-	initTtranxID, err := p.store.PayUnit.InsertInitializedTransaction(ctx, &result)
-	if err != nil {
-		return nil, err
-	}
+	query := url.Values{}
+	query.Set("t_url", details.TURL)
+	query.Set("t_id", details.TID)
+	query.Set("t_sum", details.TSum)
 
-	if err := p.store.Booking.UpdateInitTransactionID(ctx, bookingID, initTtranxID); err != nil {
+	var result PayunitProvidersResponse
+	if err := p.do(ctx, http.MethodGet, "/gateways?"+query.Encode(), nil, &result); err != nil {
 		return nil, err
 	}
 
-	if err := p.store.Booking.UpdateTransactionID(ctx, bookingID, transactionID); err != nil {
-		return nil, err
+	methods := make([]payment.Method, 0, len(result.Data))
+	for _, d := range result.Data {
+		methods = append(methods, payment.Method{
+			Code:        d.ShortCode,
+			Name:        d.Name,
+			Logo:        d.Logo,
+			CountryCode: d.Country.CountryCode,
+		})
 	}
 
-	// add the initialized transaction ID to the booking table
-	return &result, nil
+	return methods, nil
 }
 
-func (p *Payunit) GetProviders(ctx context.Context, bookingID int64) (*store.PayunitProvidersResponse, error) {
-	PAYUNIT_API_USERNAME := os.Getenv("PAYUNIT_API_USERNAME")
-	PAYUNIT_API_PASSWORD := os.Getenv("PAYUNIT_API_PASSWORD")
-	PAYUNIT_API_TOKEN_SANDBOX := os.Getenv("PAYUNIT_API_TOKEN_SANDBOX")
-	// PAYUNIT_API_TOKEN_LIVE := os.Getenv("PAYUNIT_API_TOKEN_LIVE")
-	// PAYUNIT_BASE_URL := os.Getenv("PAYUNIT_BASE_URL")
-	// PAYUNIT_MODE := os.Getenv("PAYUNIT_MODE")
-
-	payunitTransaction, err := p.store.PayUnit.GetPayunitInitializationByTransactionID(ctx, bookingID)
-	if err != nil {
-		return nil, err
+// Charge makes the payment of a transaction with one of PayUnit's gateways
+func (p *Payunit) Charge(ctx context.Context, req payment.ChargeRequest) (*payment.Charge, error) {
+	payload := PaymentRequest{
+		Gateway:       req.Method,
+		Amount:        req.Amount,
+		TransactionID: req.TransactionID,
+		ReturnURL:     p.config.ReturnURL,
+		PhoneNumber:   req.PhoneNumber,
+		Currency:      req.Currency,
+		PaymentType:   "button",
+		NotifyURL:     p.notifyURL(req.BookingID, req.TransactionID),
 	}
 
-	url := fmt.Sprintf("https://gateway.payunit.net/api/gateway/gateways?t_url=%s&t_id=%s&t_sum=%d", payunitTransaction.Data.TURL, payunitTransaction.Data.TID, payunitTransaction.Data.TSum)
-
-	req, err := http.NewRequest("GET", url, nil)
-	if err != nil {
+	var result PaymentResponse
+	if err := p.do(ctx, http.MethodPost, "/makepayment", payload, &result); err != nil {
 		return nil, err
 	}
 
-	encodedValue := base64.StdEncoding.EncodeToString([]byte(fmt.Sprintf("%s:%s", PAYUNIT_API_USERNAME, PAYUNIT_API_PASSWORD)))
-
-	req.Header.Set("x-api-key", PAYUNIT_API_TOKEN_SANDBOX)
-	req.Header.Set("mode", "sandbox")
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("Authorization", fmt.Sprintf("Basic %s", encodedValue))
+	return &payment.Charge{
+		ID:                    result.Data.ID,
+		TransactionID:         result.Data.TransactionID,
+		State:                 payment.State(strings.ToUpper(result.Data.PaymentStatus)),
+		ProviderTransactionID: result.Data.ProviderTransactionID,
+	}, nil
+}
 
-	client := &http.Client{}
-	resp, err := client.Do(req)
-	if err != nil {
+// Status asks PayUnit for the state of a transaction
+func (p *Payunit) Status(ctx context.Context, transactionID string) (*payment.Status, error) {
+	var result PaymentStatusResponse
+	if err := p.do(ctx, http.MethodGet, "/paymentstatus/"+url.PathEscape(transactionID), nil, &result); err != nil {
 		return nil, err
 	}
-	defer resp.Body.Close()
 
-	body, _ := io.ReadAll(resp.Body)
-	fmt.Println("Providers response:", string(body))
-
-	var result store.PayunitProvidersResponse
-	if err := json.Unmarshal(body, &result); err != nil {
-		return nil, fmt.Errorf("failed to parse response: %v", err)
-	}
-
-	return &result, nil
+	return &payment.Status{
+		TransactionID: transactionID,
+		State:         payment.State(result.Data.TransactionStatus),
+		Amount:        result.Data.TransactionAmount,
+		Currency:      result.Data.TransactionCurrency,
+		Method:        result.Data.TransactionGateway,
+		Message:       result.Data.Message,
+	}, nil
 }
 
-func (p *Payunit) MakePayment(ctx context.Context, requestBody PaymentRequest, bookingID int64, userID int64) (*store.PaymentResponse, error) {
-	PAYUNIT_API_USERNAME := os.Getenv("PAYUNIT_API_USERNAME")
-	PAYUNIT_API_PASSWORD := os.Getenv("PAYUNIT_API_PASSWORD")
-	PAYUNIT_API_TOKEN_SANDBOX := os.Getenv("PAYUNIT_API_TOKEN_SANDBOX")
-	BackendURL := os.Getenv("BACKEND_URL")
-	frontendURL := os.Getenv("FRONTEND_URL")
-
-	ReturnURL := fmt.Sprintf("%s/dashboard/booking/paymentsuccess", frontendURL)
-	NotifyURL := fmt.Sprintf("%s/api/v1/payunit/notify?bookingID=%d", BackendURL, bookingID)
-
-	url := "https://gateway.payunit.net/api/gateway/makepayment"
-
-	booking, err := p.store.Booking.GetByID(ctx, bookingID)
-	if err != nil {
-		return nil, err
-	}
+// Refund returns payment.ErrRefundUnsupported: the PayUnit gateway API used
+// here (initialize, gateways, makepayment, paymentstatus) has no documented
+// refund call, so refunds are paid out by hand until one is confirmed
+func (p *Payunit) Refund(ctx context.Context, req payment.RefundRequest) (*payment.Refund, error) {
+	return nil, payment.ErrRefundUnsupported
+}
 
-	payload := PaymentRequest{
-		Gateway:       requestBody.Gateway,
-		Amount:        booking.TotalAmount,
-		TransactionID: booking.TransactionID.String,
-		ReturnURL:     ReturnURL,
-		PhoneNumber:   requestBody.PhoneNumber,
-		Currency:      "XAF",
-		PaymentType:   "button",
-		NotifyURL:     NotifyURL,
-	}
+// RefundStatus returns payment.ErrRefundUnsupported, as PayUnit never issues
+// the refunds
+func (p *Payunit) RefundStatus(ctx context.Context, refundID string) (*payment.Refund, error) {
+	return nil, payment.ErrRefundUnsupported
+}
 
-	jsonData, err := json.Marshal(payload)
-	if err != nil {
-		return nil, fmt.Errorf("failed to encode JSON: %v", err)
-	}
-	req, err := http.NewRequest("POST", url, bytes.NewBuffer(jsonData))
+// VerifyWebhook reads a PayUnit notification. It must come from the
+// configured allowlist and, once a webhook secret is set, arrive at the notify
+// URL signed for its transaction before that URL expired. PayUnit does not
+// sign notifications itself, so the signature is our own, put in the URL
+// given with the transaction. The notification only tells which transaction
+// changed: its state is always asked from PayUnit before use.
+func (p *Payunit) VerifyWebhook(r *http.Request) (*payment.Notification, error) {
+	// RemoteAddr may have been rewritten from forwarded headers; only the
+	// TCP peer and the proxies trusted in front of it are believed
+	source := p.config.source(payment.Peer(r), r.Header.Get("X-Forwarded-For"))
+	if !p.config.allows(source) {
+		return nil, fmt.Errorf("%w: unexpected source %s", payment.ErrInvalidWebhook, source)
+	}
+
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxNotificationSize))
 	if err != nil {
-		return nil, fmt.Errorf("failed to create request: %v", err)
+		return nil, fmt.Errorf("failed to read notification: %v", err)
 	}
-	encodedValue := base64.StdEncoding.EncodeToString([]byte(fmt.Sprintf("%s:%s", PAYUNIT_API_USERNAME, PAYUNIT_API_PASSWORD)))
 
-	// Set headers
-	req.Header.Set("x-api-key", PAYUNIT_API_TOKEN_SANDBOX)
-	req.Header.Set("mode", "sandbox")
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("Authorization", fmt.Sprintf("Basic %s", encodedValue))
+	query := r.URL.Query()
+	bookingID, _ := strconv.ParseInt(query.Get("bookingID"), 10, 64)
 
-	client := &http.Client{}
-	resp, err := client.Do(req)
-	if err != nil {
-		return nil, err
+	var payload struct {
+		TransactionStatus string `json:"transaction_status"`
+		TransactionID     string `json:"transaction_id"`
 	}
-	defer resp.Body.Close()
-
-	body, _ := io.ReadAll(resp.Body)
-	fmt.Println("Payment response:", string(body))
-
-	var result store.PaymentResponse
-	if err := json.Unmarshal(body, &result); err != nil {
-		return nil, fmt.Errorf("failed to parse response: %v", err)
+	if err := json.Unmarshal(body, &payload); err != nil || payload.TransactionID == "" {
+		return nil, fmt.Errorf("%w: malformed payload", payment.ErrInvalidWebhook)
 	}
 
-	paymentID, err := p.store.PayUnit.InsertPayunitPayment(ctx, &result)
-	if err != nil {
-		return nil, err
-	}
+	if p.config.WebhookSecret != "" {
+		expires, _ := strconv.ParseInt(query.Get("expires"), 10, 64)
+		transactionID := query.Get("transaction_id")
 
-	if err := p.store.Booking.UpdatePayunitPaymentID(ctx, bookingID, paymentID); err != nil {
-		return nil, err
+		switch {
+		case bookingID <= 0 || transactionID == "" || expires <= 0:
+			return nil, fmt.Errorf("%w: unsigned notify URL", payment.ErrInvalidWebhook)
+		case !p.validSignature(notifySignedData(bookingID, transactionID, expires), query.Get("signature")):
+			return nil, fmt.Errorf("%w: bad signature", payment.ErrInvalidWebhook)
+		case time.Now().Unix() > expires:
+			return nil, fmt.Errorf("%w: notify URL expired", payment.ErrInvalidWebhook)
+		case transactionID != payload.TransactionID:
+			return nil, fmt.Errorf("%w: notify URL is for transaction %s", payment.ErrInvalidWebhook, transactionID)
+		}
 	}
 
-	return &result, nil
+	return &payment.Notification{
+		TransactionID: payload.TransactionID,
+		State:         payment.State(payload.TransactionStatus),
+		BookingID:     bookingID,
+		DedupeKey:     payload.TransactionID + ":" + strings.ToUpper(payload.TransactionStatus),
+		Payload:       body,
+	}, nil
 }
 
-func (p *Payunit) GetPaymentStatus(ctx context.Context, bookingID int64) (*store.PaymentStatusResponse, error) {
-	PAYUNIT_API_USERNAME := os.Getenv("PAYUNIT_API_USERNAME")
-	PAYUNIT_API_PASSWORD := os.Getenv("PAYUNIT_API_PASSWORD")
-	PAYUNIT_API_TOKEN_SANDBOX := os.Getenv("PAYUNIT_API_TOKEN_SANDBOX")
+// sign returns the hex HMAC-SHA256 of data under the webhook secret
+func (p *Payunit) sign(data []byte) string {
+	mac := hmac.New(sha256.New, []byte(p.config.WebhookSecret))
+	mac.Write(data)
+	return hex.EncodeToString(mac.Sum(nil))
+}
 
-	// 1️⃣ Fetch the booking
-	booking, err := p.store.Booking.GetByID(ctx, bookingID)
-	if err != nil {
-		return nil, fmt.Errorf("failed to retrieve booking: %v", err)
-	}
+func (p *Payunit) validSignature(data []byte, signature string) bool {
+	return hmac.Equal([]byte(p.sign(data)), []byte(strings.ToLower(signature)))
+}
 
-	if !booking.TransactionID.Valid {
-		return nil, fmt.Errorf("booking has no transaction ID")
+// do sends a request to the PayUnit API and decodes its JSON answer into out
+func (p *Payunit) do(ctx context.Context, method, path string, in, out any) error {
+	var body io.Reader
+	if in != nil {
+		jsonData, err := json.Marshal(in)
+		if err != nil {
+			return fmt.Errorf("failed to encode JSON: %v", err)
+		}
+		body = bytes.NewReader(jsonData)
 	}
-	transactionID := booking.TransactionID.String
-
-	// 2️⃣ Build request
-	url := fmt.Sprintf("https://gateway.payunit.net/api/gateway/paymentstatus/%s", transactionID)
-	reqCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
-	defer cancel()
 
-	req, err := http.NewRequestWithContext(reqCtx, "GET", url, nil)
+	req, err := http.NewRequestWithContext(ctx, method, p.config.BaseURL+"/api/gateway"+path, body)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create request: %v", err)
+		return fmt.Errorf("failed to create request: %v", err)
 	}
 
-	encodedValue := base64.StdEncoding.EncodeToString([]byte(fmt.Sprintf("%s:%s", PAYUNIT_API_USERNAME, PAYUNIT_API_PASSWORD)))
-	req.Header.Set("x-api-key", PAYUNIT_API_TOKEN_SANDBOX)
-	req.Header.Set("mode", "sandbox")
+	credentials := fmt.Sprintf("%s:%s", p.config.Username, p.config.Password)
+
+	req.Header.Set("x-api-key", p.config.Token())
+	req.Header.Set("mode", p.config.Mode)
 	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("Authorization", fmt.Sprintf("Basic %s", encodedValue))
+	req.Header.Set("Authorization", "Basic "+base64.StdEncoding.EncodeToString([]byte(credentials)))
 
-	// 3️⃣ Send request
-	client := &http.Client{}
-	resp, err := client.Do(req)
+	resp, err := p.client.Do(req)
 	if err != nil {
-		return nil, fmt.Errorf("PayUnit request failed: %v", err)
+		return fmt.Errorf("PayUnit request failed: %v", err)
 	}
 	defer resp.Body.Close()
 
-	body, _ := io.ReadAll(resp.Body)
+	respBody, _ := io.ReadAll(resp.Body)
 
-	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("unexpected status code %d: %s", resp.StatusCode, string(body))
+	if resp.StatusCode >= http.StatusBadRequest {
+		return fmt.Errorf("unexpected status code %d: %s", resp.StatusCode, string(respBody))
 	}
 
-	fmt.Println("📦 PayUnit Payment Status response:", string(body))
-
-	var result store.PaymentStatusResponse
-	if err := json.Unmarshal(body, &result); err != nil {
-		return nil, fmt.Errorf("failed to parse response: %v", err)
+	if err := json.Unmarshal(respBody, out); err != nil {
+		return fmt.Errorf("failed to parse response: %v", err)
 	}
 
-	// 4️⃣ Insert or update DB
-	exists, err := p.store.PayUnit.CheckPaymentStatusExists(ctx, transactionID)
-	if err != nil {
-		return nil, err
-	}
+	return nil
+}
 
-	if !exists {
-		if _, err := p.store.PayUnit.InsertPaymentStatus(ctx, &result); err != nil {
-			return nil, fmt.Errorf("failed to insert payment status: %v", err)
-		}
-	}
+// notifyURL is where PayUnit notifies the changes of a booking's
+// transaction. With a webhook secret set it is signed for the booking and the
+// transaction, and expires after notifyURLLifetime.
+func (p *Payunit) notifyURL(bookingID int64, transactionID string) string {
+	return p.signedNotifyURL(bookingID, transactionID, time.Now().Add(notifyURLLifetime))
+}
 
-	// 5️⃣ Update booking and handle business logic
-	switch result.Data.TransactionStatus {
-	case "PENDING":
-		err = p.store.Booking.UpdatePaymentStatus(ctx, bookingID, "pending", booking.UserID)
-	case "SUCCESS":
-		if err := p.store.Booking.UpdatePaymentStatus(ctx, bookingID, "paid", booking.UserID); err != nil {
-			return nil, fmt.Errorf("failed to update booking status: %v", err)
-		}
-		if booking.ZoomMeetingID.Valid {
-			return &result, nil
-		}
-		meeting, err := zoom.CreateZoomMeeting(booking)
-		if err != nil {
-			return nil, fmt.Errorf("failed to create zoom meeting: %v", err)
-		}
-		zmtID, err := p.store.ZoomMeeting.Insert(ctx, meeting, booking.UserID)
-		if err != nil {
-			return nil, fmt.Errorf("failed to insert zoom meeting: %v", err)
-		}
-		booking.ZoomMeetingID = sql.NullInt64{Int64: zmtID, Valid: true}
-		booking.BKStatus = "confirmed"
-		if err = p.store.Booking.Update(ctx, booking); err != nil {
-			return nil, fmt.Errorf("failed to update booking with zoom meeting ID: %v", err)
-		}
-  
-	case "FAILED":
-		err = p.store.Booking.UpdatePaymentStatus(ctx, bookingID, "failed", booking.UserID)
-	case "CANCELLED":
-		err = p.store.Booking.UpdatePaymentStatus(ctx, bookingID, "cancelled", booking.UserID)
-	default:
-		return nil, fmt.Errorf("unknown payment status: %s", result.Data.TransactionStatus)
-	}
-	if err != nil {
-		return nil, fmt.Errorf("failed to update booking: %v", err)
+func (p *Payunit) signedNotifyURL(bookingID int64, transactionID string, expires time.Time) string {
+	query := url.Values{}
+	query.Set("bookingID", strconv.FormatInt(bookingID, 10))
+	query.Set("transaction_id", transactionID)
+	if p.config.WebhookSecret != "" {
+		query.Set("expires", strconv.FormatInt(expires.Unix(), 10))
+		query.Set("signature", p.sign(notifySignedData(bookingID, transactionID, expires.Unix())))
 	}
+	return p.config.NotifyURL + "?" + query.Encode()
+}
 
-	return &result, nil
+// notifySignedData is what the signature of a notify URL covers
+func notifySignedData(bookingID int64, transactionID string, expires int64) []byte {
+	return []byte(fmt.Sprintf("%d|%s|%d", bookingID, transactionID, expires))
 }
 
-func NewPayunit(db *sql.DB) Payunit {
-	storage := store.NewStorage(db)
-	return Payunit{
-		store: storage,
+// NewPayunit returns a PayUnit gateway configured by cfg, which should come
+// from LoadConfig
+func NewPayunit(cfg Config) *Payunit {
+	return &Payunit{
+		config: cfg,
+		client: &http.Client{Timeout: cfg.Timeout},
 	}
 }
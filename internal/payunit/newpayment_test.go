@@ -0,0 +1,219 @@
+package payunit
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"consult_app.cedrickewi/internal/payment"
+)
+
+// gateway stands in for the PayUnit API: it checks each request with check
+// and answers with the JSON of response
+func gateway(t *testing.T, check func(t *testing.T, r *http.Request), response any) *Payunit {
+	t.Helper()
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if user, pass, ok := r.BasicAuth(); !ok || user != "user" || pass != "secret" {
+			t.Errorf("basic auth = %q, %q, want user, secret", user, pass)
+		}
+		if got := r.Header.Get("x-api-key"); got != "sandbox-token" {
+			t.Errorf("x-api-key = %q, want sandbox-token", got)
+		}
+		if got := r.Header.Get("mode"); got != ModeSandbox {
+			t.Errorf("mode = %q, want %q", got, ModeSandbox)
+		}
+		check(t, r)
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(response)
+	}))
+	t.Cleanup(srv.Close)
+
+	return NewPayunit(Config{
+		Mode:         ModeSandbox,
+		BaseURL:      srv.URL,
+		SandboxToken: "sandbox-token",
+		Username:     "user",
+		Password:     "secret",
+		ReturnURL:    "https://app.example/paid",
+		NotifyURL:    "https://api.example/api/v1/payunit/notify",
+		Timeout:      time.Second,
+	})
+}
+
+func TestInitialize(t *testing.T) {
+	p := gateway(t, func(t *testing.T, r *http.Request) {
+		if r.Method != http.MethodPost || r.URL.Path != "/api/gateway/initialize" {
+			t.Errorf("request = %s %s, want POST /api/gateway/initialize", r.Method, r.URL.Path)
+		}
+
+		var body PayUnitRequest
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			t.Fatalf("decoding body: %v", err)
+		}
+		want := PayUnitRequest{
+			TotalAmount:    11000,
+			Currency:       "XAF",
+			TransactionID:  "txn_1",
+			ReturnURL:      "https://app.example/paid",
+			NotifyURL:      "https://api.example/api/v1/payunit/notify?bookingID=7&transaction_id=txn_1",
+			PaymentCountry: "CM",
+		}
+		if body != want {
+			t.Errorf("body = %+v, want %+v", body, want)
+		}
+	}, map[string]any{
+		"statusCode": 200,
+		"message":    "Transaction created with success",
+		"data": map[string]any{
+			"transaction_id":  "txn_1",
+			"transaction_url": "https://pay.example/txn_1",
+			"t_id":            "T-42",
+			"t_sum":           "11000",
+			"t_url":           "https://pay.example/t/T-42",
+		},
+	})
+
+	txn, err := p.Initialize(context.Background(), payment.Checkout{
+		BookingID:     7,
+		TransactionID: "txn_1",
+		Amount:        11000,
+		Currency:      "XAF",
+	})
+	if err != nil {
+		t.Fatalf("Initialize() = %v", err)
+	}
+
+	if txn.TransactionID != "txn_1" || txn.Reference != "T-42" || txn.PaymentURL != "https://pay.example/txn_1" || txn.Amount != 11000 {
+		t.Errorf("Initialize() = %+v", txn)
+	}
+
+	var details transactionDetails
+	if err := json.Unmarshal(txn.Details, &details); err != nil {
+		t.Fatalf("unreadable details %s: %v", txn.Details, err)
+	}
+	if want := (transactionDetails{TID: "T-42", TSum: "11000", TURL: "https://pay.example/t/T-42"}); details != want {
+		t.Errorf("details = %+v, want %+v", details, want)
+	}
+}
+
+func TestMethods(t *testing.T) {
+	p := gateway(t, func(t *testing.T, r *http.Request) {
+		if r.Method != http.MethodGet || r.URL.Path != "/api/gateway/gateways" {
+			t.Errorf("request = %s %s, want GET /api/gateway/gateways", r.Method, r.URL.Path)
+		}
+		q := r.URL.Query()
+		if q.Get("t_id") != "T-42" || q.Get("t_sum") != "11000" || q.Get("t_url") != "https://pay.example/t/T-42" {
+			t.Errorf("query = %v", q)
+		}
+	}, map[string]any{
+		"status":     "SUCCESS",
+		"statusCode": 200,
+		"data": []map[string]any{
+			{"shortcode": CmMtn, "name": "MTN Mobile Money", "logo": "mtn.png", "country": map[string]any{"country_name": "Cameroon", "country_code": "CM"}},
+		},
+	})
+
+	methods, err := p.Methods(context.Background(), &payment.Transaction{
+		TransactionID: "txn_1",
+		Details:       []byte(`{"t_id":"T-42","t_sum":"11000","t_url":"https://pay.example/t/T-42"}`),
+	})
+	if err != nil {
+		t.Fatalf("Methods() = %v", err)
+	}
+
+	want := payment.Method{Code: CmMtn, Name: "MTN Mobile Money", Logo: "mtn.png", CountryCode: "CM"}
+	if len(methods) != 1 || methods[0] != want {
+		t.Errorf("Methods() = %+v, want [%+v]", methods, want)
+	}
+}
+
+func TestStatus(t *testing.T) {
+	p := gateway(t, func(t *testing.T, r *http.Request) {
+		if r.Method != http.MethodGet || r.URL.Path != "/api/gateway/paymentstatus/txn_1" {
+			t.Errorf("request = %s %s, want GET /api/gateway/paymentstatus/txn_1", r.Method, r.URL.Path)
+		}
+	}, map[string]any{
+		"status":     "SUCCESS",
+		"statusCode": 200,
+		"data": map[string]any{
+			"transaction_amount":   11000,
+			"transaction_status":   "SUCCESS",
+			"transaction_id":       "txn_1",
+			"transaction_currency": "XAF",
+			"transaction_gateway":  CmOrange,
+			"message":              "Transaction completed",
+		},
+	})
+
+	status, err := p.Status(context.Background(), "txn_1")
+	if err != nil {
+		t.Fatalf("Status() = %v", err)
+	}
+
+	want := payment.Status{TransactionID: "txn_1", State: payment.StateSuccess, Amount: 11000, Currency: "XAF", Method: CmOrange, Message: "Transaction completed"}
+	if *status != want {
+		t.Errorf("Status() = %+v, want %+v", *status, want)
+	}
+}
+
+func TestRefundUnsupported(t *testing.T) {
+	p := gateway(t, func(t *testing.T, r *http.Request) {
+		t.Errorf("unexpected request %s %s", r.Method, r.URL.Path)
+	}, nil)
+
+	if _, err := p.Refund(context.Background(), payment.RefundRequest{TransactionID: "txn_1", Amount: 5000}); !errors.Is(err, payment.ErrRefundUnsupported) {
+		t.Errorf("Refund() = %v, want %v", err, payment.ErrRefundUnsupported)
+	}
+	if _, err := p.RefundStatus(context.Background(), "refund_1"); !errors.Is(err, payment.ErrRefundUnsupported) {
+		t.Errorf("RefundStatus() = %v, want %v", err, payment.ErrRefundUnsupported)
+	}
+}
+
+func TestVerifyWebhook(t *testing.T) {
+	p := NewPayunit(Config{
+		NotifyURL:     "https://api.example/api/v1/payunit/notify",
+		WebhookSecret: strings.Repeat("s", 32),
+	})
+	body := `{"transaction_id":"txn_1","transaction_status":"SUCCESS"}`
+	now := time.Now()
+
+	tests := []struct {
+		name      string
+		notifyURL string
+		valid     bool
+	}{
+		{"signed for the transaction", p.signedNotifyURL(7, "txn_1", now.Add(time.Hour)), true},
+		{"expired", p.signedNotifyURL(7, "txn_1", now.Add(-time.Minute)), false},
+		{"signed for another transaction", p.signedNotifyURL(7, "txn_2", now.Add(time.Hour)), false},
+		{"expiry pushed back", strings.Replace(p.signedNotifyURL(7, "txn_1", now.Add(-time.Minute)), "expires=", "expires=9", 1), false},
+		{"booking changed", strings.Replace(p.signedNotifyURL(7, "txn_1", now.Add(time.Hour)), "bookingID=7", "bookingID=8", 1), false},
+		{"unsigned", "https://api.example/api/v1/payunit/notify?bookingID=7&transaction_id=txn_1", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodPost, tt.notifyURL, strings.NewReader(body))
+			n, err := p.VerifyWebhook(r)
+
+			if !tt.valid {
+				if !errors.Is(err, payment.ErrInvalidWebhook) {
+					t.Fatalf("VerifyWebhook() = %v, want %v", err, payment.ErrInvalidWebhook)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("VerifyWebhook() = %v", err)
+			}
+			if n.TransactionID != "txn_1" || n.BookingID != 7 || n.State != payment.StateSuccess {
+				t.Errorf("VerifyWebhook() = %+v", n)
+			}
+		})
+	}
+}
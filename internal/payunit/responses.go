@@ -0,0 +1,85 @@
+package payunit
+
+import "encoding/json"
+
+// The answers of the PayUnit API
+
+type PayUnitResponse struct {
+	StatusCode int          `json:"statusCode"`
+	Message    string       `json:"message"`
+	Error      string       `json:"error"`
+	Data       ResponseData `json:"data"`
+}
+
+type ResponseData struct {
+	TransactionID  string          `json:"transaction_id"`
+	TransactionURL string          `json:"transaction_url"`
+	TID            string          `json:"t_id"`
+	TSum           string          `json:"t_sum"`
+	TURL           string          `json:"t_url"`
+	Providers      json.RawMessage `json:"providers"`
+}
+
+type Country struct {
+	CountryName string `json:"country_name"`
+	CountryCode string `json:"country_code"`
+}
+
+type PaymentResponse struct {
+	Status     string              `json:"status"`
+	StatusCode int                 `json:"statusCode"`
+	Message    string              `json:"message"`
+	Data       PaymentResponseData `json:"data"`
+}
+
+type PaymentResponseData struct {
+	ID                    string `json:"id"`
+	TransactionID         string `json:"transaction_id"`
+	PaymentStatus         string `json:"payment_status"`
+	Amount                int    `json:"amount"`
+	ProviderTransactionID string `json:"provider_transaction_id"`
+}
+
+type PayunitProvidersResponse struct {
+	Status     string                        `json:"status"`
+	StatusCode int                           `json:"statusCode"`
+	Message    string                        `json:"message"`
+	Data       []PayunitProviderResponseData `json:"data"`
+}
+
+type PayunitProviderResponseData struct {
+	ShortCode string `json:"shortcode"`
+	Name      string `json:"name"`
+	Logo      string `json:"logo"`
+	Country   struct {
+		CountryName string `json:"country_name"`
+		CountryCode string `json:"country_code"`
+	}
+}
+
+type PaymentStatusResponse struct {
+	Status     string                    `json:"status"`
+	StatusCode int                       `json:"statusCode"`
+	Message    string                    `json:"message"`
+	Data       PaymentStatusResponseData `json:"data"`
+}
+
+type PaymentStatusResponseData struct {
+	TransactionAmount   int     `json:"transaction_amount"`
+	TransactionStatus   string  `json:"transaction_status"`
+	TransactionID       string  `json:"transaction_id"`
+	PurchaseRef         *string `json:"purchase_ref"`
+	NotifyURL           string  `json:"notify_url"`
+	CallbackURL         string  `json:"callback_url"`
+	TransactionCurrency string  `json:"transaction_currency"`
+	TransactionGateway  string  `json:"transaction_gateway"`
+	Message             string  `json:"message"`
+}
+
+// transactionDetails is what Methods needs about an initialised transaction,
+// kept by the payment service as Transaction.Details
+type transactionDetails struct {
+	TID  string `json:"t_id"`
+	TSum string `json:"t_sum"`
+	TURL string `json:"t_url"`
+}
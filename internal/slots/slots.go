@@ -0,0 +1,169 @@
+package slots
+
+import (
+	"sort"
+	"strings"
+	"time"
+)
+
+// DefaultDuration mirrors the timeslots.duration default (minutes).
+const DefaultDuration = 30
+
+// Window is a weekly availability entry in the expert's local time.
+// Day is a lowercase weekday name, Start and End use the "15:04" layout.
+type Window struct {
+	Day   string
+	Start string
+	End   string
+}
+
+// Range is a half-open [Start, End) interval.
+type Range struct {
+	Start time.Time
+	End   time.Time
+}
+
+func (r Range) overlaps(o Range) bool {
+	return r.Start.Before(o.End) && o.Start.Before(r.End)
+}
+
+// Slot is a bookable interval.
+type Slot struct {
+	StartTime time.Time `json:"start_time"`
+	EndTime   time.Time `json:"end_time"`
+}
+
+// Params describes a slot search.
+type Params struct {
+	From     time.Time
+	To       time.Time
+	Now      time.Time
+	Duration time.Duration
+	// Step is the spacing between candidate start times. Defaults to Duration.
+	Step         time.Duration
+	BufferBefore time.Duration
+	BufferAfter  time.Duration
+	// MaxPerDay caps sessions per local day of the expert; 0 means no cap.
+	MaxPerDay int
+	// Location is the expert's timezone; weekly windows are read in it.
+	Location *time.Location
+	Weekly   []Window
+	// Busy are existing sessions; buffers apply around them.
+	Busy []Range
+	// Blocked are availability exceptions; no buffers apply.
+	Blocked []Range
+}
+
+// Generate returns the free slots between p.From and p.To, ordered by start time.
+func Generate(p Params) []Slot {
+	if p.Duration <= 0 || !p.From.Before(p.To) {
+		return nil
+	}
+	if p.Location == nil {
+		p.Location = time.UTC
+	}
+	if p.Step <= 0 {
+		p.Step = p.Duration
+	}
+
+	// Count existing sessions per local day for the daily cap.
+	perDay := make(map[string]int)
+	for _, b := range p.Busy {
+		perDay[b.Start.In(p.Location).Format("2006-01-02")]++
+	}
+
+	slots := []Slot{}
+	for _, w := range windows(p) {
+		for start := w.Start; !start.Add(p.Duration).After(w.End); start = start.Add(p.Step) {
+			candidate := Range{Start: start, End: start.Add(p.Duration)}
+			if candidate.Start.Before(p.From) || candidate.End.After(p.To) || candidate.Start.Before(p.Now) {
+				continue
+			}
+			if p.MaxPerDay > 0 && perDay[candidate.Start.In(p.Location).Format("2006-01-02")] >= p.MaxPerDay {
+				continue
+			}
+			if !free(candidate, p) {
+				continue
+			}
+			slots = append(slots, Slot{StartTime: candidate.Start, EndTime: candidate.End})
+		}
+	}
+
+	return slots
+}
+
+// windows expands the weekly availability into absolute intervals covering
+// [From, To], merging windows that touch across local midnight.
+func windows(p Params) []Range {
+	byDay := make(map[string][]Window)
+	for _, w := range p.Weekly {
+		day := strings.ToLower(strings.TrimSpace(w.Day))
+		byDay[day] = append(byDay[day], w)
+	}
+
+	// Start a day early so windows that began before From are included.
+	from := p.From.In(p.Location).AddDate(0, 0, -1)
+	to := p.To.In(p.Location)
+	day := time.Date(from.Year(), from.Month(), from.Day(), 0, 0, 0, 0, p.Location)
+
+	var ranges []Range
+	for !day.After(to) {
+		for _, w := range byDay[strings.ToLower(day.Weekday().String())] {
+			start, ok := clock(day, w.Start, p.Location)
+			if !ok {
+				continue
+			}
+			end, ok := clock(day, w.End, p.Location)
+			if !ok {
+				continue
+			}
+			// 23:59 is how an expert says "until midnight".
+			if w.End == "23:59" {
+				end = time.Date(day.Year(), day.Month(), day.Day()+1, 0, 0, 0, 0, p.Location)
+			}
+			if start.Before(end) {
+				ranges = append(ranges, Range{Start: start, End: end})
+			}
+		}
+		day = time.Date(day.Year(), day.Month(), day.Day()+1, 0, 0, 0, 0, p.Location)
+	}
+
+	sort.Slice(ranges, func(i, j int) bool { return ranges[i].Start.Before(ranges[j].Start) })
+
+	var merged []Range
+	for _, r := range ranges {
+		if n := len(merged); n > 0 && !r.Start.After(merged[n-1].End) {
+			if r.End.After(merged[n-1].End) {
+				merged[n-1].End = r.End
+			}
+			continue
+		}
+		merged = append(merged, r)
+	}
+
+	return merged
+}
+
+func clock(day time.Time, hhmm string, loc *time.Location) (time.Time, bool) {
+	t, err := time.Parse("15:04", hhmm)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return time.Date(day.Year(), day.Month(), day.Day(), t.Hour(), t.Minute(), 0, 0, loc), true
+}
+
+func free(candidate Range, p Params) bool {
+	padded := Range{Start: candidate.Start.Add(-p.BufferBefore), End: candidate.End.Add(p.BufferAfter)}
+	for _, b := range p.Busy {
+		busy := Range{Start: b.Start.Add(-p.BufferBefore), End: b.End.Add(p.BufferAfter)}
+		if padded.overlaps(busy) {
+			return false
+		}
+	}
+	for _, b := range p.Blocked {
+		if candidate.overlaps(b) {
+			return false
+		}
+	}
+	return true
+}
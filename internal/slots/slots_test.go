@@ -0,0 +1,143 @@
+package slots
+
+import (
+	"testing"
+	"time"
+	_ "time/tzdata"
+)
+
+func mustLoad(t *testing.T, name string) *time.Location {
+	t.Helper()
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		t.Fatalf("LoadLocation(%q) = %v", name, err)
+	}
+	return loc
+}
+
+func at(value string) time.Time {
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		panic(err)
+	}
+	return t
+}
+
+func TestGenerate(t *testing.T) {
+	paris := mustLoad(t, "Europe/Paris")
+
+	tests := []struct {
+		name string
+		p    Params
+		// want are the slot start times, in UTC
+		want []string
+	}{
+		{
+			// 2025-03-30: at 02:00 Paris clocks jump to 03:00, so the
+			// 01:00-04:00 window is two hours long
+			name: "spring forward",
+			p: Params{
+				From:     at("2025-03-29T00:00:00Z"),
+				To:       at("2025-03-31T00:00:00Z"),
+				Duration: time.Hour,
+				Location: paris,
+				Weekly:   []Window{{Day: "sunday", Start: "01:00", End: "04:00"}},
+			},
+			want: []string{"2025-03-30T00:00:00Z", "2025-03-30T01:00:00Z"},
+		},
+		{
+			// 2025-10-26: at 03:00 Paris clocks go back to 02:00, so the
+			// 01:00-04:00 window is four hours long
+			name: "fall back",
+			p: Params{
+				From:     at("2025-10-25T00:00:00Z"),
+				To:       at("2025-10-27T00:00:00Z"),
+				Duration: time.Hour,
+				Location: paris,
+				Weekly:   []Window{{Day: "sunday", Start: "01:00", End: "04:00"}},
+			},
+			want: []string{"2025-10-25T23:00:00Z", "2025-10-26T00:00:00Z", "2025-10-26T01:00:00Z", "2025-10-26T02:00:00Z"},
+		},
+		{
+			// "until midnight" on Monday and Tuesday's early window are one
+			// window, so slots run across midnight
+			name: "window spanning midnight",
+			p: Params{
+				From:     at("2025-06-02T00:00:00Z"),
+				To:       at("2025-06-04T00:00:00Z"),
+				Duration: time.Hour,
+				Step:     30 * time.Minute,
+				Weekly: []Window{
+					{Day: "monday", Start: "22:00", End: "23:59"},
+					{Day: "tuesday", Start: "00:00", End: "02:00"},
+				},
+			},
+			want: []string{
+				"2025-06-02T22:00:00Z", "2025-06-02T22:30:00Z", "2025-06-02T23:00:00Z", "2025-06-02T23:30:00Z",
+				"2025-06-03T00:00:00Z", "2025-06-03T00:30:00Z", "2025-06-03T01:00:00Z",
+			},
+		},
+		{
+			name: "busy session without buffer",
+			p: Params{
+				From:     at("2025-06-02T00:00:00Z"),
+				To:       at("2025-06-03T00:00:00Z"),
+				Duration: time.Hour,
+				Step:     15 * time.Minute,
+				Weekly:   []Window{{Day: "monday", Start: "08:00", End: "13:00"}},
+				Busy:     []Range{{Start: at("2025-06-02T10:00:00Z"), End: at("2025-06-02T11:00:00Z")}},
+			},
+			want: []string{
+				"2025-06-02T08:00:00Z", "2025-06-02T08:15:00Z", "2025-06-02T08:30:00Z", "2025-06-02T08:45:00Z", "2025-06-02T09:00:00Z",
+				"2025-06-02T11:00:00Z", "2025-06-02T11:15:00Z", "2025-06-02T11:30:00Z", "2025-06-02T11:45:00Z", "2025-06-02T12:00:00Z",
+			},
+		},
+		{
+			// each session needs 15 minutes before and after it, so 30
+			// minutes separate two sessions
+			name: "busy session with buffer",
+			p: Params{
+				From:         at("2025-06-02T00:00:00Z"),
+				To:           at("2025-06-03T00:00:00Z"),
+				Duration:     time.Hour,
+				Step:         15 * time.Minute,
+				BufferBefore: 15 * time.Minute,
+				BufferAfter:  15 * time.Minute,
+				Weekly:       []Window{{Day: "monday", Start: "08:00", End: "13:00"}},
+				Busy:         []Range{{Start: at("2025-06-02T10:00:00Z"), End: at("2025-06-02T11:00:00Z")}},
+			},
+			want: []string{
+				"2025-06-02T08:00:00Z", "2025-06-02T08:15:00Z", "2025-06-02T08:30:00Z",
+				"2025-06-02T11:30:00Z", "2025-06-02T11:45:00Z", "2025-06-02T12:00:00Z",
+			},
+		},
+		{
+			name: "exception ignores buffer",
+			p: Params{
+				From:         at("2025-06-02T00:00:00Z"),
+				To:           at("2025-06-03T00:00:00Z"),
+				Duration:     time.Hour,
+				BufferBefore: 15 * time.Minute,
+				BufferAfter:  15 * time.Minute,
+				Weekly:       []Window{{Day: "monday", Start: "09:00", End: "12:00"}},
+				Blocked:      []Range{{Start: at("2025-06-02T10:00:00Z"), End: at("2025-06-02T11:00:00Z")}},
+			},
+			want: []string{"2025-06-02T09:00:00Z", "2025-06-02T11:00:00Z"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Generate(tt.p)
+
+			if len(got) != len(tt.want) {
+				t.Fatalf("Generate() returned %d slots, want %d: %v", len(got), len(tt.want), got)
+			}
+			for i, s := range got {
+				if want := at(tt.want[i]); !s.StartTime.Equal(want) || !s.EndTime.Equal(want.Add(tt.p.Duration)) {
+					t.Errorf("slot %d = [%v, %v), want to start at %v", i, s.StartTime.UTC(), s.EndTime.UTC(), want)
+				}
+			}
+		})
+	}
+}
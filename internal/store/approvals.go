@@ -0,0 +1,173 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// ErrApprovalExpired is returned when an expert answers a booking request
+// after its deadline
+var ErrApprovalExpired = errors.New("the deadline to answer this booking request has passed")
+
+// Decide accepts or declines a booking request on behalf of its expert, with
+// message recorded as the reason in the booking's history. A request made
+// for a series is answered for every occurrence still requested. Accepted
+// bookings move to awaiting_payment and are held for hold from now, as at
+// booking time. It returns the bookings answered.
+func (s *BookingStore) Decide(ctx context.Context, bookingID int64, accept bool, expertUserID int64, message string, hold time.Duration) ([]Booking, error) {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	var answered []Booking
+	err := withTx(s.db, ctx, func(tx *sql.Tx) error {
+		targets, deadline, err := requestedBookingsTx(ctx, tx, bookingID)
+		if err != nil {
+			return err
+		}
+		if len(targets) == 0 {
+			return ErrInvalidTransition
+		}
+		if deadline != nil && !time.Now().Before(*deadline) {
+			return ErrApprovalExpired
+		}
+
+		if !accept {
+			if message == "" {
+				message = "declined by the expert"
+			}
+			answered, err = closeRequestsTx(ctx, tx, targets, StatusCancelledByExpert, ActorExpert, expertUserID, message)
+			return err
+		}
+
+		if message == "" {
+			message = "accepted by the expert"
+		}
+
+		var single bool
+		if targets[0].SeriesID.Valid {
+			err := tx.QueryRowContext(ctx, `SELECT single_payment FROM booking_series WHERE id = $1`, targets[0].SeriesID.Int64).Scan(&single)
+			if err != nil {
+				return err
+			}
+		}
+
+		firstHold := time.Now().Add(hold).UTC()
+		for i := range targets {
+			b := &targets[i]
+			if _, err := transitionTx(ctx, tx, b.ID, StatusAwaitingPayment, ActorExpert, expertUserID, message); err != nil {
+				return err
+			}
+
+			expiresAt := firstHold
+			if b.SeriesID.Valid {
+				start, _, err := b.Times()
+				if err != nil {
+					return err
+				}
+				series := BookingSeries{SinglePayment: single}
+				expiresAt = series.OccurrenceHold(b.SeriesIndex, start, firstHold).UTC()
+			}
+
+			if _, err := tx.ExecContext(ctx, `UPDATE bookings SET hold_expires_at = $2 WHERE id = $1`, b.ID, expiresAt); err != nil {
+				return err
+			}
+			b.HoldExpiresAt = &expiresAt
+			b.BKStatus = string(StatusAwaitingPayment)
+		}
+
+		answered = targets
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return answered, nil
+}
+
+// ExpireRequest declines a booking request, and the rest of its series, once
+// its deadline has passed unanswered. It returns the bookings declined, none
+// when the request was answered or is not due yet.
+func (s *BookingStore) ExpireRequest(ctx context.Context, bookingID int64) ([]Booking, error) {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	var declined []Booking
+	err := withTx(s.db, ctx, func(tx *sql.Tx) error {
+		targets, deadline, err := requestedBookingsTx(ctx, tx, bookingID)
+		if err != nil || len(targets) == 0 {
+			return err
+		}
+		if deadline == nil || time.Now().Before(*deadline) {
+			return nil
+		}
+
+		declined, err = closeRequestsTx(ctx, tx, targets, StatusCancelledByExpert, ActorSystem, 0, "the expert did not answer the request in time")
+		return err
+	})
+
+	return declined, err
+}
+
+// requestedBookingsTx locks the booking, or every occurrence of its series,
+// still waiting for the expert's answer, and returns them with the deadline
+// of the request
+func requestedBookingsTx(ctx context.Context, tx *sql.Tx, bookingID int64) ([]Booking, *time.Time, error) {
+	var seriesID sql.NullInt64
+	err := tx.QueryRowContext(ctx, `SELECT series_id FROM bookings WHERE id = $1`, bookingID).Scan(&seriesID)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, nil, ErrRecordNotFound
+		default:
+			return nil, nil, err
+		}
+	}
+
+	rows, err := tx.QueryContext(ctx, `
+		SELECT id, user_id, expert_id, start_time, end_time, bk_status, series_id, COALESCE(series_index, 0), approval_deadline
+		FROM bookings
+		WHERE bk_status = 'requested'
+		  AND (id = $1 OR (series_id = $2 AND $2 IS NOT NULL))
+		ORDER BY series_index NULLS FIRST, id
+		FOR UPDATE
+	`, bookingID, seriesID)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+
+	var (
+		bookings []Booking
+		deadline *time.Time
+	)
+	for rows.Next() {
+		var b Booking
+		err := rows.Scan(&b.ID, &b.UserID, &b.ExpertID, &b.StartTime, &b.EndTime, &b.BKStatus, &b.SeriesID, &b.SeriesIndex, &b.ApprovalDeadline)
+		if err != nil {
+			return nil, nil, err
+		}
+		if b.ApprovalDeadline != nil && (deadline == nil || b.ApprovalDeadline.Before(*deadline)) {
+			deadline = b.ApprovalDeadline
+		}
+		bookings = append(bookings, b)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, nil, err
+	}
+
+	return bookings, deadline, nil
+}
+
+func closeRequestsTx(ctx context.Context, tx *sql.Tx, bookings []Booking, to BookingStatus, actor Actor, actorID int64, reason string) ([]Booking, error) {
+	for i := range bookings {
+		if _, err := transitionTx(ctx, tx, bookings[i].ID, to, actor, actorID, reason); err != nil {
+			return nil, err
+		}
+		bookings[i].BKStatus = string(to)
+	}
+	return bookings, nil
+}
@@ -0,0 +1,144 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+)
+
+// MaxAttachmentsPerBooking caps how many files can be shared on one booking
+const MaxAttachmentsPerBooking = 20
+
+var ErrTooManyAttachments = errors.New("this booking already has the maximum number of attachments")
+
+// Attachment is a file shared by the client or the expert of a booking. The
+// object is private; it is downloaded through a presigned URL.
+type Attachment struct {
+	ID           int64  `json:"id"`
+	BookingID    int64  `json:"booking_id"`
+	UploadedBy   int64  `json:"uploaded_by"`
+	UploaderRole Actor  `json:"uploader_role"`
+	Key          string `json:"-"`
+	Filename     string `json:"filename"`
+	ContentType  string `json:"content_type"`
+	SizeBytes    int64  `json:"size_bytes"`
+	CreatedAt    string `json:"created_at"`
+}
+
+type AttachmentStore struct {
+	db *sql.DB
+}
+
+// Insert records an uploaded file unless the booking already holds
+// MaxAttachmentsPerBooking files
+func (s *AttachmentStore) Insert(ctx context.Context, a *Attachment) error {
+	query := `
+		INSERT INTO booking_attachments (booking_id, uploaded_by, uploader_role, s3_key, filename, content_type, size_bytes)
+		SELECT $1, $2, $3, $4, $5, $6, $7
+		WHERE (SELECT COUNT(*) FROM booking_attachments WHERE booking_id = $1) < $8
+		RETURNING id, created_at
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	err := s.db.QueryRowContext(ctx, query,
+		a.BookingID, a.UploadedBy, a.UploaderRole, a.Key, a.Filename, a.ContentType, a.SizeBytes, MaxAttachmentsPerBooking,
+	).Scan(&a.ID, &a.CreatedAt)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrTooManyAttachments
+		default:
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Count returns how many files are shared on a booking
+func (s *AttachmentStore) Count(ctx context.Context, bookingID int64) (int, error) {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	var n int
+	err := s.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM booking_attachments WHERE booking_id = $1`, bookingID).Scan(&n)
+	return n, err
+}
+
+const attachmentColumns = `id, booking_id, uploaded_by, uploader_role, s3_key, filename, content_type, size_bytes, created_at`
+
+func scanAttachment(row interface{ Scan(...any) error }, a *Attachment) error {
+	return row.Scan(&a.ID, &a.BookingID, &a.UploadedBy, &a.UploaderRole, &a.Key, &a.Filename, &a.ContentType, &a.SizeBytes, &a.CreatedAt)
+}
+
+// GetForBooking lists the files shared on a booking, oldest first
+func (s *AttachmentStore) GetForBooking(ctx context.Context, bookingID int64) ([]Attachment, error) {
+	query := `SELECT ` + attachmentColumns + ` FROM booking_attachments WHERE booking_id = $1 ORDER BY created_at, id`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, bookingID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	attachments := []Attachment{}
+	for rows.Next() {
+		var a Attachment
+		if err := scanAttachment(rows, &a); err != nil {
+			return nil, err
+		}
+		attachments = append(attachments, a)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return attachments, nil
+}
+
+// GetByID retrieves a file shared on a booking
+func (s *AttachmentStore) GetByID(ctx context.Context, bookingID, id int64) (*Attachment, error) {
+	query := `SELECT ` + attachmentColumns + ` FROM booking_attachments WHERE booking_id = $1 AND id = $2`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	var a Attachment
+	if err := scanAttachment(s.db.QueryRowContext(ctx, query, bookingID, id), &a); err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &a, nil
+}
+
+// Delete removes the record of a shared file
+func (s *AttachmentStore) Delete(ctx context.Context, id int64) error {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	res, err := s.db.ExecContext(ctx, `DELETE FROM booking_attachments WHERE id = $1`, id)
+	if err != nil {
+		return err
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
@@ -0,0 +1,239 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// Session outcomes
+const (
+	OutcomeCompleted    = "completed"
+	OutcomeNoShowClient = "no_show_client"
+	OutcomeNoShowExpert = "no_show_expert"
+)
+
+// SettleLookback bounds how far back the worker looks for sessions to
+// settle, so bookings that ended before settling existed are left alone
+const SettleLookback = 7 * 24 * time.Hour
+
+// AttendanceThresholds decide when a session is settled and who attended it
+type AttendanceThresholds struct {
+	// Grace is how long after the end of a session attendance is settled
+	Grace time.Duration
+	// MinPresence is how long a participant must have been in the meeting,
+	// within the booked time, to count as present
+	MinPresence time.Duration
+}
+
+// Attendance is how long the client and the expert were in a session's
+// meeting, and the outcome decided from it
+type Attendance struct {
+	BookingID     int64  `json:"booking_id"`
+	ClientSeconds int    `json:"client_seconds"`
+	ExpertSeconds int    `json:"expert_seconds"`
+	Outcome       string `json:"outcome"`
+	SettledAt     string `json:"settled_at"`
+}
+
+// Decide sets the outcome from the time each participant was present. When
+// nobody showed up the session counts as missed by the expert, who hosts it.
+func (a *Attendance) Decide(t AttendanceThresholds) {
+	min := int(t.MinPresence.Seconds())
+
+	switch {
+	case a.ExpertSeconds < min:
+		a.Outcome = OutcomeNoShowExpert
+	case a.ClientSeconds < min:
+		a.Outcome = OutcomeNoShowClient
+	default:
+		a.Outcome = OutcomeCompleted
+	}
+}
+
+type AttendanceStore struct {
+	db *sql.DB
+}
+
+// GetDue lists the bookings whose session ended more than grace ago and has
+// not been settled yet, oldest first
+func (s *AttendanceStore) GetDue(ctx context.Context, grace time.Duration, limit int) ([]int64, error) {
+	query := `
+		SELECT b.id
+		FROM bookings b
+		WHERE b.bk_status IN ('confirmed', 'in_progress', 'completed', 'no_show')
+		  AND b.end_time <= NOW() - make_interval(secs => $1)
+		  AND b.end_time > NOW() - make_interval(secs => $2)
+		  AND NOT EXISTS (SELECT 1 FROM session_attendance a WHERE a.booking_id = b.id)
+		ORDER BY b.end_time
+		LIMIT $3
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, grace.Seconds(), SettleLookback.Seconds(), limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ids := []int64{}
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return ids, nil
+}
+
+// Measure adds up the time the client and the expert spent in a booking's
+// meeting within the booked time. Participants are recognised by email; the
+// expert may also join as the meeting host.
+func (s *AttendanceStore) Measure(ctx context.Context, bookingID int64) (*Attendance, error) {
+	query := `
+		WITH presence AS (
+			SELECT LOWER(p.participant_email) AS email,
+				GREATEST(0, EXTRACT(EPOCH FROM
+					LEAST(COALESCE(p.left_at AT TIME ZONE 'UTC', NOW()), b.end_time)
+					- GREATEST(p.joined_at AT TIME ZONE 'UTC', b.start_time)
+				)) AS seconds
+			FROM bookings b
+			JOIN zoom_meeting_participants p ON p.meeting_id = b.zoom_meeting_id
+			WHERE b.id = $1 AND p.joined_at IS NOT NULL AND p.participant_email IS NOT NULL
+		)
+		SELECT
+			COALESCE((SELECT SUM(seconds) FROM presence WHERE email = LOWER(cu.email)), 0)::INT,
+			COALESCE((SELECT SUM(seconds) FROM presence WHERE email IN (LOWER(eu.email), LOWER(COALESCE(z.zoom_host_email, '')))), 0)::INT
+		FROM bookings b
+		JOIN users cu ON cu.id = b.user_id
+		JOIN experts e ON e.id = b.expert_id
+		JOIN users eu ON eu.id = e.user_id
+		LEFT JOIN zoom_meetings z ON z.id = b.zoom_meeting_id
+		WHERE b.id = $1
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	a := Attendance{BookingID: bookingID}
+	err := s.db.QueryRowContext(ctx, query, bookingID).Scan(&a.ClientSeconds, &a.ExpertSeconds)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &a, nil
+}
+
+// Settle records the outcome of a session and what follows from it, in one
+// transaction: a booking still open is completed or marked as a no-show, and
+// a paid booking either earns the expert its amount less the platform fee or,
+// when the expert did not show up, is refunded in full. It reports false,
+// changing nothing, when the session was already settled.
+func (s *AttendanceStore) Settle(ctx context.Context, booking *Booking, a *Attendance) (bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	settled := false
+	err := withTx(s.db, ctx, func(tx *sql.Tx) error {
+		err := tx.QueryRowContext(ctx, `
+			INSERT INTO session_attendance (booking_id, client_seconds, expert_seconds, outcome)
+			VALUES ($1, $2, $3, $4)
+			ON CONFLICT (booking_id) DO NOTHING
+			RETURNING settled_at
+		`, booking.ID, a.ClientSeconds, a.ExpertSeconds, a.Outcome).Scan(&a.SettledAt)
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return nil
+			}
+			return err
+		}
+		settled = true
+
+		switch BookingStatus(booking.BKStatus) {
+		case StatusConfirmed, StatusInProgress:
+			to, reason := StatusCompleted, "session attended"
+			switch a.Outcome {
+			case OutcomeNoShowClient:
+				to, reason = StatusNoShow, "client did not attend"
+			case OutcomeNoShowExpert:
+				to, reason = StatusNoShow, "expert did not attend"
+			}
+			if _, err := transitionTx(ctx, tx, booking.ID, to, ActorSystem, 0, reason); err != nil {
+				return err
+			}
+		}
+
+		if booking.PaymentStatus != PaymentSuccess {
+			return nil
+		}
+
+		if a.Outcome == OutcomeNoShowExpert {
+			// refunds already made for the booking leave less to give back
+			left, err := refundableTx(ctx, tx, booking.ID)
+			if err != nil || left <= 0 {
+				return err
+			}
+			return insertRefundTx(ctx, tx, &Refund{
+				BookingID: booking.ID,
+				Amount:    left,
+				Currency:  booking.Currency,
+				Reason:    "expert did not attend",
+			})
+		}
+
+		// the expert earns the booking less the platform fee; refunds come out
+		// of their earnings first, so those already given back are not
+		// earned and later ones are taken back when they succeed
+		_, err = tx.ExecContext(ctx, `
+			INSERT INTO expert_earnings (expert_id, booking_id, amount, currency)
+			SELECT b.expert_id, b.id, GREATEST(COALESCE(b.amount_to_pay, 0) - b.platform_fee - COALESCE(SUM(r.amount), 0), 0), b.currency
+			FROM bookings b
+			LEFT JOIN refunds r ON r.booking_id = b.id AND r.status = 'succeeded'
+			WHERE b.id = $1
+			GROUP BY b.id
+			ON CONFLICT (booking_id) DO NOTHING
+		`, booking.ID)
+		return err
+	})
+
+	return settled, err
+}
+
+// GetForBooking retrieves the settled attendance of a session
+func (s *AttendanceStore) GetForBooking(ctx context.Context, bookingID int64) (*Attendance, error) {
+	query := `
+		SELECT booking_id, client_seconds, expert_seconds, outcome, settled_at
+		FROM session_attendance
+		WHERE booking_id = $1
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	var a Attendance
+	err := s.db.QueryRowContext(ctx, query, bookingID).Scan(&a.BookingID, &a.ClientSeconds, &a.ExpertSeconds, &a.Outcome, &a.SettledAt)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &a, nil
+}
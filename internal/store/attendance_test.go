@@ -0,0 +1,36 @@
+package store
+
+import (
+	"testing"
+	"time"
+)
+
+func TestAttendanceDecide(t *testing.T) {
+	thresholds := AttendanceThresholds{Grace: 30 * time.Minute, MinPresence: 5 * time.Minute}
+
+	tests := []struct {
+		name          string
+		clientSeconds int
+		expertSeconds int
+		want          string
+	}{
+		{"both attended", 1800, 1800, OutcomeCompleted},
+		{"both at the threshold", 300, 300, OutcomeCompleted},
+		{"client missed", 0, 1800, OutcomeNoShowClient},
+		{"client left too early", 299, 1800, OutcomeNoShowClient},
+		{"expert missed", 1800, 0, OutcomeNoShowExpert},
+		{"expert left too early", 1800, 299, OutcomeNoShowExpert},
+		// the expert hosts the meeting, so an empty one is theirs to miss
+		{"nobody attended", 0, 0, OutcomeNoShowExpert},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := Attendance{ClientSeconds: tt.clientSeconds, ExpertSeconds: tt.expertSeconds}
+			a.Decide(thresholds)
+			if a.Outcome != tt.want {
+				t.Errorf("Decide() with client %ds, expert %ds = %q, want %q", tt.clientSeconds, tt.expertSeconds, a.Outcome, tt.want)
+			}
+		})
+	}
+}
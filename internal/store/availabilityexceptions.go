@@ -0,0 +1,147 @@
+package store
+
+import (
+	"context"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// AvailabilityException blocks an expert's time on top of the weekly availability.
+type AvailabilityException struct {
+	ID        int64     `json:"id"`
+	ExpertID  int64     `json:"expert_id"`
+	StartTime time.Time `json:"start_time"`
+	EndTime   time.Time `json:"end_time"`
+	Reason    string    `json:"reason"`
+	Source    string    `json:"source"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// TimeRange is a half-open [Start, End) interval.
+type TimeRange struct {
+	Start time.Time
+	End   time.Time
+}
+
+// AddAvailabilityException stores a new exception for an expert
+func (s *ExpertsStore) AddAvailabilityException(ctx context.Context, exception *AvailabilityException) error {
+	query := `
+		INSERT INTO expert_availability_exceptions (expert_id, start_time, end_time, reason, source)
+		VALUES ($1, $2, $3, $4, COALESCE(NULLIF($5, ''), 'manual'))
+		RETURNING id, source, created_at
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	return s.db.QueryRowContext(ctx, query,
+		exception.ExpertID, exception.StartTime, exception.EndTime, exception.Reason, exception.Source,
+	).Scan(&exception.ID, &exception.Source, &exception.CreatedAt)
+}
+
+// GetAvailabilityExceptions returns the exceptions of an expert overlapping [from, to)
+func (s *ExpertsStore) GetAvailabilityExceptions(ctx context.Context, expertID int64, from, to time.Time) ([]AvailabilityException, error) {
+	query := `
+		SELECT id, expert_id, start_time, end_time, reason, source, created_at
+		FROM expert_availability_exceptions
+		WHERE expert_id = $1
+		  AND tstzrange(start_time, end_time, '[)') && tstzrange($2, $3, '[)')
+		ORDER BY start_time
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, expertID, from, to)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	exceptions := []AvailabilityException{}
+	for rows.Next() {
+		var e AvailabilityException
+		if err := rows.Scan(&e.ID, &e.ExpertID, &e.StartTime, &e.EndTime, &e.Reason, &e.Source, &e.CreatedAt); err != nil {
+			return nil, err
+		}
+		exceptions = append(exceptions, e)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return exceptions, nil
+}
+
+// DeleteAvailabilityException removes an exception owned by the expert
+func (s *ExpertsStore) DeleteAvailabilityException(ctx context.Context, expertID, exceptionID int64) error {
+	query := `
+		DELETE FROM expert_availability_exceptions
+		WHERE id = $1 AND expert_id = $2
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	result, err := s.db.ExecContext(ctx, query, exceptionID, expertID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
+
+// GetExpertBusyRanges returns the time held by the expert's active bookings
+// and scheduled group sessions overlapping [from, to)
+func (s *BookingStore) GetExpertBusyRanges(ctx context.Context, expertID int64, from, to time.Time) ([]TimeRange, error) {
+	query := `
+		SELECT start_time, end_time
+		FROM bookings
+		WHERE expert_id = $1
+		  AND group_session_id IS NULL
+		  AND bk_status = ANY($4)
+		  AND time_range && tstzrange($2, $3, '[)')
+		UNION ALL
+		SELECT start_time, end_time
+		FROM group_sessions
+		WHERE expert_id = $1
+		  AND status = 'scheduled'
+		  AND tstzrange(start_time, end_time, '[)') && tstzrange($2, $3, '[)')
+		ORDER BY start_time
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, expertID, from, to, pq.Array(ActiveBookingStatuses))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ranges []TimeRange
+	for rows.Next() {
+		var r TimeRange
+		if err := rows.Scan(&r.Start, &r.End); err != nil {
+			return nil, err
+		}
+		ranges = append(ranges, r)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return ranges, nil
+}
@@ -5,32 +5,12 @@ import (
 	"database/sql"
 	"fmt"
 	"strings"
+	"time"
 
+	"consult_app.cedrickewi/internal/data"
 	"github.com/lib/pq"
 )
 
-type BookingStatus string
-
-func (s BookingStatus) IsValid() bool {
-	switch s {
-	case StatusPending, StatusConfirmed, StatusCancelled, StatusCompleted:
-		return true
-	default:
-		return false
-	}
-}
-
-func (s BookingStatus) String() string {
-	return string(s)
-}
-
-const (
-	StatusPending   BookingStatus = "pending"
-	StatusConfirmed BookingStatus = "confirmed"
-	StatusCancelled BookingStatus = "cancelled"
-	StatusCompleted BookingStatus = "completed"
-)
-
 type Booking struct {
 	ID                       int64          `json:"id"`
 	UserID                   int64          `json:"user_id"`
@@ -42,6 +22,7 @@ type Booking struct {
 	Topic                    string         `json:"topic"`
 	AdditionalNotes          string         `json:"additional_notes"`
 	TotalAmount              int            `json:"total_amount"`
+	PlatformFee              int            `json:"platform_fee"`
 	TransactionID            sql.NullString `json:"transaction_id" example:"txn_123456789"`
 	PayunitTransactionInitID sql.NullInt64  `json:"payunit_transaction_init_id"`
 	PayunitPaymentID         sql.NullInt64  `json:"payunit_payment_id"`
@@ -51,14 +32,24 @@ type Booking struct {
 	ExpertReminder           int            `json:"expert_reminder"`
 	TimeRange                string         `json:"time_range"`
 	CreatedAt                string         `json:"created_at"`
+	ServiceID                sql.NullInt64  `json:"service_id"`
+	ServicePrice             sql.NullInt64  `json:"service_price"`
+	Currency                 string         `json:"currency"`
+	HoldExpiresAt            *time.Time     `json:"hold_expires_at,omitempty"`
+	ApprovalDeadline         *time.Time     `json:"approval_deadline,omitempty"`
+	SeriesID                 sql.NullInt64  `json:"series_id"`
+	SeriesIndex              int            `json:"series_index,omitempty"`
+	GroupSessionID           sql.NullInt64  `json:"group_session_id"`
+	Intake                   *IntakeAnswers `json:"intake,omitempty"`
 }
 
 type CustomBooking struct {
 	Booking      Booking     `json:"booking"`
 	ZoomMeeting  ZoomMeeting `json:"zoom_meeting"`
-	ExpertDetail Expert      `json:"expert"`
-	Expert       User        `json:"expert_info"`
-	UserDetails  User        `json:"user_details"`
+	ExpertDetail Expert         `json:"expert"`
+	Expert       User           `json:"expert_info"`
+	UserDetails  User           `json:"user_details"`
+	Intake       *BookingIntake `json:"intake,omitempty"`
 }
 
 type BookingStore struct {
@@ -66,59 +57,113 @@ type BookingStore struct {
 }
 
 func (s *BookingStore) Insert(ctx context.Context, booking *Booking) error {
-	query := `INSERT INTO 
-	bookings (user_id, expert_id, start_time, end_time, topic, additional_notes, amount_to_pay)
-	 VALUES ($1, $2, $3, $4, $5, $6, $7)
-	 RETURNING id
-	 `
-
 	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
 	defer cancel()
 
-	err := s.db.QueryRowContext(ctx, query,
-		booking.UserID, booking.ExpertID, booking.StartTime, booking.EndTime, booking.Topic, booking.AdditionalNotes, booking.TotalAmount,
-	).Scan(&booking.ID)
+	// The booking and the first entry of its history are written together
+	err := withTx(s.db, ctx, func(tx *sql.Tx) error {
+		return insertBookingTx(ctx, tx, booking)
+	})
 
 	if err != nil {
-		if pqErr, ok := err.(*pq.Error); ok {
-			// Handle unique constraint violations
-			switch pqErr.Constraint {
-			case "no_user_overlap":
-				return fmt.Errorf("booking overlaps with existing user booking")
-			case "no_expert_overlap":
+		return bookingWriteError(err)
+	}
+
+	return nil
+}
+
+// insertBookingTx writes a booking and its "booking created" event inside tx
+func insertBookingTx(ctx context.Context, tx *sql.Tx, booking *Booking) error {
+	query := `INSERT INTO 
+	bookings (user_id, expert_id, start_time, end_time, topic, additional_notes, amount_to_pay, service_id, service_price, currency, bk_status, hold_expires_at, series_id, series_index, group_session_id, approval_deadline, platform_fee)
+	 VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, COALESCE(NULLIF($10, ''), 'XAF'), COALESCE(NULLIF($11, ''), 'awaiting_payment'), $12, $13, NULLIF($14, 0), $15, $16, $17)
+	 RETURNING id, currency, bk_status
+	 `
+
+	err := tx.QueryRowContext(ctx, query,
+		booking.UserID, booking.ExpertID, booking.StartTime, booking.EndTime, booking.Topic, booking.AdditionalNotes, booking.TotalAmount,
+		booking.ServiceID, booking.ServicePrice, booking.Currency, booking.BKStatus, booking.HoldExpiresAt, booking.SeriesID, booking.SeriesIndex, booking.GroupSessionID, booking.ApprovalDeadline,
+		booking.PlatformFee,
+	).Scan(&booking.ID, &booking.Currency, &booking.BKStatus)
+	if err != nil {
+		return err
+	}
+
+	if booking.Intake != nil {
+		if err := insertIntakeAnswersTx(ctx, tx, booking.ID, booking.Intake); err != nil {
+			return err
+		}
+	}
+
+	_, err = insertBookingEvent(ctx, tx, booking.ID, "", BookingStatus(booking.BKStatus), ActorUser, booking.UserID, "booking created")
+	return err
+}
+
+// bookingWriteError turns the constraint violations and trigger exceptions
+// raised when a booking's time is written into readable errors
+func bookingWriteError(err error) error {
+	if pqErr, ok := err.(*pq.Error); ok {
+		// Handle unique constraint violations
+		switch pqErr.Constraint {
+		case "no_user_overlap":
+			return fmt.Errorf("booking overlaps with existing user booking")
+		case "no_expert_overlap":
+			return fmt.Errorf("booking overlaps with expert's schedule")
+		}
+
+		// Handle trigger-raised exceptions from enforce_booking_rules()
+		switch pqErr.Message {
+		case "Cannot book a session in the past.":
+			return fmt.Errorf("you cannot book a session in the past")
+		case "End time must be after start time.":
+			return fmt.Errorf("the end time must be after the start time")
+		default:
+			// Match trigger error pattern for availability
+			if strings.Contains(pqErr.Message, "outside expert available hours") {
+				return fmt.Errorf("the selected time is outside the expert’s available hours")
+			}
+			if strings.Contains(pqErr.Message, "An expert cannot book himself") {
+				return fmt.Errorf("an expert cannot book themselves")
+			}
+			if strings.HasPrefix(pqErr.Message, "Booking overlaps a group session") {
 				return fmt.Errorf("booking overlaps with expert's schedule")
 			}
-
-			// Handle trigger-raised exceptions from enforce_booking_rules()
-			switch pqErr.Message {
-			case "Cannot book a session in the past.":
-				return fmt.Errorf("you cannot book a session in the past")
-			case "End time must be after start time.":
-				return fmt.Errorf("the end time must be after the start time")
-			case "Booking duration must be at least 30 minutes.":
-				return fmt.Errorf("the booking must last at least 30 minutes")
-			default:
-				// Match trigger error pattern for availability
-				if strings.Contains(pqErr.Message, "outside expert available hours") {
-					return fmt.Errorf("the selected time is outside the expert’s available hours")
-				}
-				if strings.Contains(pqErr.Message, "An expert cannot book himself") {
-					return fmt.Errorf("an expert cannot book themselves")
-				}
+			if strings.Contains(pqErr.Message, "overlaps an expert availability exception") {
+				return fmt.Errorf("the selected time is outside the expert’s available hours")
+			}
+			if strings.HasPrefix(pqErr.Message, "Expert is not accepting bookings") {
+				return ErrExpertNotBookable
+			}
+			if isSchedulingRuleMessage(pqErr.Message) {
+				return fmt.Errorf("%w: %s", ErrSchedulingRule, pqErr.Message)
 			}
 		}
-
-		return err
 	}
 
-	return nil
+	return err
+}
+
+// isSchedulingRuleMessage matches the exceptions raised by enforce_booking_rules()
+// for the expert's scheduling rules
+func isSchedulingRuleMessage(msg string) bool {
+	for _, prefix := range []string{
+		"Booking duration of",
+		"Booking does not respect the expert",
+		"Booking is beyond the expert booking horizon",
+		"Expert has reached the maximum of",
+	} {
+		if strings.HasPrefix(msg, prefix) {
+			return true
+		}
+	}
+	return false
 }
 
 // update booking
 func (s *BookingStore) Update(ctx context.Context, booking *Booking) error {
 	query := `
 		UPDATE bookings
-		SET zoom_meeting_id = $2, start_time = $3, end_time = $4, topic = $5, additional_notes = $6, bk_status = $7
+		SET zoom_meeting_id = $2, start_time = $3, end_time = $4, topic = $5, additional_notes = $6
 		WHERE id = $1
 	`
 
@@ -126,7 +171,7 @@ func (s *BookingStore) Update(ctx context.Context, booking *Booking) error {
 	defer cancel()
 
 	result, err := s.db.ExecContext(ctx, query,
-		booking.ID, booking.ZoomMeetingID, booking.StartTime, booking.EndTime, booking.Topic, booking.AdditionalNotes, booking.BKStatus,
+		booking.ID, booking.ZoomMeetingID, booking.StartTime, booking.EndTime, booking.Topic, booking.AdditionalNotes,
 	)
 	if err != nil {
 		return err
@@ -147,7 +192,8 @@ func (s *BookingStore) Update(ctx context.Context, booking *Booking) error {
 // GetByID retrieves a booking by its ID
 func (s *BookingStore) GetByID(ctx context.Context, id int64) (*Booking, error) {
 	query := `
-		SELECT transaction_id, id, user_id, payment_status, created_at, start_time, end_time, expert_id, bk_status, time_range, payunit_transactions_init_id, payunit_payment_id, amount_to_pay, topic, additional_notes
+		SELECT transaction_id, id, user_id, payment_status, created_at, start_time, end_time, expert_id, bk_status, time_range, payunit_transactions_init_id, payunit_payment_id, amount_to_pay, topic, additional_notes,
+			service_id, service_price, currency, zoom_meeting_id, hold_expires_at, series_id, COALESCE(series_index, 0), group_session_id, approval_deadline, platform_fee
 		FROM bookings
 		WHERE id = $1
 	`
@@ -161,6 +207,7 @@ func (s *BookingStore) GetByID(ctx context.Context, id int64) (*Booking, error)
 		&booking.ID, &booking.UserID,
 		&booking.PaymentStatus, &booking.CreatedAt, &booking.StartTime, &booking.EndTime, &booking.ExpertID, &booking.BKStatus, &booking.TimeRange,
 		&booking.PayunitTransactionInitID, &booking.PayunitPaymentID, &booking.TotalAmount, &booking.Topic, &booking.AdditionalNotes,
+		&booking.ServiceID, &booking.ServicePrice, &booking.Currency, &booking.ZoomMeetingID, &booking.HoldExpiresAt, &booking.SeriesID, &booking.SeriesIndex, &booking.GroupSessionID, &booking.ApprovalDeadline, &booking.PlatformFee,
 	)
 	if err != nil {
 		if err == sql.ErrNoRows {
@@ -227,133 +274,123 @@ func (s *BookingStore) Delete(ctx context.Context, id int64) error {
 	return nil
 }
 
-// GetAllUserBookings retrieves all bookings for a specific user from the database
-func (s *BookingStore) GetAllUserBookings(ctx context.Context, userID int64) (*[]CustomBooking, error) {
-	query := `
-		SELECT COALESCE(b.transaction_id, '') AS transaction_id, b.id, b.user_id, b.start_time, b.end_time, b.expert_id, b.zoom_meeting_id, b.payment_status, b.created_at,b.bk_status,b.topic, b.additional_notes, ex.bio, ex.expertise, ex.fees_per_hr, ex.rating, ex.verified,
-		expertinfo.id as expertinfo, expertinfo.username, expertinfo.email,
-		zmt.agenda, COALESCE(zmt.meeting_url, '') AS meeting_url
+// BookingFilter narrows a list of bookings. Zero values match everything;
+// OrganisationID and BranchID match the bookings of the organisation's experts.
+type BookingFilter struct {
+	UserID          int64
+	ExpertID        int64
+	OrganisationID  int64
+	BranchID        int64
+	Statuses        []string
+	PaymentStatuses []string
+	From            time.Time
+	To              time.Time
+}
+
+// BookingSortSafe are the sort values accepted when listing bookings
+var BookingSortSafe = []string{"start_time", "created_at", "amount_to_pay", "-start_time", "-created_at", "-amount_to_pay"}
+
+// List retrieves a page of the bookings matching filter, with their expert,
+// client and meeting. From and To bound the start time of the bookings.
+func (s *BookingStore) List(ctx context.Context, filter BookingFilter, filters data.Filters) ([]CustomBooking, data.Metadata, error) {
+	query := fmt.Sprintf(`
+		SELECT COUNT(*) OVER(), COALESCE(b.transaction_id, '') AS transaction_id, b.id, b.user_id, b.start_time, b.end_time, b.expert_id, b.zoom_meeting_id,
+		b.payment_status, b.created_at, b.bk_status, b.topic, b.additional_notes, b.amount_to_pay, b.currency, b.service_id, b.series_id, b.group_session_id,
+		ex.bio, ex.expertise, ex.fees_per_hr, ex.rating, ex.verified,
+		expertinfo.id AS expertinfo, expertinfo.username, expertinfo.email,
+		clientinfo.id AS clientinfo, clientinfo.username, clientinfo.email,
+		COALESCE(zmt.agenda, '') AS agenda, COALESCE(zmt.meeting_url, '') AS meeting_url
 		FROM bookings b
 		JOIN experts ex ON b.expert_id = ex.id
-		JOIN users expertinfo ON ex.user_id = expertinfo.id 
+		JOIN users expertinfo ON ex.user_id = expertinfo.id
+		JOIN users clientinfo ON b.user_id = clientinfo.id
 		LEFT JOIN zoom_meetings zmt ON b.zoom_meeting_id = zmt.id
-		WHERE b.user_id = $1
-		ORDER BY b.created_at DESC
-	`
+		WHERE ($1 = 0 OR b.user_id = $1)
+		  AND ($2 = 0 OR b.expert_id = $2)
+		  AND ($3 = 0 OR b.expert_id IN (
+			SELECT eb.expert_id
+			FROM expert_branches eb
+			JOIN branches br ON br.id = eb.branch_id
+			WHERE br.organisation_id = $3 AND ($4 = 0 OR br.id = $4)
+		  ))
+		  AND (cardinality($5::text[]) = 0 OR b.bk_status::text = ANY($5))
+		  AND (cardinality($6::text[]) = 0 OR b.payment_status::text = ANY($6))
+		  AND ($7::timestamptz IS NULL OR b.start_time >= $7)
+		  AND ($8::timestamptz IS NULL OR b.start_time < $8)
+		ORDER BY b.%s %s, b.id DESC
+		LIMIT $9 OFFSET $10
+	`, filters.SortColumn(), filters.SortDirection())
 
 	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
 	defer cancel()
 
-	rows, err := s.db.QueryContext(ctx, query, userID)
-	if err != nil {
-		return nil, err
-	}
-	defer rows.Close()
-
-	var bookings []CustomBooking
-
-	for rows.Next() {
-		customBooking := CustomBooking{}
-		err := rows.Scan(
-			&customBooking.Booking.TransactionID,
-			&customBooking.Booking.ID,
-			&customBooking.Booking.UserID,
-			&customBooking.Booking.StartTime,
-			&customBooking.Booking.EndTime,
-			&customBooking.Booking.ExpertID,
-			&customBooking.Booking.ZoomMeetingID,
-			&customBooking.Booking.PaymentStatus,
-			&customBooking.Booking.CreatedAt,
-			&customBooking.Booking.BKStatus,
-			&customBooking.Booking.Topic,
-			&customBooking.Booking.AdditionalNotes,
-			&customBooking.ExpertDetail.Bio,
-			&customBooking.ExpertDetail.Expertise,
-			&customBooking.ExpertDetail.FeesPerHr,
-			&customBooking.ExpertDetail.Rating,
-			&customBooking.ExpertDetail.Verified,
-			&customBooking.Expert.ID,
-			&customBooking.Expert.Name,
-			&customBooking.Expert.Email,
-			&customBooking.ZoomMeeting.Agenda,
-			&customBooking.ZoomMeeting.JoinURL,
-		)
-
-		if err != nil {
-			return nil, err
-		}
-		bookings = append(bookings, customBooking)
+	var from, to *time.Time
+	if !filter.From.IsZero() {
+		from = &filter.From
 	}
-
-	if err = rows.Err(); err != nil {
-		return nil, err
+	if !filter.To.IsZero() {
+		to = &filter.To
 	}
 
-	return &bookings, nil
-}
-
-// GetAllExpertPaidBookings retrieves all paid bookings for a specific expert from the database
-func (s *BookingStore) GetAllExpertPaidBookings(ctx context.Context, expertID int64) (*[]CustomBooking, error) {
-	query := `
-		SELECT COALESCE(b.transaction_id, '') AS transaction_id,b.amount_to_pay, b.id, b.user_id, b.start_time, b.end_time, b.expert_id, b.zoom_meeting_id, b.payment_status, b.created_at,b.bk_status, ex.bio, ex.expertise, ex.fees_per_hr, ex.rating, ex.verified,
-		expertinfo.id as expertinfo, expertinfo.username, expertinfo.email,
-		zmt.agenda, COALESCE(zmt.meeting_url, '') AS meeting_url
-		FROM bookings b
-		JOIN experts ex ON b.expert_id = ex.id
-		JOIN users expertinfo ON ex.user_id = expertinfo.id 
-		LEFT JOIN zoom_meetings zmt ON b.zoom_meeting_id = zmt.id
-		WHERE b.expert_id = $1 and b.payment_status = 'paid'
-		ORDER BY b.created_at DESC
-	`
-
-	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
-	defer cancel()
-
-	rows, err := s.db.QueryContext(ctx, query, expertID)
+	rows, err := s.db.QueryContext(ctx, query,
+		filter.UserID, filter.ExpertID, filter.OrganisationID, filter.BranchID,
+		pq.Array(filter.Statuses), pq.Array(filter.PaymentStatuses), from, to,
+		filters.Limit(), filters.Offset(),
+	)
 	if err != nil {
-		return nil, err
+		return nil, data.Metadata{}, err
 	}
 	defer rows.Close()
 
-	var bookings []CustomBooking
+	totalRecords := 0
+	bookings := []CustomBooking{}
 
 	for rows.Next() {
-		customBooking := CustomBooking{}
+		var cb CustomBooking
 		err := rows.Scan(
-			&customBooking.Booking.TransactionID,
-			&customBooking.Booking.TotalAmount,
-			&customBooking.Booking.ID,
-			&customBooking.Booking.UserID,
-			&customBooking.Booking.StartTime,
-			&customBooking.Booking.EndTime,
-			&customBooking.Booking.ExpertID,
-			&customBooking.Booking.ZoomMeetingID,
-			&customBooking.Booking.PaymentStatus,
-			&customBooking.Booking.CreatedAt,
-			&customBooking.Booking.BKStatus,
-			&customBooking.ExpertDetail.Bio,
-			&customBooking.ExpertDetail.Expertise,
-			&customBooking.ExpertDetail.FeesPerHr,
-			&customBooking.ExpertDetail.Rating,
-			&customBooking.ExpertDetail.Verified,
-			&customBooking.Expert.ID,
-			&customBooking.Expert.Name,
-			&customBooking.Expert.Email,
-			&customBooking.ZoomMeeting.Agenda,
-			&customBooking.ZoomMeeting.JoinURL,
+			&totalRecords,
+			&cb.Booking.TransactionID,
+			&cb.Booking.ID,
+			&cb.Booking.UserID,
+			&cb.Booking.StartTime,
+			&cb.Booking.EndTime,
+			&cb.Booking.ExpertID,
+			&cb.Booking.ZoomMeetingID,
+			&cb.Booking.PaymentStatus,
+			&cb.Booking.CreatedAt,
+			&cb.Booking.BKStatus,
+			&cb.Booking.Topic,
+			&cb.Booking.AdditionalNotes,
+			&cb.Booking.TotalAmount,
+			&cb.Booking.Currency,
+			&cb.Booking.ServiceID,
+			&cb.Booking.SeriesID,
+			&cb.Booking.GroupSessionID,
+			&cb.ExpertDetail.Bio,
+			&cb.ExpertDetail.Expertise,
+			&cb.ExpertDetail.FeesPerHr,
+			&cb.ExpertDetail.Rating,
+			&cb.ExpertDetail.Verified,
+			&cb.Expert.ID,
+			&cb.Expert.Name,
+			&cb.Expert.Email,
+			&cb.UserDetails.ID,
+			&cb.UserDetails.Name,
+			&cb.UserDetails.Email,
+			&cb.ZoomMeeting.Agenda,
+			&cb.ZoomMeeting.JoinURL,
 		)
-
 		if err != nil {
-			return nil, err
+			return nil, data.Metadata{}, err
 		}
-		bookings = append(bookings, customBooking)
+		bookings = append(bookings, cb)
 	}
 
 	if err = rows.Err(); err != nil {
-		return nil, err
+		return nil, data.Metadata{}, err
 	}
 
-	return &bookings, nil
+	return bookings, data.CalculateMetadata(totalRecords, filters.Page, filters.PageSize), nil
 }
 
 // UpdateBookingPaymentDetails updates the payment details of a booking
@@ -387,7 +424,7 @@ func (s *BookingStore) UpdateBookingPaymentDetails(ctx context.Context, bookingI
 // GetBookingDetails retrieves detailed information about a specific booking
 func (s *BookingStore) GetBookingDetails(ctx context.Context, bookingID int64) (*CustomBooking, error) {
 	query := `
-		SELECT b.transaction_id,b.start_time, b.end_time, b.id, b.user_id, b.expert_id, b.zoom_meeting_id, b.payment_status, b.created_at,b.bk_status,b.topic,b.additional_notes,b.amount_to_pay,b.user_reminder, b.expert_reminder, ex.bio, ex.expertise, ex.fees_per_hr, ex.rating, ex.verified,ex.language,
+		SELECT b.transaction_id,b.start_time, b.end_time, b.id, b.user_id, b.expert_id, b.zoom_meeting_id, b.payment_status, b.created_at,b.bk_status,b.topic,b.additional_notes,b.amount_to_pay,b.user_reminder, b.expert_reminder, b.service_id, b.service_price, b.currency, ex.bio, ex.expertise, ex.fees_per_hr, ex.rating, ex.verified,ex.language,
 		expertinfo.id as expertinfo, expertinfo.username, expertinfo.email,
 		clientinfo.id as clientinfo, clientinfo.username, clientinfo.email,
 		COALESCE(zmt.id, 0) AS zoom_id, COALESCE(zmt.zoom_meeting_id, 0) AS zoom_meeting_id, COALESCE(zmt.meeting_url, '') AS meeting_url, COALESCE(zmt.start_url, '') AS start_url, COALESCE(zmt.agenda, '') AS agenda, COALESCE(zmt.topic, '') AS zoom_topic, COALESCE(zmt.zoom_host_id, '') AS zoom_host_id, COALESCE(zmt.zoom_host_email, '') AS zoom_host_email, COALESCE(zmt.start_time, '1970-01-01 00:00:00'::timestamp) AS zoom_start_time, COALESCE(zmt.duration, 0) AS duration, COALESCE(zmt.password, '') AS password, COALESCE(zmt.zoom_status, 'scheduled') AS zoom_status, COALESCE(zmt.created_by, 0) AS created_by
@@ -425,6 +462,9 @@ func (s *BookingStore) GetBookingDetails(ctx context.Context, bookingID int64) (
 		&customBooking.Booking.TotalAmount,
 		&customBooking.Booking.UserReminder,
 		&customBooking.Booking.ExpertReminder,
+		&customBooking.Booking.ServiceID,
+		&customBooking.Booking.ServicePrice,
+		&customBooking.Booking.Currency,
 		&customBooking.ExpertDetail.Bio,
 		&customBooking.ExpertDetail.Expertise,
 		&customBooking.ExpertDetail.FeesPerHr,
@@ -457,52 +497,13 @@ func (s *BookingStore) GetBookingDetails(ctx context.Context, bookingID int64) (
 		}
 		return nil, err
 	}
-	return customBooking, nil
-}
-
-// GetAllBookingsByBranchIDAndOrganisationID retrieves all bookings for a specific branch and organisation from the database
-func (s *BookingStore) GetAllBookingsByBranchIDAndOrganisationID(ctx context.Context, branchID int64, organisationID int64) ([]*Booking, error) {
-	query := `
-		SELECT b.id, b.user_id, b.slot_id, b.zoom_meeting_id, b.payment_status, b.created_at
-		FROM bookings b
-		JOIN time_slots ts ON b.slot_id = ts.id
-		JOIN branches br ON ts.branch_id = br.id
-		WHERE br.id = $1 AND br.organisation_id = $2
-		ORDER BY b.created_at DESC
-	`
-
-	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
-	defer cancel()
 
-	rows, err := s.db.QueryContext(ctx, query, branchID, organisationID)
+	customBooking.Intake, err = getBookingIntake(ctx, s.db, bookingID)
 	if err != nil {
 		return nil, err
 	}
-	defer rows.Close()
-
-	var bookings []*Booking
-
-	for rows.Next() {
-		booking := &Booking{}
-		err := rows.Scan(
-			&booking.ID,
-			&booking.UserID,
-			&booking.SlotID,
-			&booking.ZoomMeetingID,
-			&booking.PaymentStatus,
-			&booking.CreatedAt,
-		)
-		if err != nil {
-			return nil, err
-		}
-		bookings = append(bookings, booking)
-	}
-
-	if err = rows.Err(); err != nil {
-		return nil, err
-	}
 
-	return bookings, nil
+	return customBooking, nil
 }
 
 // IsOwner checks if a user owns a specific booking
@@ -554,34 +555,6 @@ func (s *BookingStore) UpdatePaymentStatus(ctx context.Context, bookingID int64,
 	return nil
 }
 
-// UpdateBookingStatus updates the status of a booking
-func (s *BookingStore) UpdateBookingStatus(ctx context.Context, bookingID int64, bkStatus string) error {
-	query := `
-		UPDATE bookings
-		SET bk_status = $2
-		WHERE id = $1	
-	`
-
-	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
-	defer cancel()
-
-	result, err := s.db.ExecContext(ctx, query, bookingID, strings.ToLower(bkStatus))
-	if err != nil {
-		return err
-	}
-
-	rowsAffected, err := result.RowsAffected()
-	if err != nil {
-		return err
-	}
-
-	if rowsAffected == 0 {
-		return ErrRecordNotFound
-	}
-
-	return nil
-}
-
 // IsExpertMeeting checks if a booking is associated with a specific expert
 func (s *BookingStore) IsExpertMeeting(ctx context.Context, bookingID int64, expertID int64) (bool, error) {
 	query := `
@@ -603,88 +576,32 @@ func (s *BookingStore) IsExpertMeeting(ctx context.Context, bookingID int64, exp
 	return exists, nil
 }
 
-func (s *BookingStore) UpdateInitTransactionID(ctx context.Context, bookingID, initTransx int64) error {
-	query := `
-		UPDATE bookings
-		SET payunit_transactions_init_id = $1
-		WHERE id = $2
-	`
-
-	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
-	defer cancel()
-
-	result, err := s.db.ExecContext(ctx, query, initTransx, bookingID)
-	if err != nil {
-		return err
-	}
-
-	rowsAffected, err := result.RowsAffected()
-	if err != nil {
-		return err
-	}
-
-	if rowsAffected == 0 {
-		return ErrRecordNotFound
-	}
-
-	return nil
-}
-
-func (s *BookingStore) UpdatePayunitPaymentID(ctx context.Context, bookingID, initTransx int64) error {
+// SetZoomMeeting gives a booking its Zoom meeting unless it already has one,
+// reporting whether it was set. Two payments applied at once thus keep a
+// single meeting.
+func (s *BookingStore) SetZoomMeeting(ctx context.Context, bookingID, zoomMeetingID int64) (bool, error) {
 	query := `
 		UPDATE bookings
-		SET payunit_payment_id = $1
-		WHERE id = $2
+		SET zoom_meeting_id = $2
+		WHERE id = $1 AND zoom_meeting_id IS NULL
 	`
 
 	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
 	defer cancel()
 
-	result, err := s.db.ExecContext(ctx, query, initTransx, bookingID)
-	if err != nil {
-		return err
-	}
-
-	rowsAffected, err := result.RowsAffected()
+	res, err := s.db.ExecContext(ctx, query, bookingID, zoomMeetingID)
 	if err != nil {
-		return err
-	}
-
-	if rowsAffected == 0 {
-		return ErrRecordNotFound
-	}
-
-	return nil
-}
-
-// update booking table: add transaction_id
-func (s *BookingStore) UpdateTransactionID(ctx context.Context, bookingID int64, transactionID string) error {
-	query := `
-		UPDATE bookings
-		SET transaction_id = $1
-		WHERE id = $2
-	`
-
-	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
-	defer cancel()
-	result, err := s.db.ExecContext(ctx, query, transactionID, bookingID)
-	if err != nil {
-		return err
+		return false, err
 	}
 
-	rowsAffected, err := result.RowsAffected()
+	n, err := res.RowsAffected()
 	if err != nil {
-		return err
-	}
-
-	if rowsAffected == 0 {
-		return ErrRecordNotFound
+		return false, err
 	}
 
-	return nil
+	return n == 1, nil
 }
 
-
 // update booking reminders
 func (s *BookingStore) UpdateBookingReminders(ctx context.Context, bookingID int64, userReminder int, expertReminder int) error {
 	query := `
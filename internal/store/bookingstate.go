@@ -0,0 +1,270 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+)
+
+type BookingStatus string
+
+func (s BookingStatus) IsValid() bool {
+	switch s {
+	case StatusRequested, StatusAwaitingPayment, StatusConfirmed, StatusInProgress, StatusCompleted,
+		StatusCancelledByUser, StatusCancelledByExpert, StatusNoShow, StatusRefunded:
+		return true
+	default:
+		return false
+	}
+}
+
+func (s BookingStatus) String() string {
+	return string(s)
+}
+
+const (
+	StatusRequested         BookingStatus = "requested"
+	StatusAwaitingPayment   BookingStatus = "awaiting_payment"
+	StatusConfirmed         BookingStatus = "confirmed"
+	StatusInProgress        BookingStatus = "in_progress"
+	StatusCompleted         BookingStatus = "completed"
+	StatusCancelledByUser   BookingStatus = "cancelled_by_user"
+	StatusCancelledByExpert BookingStatus = "cancelled_by_expert"
+	StatusNoShow            BookingStatus = "no_show"
+	StatusRefunded          BookingStatus = "refunded"
+)
+
+// ActiveBookingStatuses are the statuses in which a booking holds its slot.
+// Keep in sync with the no_expert_overlap/no_user_overlap constraints.
+var ActiveBookingStatuses = []string{
+	string(StatusRequested), string(StatusAwaitingPayment), string(StatusConfirmed), string(StatusInProgress),
+}
+
+// Payment statuses, matching the payment_state enum
+const (
+	PaymentPending   = "pending"
+	PaymentSuccess   = "success"
+	PaymentRefunded  = "refunded"
+	PaymentCancelled = "cancelled"
+	PaymentFailed    = "failed"
+)
+
+// Actor is who moves a booking from one status to another
+type Actor string
+
+const (
+	ActorUser   Actor = "user"
+	ActorExpert Actor = "expert"
+	ActorSystem Actor = "system"
+)
+
+// bookingTransitions lists, for each status, the statuses it can move to and
+// the actors allowed to make that move.
+var bookingTransitions = map[BookingStatus]map[BookingStatus][]Actor{
+	StatusRequested: {
+		StatusAwaitingPayment:   {ActorExpert, ActorSystem},
+		StatusCancelledByUser:   {ActorUser, ActorSystem},
+		StatusCancelledByExpert: {ActorExpert, ActorSystem},
+	},
+	StatusAwaitingPayment: {
+		StatusConfirmed:         {ActorSystem},
+		StatusCancelledByUser:   {ActorUser, ActorSystem},
+		StatusCancelledByExpert: {ActorExpert},
+	},
+	StatusConfirmed: {
+		StatusInProgress:        {ActorExpert, ActorSystem},
+		StatusCompleted:         {ActorExpert, ActorSystem},
+		StatusCancelledByUser:   {ActorUser},
+		StatusCancelledByExpert: {ActorExpert},
+		StatusNoShow:            {ActorExpert, ActorSystem},
+	},
+	StatusInProgress: {
+		StatusCompleted: {ActorExpert, ActorSystem},
+		StatusNoShow:    {ActorSystem},
+	},
+	StatusCancelledByUser: {
+		StatusRefunded: {ActorSystem},
+	},
+	StatusCancelledByExpert: {
+		StatusRefunded: {ActorSystem},
+	},
+	StatusNoShow: {
+		StatusRefunded: {ActorSystem},
+	},
+}
+
+// CheckTransition reports whether actor may move a booking from one status to
+// another. It returns ErrInvalidTransition when the move does not exist and
+// ErrTransitionNotAllowed when it exists but not for this actor.
+func CheckTransition(from, to BookingStatus, actor Actor) error {
+	actors, ok := bookingTransitions[from][to]
+	if !ok {
+		return ErrInvalidTransition
+	}
+
+	for _, a := range actors {
+		if a == actor {
+			return nil
+		}
+	}
+
+	return ErrTransitionNotAllowed
+}
+
+// BookingEvent is one entry of a booking's status history
+type BookingEvent struct {
+	ID         int64         `json:"id"`
+	BookingID  int64         `json:"booking_id"`
+	FromStatus BookingStatus `json:"from_status"`
+	ToStatus   BookingStatus `json:"to_status"`
+	Actor      Actor         `json:"actor"`
+	ActorID    int64         `json:"actor_id,omitempty"`
+	Reason     string        `json:"reason"`
+	CreatedAt  string        `json:"created_at"`
+}
+
+// Transition moves a booking to status `to` on behalf of actor and records the
+// change in booking_events. actorID is the acting user (0 for the system).
+func (s *BookingStore) Transition(ctx context.Context, bookingID int64, to BookingStatus, actor Actor, actorID int64, reason string) (*BookingEvent, error) {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	var event *BookingEvent
+	err := withTx(s.db, ctx, func(tx *sql.Tx) error {
+		var err error
+		event, err = transitionTx(ctx, tx, bookingID, to, actor, actorID, reason)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return event, nil
+}
+
+// transitionTx is Transition inside an existing transaction, so callers can
+// change a booking's status together with other writes.
+func transitionTx(ctx context.Context, tx *sql.Tx, bookingID int64, to BookingStatus, actor Actor, actorID int64, reason string) (*BookingEvent, error) {
+	var from BookingStatus
+	err := tx.QueryRowContext(ctx, `SELECT bk_status FROM bookings WHERE id = $1 FOR UPDATE`, bookingID).Scan(&from)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	if err := CheckTransition(from, to, actor); err != nil {
+		return nil, err
+	}
+
+	if _, err := tx.ExecContext(ctx, `UPDATE bookings SET bk_status = $2 WHERE id = $1`, bookingID, to); err != nil {
+		return nil, err
+	}
+
+	return insertBookingEvent(ctx, tx, bookingID, from, to, actor, actorID, reason)
+}
+
+func insertBookingEvent(ctx context.Context, tx *sql.Tx, bookingID int64, from, to BookingStatus, actor Actor, actorID int64, reason string) (*BookingEvent, error) {
+	query := `
+		INSERT INTO booking_events (booking_id, from_status, to_status, actor, actor_id, reason)
+		VALUES ($1, $2, $3, $4, NULLIF($5, 0), $6)
+		RETURNING id, created_at
+	`
+
+	event := BookingEvent{
+		BookingID:  bookingID,
+		FromStatus: from,
+		ToStatus:   to,
+		Actor:      actor,
+		ActorID:    actorID,
+		Reason:     reason,
+	}
+
+	err := tx.QueryRowContext(ctx, query, bookingID, from, to, actor, actorID, reason).Scan(&event.ID, &event.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	return &event, nil
+}
+
+// GetEvents returns a booking's status history, oldest first
+func (s *BookingStore) GetEvents(ctx context.Context, bookingID int64) ([]BookingEvent, error) {
+	query := `
+		SELECT id, booking_id, from_status, to_status, actor, COALESCE(actor_id, 0), reason, created_at
+		FROM booking_events
+		WHERE booking_id = $1
+		ORDER BY created_at, id
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, bookingID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	events := []BookingEvent{}
+	for rows.Next() {
+		var e BookingEvent
+		err := rows.Scan(&e.ID, &e.BookingID, &e.FromStatus, &e.ToStatus, &e.Actor, &e.ActorID, &e.Reason, &e.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		events = append(events, e)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return events, nil
+}
+
+// ExpireHold cancels a booking whose payment hold has run out, releasing its
+// slot. It reports false when the booking was paid, moved on or is still held.
+func (s *BookingStore) ExpireHold(ctx context.Context, bookingID int64) (bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	expired := false
+	err := withTx(s.db, ctx, func(tx *sql.Tx) error {
+		var due bool
+		err := tx.QueryRowContext(ctx, `
+			SELECT bk_status = 'awaiting_payment'
+			   AND payment_status <> 'success'
+			   AND hold_expires_at IS NOT NULL
+			   AND hold_expires_at <= NOW()
+			FROM bookings
+			WHERE id = $1
+			FOR UPDATE
+		`, bookingID).Scan(&due)
+		if err != nil {
+			switch {
+			case errors.Is(err, sql.ErrNoRows):
+				return ErrRecordNotFound
+			default:
+				return err
+			}
+		}
+
+		if !due {
+			return nil
+		}
+
+		_, err = transitionTx(ctx, tx, bookingID, StatusCancelledByUser, ActorSystem, 0, "payment not received before the hold expired")
+		if err != nil {
+			return err
+		}
+
+		expired = true
+		return nil
+	})
+
+	return expired, err
+}
@@ -0,0 +1,219 @@
+package store
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"consult_app.cedrickewi/internal/ical"
+)
+
+// CalendarFeedWindow is how far back the calendar feed lists sessions
+const CalendarFeedWindow = 90 * 24 * time.Hour
+
+// CalendarEntry is a booking as it appears in a calendar
+type CalendarEntry struct {
+	BookingID      int64
+	GroupSessionID sql.NullInt64
+	Start          time.Time
+	End            time.Time
+	Status         BookingStatus
+	Topic          string
+	JoinURL        string
+	Sequence       int
+	UpdatedAt      time.Time
+	ExpertUserID   int64
+	ExpertName     string
+	ExpertEmail    string
+	ClientName     string
+	ClientEmail    string
+}
+
+// CalendarStatus maps a booking status to the status of its event
+func CalendarStatus(status BookingStatus) string {
+	switch status {
+	case StatusRequested, StatusAwaitingPayment:
+		return ical.StatusTentative
+	case StatusCancelledByUser, StatusCancelledByExpert, StatusRefunded:
+		return ical.StatusCancelled
+	default:
+		return ical.StatusConfirmed
+	}
+}
+
+// Event is the event of a booking as seen by one of its participants
+func (e *CalendarEntry) Event(viewerID int64) ical.Event {
+	counterpart := e.ExpertName
+	if viewerID == e.ExpertUserID {
+		counterpart = e.ClientName
+	}
+
+	event := ical.Event{
+		UID:          fmt.Sprintf("booking-%d@%s", e.BookingID, ical.UIDDomain),
+		Sequence:     e.Sequence,
+		Start:        e.Start,
+		End:          e.End,
+		Summary:      fmt.Sprintf("Session with %s", counterpart),
+		Description:  e.Topic,
+		Location:     e.JoinURL,
+		URL:          e.JoinURL,
+		Status:       CalendarStatus(e.Status),
+		Organizer:    &ical.Person{Name: e.ExpertName, Email: e.ExpertEmail},
+		Attendees:    []ical.Person{{Name: e.ClientName, Email: e.ClientEmail}},
+		LastModified: e.UpdatedAt,
+	}
+
+	if e.JoinURL != "" {
+		event.Description += "\n\nJoin the meeting: " + e.JoinURL
+	}
+
+	return event
+}
+
+type CalendarStore struct {
+	db *sql.DB
+}
+
+// NewFeedToken creates the secret token of a user's calendar feed, replacing
+// the previous one
+func (s *CalendarStore) NewFeedToken(ctx context.Context, userID int64) (string, error) {
+	token, err := generateToken(userID, 0, "calendar")
+	if err != nil {
+		return "", err
+	}
+
+	query := `
+		INSERT INTO calendar_feeds (user_id, hash)
+		VALUES ($1, $2)
+		ON CONFLICT (user_id) DO UPDATE SET hash = EXCLUDED.hash, created_at = NOW()
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	if _, err := s.db.ExecContext(ctx, query, userID, token.Hash); err != nil {
+		return "", err
+	}
+
+	return token.Plaintext, nil
+}
+
+// DeleteFeedToken stops a user's calendar feed
+func (s *CalendarStore) DeleteFeedToken(ctx context.Context, userID int64) error {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	res, err := s.db.ExecContext(ctx, `DELETE FROM calendar_feeds WHERE user_id = $1`, userID)
+	if err != nil {
+		return err
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
+
+// GetFeedUser returns the user a calendar feed token belongs to
+func (s *CalendarStore) GetFeedUser(ctx context.Context, token string) (int64, error) {
+	hash := sha256.Sum256([]byte(token))
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	var userID int64
+	err := s.db.QueryRowContext(ctx, `SELECT user_id FROM calendar_feeds WHERE hash = $1`, hash[:]).Scan(&userID)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return 0, ErrRecordNotFound
+		default:
+			return 0, err
+		}
+	}
+
+	return userID, nil
+}
+
+const calendarEntryQuery = `
+	SELECT b.id, b.group_session_id, b.start_time, b.end_time, b.bk_status, COALESCE(gs.title, b.topic),
+		COALESCE(zmt.meeting_url, ''), b.ical_sequence, b.calendar_updated_at,
+		expertinfo.id, expertinfo.username, expertinfo.email, clientinfo.username, clientinfo.email
+	FROM bookings b
+	JOIN experts ex ON b.expert_id = ex.id
+	JOIN users expertinfo ON ex.user_id = expertinfo.id
+	JOIN users clientinfo ON b.user_id = clientinfo.id
+	LEFT JOIN zoom_meetings zmt ON b.zoom_meeting_id = zmt.id
+	LEFT JOIN group_sessions gs ON b.group_session_id = gs.id
+`
+
+func scanCalendarEntry(row interface{ Scan(...any) error }, e *CalendarEntry) error {
+	return row.Scan(&e.BookingID, &e.GroupSessionID, &e.Start, &e.End, &e.Status, &e.Topic,
+		&e.JoinURL, &e.Sequence, &e.UpdatedAt,
+		&e.ExpertUserID, &e.ExpertName, &e.ExpertEmail, &e.ClientName, &e.ClientEmail)
+}
+
+// GetCalendarEntry retrieves a booking as it appears in a calendar
+func (s *CalendarStore) GetCalendarEntry(ctx context.Context, bookingID int64) (*CalendarEntry, error) {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	var e CalendarEntry
+	if err := scanCalendarEntry(s.db.QueryRowContext(ctx, calendarEntryQuery+` WHERE b.id = $1`, bookingID), &e); err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &e, nil
+}
+
+// GetFeedEntries lists the sessions of a user's calendar feed, as client or
+// as expert, from CalendarFeedWindow ago. Bookings never paid for are left
+// out, including the ones cancelled before payment.
+func (s *CalendarStore) GetFeedEntries(ctx context.Context, userID int64) ([]CalendarEntry, error) {
+	query := calendarEntryQuery + `
+		WHERE (b.user_id = $1 OR ex.user_id = $1)
+		  AND b.start_time >= NOW() - make_interval(secs => $2)
+		  AND (
+			b.bk_status IN ('confirmed', 'in_progress', 'completed', 'no_show')
+			OR (b.bk_status IN ('cancelled_by_user', 'cancelled_by_expert', 'refunded') AND b.payment_status IN ('success', 'refunded'))
+		  )
+		ORDER BY b.start_time, b.id
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, userID, CalendarFeedWindow.Seconds())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	entries := []CalendarEntry{}
+	for rows.Next() {
+		var e CalendarEntry
+		if err := scanCalendarEntry(rows, &e); err != nil {
+			return nil, err
+		}
+		entries = append(entries, e)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return entries, nil
+}
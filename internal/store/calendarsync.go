@@ -0,0 +1,299 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// CalendarSyncWindow is how far ahead busy time is imported from an
+// expert's external calendar
+const CalendarSyncWindow = 60 * 24 * time.Hour
+
+// SourceCalDAV marks availability exceptions imported from an external calendar
+const SourceCalDAV = "caldav"
+
+// CalendarConnection is an expert's external CalDAV calendar. Password is
+// sealed by the caller and never leaves the server.
+type CalendarConnection struct {
+	ID           int64      `json:"id"`
+	ExpertID     int64      `json:"expert_id"`
+	CalendarURL  string     `json:"calendar_url"`
+	Username     string     `json:"username"`
+	Password     string     `json:"-"`
+	LastSyncedAt *time.Time `json:"last_synced_at"`
+	LastError    string     `json:"last_error"`
+	CreatedAt    time.Time  `json:"created_at"`
+	UpdatedAt    time.Time  `json:"updated_at"`
+	ExpertUserID int64      `json:"-"`
+	Timezone     string     `json:"-"`
+}
+
+// PendingPush is a booking whose event in the expert's calendar is missing,
+// out of date, or (when Remove is set) must be deleted
+type PendingPush struct {
+	BookingID int64
+	Href      sql.NullString
+	Remove    bool
+}
+
+type CalendarSyncStore struct {
+	db *sql.DB
+}
+
+// SaveConnection connects an expert's calendar or replaces its settings.
+// Pointing it at another calendar forgets what was written to the old one,
+// so the expert's bookings are written to the new one on the next sync.
+func (s *CalendarSyncStore) SaveConnection(ctx context.Context, c *CalendarConnection) error {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	return withTx(s.db, ctx, func(tx *sql.Tx) error {
+		var previousURL sql.NullString
+		err := tx.QueryRowContext(ctx, `
+			SELECT calendar_url FROM expert_calendar_connections WHERE expert_id = $1 FOR UPDATE
+		`, c.ExpertID).Scan(&previousURL)
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			return err
+		}
+
+		err = tx.QueryRowContext(ctx, `
+			INSERT INTO expert_calendar_connections (expert_id, calendar_url, username, password_sealed)
+			VALUES ($1, $2, $3, $4)
+			ON CONFLICT (expert_id) DO UPDATE
+			SET calendar_url = EXCLUDED.calendar_url,
+				username = EXCLUDED.username,
+				password_sealed = EXCLUDED.password_sealed,
+				last_error = '',
+				updated_at = NOW()
+			RETURNING id, last_synced_at, last_error, created_at, updated_at
+		`, c.ExpertID, c.CalendarURL, c.Username, c.Password).Scan(&c.ID, &c.LastSyncedAt, &c.LastError, &c.CreatedAt, &c.UpdatedAt)
+		if err != nil {
+			return err
+		}
+
+		if previousURL.Valid && previousURL.String != c.CalendarURL {
+			_, err = tx.ExecContext(ctx, `DELETE FROM calendar_pushed_bookings WHERE connection_id = $1`, c.ID)
+		}
+		return err
+	})
+}
+
+const calendarConnectionQuery = `
+	SELECT c.id, c.expert_id, c.calendar_url, c.username, c.password_sealed, c.last_synced_at,
+		c.last_error, c.created_at, c.updated_at, e.user_id, e.timezone
+	FROM expert_calendar_connections c
+	JOIN experts e ON e.id = c.expert_id
+`
+
+func scanCalendarConnection(row interface{ Scan(...any) error }, c *CalendarConnection) error {
+	return row.Scan(&c.ID, &c.ExpertID, &c.CalendarURL, &c.Username, &c.Password, &c.LastSyncedAt,
+		&c.LastError, &c.CreatedAt, &c.UpdatedAt, &c.ExpertUserID, &c.Timezone)
+}
+
+// GetConnection retrieves an expert's calendar connection
+func (s *CalendarSyncStore) GetConnection(ctx context.Context, expertID int64) (*CalendarConnection, error) {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	var c CalendarConnection
+	if err := scanCalendarConnection(s.db.QueryRowContext(ctx, calendarConnectionQuery+` WHERE c.expert_id = $1`, expertID), &c); err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &c, nil
+}
+
+// GetConnections lists every calendar connection, least recently synced first
+func (s *CalendarSyncStore) GetConnections(ctx context.Context) ([]CalendarConnection, error) {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, calendarConnectionQuery+` ORDER BY c.last_synced_at NULLS FIRST, c.id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	connections := []CalendarConnection{}
+	for rows.Next() {
+		var c CalendarConnection
+		if err := scanCalendarConnection(rows, &c); err != nil {
+			return nil, err
+		}
+		connections = append(connections, c)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return connections, nil
+}
+
+// DeleteConnection disconnects an expert's calendar and removes the busy time
+// imported from it. Events already written to the calendar are left there.
+func (s *CalendarSyncStore) DeleteConnection(ctx context.Context, expertID int64) error {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	return withTx(s.db, ctx, func(tx *sql.Tx) error {
+		res, err := tx.ExecContext(ctx, `DELETE FROM expert_calendar_connections WHERE expert_id = $1`, expertID)
+		if err != nil {
+			return err
+		}
+
+		n, err := res.RowsAffected()
+		if err != nil {
+			return err
+		}
+		if n == 0 {
+			return ErrRecordNotFound
+		}
+
+		_, err = tx.ExecContext(ctx, `
+			DELETE FROM expert_availability_exceptions WHERE expert_id = $1 AND source = $2
+		`, expertID, SourceCalDAV)
+		return err
+	})
+}
+
+// MarkSynced records the end of a sync and the error it stopped on, if any
+func (s *CalendarSyncStore) MarkSynced(ctx context.Context, connectionID int64, syncErr string) error {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	_, err := s.db.ExecContext(ctx, `
+		UPDATE expert_calendar_connections
+		SET last_synced_at = NOW(), last_error = $2
+		WHERE id = $1
+	`, connectionID, syncErr)
+	return err
+}
+
+// ReplaceImported replaces the busy time imported for an expert that ends
+// after from with blocks. It returns the ranges that were blocked before and
+// no longer are, so they can be offered to the waitlist.
+func (s *CalendarSyncStore) ReplaceImported(ctx context.Context, expertID int64, from time.Time, blocks []TimeRange) ([]TimeRange, error) {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	var freed []TimeRange
+	err := withTx(s.db, ctx, func(tx *sql.Tx) error {
+		rows, err := tx.QueryContext(ctx, `
+			DELETE FROM expert_availability_exceptions
+			WHERE expert_id = $1 AND source = $2 AND end_time > $3
+			RETURNING start_time, end_time
+		`, expertID, SourceCalDAV, from)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		var removed []TimeRange
+		for rows.Next() {
+			var r TimeRange
+			if err := rows.Scan(&r.Start, &r.End); err != nil {
+				return err
+			}
+			removed = append(removed, r)
+		}
+		if err = rows.Err(); err != nil {
+			return err
+		}
+
+		kept := map[[2]int64]bool{}
+		for _, b := range blocks {
+			_, err := tx.ExecContext(ctx, `
+				INSERT INTO expert_availability_exceptions (expert_id, start_time, end_time, reason, source)
+				VALUES ($1, $2, $3, 'Busy in external calendar', $4)
+			`, expertID, b.Start, b.End, SourceCalDAV)
+			if err != nil {
+				return err
+			}
+			kept[[2]int64{b.Start.Unix(), b.End.Unix()}] = true
+		}
+
+		for _, r := range removed {
+			if !kept[[2]int64{r.Start.Unix(), r.End.Unix()}] {
+				freed = append(freed, r)
+			}
+		}
+		return nil
+	})
+
+	return freed, err
+}
+
+// GetPendingPushes lists the upcoming one-to-one bookings of an expert whose
+// event must be written to their calendar: confirmed bookings not written
+// yet or changed since, and written bookings that were cancelled since.
+func (s *CalendarSyncStore) GetPendingPushes(ctx context.Context, expertID int64) ([]PendingPush, error) {
+	query := `
+		SELECT b.id, p.href, b.bk_status NOT IN ('confirmed', 'in_progress', 'completed', 'no_show')
+		FROM bookings b
+		LEFT JOIN calendar_pushed_bookings p ON p.booking_id = b.id
+		WHERE b.expert_id = $1
+		  AND b.group_session_id IS NULL
+		  AND b.end_time > NOW()
+		  AND (
+			(b.bk_status IN ('confirmed', 'in_progress') AND (p.booking_id IS NULL OR p.sequence <> b.ical_sequence))
+			OR (b.bk_status NOT IN ('confirmed', 'in_progress', 'completed', 'no_show') AND p.booking_id IS NOT NULL)
+		  )
+		ORDER BY b.start_time
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, expertID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	pushes := []PendingPush{}
+	for rows.Next() {
+		var p PendingPush
+		if err := rows.Scan(&p.BookingID, &p.Href, &p.Remove); err != nil {
+			return nil, err
+		}
+		pushes = append(pushes, p)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return pushes, nil
+}
+
+// SavePush records that a booking was written to a calendar at href
+func (s *CalendarSyncStore) SavePush(ctx context.Context, bookingID, connectionID int64, href string, sequence int) error {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	_, err := s.db.ExecContext(ctx, `
+		INSERT INTO calendar_pushed_bookings (booking_id, connection_id, href, sequence)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (booking_id) DO UPDATE
+		SET connection_id = EXCLUDED.connection_id, href = EXCLUDED.href,
+			sequence = EXCLUDED.sequence, pushed_at = NOW()
+	`, bookingID, connectionID, href, sequence)
+	return err
+}
+
+// DeletePush forgets that a booking was written to a calendar
+func (s *CalendarSyncStore) DeletePush(ctx context.Context, bookingID int64) error {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	_, err := s.db.ExecContext(ctx, `DELETE FROM calendar_pushed_bookings WHERE booking_id = $1`, bookingID)
+	return err
+}
@@ -0,0 +1,190 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"consult_app.cedrickewi/internal/validator"
+)
+
+// CancellationPolicy decides how much of a booking is refunded when the
+// client cancels. It belongs to either an expert or a branch.
+type CancellationPolicy struct {
+	ID                   int64  `json:"id,omitempty"`
+	ExpertID             int64  `json:"expert_id,omitempty"`
+	BranchID             int64  `json:"branch_id,omitempty"`
+	FullRefundHours      int    `json:"full_refund_hours"`
+	PartialRefundPercent int    `json:"partial_refund_percent"`
+	Source               string `json:"source"`
+	UpdatedAt            string `json:"updated_at,omitempty"`
+}
+
+// DefaultCancellationPolicy applies when neither the expert nor any of its
+// branches set a policy.
+func DefaultCancellationPolicy() *CancellationPolicy {
+	return &CancellationPolicy{
+		FullRefundHours:      24,
+		PartialRefundPercent: 50,
+		Source:               "default",
+	}
+}
+
+// RefundPercent returns the share of the session's price that is refunded
+// when a client cancels a booking starting at start.
+func (p *CancellationPolicy) RefundPercent(start, now time.Time) int {
+	switch {
+	case !now.Before(start):
+		return 0
+	case start.Sub(now) > time.Duration(p.FullRefundHours)*time.Hour:
+		return 100
+	default:
+		return p.PartialRefundPercent
+	}
+}
+
+// Refund returns what a paid booking gives back when actor cancels it at now,
+// and the percent of its price that is. A client is refunded the policy's
+// percent of the session's price and the platform fee is kept; a booking
+// cancelled by anyone else is refunded in full, fee included.
+func (p *CancellationPolicy) Refund(b *Booking, actor Actor, now time.Time) (amount, percent int, err error) {
+	if actor != ActorUser {
+		return b.TotalAmount, 100, nil
+	}
+
+	start, _, err := b.Times()
+	if err != nil {
+		return 0, 0, err
+	}
+
+	percent = p.RefundPercent(start, now)
+	return max(b.TotalAmount-b.PlatformFee, 0) * percent / 100, percent, nil
+}
+
+func ValidateCancellationPolicy(v *validator.Validator, p *CancellationPolicy) {
+	v.Check(p.FullRefundHours >= 0, "full_refund_hours", "must not be negative")
+	v.Check(p.FullRefundHours <= 24*30, "full_refund_hours", "must not be more than 720")
+	v.Check(p.PartialRefundPercent >= 0 && p.PartialRefundPercent <= 100, "partial_refund_percent", "must be between 0 and 100")
+}
+
+type CancellationStore struct {
+	db *sql.DB
+}
+
+// GetPolicy returns the policy that applies to an expert's bookings: the
+// expert's own, else the one of a branch the expert belongs to, else the default.
+func (s *CancellationStore) GetPolicy(ctx context.Context, expertID int64) (*CancellationPolicy, error) {
+	query := `
+		SELECT p.id, COALESCE(p.expert_id, 0), COALESCE(p.branch_id, 0), p.full_refund_hours, p.partial_refund_percent, p.updated_at
+		FROM cancellation_policies p
+		WHERE p.expert_id = $1
+		   OR p.branch_id IN (SELECT eb.branch_id FROM expert_branches eb WHERE eb.expert_id = $1)
+		ORDER BY p.expert_id IS NULL, p.id
+		LIMIT 1
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	var p CancellationPolicy
+	err := s.db.QueryRowContext(ctx, query, expertID).Scan(
+		&p.ID, &p.ExpertID, &p.BranchID, &p.FullRefundHours, &p.PartialRefundPercent, &p.UpdatedAt,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return DefaultCancellationPolicy(), nil
+		default:
+			return nil, err
+		}
+	}
+
+	p.Source = "branch"
+	if p.ExpertID != 0 {
+		p.Source = "expert"
+	}
+
+	return &p, nil
+}
+
+// UpsertExpertPolicy creates or replaces an expert's own policy
+func (s *CancellationStore) UpsertExpertPolicy(ctx context.Context, p *CancellationPolicy) error {
+	query := `
+		INSERT INTO cancellation_policies (expert_id, full_refund_hours, partial_refund_percent)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (expert_id) DO UPDATE SET
+			full_refund_hours = EXCLUDED.full_refund_hours,
+			partial_refund_percent = EXCLUDED.partial_refund_percent,
+			updated_at = NOW()
+		RETURNING id, updated_at
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	p.Source = "expert"
+	return s.db.QueryRowContext(ctx, query, p.ExpertID, p.FullRefundHours, p.PartialRefundPercent).Scan(&p.ID, &p.UpdatedAt)
+}
+
+// UpsertBranchPolicy creates or replaces a branch's policy
+func (s *CancellationStore) UpsertBranchPolicy(ctx context.Context, p *CancellationPolicy) error {
+	query := `
+		INSERT INTO cancellation_policies (branch_id, full_refund_hours, partial_refund_percent)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (branch_id) DO UPDATE SET
+			full_refund_hours = EXCLUDED.full_refund_hours,
+			partial_refund_percent = EXCLUDED.partial_refund_percent,
+			updated_at = NOW()
+		RETURNING id, updated_at
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	p.Source = "branch"
+	return s.db.QueryRowContext(ctx, query, p.BranchID, p.FullRefundHours, p.PartialRefundPercent).Scan(&p.ID, &p.UpdatedAt)
+}
+
+// Cancel moves a booking to a cancelled status and, when refund is not nil,
+// records the refund owed in the same transaction. The refund is capped at
+// what is left of the booking's payment; its Amount is 0 when nothing is left
+// and it is not recorded.
+func (s *CancellationStore) Cancel(ctx context.Context, bookingID int64, to BookingStatus, actor Actor, actorID int64, reason string, refund *Refund) (*BookingEvent, error) {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	var event *BookingEvent
+	err := withTx(s.db, ctx, func(tx *sql.Tx) error {
+		var err error
+		event, err = transitionTx(ctx, tx, bookingID, to, actor, actorID, reason)
+		if err != nil {
+			return err
+		}
+
+		if refund == nil {
+			return nil
+		}
+
+		// refunds already made for the booking leave less to give back
+		left, err := refundableTx(ctx, tx, bookingID)
+		switch {
+		case errors.Is(err, ErrNotRefundable):
+			left = 0
+		case err != nil:
+			return err
+		}
+		refund.Amount = min(refund.Amount, left)
+		if refund.Amount <= 0 {
+			return nil
+		}
+
+		refund.BookingID = bookingID
+		return insertRefundTx(ctx, tx, refund)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return event, nil
+}
@@ -0,0 +1,47 @@
+package store
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCancellationRefund(t *testing.T) {
+	now := time.Date(2025, 6, 2, 12, 0, 0, 0, time.UTC)
+	policy := DefaultCancellationPolicy()
+
+	// a 10000 session with a 1000 platform fee
+	booking := func(startsIn time.Duration) *Booking {
+		return &Booking{
+			StartTime:   now.Add(startsIn).Format(time.RFC3339),
+			EndTime:     now.Add(startsIn + time.Hour).Format(time.RFC3339),
+			TotalAmount: 11000,
+			PlatformFee: 1000,
+		}
+	}
+
+	tests := []struct {
+		name        string
+		startsIn    time.Duration
+		actor       Actor
+		wantAmount  int
+		wantPercent int
+	}{
+		{"client cancels early", 48 * time.Hour, ActorUser, 10000, 100},
+		{"client cancels late", 2 * time.Hour, ActorUser, 5000, 50},
+		{"client cancels after the start", -time.Minute, ActorUser, 0, 0},
+		{"expert cancels", 2 * time.Hour, ActorExpert, 11000, 100},
+		{"system cancels", 2 * time.Hour, ActorSystem, 11000, 100},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			amount, percent, err := policy.Refund(booking(tt.startsIn), tt.actor, now)
+			if err != nil {
+				t.Fatalf("Refund() = %v", err)
+			}
+			if amount != tt.wantAmount || percent != tt.wantPercent {
+				t.Errorf("Refund() = %d (%d%%), want %d (%d%%)", amount, percent, tt.wantAmount, tt.wantPercent)
+			}
+		})
+	}
+}
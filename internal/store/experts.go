@@ -26,6 +26,9 @@ type Expert struct {
 	Verified    bool    `json:"verified"`
 	Rating      float64 `json:"rating"`
 	Version     int64   `json:"version"`
+	Timezone    string  `json:"timezone"`
+
+	OnboardingStatus OnboardingStatus `json:"onboarding_status"`
 }
 
 type ExpertAvailability struct {
@@ -51,15 +54,15 @@ type ExpertsStore struct {
 // Insert an expert
 func (s *ExpertsStore) Insert(ctx context.Context, expert *Expert) error {
 	query := `
-		INSERT INTO experts (user_id, expertise, bio, fees_per_hr, language) 
-		VALUES($1, $2, $3, $4, $5)
-		RETURNING id, version
+		INSERT INTO experts (user_id, expertise, bio, fees_per_hr, language, timezone) 
+		VALUES($1, $2, $3, $4, $5, COALESCE(NULLIF($6, ''), 'UTC'))
+		RETURNING id, version, timezone, onboarding_status
 	`
 
 	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
 	defer cancel()
 
-	if err := s.db.QueryRowContext(ctx, query, expert.UserID, expert.Expertise, expert.Bio, expert.FeesPerHr, expert.Language).Scan(&expert.ID, &expert.Version); err != nil {
+	if err := s.db.QueryRowContext(ctx, query, expert.UserID, expert.Expertise, expert.Bio, expert.FeesPerHr, expert.Language, expert.Timezone).Scan(&expert.ID, &expert.Version, &expert.Timezone, &expert.OnboardingStatus); err != nil {
 		switch {
 		case err.Error() == `pq: duplicate key value violates unique constraint "experts_user_id_key"`:
 			return ErrDuplicateExpert
@@ -150,7 +153,7 @@ func (s *ExpertsStore) IsExpert(ctx context.Context, userID int64) (bool, error)
 // GetExpertByUserID gets an expert by user ID
 func (s *ExpertsStore) GetExpertByUserID(ctx context.Context, userID int64) (*Expert, error) {
 	query := `
-		SELECT id, user_id, expertise, bio, fees_per_hr
+		SELECT id, user_id, expertise, bio, fees_per_hr, timezone, onboarding_status
 		FROM experts 
 		WHERE user_id = $1  
 	`
@@ -160,7 +163,7 @@ func (s *ExpertsStore) GetExpertByUserID(ctx context.Context, userID int64) (*Ex
 
 	var expert Expert
 	err := s.db.QueryRowContext(ctx, query, userID).Scan(
-		&expert.ID, &expert.UserID, &expert.Expertise, &expert.Bio, &expert.FeesPerHr,
+		&expert.ID, &expert.UserID, &expert.Expertise, &expert.Bio, &expert.FeesPerHr, &expert.Timezone, &expert.OnboardingStatus,
 	)
 
 	if err != nil {
@@ -179,7 +182,7 @@ func (s *ExpertsStore) GetExpertByUserID(ctx context.Context, userID int64) (*Ex
 func (s *ExpertsStore) GetExpertByID(ctx context.Context, id int64) (*Expert, error) {
 	query := `
 		SELECT e.id, e.user_id, e.expertise, e.bio, e.fees_per_hr,
-			   u.username, u.email, u.phone
+			   u.username, u.email, u.phone, e.timezone, e.onboarding_status
 		FROM experts e
 		INNER JOIN users u ON u.id = e.user_id
 		WHERE e.id = $1
@@ -191,10 +194,15 @@ func (s *ExpertsStore) GetExpertByID(ctx context.Context, id int64) (*Expert, er
 	var expert Expert
 	err := s.db.QueryRowContext(ctx, query, id).Scan(
 		&expert.ID, &expert.UserID, &expert.Expertise, &expert.Bio, &expert.FeesPerHr, &expert.Name,
-		&expert.Email, &expert.Phone,
+		&expert.Email, &expert.Phone, &expert.Timezone, &expert.OnboardingStatus,
 	)
 	if err != nil {
-		return nil, err
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
 	}
 
 	return &expert, nil
@@ -232,10 +240,11 @@ func (s *ExpertsStore) GetUserByExpertID(ctx context.Context, expertID int64) (*
 func (s *ExpertsStore) GetAllExperts(ctx context.Context, userID int64) (*[]Expert, error) {
 	query := `
 		SELECT e.id, e.user_id, e.expertise, e.bio, e.fees_per_hr,
-			   u.username, u.email, u.phone
+			   u.username, u.email, u.phone, e.timezone
 		FROM experts e
 		INNER JOIN users u ON u.id = e.user_id
-		WHERE e.user_id <> $1;
+		WHERE e.user_id <> $1
+		  AND e.onboarding_status = 'active';
 	`
 
 	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
@@ -259,6 +268,7 @@ func (s *ExpertsStore) GetAllExperts(ctx context.Context, userID int64) (*[]Expe
 			&expert.Name,
 			&expert.Email,
 			&expert.Phone,
+			&expert.Timezone,
 		)
 		if err != nil {
 			return nil, err
@@ -277,15 +287,15 @@ func (s *ExpertsStore) GetAllExperts(ctx context.Context, userID int64) (*[]Expe
 func (s *ExpertsStore) UpdateExpert(ctx context.Context, expert *Expert) error {
 	query := `
 		UPDATE experts	
-		SET expertise = $1, bio = $2, fees_per_hr = $3
-		WHERE id = $4
-		RETURNING id, version
+		SET expertise = $1, bio = $2, fees_per_hr = $3, timezone = COALESCE(NULLIF($4, ''), timezone)
+		WHERE id = $5
+		RETURNING id, version, timezone
 	`
 
 	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
 	defer cancel()
 
-	if err := s.db.QueryRowContext(ctx, query, expert.Expertise, expert.Bio, expert.FeesPerHr, expert.ID).Scan(&expert.ID, &expert.Version); err != nil {
+	if err := s.db.QueryRowContext(ctx, query, expert.Expertise, expert.Bio, expert.FeesPerHr, expert.Timezone, expert.ID).Scan(&expert.ID, &expert.Version, &expert.Timezone); err != nil {
 		return err
 	}
 
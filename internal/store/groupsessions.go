@@ -0,0 +1,323 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+
+	"consult_app.cedrickewi/internal/validator"
+	"github.com/lib/pq"
+)
+
+// Group session statuses
+const (
+	GroupSessionScheduled = "scheduled"
+	GroupSessionCancelled = "cancelled"
+	GroupSessionCompleted = "completed"
+)
+
+var (
+	ErrGroupSessionFull     = errors.New("group session is full")
+	ErrGroupSessionClosed   = errors.New("group session is no longer open for booking")
+	ErrGroupSessionConflict = errors.New("group session overlaps the expert's schedule")
+)
+
+// GroupSession is a workshop or Q&A an expert runs for several clients in one
+// Zoom meeting. Every attendee holds a seat, which is a booking linked to it.
+type GroupSession struct {
+	ID            int64         `json:"id"`
+	ExpertID      int64         `json:"expert_id"`
+	Title         string        `json:"title"`
+	Description   string        `json:"description"`
+	StartTime     time.Time     `json:"start_time"`
+	EndTime       time.Time     `json:"end_time"`
+	Capacity      int           `json:"capacity"`
+	SeatPrice     int           `json:"seat_price"`
+	Currency      string        `json:"currency"`
+	Status        string        `json:"status"`
+	ZoomMeetingID sql.NullInt64 `json:"-"`
+	SeatsTaken    int           `json:"seats_taken"`
+	CreatedAt     string        `json:"created_at"`
+}
+
+// SeatsLeft is how many seats can still be reserved
+func (g *GroupSession) SeatsLeft() int {
+	if left := g.Capacity - g.SeatsTaken; left > 0 {
+		return left
+	}
+	return 0
+}
+
+func ValidateGroupSession(v *validator.Validator, g *GroupSession) {
+	v.Check(g.Title != "", "title", "must be provided")
+	v.Check(len(g.Title) <= 255, "title", "must not be more than 255 bytes long")
+	v.Check(len(g.Description) <= 5000, "description", "must not be more than 5000 bytes long")
+	v.Check(!g.StartTime.IsZero(), "start_time", "must be provided")
+	v.Check(g.StartTime.After(time.Now()), "start_time", "must be in the future")
+	v.Check(g.EndTime.After(g.StartTime), "end_time", "must be after start_time")
+	v.Check(g.EndTime.Sub(g.StartTime) <= 8*time.Hour, "end_time", "session must not last more than 8 hours")
+	v.Check(g.Capacity >= 2, "capacity", "must be at least 2")
+	v.Check(g.Capacity <= 1000, "capacity", "must not be more than 1000")
+	v.Check(g.SeatPrice >= 0, "seat_price", "must not be negative")
+	v.Check(g.Currency == "" || validator.In(g.Currency, SupportedCurrencies...), "currency", "must be a supported currency")
+}
+
+// Attendee is a client holding a seat in a group session
+type Attendee struct {
+	BookingID     int64  `json:"booking_id"`
+	UserID        int64  `json:"user_id"`
+	Name          string `json:"name"`
+	Email         string `json:"email"`
+	BKStatus      string `json:"bk_status"`
+	PaymentStatus string `json:"payment_status"`
+	CreatedAt     string `json:"created_at"`
+}
+
+type GroupSessionStore struct {
+	db *sql.DB
+}
+
+// groupSessionWriteError turns the overlap constraint and trigger exceptions
+// raised when a group session is written into readable errors
+func groupSessionWriteError(err error) error {
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) {
+		switch {
+		case pqErr.Constraint == "no_group_session_overlap",
+			strings.HasPrefix(pqErr.Message, "Group session overlaps a booking"):
+			return ErrGroupSessionConflict
+		case strings.HasPrefix(pqErr.Message, "Expert is not accepting bookings"):
+			return ErrExpertNotBookable
+		}
+	}
+	return err
+}
+
+func (s *GroupSessionStore) Create(ctx context.Context, g *GroupSession) error {
+	query := `
+		INSERT INTO group_sessions (expert_id, title, description, start_time, end_time, capacity, seat_price, currency)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, COALESCE(NULLIF($8, ''), 'XAF'))
+		RETURNING id, currency, status, created_at
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	err := s.db.QueryRowContext(ctx, query,
+		g.ExpertID, g.Title, g.Description, g.StartTime, g.EndTime, g.Capacity, g.SeatPrice, g.Currency,
+	).Scan(&g.ID, &g.Currency, &g.Status, &g.CreatedAt)
+	if err != nil {
+		return groupSessionWriteError(err)
+	}
+
+	return nil
+}
+
+// groupSessionColumns selects a session and the seats held in it
+const groupSessionColumns = `
+	gs.id, gs.expert_id, gs.title, gs.description, gs.start_time, gs.end_time, gs.capacity, gs.seat_price,
+	gs.currency, gs.status, gs.zoom_meeting_id, gs.created_at,
+	(SELECT COUNT(*) FROM bookings b WHERE b.group_session_id = gs.id AND b.bk_status = ANY($1))
+`
+
+func scanGroupSession(row interface{ Scan(...any) error }, g *GroupSession) error {
+	return row.Scan(
+		&g.ID, &g.ExpertID, &g.Title, &g.Description, &g.StartTime, &g.EndTime, &g.Capacity, &g.SeatPrice,
+		&g.Currency, &g.Status, &g.ZoomMeetingID, &g.CreatedAt, &g.SeatsTaken,
+	)
+}
+
+func (s *GroupSessionStore) GetByID(ctx context.Context, id int64) (*GroupSession, error) {
+	query := `SELECT ` + groupSessionColumns + ` FROM group_sessions gs WHERE gs.id = $2`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	var g GroupSession
+	if err := scanGroupSession(s.db.QueryRowContext(ctx, query, pq.Array(ActiveBookingStatuses), id), &g); err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &g, nil
+}
+
+// GetUpcomingForExpert lists the expert's scheduled sessions that have not started
+func (s *GroupSessionStore) GetUpcomingForExpert(ctx context.Context, expertID int64) ([]GroupSession, error) {
+	query := `SELECT ` + groupSessionColumns + `
+		FROM group_sessions gs
+		WHERE gs.expert_id = $2 AND gs.status = 'scheduled' AND gs.start_time > NOW()
+		ORDER BY gs.start_time`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, pq.Array(ActiveBookingStatuses), expertID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	sessions := []GroupSession{}
+	for rows.Next() {
+		var g GroupSession
+		if err := scanGroupSession(rows, &g); err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, g)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return sessions, nil
+}
+
+// ReserveSeat books a seat in a group session for booking.UserID. The session
+// row is locked while the seats are counted so it can never be overbooked.
+func (s *GroupSessionStore) ReserveSeat(ctx context.Context, sessionID int64, booking *Booking) error {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	err := withTx(s.db, ctx, func(tx *sql.Tx) error {
+		var status string
+		var capacity int
+		var open bool
+		err := tx.QueryRowContext(ctx, `
+			SELECT status, capacity, start_time > NOW()
+			FROM group_sessions
+			WHERE id = $1
+			FOR UPDATE
+		`, sessionID).Scan(&status, &capacity, &open)
+		if err != nil {
+			switch {
+			case errors.Is(err, sql.ErrNoRows):
+				return ErrRecordNotFound
+			default:
+				return err
+			}
+		}
+
+		if status != GroupSessionScheduled || !open {
+			return ErrGroupSessionClosed
+		}
+
+		var taken int
+		err = tx.QueryRowContext(ctx,
+			`SELECT COUNT(*) FROM bookings WHERE group_session_id = $1 AND bk_status = ANY($2)`,
+			sessionID, pq.Array(ActiveBookingStatuses),
+		).Scan(&taken)
+		if err != nil {
+			return err
+		}
+
+		if taken >= capacity {
+			return ErrGroupSessionFull
+		}
+
+		booking.GroupSessionID = sql.NullInt64{Int64: sessionID, Valid: true}
+		return insertBookingTx(ctx, tx, booking)
+	})
+
+	if err != nil {
+		return bookingWriteError(err)
+	}
+
+	return nil
+}
+
+// GetAttendees lists who holds or held a seat in a group session
+func (s *GroupSessionStore) GetAttendees(ctx context.Context, sessionID int64) ([]Attendee, error) {
+	query := `
+		SELECT b.id, u.id, u.username, u.email, b.bk_status, b.payment_status, b.created_at
+		FROM bookings b
+		JOIN users u ON u.id = b.user_id
+		WHERE b.group_session_id = $1
+		ORDER BY b.created_at
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, sessionID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	attendees := []Attendee{}
+	for rows.Next() {
+		var a Attendee
+		if err := rows.Scan(&a.BookingID, &a.UserID, &a.Name, &a.Email, &a.BKStatus, &a.PaymentStatus, &a.CreatedAt); err != nil {
+			return nil, err
+		}
+		attendees = append(attendees, a)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return attendees, nil
+}
+
+// SetZoomMeeting records the meeting shared by a session's attendees. It
+// reports false when another seat's payment attached one first.
+func (s *GroupSessionStore) SetZoomMeeting(ctx context.Context, sessionID, zoomMeetingID int64) (bool, error) {
+	query := `
+		UPDATE group_sessions
+		SET zoom_meeting_id = $2
+		WHERE id = $1 AND zoom_meeting_id IS NULL
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	res, err := s.db.ExecContext(ctx, query, sessionID, zoomMeetingID)
+	if err != nil {
+		return false, err
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	return n == 1, nil
+}
+
+// Cancel withdraws a scheduled session, freeing the expert's calendar. The
+// seats are cancelled and refunded by the caller.
+func (s *GroupSessionStore) Cancel(ctx context.Context, sessionID int64) error {
+	query := `
+		UPDATE group_sessions
+		SET status = 'cancelled'
+		WHERE id = $1 AND status = 'scheduled'
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	res, err := s.db.ExecContext(ctx, query, sessionID)
+	if err != nil {
+		return err
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if n == 0 {
+		return ErrGroupSessionClosed
+	}
+
+	return nil
+}
@@ -0,0 +1,111 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+)
+
+// testDB opens the migrated database named by TEST_DB_ADDR; tests needing
+// one are skipped without it
+func testDB(t *testing.T) *sql.DB {
+	t.Helper()
+
+	addr := os.Getenv("TEST_DB_ADDR")
+	if addr == "" {
+		t.Skip("TEST_DB_ADDR is not set")
+	}
+
+	db, err := sql.Open("postgres", addr)
+	if err != nil {
+		t.Fatalf("sql.Open() = %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	return db
+}
+
+// testUser inserts an activated user, removed with everything it owns when
+// the test ends
+func testUser(t *testing.T, db *sql.DB, name string) int64 {
+	t.Helper()
+
+	var id int64
+	err := db.QueryRow(`
+		INSERT INTO users (username, email, password_hash, is_activated, phone, auth_provider)
+		VALUES ($1, $2, '', true, '', 'local')
+		RETURNING id
+	`, name, fmt.Sprintf("%s-%d@example.com", name, time.Now().UnixNano())).Scan(&id)
+	if err != nil {
+		t.Fatalf("inserting user %s: %v", name, err)
+	}
+
+	t.Cleanup(func() {
+		db.Exec(`DELETE FROM bookings WHERE user_id = $1 OR expert_id IN (SELECT id FROM experts WHERE user_id = $1)`, id)
+		db.Exec(`DELETE FROM group_sessions WHERE expert_id IN (SELECT id FROM experts WHERE user_id = $1)`, id)
+		db.Exec(`DELETE FROM experts WHERE user_id = $1`, id)
+		db.Exec(`DELETE FROM users WHERE id = $1`, id)
+	})
+
+	return id
+}
+
+func TestConfirmSeatsOfOneGroupSession(t *testing.T) {
+	db := testDB(t)
+	s := NewStorage(db)
+	ctx := context.Background()
+
+	var expertID int64
+	err := db.QueryRow(`
+		INSERT INTO experts (user_id, expertise, bio, fees_per_hr, language, timezone, onboarding_status)
+		VALUES ($1, 'workshops', '', 0, 'en', 'UTC', 'active')
+		RETURNING id
+	`, testUser(t, db, "host")).Scan(&expertID)
+	if err != nil {
+		t.Fatalf("inserting expert: %v", err)
+	}
+
+	start := time.Now().Add(48 * time.Hour).Truncate(time.Hour).UTC()
+	session := &GroupSession{
+		ExpertID:  expertID,
+		Title:     "Q&A",
+		StartTime: start,
+		EndTime:   start.Add(time.Hour),
+		Capacity:  5,
+		SeatPrice: 5000,
+		Currency:  "XAF",
+	}
+	if err := s.GroupSession.Create(ctx, session); err != nil {
+		t.Fatalf("GroupSession.Create() = %v", err)
+	}
+
+	for _, name := range []string{"first", "second"} {
+		seat := &Booking{
+			UserID:      testUser(t, db, name),
+			ExpertID:    expertID,
+			StartTime:   session.StartTime.Format(time.RFC3339),
+			EndTime:     session.EndTime.Format(time.RFC3339),
+			Topic:       session.Title,
+			Currency:    session.Currency,
+			TotalAmount: session.SeatPrice,
+		}
+		if err := s.GroupSession.ReserveSeat(ctx, session.ID, seat); err != nil {
+			t.Fatalf("ReserveSeat() for the %s attendee = %v", name, err)
+		}
+		if _, err := s.Booking.Transition(ctx, seat.ID, StatusConfirmed, ActorSystem, 0, "paid"); err != nil {
+			t.Fatalf("confirming the %s attendee's seat = %v", name, err)
+		}
+	}
+
+	var confirmed int
+	err = db.QueryRow(`SELECT COUNT(*) FROM bookings WHERE group_session_id = $1 AND bk_status = 'confirmed'`, session.ID).Scan(&confirmed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if confirmed != 2 {
+		t.Errorf("%d seats confirmed, want 2", confirmed)
+	}
+}
@@ -0,0 +1,329 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"consult_app.cedrickewi/internal/validator"
+)
+
+// Intake field types
+const (
+	IntakeText   = "text"
+	IntakeChoice = "choice"
+	IntakeFile   = "file"
+	IntakeDate   = "date"
+)
+
+// MaxIntakeFields caps the size of an intake form
+const MaxIntakeFields = 50
+
+var intakeKeyRX = regexp.MustCompile(`^[a-z0-9_]{1,64}$`)
+
+// IntakeField is one question of an intake form. Choice fields list their
+// options; the answer to a file field is the location of an uploaded file.
+type IntakeField struct {
+	Key      string   `json:"key"`
+	Label    string   `json:"label"`
+	Type     string   `json:"type"`
+	Required bool     `json:"required"`
+	Options  []string `json:"options,omitempty"`
+	Help     string   `json:"help,omitempty"`
+}
+
+// IntakeForm is the questionnaire a client fills in when booking an expert.
+// It belongs to an expert, or to an organisation for all of its experts.
+type IntakeForm struct {
+	ID             int64         `json:"id"`
+	ExpertID       sql.NullInt64 `json:"expert_id"`
+	OrganisationID sql.NullInt64 `json:"organisation_id"`
+	Title          string        `json:"title"`
+	Version        int           `json:"version"`
+	VersionID      int64         `json:"version_id"`
+	Fields         []IntakeField `json:"fields"`
+	IsActive       bool          `json:"is_active"`
+	CreatedAt      string        `json:"created_at"`
+	UpdatedAt      string        `json:"updated_at"`
+}
+
+// IntakeAnswers are a client's answers to a version of an intake form, keyed
+// by field key
+type IntakeAnswers struct {
+	FormVersionID int64             `json:"form_version_id"`
+	Answers       map[string]string `json:"answers"`
+}
+
+// BookingIntake is what a client answered when booking, with the fields of
+// the form version they answered
+type BookingIntake struct {
+	FormID      int64             `json:"form_id"`
+	Version     int               `json:"version"`
+	Title       string            `json:"title"`
+	Fields      []IntakeField     `json:"fields"`
+	Answers     map[string]string `json:"answers"`
+	SubmittedAt string            `json:"submitted_at"`
+}
+
+// IntakeFilePrefix is the part of the path of the files a client uploads for
+// an expert's intake form
+func IntakeFilePrefix(expertID, userID int64) string {
+	return fmt.Sprintf("intake/%d/%d/", expertID, userID)
+}
+
+func ValidateIntakeForm(v *validator.Validator, f *IntakeForm) {
+	v.Check(f.Title != "", "title", "must be provided")
+	v.Check(len(f.Title) <= 255, "title", "must not be more than 255 bytes long")
+	v.Check(len(f.Fields) > 0, "fields", "must contain at least one field")
+	v.Check(len(f.Fields) <= MaxIntakeFields, "fields", fmt.Sprintf("must not contain more than %d fields", MaxIntakeFields))
+
+	keys := make(map[string]bool, len(f.Fields))
+	for i, field := range f.Fields {
+		name := fmt.Sprintf("fields[%d]", i)
+		v.Check(validator.Matches(field.Key, intakeKeyRX), name+".key", "must be 1 to 64 lowercase letters, digits or underscores")
+		v.Check(!keys[field.Key], name+".key", "must be unique")
+		keys[field.Key] = true
+
+		v.Check(field.Label != "", name+".label", "must be provided")
+		v.Check(len(field.Label) <= 255, name+".label", "must not be more than 255 bytes long")
+		v.Check(len(field.Help) <= 1000, name+".help", "must not be more than 1000 bytes long")
+		v.Check(validator.In(field.Type, IntakeText, IntakeChoice, IntakeFile, IntakeDate), name+".type", "must be text, choice, file or date")
+
+		if field.Type == IntakeChoice {
+			v.Check(len(field.Options) >= 2, name+".options", "must contain at least two options")
+			v.Check(validator.Unique(field.Options), name+".options", "must not contain duplicate values")
+			v.Check(!slices.Contains(field.Options, ""), name+".options", "must not contain empty values")
+		} else {
+			v.Check(len(field.Options) == 0, name+".options", "are only allowed on choice fields")
+		}
+	}
+}
+
+// ValidateIntakeAnswers checks a client's answers against the fields of the
+// form. Files must have been uploaded by the client for this expert.
+func ValidateIntakeAnswers(v *validator.Validator, form *IntakeForm, answers map[string]string, expertID, userID int64) {
+	fields := make(map[string]IntakeField, len(form.Fields))
+	for _, field := range form.Fields {
+		fields[field.Key] = field
+	}
+
+	for key := range answers {
+		if _, ok := fields[key]; !ok {
+			v.AddError("intake."+key, "is not a field of the intake form")
+		}
+	}
+
+	for _, field := range form.Fields {
+		name := "intake." + field.Key
+		answer := strings.TrimSpace(answers[field.Key])
+		if answer == "" {
+			v.Check(!field.Required, name, "must be provided")
+			continue
+		}
+
+		switch field.Type {
+		case IntakeText:
+			v.Check(len(answer) <= 5000, name, "must not be more than 5000 bytes long")
+		case IntakeChoice:
+			v.Check(slices.Contains(field.Options, answer), name, "must be one of the options")
+		case IntakeDate:
+			_, err := time.Parse("2006-01-02", answer)
+			v.Check(err == nil, name, "must be a date in the YYYY-MM-DD format")
+		case IntakeFile:
+			v.Check(strings.Contains(answer, "/"+IntakeFilePrefix(expertID, userID)), name, "must be a file uploaded for this form")
+		}
+	}
+}
+
+type IntakeFormStore struct {
+	db *sql.DB
+}
+
+// Save stores a form for its expert or organisation. Editing an existing
+// form keeps the old fields as a previous version.
+func (s *IntakeFormStore) Save(ctx context.Context, f *IntakeForm) error {
+	fields, err := json.Marshal(f.Fields)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	return withTx(s.db, ctx, func(tx *sql.Tx) error {
+		err := tx.QueryRowContext(ctx, `
+			SELECT id, current_version + 1
+			FROM intake_forms
+			WHERE expert_id IS NOT DISTINCT FROM $1 AND organisation_id IS NOT DISTINCT FROM $2
+			FOR UPDATE
+		`, f.ExpertID, f.OrganisationID).Scan(&f.ID, &f.Version)
+
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			f.Version = 1
+			err = tx.QueryRowContext(ctx, `
+				INSERT INTO intake_forms (expert_id, organisation_id, title)
+				VALUES ($1, $2, $3)
+				RETURNING id, is_active, created_at, updated_at
+			`, f.ExpertID, f.OrganisationID, f.Title).Scan(&f.ID, &f.IsActive, &f.CreatedAt, &f.UpdatedAt)
+		case err == nil:
+			err = tx.QueryRowContext(ctx, `
+				UPDATE intake_forms
+				SET title = $2, current_version = $3, is_active = TRUE, updated_at = NOW()
+				WHERE id = $1
+				RETURNING is_active, created_at, updated_at
+			`, f.ID, f.Title, f.Version).Scan(&f.IsActive, &f.CreatedAt, &f.UpdatedAt)
+		}
+		if err != nil {
+			return err
+		}
+
+		return tx.QueryRowContext(ctx, `
+			INSERT INTO intake_form_versions (form_id, version, title, fields)
+			VALUES ($1, $2, $3, $4)
+			RETURNING id
+		`, f.ID, f.Version, f.Title, fields).Scan(&f.VersionID)
+	})
+}
+
+const intakeFormColumns = `
+	f.id, f.expert_id, f.organisation_id, v.title, f.current_version, v.id, v.fields, f.is_active, f.created_at, f.updated_at
+`
+
+func scanIntakeForm(row *sql.Row) (*IntakeForm, error) {
+	var f IntakeForm
+	var fields []byte
+	err := row.Scan(&f.ID, &f.ExpertID, &f.OrganisationID, &f.Title, &f.Version, &f.VersionID, &fields, &f.IsActive, &f.CreatedAt, &f.UpdatedAt)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	if err := json.Unmarshal(fields, &f.Fields); err != nil {
+		return nil, err
+	}
+
+	return &f, nil
+}
+
+// GetOwn retrieves the current version of the form of an expert or of an
+// organisation, active or not
+func (s *IntakeFormStore) GetOwn(ctx context.Context, expertID, organisationID sql.NullInt64) (*IntakeForm, error) {
+	query := `SELECT ` + intakeFormColumns + `
+		FROM intake_forms f
+		JOIN intake_form_versions v ON v.form_id = f.id AND v.version = f.current_version
+		WHERE f.expert_id IS NOT DISTINCT FROM $1 AND f.organisation_id IS NOT DISTINCT FROM $2`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	return scanIntakeForm(s.db.QueryRowContext(ctx, query, expertID, organisationID))
+}
+
+// GetForExpert retrieves the form clients fill in when booking an expert: the
+// expert's own active form, or else the active form of their organisation
+func (s *IntakeFormStore) GetForExpert(ctx context.Context, expertID int64) (*IntakeForm, error) {
+	query := `SELECT ` + intakeFormColumns + `
+		FROM intake_forms f
+		JOIN intake_form_versions v ON v.form_id = f.id AND v.version = f.current_version
+		WHERE f.is_active AND (
+			f.expert_id = $1
+			OR f.organisation_id IN (
+				SELECT br.organisation_id
+				FROM expert_branches eb
+				JOIN branches br ON br.id = eb.branch_id
+				WHERE eb.expert_id = $1
+			)
+		)
+		ORDER BY f.expert_id IS NULL, f.id
+		LIMIT 1`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	return scanIntakeForm(s.db.QueryRowContext(ctx, query, expertID))
+}
+
+// Deactivate stops asking clients to fill in a form. Its versions are kept
+// for the answers already given.
+func (s *IntakeFormStore) Deactivate(ctx context.Context, formID int64) error {
+	query := `
+		UPDATE intake_forms
+		SET is_active = FALSE, updated_at = NOW()
+		WHERE id = $1 AND is_active
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	res, err := s.db.ExecContext(ctx, query, formID)
+	if err != nil {
+		return err
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
+
+// insertIntakeAnswersTx stores the answers given with a new booking
+func insertIntakeAnswersTx(ctx context.Context, tx *sql.Tx, bookingID int64, intake *IntakeAnswers) error {
+	answers, err := json.Marshal(intake.Answers)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO booking_intake_answers (booking_id, form_version_id, answers)
+		VALUES ($1, $2, $3)
+	`, bookingID, intake.FormVersionID, answers)
+	return err
+}
+
+// getBookingIntake retrieves the answers given with a booking, or nil when
+// no form was filled in
+func getBookingIntake(ctx context.Context, db *sql.DB, bookingID int64) (*BookingIntake, error) {
+	query := `
+		SELECT v.form_id, v.version, v.title, v.fields, a.answers, a.submitted_at
+		FROM booking_intake_answers a
+		JOIN intake_form_versions v ON v.id = a.form_version_id
+		WHERE a.booking_id = $1
+	`
+
+	var intake BookingIntake
+	var fields, answers []byte
+	err := db.QueryRowContext(ctx, query, bookingID).Scan(&intake.FormID, &intake.Version, &intake.Title, &fields, &answers, &intake.SubmittedAt)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, nil
+		default:
+			return nil, err
+		}
+	}
+
+	if err := json.Unmarshal(fields, &intake.Fields); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(answers, &intake.Answers); err != nil {
+		return nil, err
+	}
+
+	return &intake, nil
+}
@@ -0,0 +1,305 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"sort"
+	"time"
+
+	"consult_app.cedrickewi/internal/validator"
+	"github.com/lib/pq"
+)
+
+// Timeline item types
+const (
+	TimelineBooking = "booking"
+	TimelineNote    = "note"
+	TimelineSummary = "summary"
+)
+
+// MaxActionItems caps the action items of a session summary
+const MaxActionItems = 50
+
+// Note is an expert's private note about a client, optionally about one of
+// the client's sessions. Clients never see notes.
+type Note struct {
+	ID        int64         `json:"id"`
+	ExpertID  int64         `json:"expert_id"`
+	UserID    int64         `json:"user_id"`
+	BookingID sql.NullInt64 `json:"booking_id"`
+	Body      string        `json:"body"`
+	CreatedAt time.Time     `json:"created_at"`
+	UpdatedAt time.Time     `json:"updated_at"`
+}
+
+func ValidateNote(v *validator.Validator, n *Note) {
+	v.Check(n.Body != "", "body", "must be provided")
+	v.Check(len(n.Body) <= 20000, "body", "must not be more than 20000 bytes long")
+}
+
+// Summary is what an expert shares with the client after a session
+type Summary struct {
+	ID           int64         `json:"id"`
+	BookingID    int64         `json:"booking_id"`
+	ExpertID     int64         `json:"expert_id"`
+	Summary      string        `json:"summary"`
+	ActionItems  []string      `json:"action_items"`
+	AttachmentID sql.NullInt64 `json:"attachment_id"`
+	CreatedAt    time.Time     `json:"created_at"`
+	UpdatedAt    time.Time     `json:"updated_at"`
+}
+
+func ValidateSummary(v *validator.Validator, s *Summary) {
+	v.Check(s.Summary != "", "summary", "must be provided")
+	v.Check(len(s.Summary) <= 20000, "summary", "must not be more than 20000 bytes long")
+	v.Check(len(s.ActionItems) <= MaxActionItems, "action_items", "must not contain more than 50 items")
+	for _, item := range s.ActionItems {
+		v.Check(item != "", "action_items", "must not contain empty items")
+		v.Check(len(item) <= 1000, "action_items", "must not contain items more than 1000 bytes long")
+	}
+}
+
+// TimelineItem is one entry of the history an expert has with a client.
+// Exactly one of Booking, Note and Summary is set, matching Type.
+type TimelineItem struct {
+	Type    string    `json:"type"`
+	At      time.Time `json:"at"`
+	Booking *Booking  `json:"booking,omitempty"`
+	Note    *Note     `json:"note,omitempty"`
+	Summary *Summary  `json:"summary,omitempty"`
+}
+
+type NoteStore struct {
+	db *sql.DB
+}
+
+// IsClient reports whether a user has ever booked the expert
+func (s *NoteStore) IsClient(ctx context.Context, expertID, userID int64) (bool, error) {
+	query := `SELECT EXISTS (SELECT 1 FROM bookings WHERE expert_id = $1 AND user_id = $2)`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	var ok bool
+	err := s.db.QueryRowContext(ctx, query, expertID, userID).Scan(&ok)
+	return ok, err
+}
+
+func (s *NoteStore) Insert(ctx context.Context, n *Note) error {
+	query := `
+		INSERT INTO expert_notes (expert_id, user_id, booking_id, body)
+		VALUES ($1, $2, $3, $4)
+		RETURNING id, created_at, updated_at
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	return s.db.QueryRowContext(ctx, query, n.ExpertID, n.UserID, n.BookingID, n.Body).Scan(&n.ID, &n.CreatedAt, &n.UpdatedAt)
+}
+
+// GetByID retrieves one of the expert's notes
+func (s *NoteStore) GetByID(ctx context.Context, expertID, id int64) (*Note, error) {
+	query := `
+		SELECT id, expert_id, user_id, booking_id, body, created_at, updated_at
+		FROM expert_notes
+		WHERE id = $1 AND expert_id = $2
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	var n Note
+	err := s.db.QueryRowContext(ctx, query, id, expertID).Scan(&n.ID, &n.ExpertID, &n.UserID, &n.BookingID, &n.Body, &n.CreatedAt, &n.UpdatedAt)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &n, nil
+}
+
+func (s *NoteStore) Update(ctx context.Context, n *Note) error {
+	query := `
+		UPDATE expert_notes
+		SET body = $3, updated_at = NOW()
+		WHERE id = $1 AND expert_id = $2
+		RETURNING updated_at
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	err := s.db.QueryRowContext(ctx, query, n.ID, n.ExpertID, n.Body).Scan(&n.UpdatedAt)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrRecordNotFound
+		default:
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (s *NoteStore) Delete(ctx context.Context, expertID, id int64) error {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	res, err := s.db.ExecContext(ctx, `DELETE FROM expert_notes WHERE id = $1 AND expert_id = $2`, id, expertID)
+	if err != nil {
+		return err
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
+
+// SaveSummary shares a session summary with the client, replacing the one
+// shared before. It reports whether the summary is new.
+func (s *NoteStore) SaveSummary(ctx context.Context, sum *Summary) (bool, error) {
+	query := `
+		INSERT INTO session_summaries (booking_id, expert_id, summary, action_items, attachment_id)
+		VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (booking_id) DO UPDATE
+		SET summary = EXCLUDED.summary, action_items = EXCLUDED.action_items,
+			attachment_id = EXCLUDED.attachment_id, updated_at = NOW()
+		RETURNING id, created_at, updated_at, xmax = 0
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	if sum.ActionItems == nil {
+		sum.ActionItems = []string{}
+	}
+
+	var created bool
+	err := s.db.QueryRowContext(ctx, query,
+		sum.BookingID, sum.ExpertID, sum.Summary, pq.Array(sum.ActionItems), sum.AttachmentID,
+	).Scan(&sum.ID, &sum.CreatedAt, &sum.UpdatedAt, &created)
+
+	return created, err
+}
+
+const summaryColumns = `id, booking_id, expert_id, summary, action_items, attachment_id, created_at, updated_at`
+
+func scanSummary(row interface{ Scan(...any) error }, sum *Summary) error {
+	return row.Scan(&sum.ID, &sum.BookingID, &sum.ExpertID, &sum.Summary, pq.Array(&sum.ActionItems), &sum.AttachmentID, &sum.CreatedAt, &sum.UpdatedAt)
+}
+
+// GetSummary retrieves the summary shared after a session
+func (s *NoteStore) GetSummary(ctx context.Context, bookingID int64) (*Summary, error) {
+	query := `SELECT ` + summaryColumns + ` FROM session_summaries WHERE booking_id = $1`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	var sum Summary
+	if err := scanSummary(s.db.QueryRowContext(ctx, query, bookingID), &sum); err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &sum, nil
+}
+
+// Timeline combines an expert's bookings with a client, their private notes
+// about the client and the summaries shared, newest first
+func (s *NoteStore) Timeline(ctx context.Context, expertID, userID int64) ([]TimelineItem, error) {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	items := []TimelineItem{}
+
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT id, user_id, expert_id, start_time, end_time, topic, additional_notes, amount_to_pay, currency,
+			payment_status, bk_status, created_at, start_time AS at
+		FROM bookings
+		WHERE expert_id = $1 AND user_id = $2
+	`, expertID, userID)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var b Booking
+		var at time.Time
+		err := rows.Scan(&b.ID, &b.UserID, &b.ExpertID, &b.StartTime, &b.EndTime, &b.Topic, &b.AdditionalNotes, &b.TotalAmount, &b.Currency,
+			&b.PaymentStatus, &b.BKStatus, &b.CreatedAt, &at)
+		if err != nil {
+			rows.Close()
+			return nil, err
+		}
+		items = append(items, TimelineItem{Type: TimelineBooking, At: at, Booking: &b})
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	rows, err = s.db.QueryContext(ctx, `
+		SELECT id, expert_id, user_id, booking_id, body, created_at, updated_at
+		FROM expert_notes
+		WHERE expert_id = $1 AND user_id = $2
+	`, expertID, userID)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var n Note
+		if err := rows.Scan(&n.ID, &n.ExpertID, &n.UserID, &n.BookingID, &n.Body, &n.CreatedAt, &n.UpdatedAt); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		items = append(items, TimelineItem{Type: TimelineNote, At: n.CreatedAt, Note: &n})
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	rows, err = s.db.QueryContext(ctx, `
+		SELECT s.id, s.booking_id, s.expert_id, s.summary, s.action_items, s.attachment_id, s.created_at, s.updated_at
+		FROM session_summaries s
+		JOIN bookings b ON b.id = s.booking_id
+		WHERE s.expert_id = $1 AND b.user_id = $2
+	`, expertID, userID)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var sum Summary
+		if err := scanSummary(rows, &sum); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		items = append(items, TimelineItem{Type: TimelineSummary, At: sum.CreatedAt, Summary: &sum})
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	sort.SliceStable(items, func(i, j int) bool {
+		return items[i].At.After(items[j].At)
+	})
+
+	return items, nil
+}
@@ -0,0 +1,266 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"consult_app.cedrickewi/internal/validator"
+	"github.com/lib/pq"
+)
+
+type OnboardingStatus string
+
+const (
+	OnboardingDraft       OnboardingStatus = "draft"
+	OnboardingSubmitted   OnboardingStatus = "submitted"
+	OnboardingUnderReview OnboardingStatus = "under_review"
+	OnboardingActive      OnboardingStatus = "active"
+	OnboardingRejected    OnboardingStatus = "rejected"
+)
+
+// Onboarding steps an expert must complete before submitting.
+const (
+	StepProfile       = "profile"
+	StepProfilePhoto  = "profile_photo"
+	StepCertification = "certifications"
+	StepAvailability  = "availability"
+	StepPayoutDetails = "payout_details"
+)
+
+var onboardingSteps = []string{StepProfile, StepProfilePhoto, StepCertification, StepAvailability, StepPayoutDetails}
+
+// OnboardingProgress reports how far an expert is through onboarding.
+type OnboardingProgress struct {
+	Status          OnboardingStatus `json:"status"`
+	RejectionReason string           `json:"rejection_reason,omitempty"`
+	Completion      int              `json:"completion"`
+	CompletedSteps  []string         `json:"completed_steps"`
+	MissingSteps    []string         `json:"missing_steps"`
+}
+
+// CanSubmit reports whether every step is done and the status allows submission.
+func (p *OnboardingProgress) CanSubmit() bool {
+	return len(p.MissingSteps) == 0 &&
+		(p.Status == OnboardingDraft || p.Status == OnboardingRejected)
+}
+
+type Certification struct {
+	ID          int64     `json:"id"`
+	ExpertID    int64     `json:"expert_id"`
+	Name        string    `json:"cert_name"`
+	Institution string    `json:"institution"`
+	Picture     string    `json:"picture"`
+	CertDate    time.Time `json:"cert_date"`
+	CreatedAt   string    `json:"created_at"`
+}
+
+type PayoutDetails struct {
+	ExpertID      int64  `json:"expert_id"`
+	PayoutMethod  string `json:"payout_method"`
+	Provider      string `json:"provider"`
+	AccountName   string `json:"account_name"`
+	AccountNumber string `json:"account_number"`
+	UpdatedAt     string `json:"updated_at"`
+}
+
+func ValidatePayoutDetails(v *validator.Validator, p *PayoutDetails) {
+	v.Check(validator.In(p.PayoutMethod, "mobile_money", "bank_transfer"), "payout_method", "must be mobile_money or bank_transfer")
+	v.Check(p.Provider != "", "provider", "must be provided")
+	v.Check(p.AccountName != "", "account_name", "must be provided")
+	v.Check(p.AccountNumber != "", "account_number", "must be provided")
+	v.Check(len(p.AccountNumber) <= 64, "account_number", "must not be more than 64 bytes long")
+}
+
+func ValidateCertification(v *validator.Validator, c *Certification) {
+	v.Check(c.Name != "", "cert_name", "must be provided")
+	v.Check(c.Institution != "", "institution", "must be provided")
+	v.Check(!c.CertDate.IsZero(), "cert_date", "must be provided")
+	v.Check(c.CertDate.Before(time.Now()), "cert_date", "must not be in the future")
+}
+
+// GetOnboardingProgress computes the onboarding checklist of an expert
+func (s *ExpertsStore) GetOnboardingProgress(ctx context.Context, expertID int64) (*OnboardingProgress, error) {
+	query := `
+		SELECT e.onboarding_status, e.rejection_reason,
+			   (COALESCE(e.expertise, '') <> '' AND COALESCE(e.bio, '') <> '') AS has_profile,
+			   COALESCE(u.image_url, '') <> '' AS has_photo,
+			   EXISTS (SELECT 1 FROM certifications c WHERE c.expert_id = e.id) AS has_certification,
+			   EXISTS (SELECT 1 FROM expert_availabilities ea WHERE ea.expert_id = e.id) AS has_availability,
+			   EXISTS (SELECT 1 FROM expert_payout_details p WHERE p.expert_id = e.id) AS has_payout
+		FROM experts e
+		JOIN users u ON u.id = e.user_id
+		WHERE e.id = $1
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	var progress OnboardingProgress
+	done := make([]bool, len(onboardingSteps))
+	err := s.db.QueryRowContext(ctx, query, expertID).Scan(
+		&progress.Status,
+		&progress.RejectionReason,
+		&done[0], &done[1], &done[2], &done[3], &done[4],
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	progress.CompletedSteps = []string{}
+	progress.MissingSteps = []string{}
+	for i, step := range onboardingSteps {
+		if done[i] {
+			progress.CompletedSteps = append(progress.CompletedSteps, step)
+		} else {
+			progress.MissingSteps = append(progress.MissingSteps, step)
+		}
+	}
+	progress.Completion = len(progress.CompletedSteps) * 100 / len(onboardingSteps)
+
+	return &progress, nil
+}
+
+// UpdateOnboardingStatus moves an expert to status `to` if it is currently in
+// one of `from`. reviewerID is recorded for review decisions (0 for none).
+func (s *ExpertsStore) UpdateOnboardingStatus(ctx context.Context, expertID int64, from []OnboardingStatus, to OnboardingStatus, reason string, reviewerID int64) error {
+	query := `
+		UPDATE experts
+		SET onboarding_status = $2,
+			rejection_reason = $3,
+			submitted_at = CASE WHEN $2 = 'submitted' THEN NOW() ELSE submitted_at END,
+			reviewed_at = CASE WHEN $2 IN ('active', 'rejected') THEN NOW() ELSE reviewed_at END,
+			reviewed_by = COALESCE(NULLIF($4, 0), reviewed_by),
+			version = version + 1
+		WHERE id = $1 AND onboarding_status = ANY($5)
+	`
+
+	fromStatuses := make([]string, len(from))
+	for i, f := range from {
+		fromStatuses[i] = string(f)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	result, err := s.db.ExecContext(ctx, query, expertID, string(to), reason, reviewerID, pq.Array(fromStatuses))
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrInvalidTransition
+	}
+
+	return nil
+}
+
+// AddCertification stores a certification for an expert
+func (s *ExpertsStore) AddCertification(ctx context.Context, cert *Certification) error {
+	query := `
+		INSERT INTO certifications (expert_id, cert_name, institution, picture, cert_date)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING id, created_at
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	return s.db.QueryRowContext(ctx, query,
+		cert.ExpertID, cert.Name, cert.Institution, cert.Picture, cert.CertDate,
+	).Scan(&cert.ID, &cert.CreatedAt)
+}
+
+// GetCertifications lists an expert's certifications
+func (s *ExpertsStore) GetCertifications(ctx context.Context, expertID int64) ([]Certification, error) {
+	query := `
+		SELECT id, expert_id, cert_name, institution, picture, cert_date, created_at
+		FROM certifications
+		WHERE expert_id = $1
+		ORDER BY cert_date DESC
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, expertID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	certs := []Certification{}
+	for rows.Next() {
+		var c Certification
+		if err := rows.Scan(&c.ID, &c.ExpertID, &c.Name, &c.Institution, &c.Picture, &c.CertDate, &c.CreatedAt); err != nil {
+			return nil, err
+		}
+		certs = append(certs, c)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return certs, nil
+}
+
+// UpsertPayoutDetails creates or replaces an expert's payout details
+func (s *ExpertsStore) UpsertPayoutDetails(ctx context.Context, p *PayoutDetails) error {
+	query := `
+		INSERT INTO expert_payout_details (expert_id, payout_method, provider, account_name, account_number)
+		VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (expert_id) DO UPDATE SET
+			payout_method = EXCLUDED.payout_method,
+			provider = EXCLUDED.provider,
+			account_name = EXCLUDED.account_name,
+			account_number = EXCLUDED.account_number,
+			updated_at = NOW()
+		RETURNING updated_at
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	return s.db.QueryRowContext(ctx, query,
+		p.ExpertID, p.PayoutMethod, p.Provider, p.AccountName, p.AccountNumber,
+	).Scan(&p.UpdatedAt)
+}
+
+// GetPayoutDetails returns an expert's payout details
+func (s *ExpertsStore) GetPayoutDetails(ctx context.Context, expertID int64) (*PayoutDetails, error) {
+	query := `
+		SELECT expert_id, payout_method, provider, account_name, account_number, updated_at
+		FROM expert_payout_details
+		WHERE expert_id = $1
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	var p PayoutDetails
+	err := s.db.QueryRowContext(ctx, query, expertID).Scan(
+		&p.ExpertID, &p.PayoutMethod, &p.Provider, &p.AccountName, &p.AccountNumber, &p.UpdatedAt,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &p, nil
+}
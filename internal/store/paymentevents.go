@@ -0,0 +1,90 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+// PaymentEventClaimTimeout is how long a notification being processed is
+// left to the request processing it before another delivery may take it over
+const PaymentEventClaimTimeout = 5 * time.Minute
+
+// PaymentEvent is a notification received from a payment gateway
+type PaymentEvent struct {
+	ID            int64      `json:"id"`
+	Provider      string     `json:"provider"`
+	DedupeKey     string     `json:"dedupe_key"`
+	TransactionID string     `json:"transaction_id"`
+	State         string     `json:"state"`
+	Payload       []byte     `json:"-"`
+	ReceivedAt    time.Time  `json:"received_at"`
+	ProcessedAt   *time.Time `json:"processed_at"`
+	Attempts      int        `json:"attempts"`
+	LastError     string     `json:"last_error"`
+}
+
+type PaymentEventStore struct {
+	db *sql.DB
+}
+
+// Record keeps a notification as received and claims it for processing. A
+// notification already recorded under the same dedupe key is not stored
+// again; it is claimed only when it was never processed and nobody else is
+// processing it. Record reports whether the caller holds the claim and must
+// process the notification.
+func (s *PaymentEventStore) Record(ctx context.Context, e *PaymentEvent) (bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	var claimed bool
+	err := withTx(s.db, ctx, func(tx *sql.Tx) error {
+		_, err := tx.ExecContext(ctx, `
+			INSERT INTO payment_events (provider, dedupe_key, transaction_id, state, payload)
+			VALUES ($1, $2, $3, $4, $5)
+			ON CONFLICT (provider, dedupe_key) DO NOTHING
+		`, e.Provider, e.DedupeKey, e.TransactionID, e.State, e.Payload)
+		if err != nil {
+			return err
+		}
+
+		err = tx.QueryRowContext(ctx, `
+			UPDATE payment_events
+			SET claimed_at = NOW(), attempts = attempts + 1
+			WHERE provider = $1 AND dedupe_key = $2
+			  AND processed_at IS NULL
+			  AND (claimed_at IS NULL OR claimed_at < NOW() - make_interval(secs => $3))
+			RETURNING id, received_at, attempts
+		`, e.Provider, e.DedupeKey, PaymentEventClaimTimeout.Seconds()).Scan(&e.ID, &e.ReceivedAt, &e.Attempts)
+		switch {
+		case err == sql.ErrNoRows:
+			return nil
+		case err != nil:
+			return err
+		}
+
+		claimed = true
+		return nil
+	})
+
+	return claimed, err
+}
+
+// MarkProcessed records how processing a claimed notification went. A
+// notification that failed, or could not be applied yet, is released so that
+// the gateway's next delivery processes it again.
+func (s *PaymentEventStore) MarkProcessed(ctx context.Context, id int64, processErr string) error {
+	query := `
+		UPDATE payment_events
+		SET processed_at = CASE WHEN $2 = '' THEN NOW() END,
+			claimed_at = NULL,
+			last_error = $2
+		WHERE id = $1
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	_, err := s.db.ExecContext(ctx, query, id, processErr)
+	return err
+}
@@ -0,0 +1,136 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// PaymentTransaction is the gateway transaction a booking is paid with
+type PaymentTransaction struct {
+	BookingID     int64
+	Provider      string
+	TransactionID string
+	// Reference is the gateway's own ID for the transaction
+	Reference string
+	URL       string
+	Amount    int
+	// Details is what the gateway needs later about the transaction, as it
+	// gave it
+	Details   []byte
+	StartedAt time.Time
+}
+
+type PaymentStore struct {
+	db *sql.DB
+}
+
+// SaveTransaction records the transaction a booking is now paid with, in
+// place of any transaction initialised before
+func (s *PaymentStore) SaveTransaction(ctx context.Context, t *PaymentTransaction) error {
+	query := `
+		UPDATE bookings
+		SET transaction_id = $1, transaction_started_at = NOW(),
+			payment_provider = $2, payment_reference = NULLIF($3, ''), payment_url = NULLIF($4, ''),
+			payment_amount = $5, payment_details = $6,
+			payment_charge_id = NULL, payment_state = NULL
+		WHERE id = $7
+		RETURNING transaction_started_at
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	var details any
+	if len(t.Details) > 0 {
+		details = t.Details
+	}
+
+	err := s.db.QueryRowContext(ctx, query,
+		t.TransactionID, t.Provider, t.Reference, t.URL, t.Amount, details, t.BookingID,
+	).Scan(&t.StartedAt)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrRecordNotFound
+		default:
+			return err
+		}
+	}
+
+	return nil
+}
+
+// GetTransaction returns the transaction a booking is paid with
+func (s *PaymentStore) GetTransaction(ctx context.Context, bookingID int64) (*PaymentTransaction, error) {
+	query := `
+		SELECT id, payment_provider, transaction_id, COALESCE(payment_reference, ''), COALESCE(payment_url, ''),
+			COALESCE(payment_amount, 0), payment_details, transaction_started_at
+		FROM bookings
+		WHERE id = $1 AND transaction_id IS NOT NULL AND payment_provider IS NOT NULL
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	var t PaymentTransaction
+	err := s.db.QueryRowContext(ctx, query, bookingID).Scan(
+		&t.BookingID, &t.Provider, &t.TransactionID, &t.Reference, &t.URL, &t.Amount, &t.Details, &t.StartedAt,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &t, nil
+}
+
+// SaveCharge records the gateway's ID for the charge of a booking's
+// transaction and the state it answered with
+func (s *PaymentStore) SaveCharge(ctx context.Context, bookingID int64, chargeID, state string) error {
+	query := `
+		UPDATE bookings
+		SET payment_charge_id = NULLIF($1, ''), payment_state = COALESCE(NULLIF($2, ''), payment_state)
+		WHERE id = $3
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	result, err := s.db.ExecContext(ctx, query, chargeID, state, bookingID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
+
+// SaveState records the state the gateway last reported for the transaction
+// a booking is paid with
+func (s *PaymentStore) SaveState(ctx context.Context, bookingID int64, transactionID, state string) error {
+	query := `
+		UPDATE bookings
+		SET payment_state = $1
+		WHERE id = $2 AND transaction_id = $3
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	_, err := s.db.ExecContext(ctx, query, state, bookingID, transactionID)
+	return err
+}
@@ -0,0 +1,150 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+// PaymentRecord is what our tables say about a booking's payment transaction
+type PaymentRecord struct {
+	BookingID     int64
+	TransactionID string
+	BKStatus      string
+	PaymentStatus string
+	StartedAt     time.Time
+	// Amount is what the gateway was asked to collect
+	Amount sql.NullInt64
+	// RecordedState is the last state the gateway reported that we stored
+	RecordedState sql.NullString
+}
+
+// PaymentMismatch is a disagreement between the gateway and our records
+type PaymentMismatch struct {
+	BookingID     int64  `json:"booking_id"`
+	TransactionID string `json:"transaction_id"`
+	Kind          string `json:"kind"`
+	GatewayValue  string `json:"gateway_value"`
+	RecordedValue string `json:"recorded_value"`
+}
+
+// ReconciliationReport is the outcome of comparing a day's transactions with
+// the gateway
+type ReconciliationReport struct {
+	ID         int64             `json:"id"`
+	Date       time.Time         `json:"report_date"`
+	Provider   string            `json:"provider"`
+	Checked    int               `json:"transactions_checked"`
+	Mismatches []PaymentMismatch `json:"mismatches"`
+	CreatedAt  time.Time         `json:"created_at"`
+}
+
+type ReconciliationStore struct {
+	db *sql.DB
+}
+
+// GetPendingPayments returns the bookings whose payment transaction was
+// started in [from, to) and is still pending, oldest first
+func (s *ReconciliationStore) GetPendingPayments(ctx context.Context, from, to time.Time) ([]int64, error) {
+	query := `
+		SELECT id
+		FROM bookings
+		WHERE transaction_id IS NOT NULL
+		  AND payment_status = 'pending'
+		  AND transaction_started_at >= $1 AND transaction_started_at < $2
+		ORDER BY transaction_started_at
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, from, to)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+
+	return ids, rows.Err()
+}
+
+// GetPaymentRecords returns what the bookings hold about the transactions
+// started in [from, to)
+func (s *ReconciliationStore) GetPaymentRecords(ctx context.Context, from, to time.Time) ([]PaymentRecord, error) {
+	query := `
+		SELECT b.id, b.transaction_id, b.bk_status, b.payment_status, b.transaction_started_at,
+			b.payment_amount, b.payment_state
+		FROM bookings b
+		WHERE b.transaction_id IS NOT NULL
+		  AND b.transaction_started_at >= $1 AND b.transaction_started_at < $2
+		ORDER BY b.transaction_started_at
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, from, to)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var records []PaymentRecord
+	for rows.Next() {
+		var r PaymentRecord
+		err := rows.Scan(&r.BookingID, &r.TransactionID, &r.BKStatus, &r.PaymentStatus, &r.StartedAt, &r.Amount, &r.RecordedState)
+		if err != nil {
+			return nil, err
+		}
+		records = append(records, r)
+	}
+
+	return records, rows.Err()
+}
+
+// SaveReport stores the report of a day, replacing any report already made
+// for that day
+func (s *ReconciliationStore) SaveReport(ctx context.Context, r *ReconciliationReport) error {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	return withTx(s.db, ctx, func(tx *sql.Tx) error {
+		err := tx.QueryRowContext(ctx, `
+			INSERT INTO payment_reconciliation_reports (report_date, provider, transactions_checked, mismatches_found)
+			VALUES ($1, $2, $3, $4)
+			ON CONFLICT (report_date) DO UPDATE
+			SET provider = EXCLUDED.provider,
+				transactions_checked = EXCLUDED.transactions_checked,
+				mismatches_found = EXCLUDED.mismatches_found,
+				created_at = NOW()
+			RETURNING id, created_at
+		`, r.Date, r.Provider, r.Checked, len(r.Mismatches)).Scan(&r.ID, &r.CreatedAt)
+		if err != nil {
+			return err
+		}
+
+		if _, err := tx.ExecContext(ctx, `DELETE FROM payment_reconciliation_mismatches WHERE report_id = $1`, r.ID); err != nil {
+			return err
+		}
+
+		for _, m := range r.Mismatches {
+			_, err := tx.ExecContext(ctx, `
+				INSERT INTO payment_reconciliation_mismatches (report_id, booking_id, transaction_id, kind, gateway_value, recorded_value)
+				VALUES ($1, $2, $3, $4, $5, $6)
+			`, r.ID, m.BookingID, m.TransactionID, m.Kind, m.GatewayValue, m.RecordedValue)
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
@@ -0,0 +1,465 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// Refund statuses
+const (
+	RefundPending    = "pending"
+	RefundProcessing = "processing"
+	// RefundManual is a refund the gateway cannot issue, waiting for staff
+	// to pay it out by hand
+	RefundManual    = "manual"
+	RefundSucceeded = "succeeded"
+	RefundFailed    = "failed"
+)
+
+// MaxRefundAttempts is how many times a refund the gateway could not take
+// is tried before it is given up as failed
+const MaxRefundAttempts = 5
+
+// RefundPollInterval is how long a refund in processing is left before the
+// gateway is asked about it again
+const RefundPollInterval = 5 * time.Minute
+
+var (
+	// ErrNotRefundable is returned when refunding a booking that was not paid
+	ErrNotRefundable = errors.New("this booking has no payment to refund")
+	// ErrRefundTooLarge is returned when a refund would give back more than
+	// what is left of the booking's payment
+	ErrRefundTooLarge = errors.New("the refund is larger than what is left of the payment")
+)
+
+// Refund is money owed back to a client for a booking
+type Refund struct {
+	ID                int64  `json:"id"`
+	BookingID         int64  `json:"booking_id"`
+	Amount            int    `json:"amount"`
+	Currency          string `json:"currency"`
+	Status            string `json:"status"`
+	Reason            string `json:"reason"`
+	RequestedBy       int64  `json:"requested_by,omitempty"`
+	ProviderReference string `json:"provider_reference,omitempty"`
+	// TransactionID is the payment transaction refunded
+	TransactionID string `json:"transaction_id,omitempty"`
+	Attempts      int    `json:"-"`
+	LastError     string `json:"last_error,omitempty"`
+	CreatedAt     string `json:"created_at"`
+	UpdatedAt     string `json:"updated_at"`
+}
+
+type RefundStore struct {
+	db *sql.DB
+}
+
+func insertRefundTx(ctx context.Context, tx *sql.Tx, refund *Refund) error {
+	query := `
+		INSERT INTO refunds (booking_id, amount, currency, reason, requested_by)
+		VALUES ($1, $2, COALESCE(NULLIF($3, ''), 'XAF'), $4, NULLIF($5, 0))
+		RETURNING id, currency, status, created_at, updated_at
+	`
+
+	return tx.QueryRowContext(ctx, query,
+		refund.BookingID, refund.Amount, refund.Currency, refund.Reason, refund.RequestedBy,
+	).Scan(&refund.ID, &refund.Currency, &refund.Status, &refund.CreatedAt, &refund.UpdatedAt)
+}
+
+// Refundable returns what is left to refund of a booking's payment: its
+// amount less the refunds not failed
+func (s *RefundStore) Refundable(ctx context.Context, bookingID int64) (int, error) {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	var left int
+	err := withTx(s.db, ctx, func(tx *sql.Tx) error {
+		var err error
+		left, err = refundableTx(ctx, tx, bookingID)
+		return err
+	})
+	return left, err
+}
+
+// Create records a refund of a paid booking, which is then issued through the
+// gateway. It fails with ErrRefundTooLarge when the booking's payment, less
+// its other refunds, does not cover it.
+func (s *RefundStore) Create(ctx context.Context, refund *Refund) error {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	return withTx(s.db, ctx, func(tx *sql.Tx) error {
+		left, err := refundableTx(ctx, tx, refund.BookingID)
+		if err != nil {
+			return err
+		}
+		if refund.Amount > left {
+			return ErrRefundTooLarge
+		}
+
+		return insertRefundTx(ctx, tx, refund)
+	})
+}
+
+// refundableTx locks a paid booking and returns what is left to refund of it
+func refundableTx(ctx context.Context, tx *sql.Tx, bookingID int64) (int, error) {
+	var (
+		paid          int
+		paymentStatus string
+	)
+	err := tx.QueryRowContext(ctx, `
+		SELECT COALESCE(amount_to_pay, 0), payment_status FROM bookings WHERE id = $1 FOR UPDATE
+	`, bookingID).Scan(&paid, &paymentStatus)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return 0, ErrRecordNotFound
+		default:
+			return 0, err
+		}
+	}
+	if paymentStatus != PaymentSuccess {
+		return 0, ErrNotRefundable
+	}
+
+	var refunded int
+	err = tx.QueryRowContext(ctx, `
+		SELECT COALESCE(SUM(amount), 0) FROM refunds WHERE booking_id = $1 AND status <> 'failed'
+	`, bookingID).Scan(&refunded)
+	if err != nil {
+		return 0, err
+	}
+
+	return paid - refunded, nil
+}
+
+// GetAllForBooking lists the refunds of a booking, newest first
+func (s *RefundStore) GetAllForBooking(ctx context.Context, bookingID int64) ([]Refund, error) {
+	query := `
+		SELECT id, booking_id, amount, currency, status, reason, COALESCE(requested_by, 0), provider_reference,
+			COALESCE(transaction_id, ''), attempts, last_error, created_at, updated_at
+		FROM refunds
+		WHERE booking_id = $1
+		ORDER BY created_at DESC
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, bookingID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return scanRefunds(rows)
+}
+
+// GetDue returns the refunds waiting to be issued and those issued that the
+// gateway has not settled since RefundPollInterval. A refund not yet linked to
+// its payment transaction gets the booking's, or for an occurrence of a series
+// paid at once, the series'.
+func (s *RefundStore) GetDue(ctx context.Context, limit int) ([]Refund, error) {
+	query := `
+		SELECT r.id, r.booking_id, r.amount, r.currency, r.status, r.reason, COALESCE(r.requested_by, 0), r.provider_reference,
+			COALESCE(r.transaction_id, b.transaction_id, (
+				SELECT o.transaction_id
+				FROM bookings o
+				WHERE o.series_id = b.series_id AND o.transaction_id IS NOT NULL
+				ORDER BY o.series_index
+				LIMIT 1
+			), ''),
+			r.attempts, r.last_error, r.created_at, r.updated_at
+		FROM refunds r
+		JOIN bookings b ON b.id = r.booking_id
+		WHERE r.status = 'pending'
+		   OR (r.status = 'processing' AND r.updated_at < NOW() - make_interval(secs => $1))
+		ORDER BY r.created_at
+		LIMIT $2
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, RefundPollInterval.Seconds(), limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return scanRefunds(rows)
+}
+
+// GetByProviderReference retrieves a refund by the gateway's reference for it
+func (s *RefundStore) GetByProviderReference(ctx context.Context, reference string) (*Refund, error) {
+	query := `
+		SELECT id, booking_id, amount, currency, status, reason, COALESCE(requested_by, 0), provider_reference,
+			COALESCE(transaction_id, ''), attempts, last_error, created_at, updated_at
+		FROM refunds
+		WHERE provider_reference = $1 AND provider_reference <> ''
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, reference)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	refunds, err := scanRefunds(rows)
+	if err != nil {
+		return nil, err
+	}
+	if len(refunds) == 0 {
+		return nil, ErrRecordNotFound
+	}
+
+	return &refunds[0], nil
+}
+
+// GetByID retrieves a refund
+func (s *RefundStore) GetByID(ctx context.Context, id int64) (*Refund, error) {
+	query := `
+		SELECT id, booking_id, amount, currency, status, reason, COALESCE(requested_by, 0), provider_reference,
+			COALESCE(transaction_id, ''), attempts, last_error, created_at, updated_at
+		FROM refunds
+		WHERE id = $1
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	refunds, err := scanRefunds(rows)
+	if err != nil {
+		return nil, err
+	}
+	if len(refunds) == 0 {
+		return nil, ErrRecordNotFound
+	}
+
+	return &refunds[0], nil
+}
+
+// GetManual lists the refunds waiting to be paid out by hand, oldest first
+func (s *RefundStore) GetManual(ctx context.Context) ([]Refund, error) {
+	query := `
+		SELECT id, booking_id, amount, currency, status, reason, COALESCE(requested_by, 0), provider_reference,
+			COALESCE(transaction_id, ''), attempts, last_error, created_at, updated_at
+		FROM refunds
+		WHERE status = 'manual'
+		ORDER BY created_at
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return scanRefunds(rows)
+}
+
+// MarkManual leaves a refund the gateway cannot issue to be paid out by hand
+func (s *RefundStore) MarkManual(ctx context.Context, id int64, transactionID, reason string) error {
+	query := `
+		UPDATE refunds
+		SET status = 'manual', transaction_id = NULLIF($2, ''), last_error = $3, updated_at = NOW()
+		WHERE id = $1 AND status IN ('pending', 'processing')
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	_, err := s.db.ExecContext(ctx, query, id, transactionID, reason)
+	return err
+}
+
+// RecordPayout records the reference of the payout made by hand for a manual
+// refund
+func (s *RefundStore) RecordPayout(ctx context.Context, id int64, reference string) error {
+	query := `
+		UPDATE refunds
+		SET provider_reference = $2, updated_at = NOW()
+		WHERE id = $1 AND status = 'manual'
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	result, err := s.db.ExecContext(ctx, query, id, reference)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
+
+// MarkIssued records that the gateway took a refund, under its reference
+func (s *RefundStore) MarkIssued(ctx context.Context, id int64, transactionID, reference string) error {
+	query := `
+		UPDATE refunds
+		SET status = 'processing', transaction_id = $2, provider_reference = $3,
+			attempts = attempts + 1, last_error = '', issued_at = NOW(), updated_at = NOW()
+		WHERE id = $1 AND status IN ('pending', 'processing')
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	_, err := s.db.ExecContext(ctx, query, id, transactionID, reference)
+	return err
+}
+
+// RecordAttempt records that issuing a pending refund failed. After
+// MaxRefundAttempts the refund is given up as failed, which RecordAttempt
+// reports.
+func (s *RefundStore) RecordAttempt(ctx context.Context, id int64, attemptErr string) (bool, error) {
+	query := `
+		UPDATE refunds
+		SET attempts = attempts + 1,
+			last_error = $2,
+			status = CASE WHEN attempts + 1 >= $3 THEN 'failed' ELSE status END,
+			settled_at = CASE WHEN attempts + 1 >= $3 THEN NOW() END,
+			updated_at = NOW()
+		WHERE id = $1 AND status = 'pending'
+		RETURNING status
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	var status string
+	err := s.db.QueryRowContext(ctx, query, id, attemptErr, MaxRefundAttempts).Scan(&status)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return false, nil
+		}
+		return false, err
+	}
+
+	return status == RefundFailed, nil
+}
+
+// Settle records the outcome of a refund at the gateway, or of its payout by
+// hand. The expert's share
+// of a refund that succeeded is taken back from their earnings of the
+// booking; once the booking's payment is refunded in full the booking is
+// marked refunded. Settling a refund already settled changes nothing, which Settle reports.
+func (s *RefundStore) Settle(ctx context.Context, id int64, succeeded bool, reason string) (bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	status := RefundFailed
+	if succeeded {
+		status = RefundSucceeded
+	}
+
+	settled := false
+	err := withTx(s.db, ctx, func(tx *sql.Tx) error {
+		var (
+			bookingID int64
+			amount    int
+		)
+		err := tx.QueryRowContext(ctx, `
+			UPDATE refunds
+			SET status = $2, last_error = $3, settled_at = NOW(), updated_at = NOW()
+			WHERE id = $1 AND status IN ('pending', 'processing', 'manual')
+			RETURNING booking_id, amount
+		`, id, status, reason).Scan(&bookingID, &amount)
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return nil
+			}
+			return err
+		}
+		settled = true
+
+		if !succeeded {
+			return nil
+		}
+
+		// a refund comes out of the expert's earnings of the booking first;
+		// the platform gives back its fee only for what exceeds them
+		_, err = tx.ExecContext(ctx, `
+			UPDATE expert_earnings
+			SET refunded_amount = LEAST(amount, refunded_amount + $2),
+				status = CASE WHEN status = 'pending' AND refunded_amount + $2 >= amount THEN 'cancelled' ELSE status END,
+				updated_at = NOW()
+			WHERE booking_id = $1
+		`, bookingID, amount)
+		if err != nil {
+			return err
+		}
+
+		var (
+			paid, refunded int
+			bkStatus       BookingStatus
+		)
+		err = tx.QueryRowContext(ctx, `
+			SELECT COALESCE(b.amount_to_pay, 0), b.bk_status,
+				(SELECT COALESCE(SUM(amount), 0) FROM refunds WHERE booking_id = b.id AND status = 'succeeded')
+			FROM bookings b
+			WHERE b.id = $1
+			FOR UPDATE
+		`, bookingID).Scan(&paid, &bkStatus, &refunded)
+		if err != nil {
+			return err
+		}
+		if refunded < paid {
+			return nil
+		}
+
+		if _, err := tx.ExecContext(ctx, `UPDATE bookings SET payment_status = 'refunded' WHERE id = $1`, bookingID); err != nil {
+			return err
+		}
+		if CheckTransition(bkStatus, StatusRefunded, ActorSystem) == nil {
+			if _, err := transitionTx(ctx, tx, bookingID, StatusRefunded, ActorSystem, 0, "refunded in full"); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+
+	return settled, err
+}
+
+func scanRefunds(rows *sql.Rows) ([]Refund, error) {
+	refunds := []Refund{}
+	for rows.Next() {
+		var r Refund
+		err := rows.Scan(&r.ID, &r.BookingID, &r.Amount, &r.Currency, &r.Status, &r.Reason,
+			&r.RequestedBy, &r.ProviderReference, &r.TransactionID, &r.Attempts, &r.LastError, &r.CreatedAt, &r.UpdatedAt)
+		if err != nil {
+			return nil, err
+		}
+		refunds = append(refunds, r)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return refunds, nil
+}
@@ -0,0 +1,362 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// Reschedule request statuses
+const (
+	RescheduleProposed  = "proposed"
+	RescheduleAccepted  = "accepted"
+	RescheduleDeclined  = "declined"
+	RescheduleWithdrawn = "withdrawn"
+)
+
+var (
+	ErrRescheduleLimit = errors.New("booking has reached its reschedule limit")
+	ErrRescheduleOpen  = errors.New("booking already has an open reschedule proposal")
+	ErrNotInSeries     = errors.New("booking is not part of a series")
+)
+
+// reschedulableStatuses are the booking statuses that can still be moved
+var reschedulableStatuses = []BookingStatus{StatusRequested, StatusAwaitingPayment, StatusConfirmed}
+
+// RescheduleRequest is a proposal by one party to move a booking to a new time
+type RescheduleRequest struct {
+	ID          int64      `json:"id"`
+	BookingID   int64      `json:"booking_id"`
+	ProposedBy  int64      `json:"proposed_by"`
+	Proposer    Actor      `json:"proposer"`
+	StartTime   time.Time  `json:"start_time"`
+	EndTime     time.Time  `json:"end_time"`
+	Reason      string     `json:"reason"`
+	Scope       string     `json:"scope"`
+	Status      string     `json:"status"`
+	RespondedBy int64      `json:"responded_by,omitempty"`
+	RespondedAt *time.Time `json:"responded_at,omitempty"`
+	CreatedAt   string     `json:"created_at"`
+	// Moves are the bookings an accepted request moved, more than one when
+	// the scope covers the following occurrences of a series
+	Moves []RescheduleMove `json:"moves,omitempty"`
+}
+
+// RescheduleMove is the new time of one booking moved by a reschedule request
+type RescheduleMove struct {
+	BookingID int64     `json:"booking_id"`
+	StartTime time.Time `json:"start_time"`
+	EndTime   time.Time `json:"end_time"`
+}
+
+type RescheduleStore struct {
+	db *sql.DB
+}
+
+// lockReschedulable locks a booking and checks it can still be moved
+func lockReschedulable(ctx context.Context, tx *sql.Tx, bookingID int64, maxReschedules int) (BookingStatus, error) {
+	var status BookingStatus
+	var count int
+	err := tx.QueryRowContext(ctx,
+		`SELECT bk_status, reschedule_count FROM bookings WHERE id = $1 FOR UPDATE`, bookingID,
+	).Scan(&status, &count)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return "", ErrRecordNotFound
+		default:
+			return "", err
+		}
+	}
+
+	reschedulable := false
+	for _, s := range reschedulableStatuses {
+		if s == status {
+			reschedulable = true
+		}
+	}
+	if !reschedulable {
+		return "", ErrInvalidTransition
+	}
+
+	if count >= maxReschedules {
+		return "", ErrRescheduleLimit
+	}
+
+	return status, nil
+}
+
+// rescheduleMoves lists the bookings a request moves. With the "following"
+// scope every later occurrence of the series that still holds its slot moves
+// by the same offset. Moves are ordered so no occurrence is moved onto one
+// that has not moved yet.
+func rescheduleMoves(ctx context.Context, tx *sql.Tx, req *RescheduleRequest) ([]RescheduleMove, error) {
+	if req.Scope != ScopeFollowing {
+		return []RescheduleMove{{BookingID: req.BookingID, StartTime: req.StartTime, EndTime: req.EndTime}}, nil
+	}
+
+	var seriesID sql.NullInt64
+	var index int
+	var start time.Time
+	err := tx.QueryRowContext(ctx,
+		`SELECT series_id, COALESCE(series_index, 0), start_time FROM bookings WHERE id = $1`, req.BookingID,
+	).Scan(&seriesID, &index, &start)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	if !seriesID.Valid {
+		return nil, ErrNotInSeries
+	}
+
+	offset := req.StartTime.Sub(start)
+
+	rows, err := tx.QueryContext(ctx, `
+		SELECT id, start_time, end_time
+		FROM bookings
+		WHERE series_id = $1 AND series_index >= $2 AND bk_status = ANY($3)
+		ORDER BY series_index
+	`, seriesID.Int64, index, pq.Array(ActiveBookingStatuses))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var moves []RescheduleMove
+	for rows.Next() {
+		var m RescheduleMove
+		if err := rows.Scan(&m.BookingID, &m.StartTime, &m.EndTime); err != nil {
+			return nil, err
+		}
+		m.StartTime = m.StartTime.Add(offset)
+		m.EndTime = m.EndTime.Add(offset)
+		moves = append(moves, m)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if offset > 0 {
+		for i, j := 0, len(moves)-1; i < j; i, j = i+1, j-1 {
+			moves[i], moves[j] = moves[j], moves[i]
+		}
+	}
+
+	return moves, nil
+}
+
+// Propose records a reschedule proposal. The new time is checked against the
+// booking rules and overlap constraints straight away so the other party is
+// never asked to accept a time that cannot be booked.
+func (s *RescheduleStore) Propose(ctx context.Context, req *RescheduleRequest, maxReschedules int) error {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	return withTx(s.db, ctx, func(tx *sql.Tx) error {
+		moves, err := rescheduleMoves(ctx, tx, req)
+		if err != nil {
+			return err
+		}
+
+		// Dry run: let the triggers and exclusion constraints judge the new times
+		if _, err := tx.ExecContext(ctx, `SAVEPOINT reschedule_check`); err != nil {
+			return err
+		}
+		for _, m := range moves {
+			if _, err := lockReschedulable(ctx, tx, m.BookingID, maxReschedules); err != nil {
+				return err
+			}
+			_, err = tx.ExecContext(ctx,
+				`UPDATE bookings SET start_time = $2, end_time = $3 WHERE id = $1`,
+				m.BookingID, m.StartTime, m.EndTime,
+			)
+			if err != nil {
+				return bookingWriteError(err)
+			}
+		}
+		if _, err := tx.ExecContext(ctx, `ROLLBACK TO SAVEPOINT reschedule_check`); err != nil {
+			return err
+		}
+
+		query := `
+			INSERT INTO booking_reschedule_requests (booking_id, proposed_by, proposer, start_time, end_time, reason, scope)
+			VALUES ($1, $2, $3, $4, $5, $6, COALESCE(NULLIF($7, ''), 'this'))
+			RETURNING id, scope, status, created_at
+		`
+
+		err = tx.QueryRowContext(ctx, query,
+			req.BookingID, req.ProposedBy, req.Proposer, req.StartTime, req.EndTime, req.Reason, req.Scope,
+		).Scan(&req.ID, &req.Scope, &req.Status, &req.CreatedAt)
+		if err != nil {
+			var pqErr *pq.Error
+			if errors.As(err, &pqErr) && pqErr.Constraint == "one_open_reschedule_per_booking" {
+				return ErrRescheduleOpen
+			}
+			return err
+		}
+
+		return nil
+	})
+}
+
+// Accept moves the booking to the proposed time and records it in the
+// booking history. The payment and Zoom meeting stay attached to the booking.
+func (s *RescheduleStore) Accept(ctx context.Context, req *RescheduleRequest, actor Actor, actorID int64, maxReschedules int) error {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	return withTx(s.db, ctx, func(tx *sql.Tx) error {
+		var status string
+		err := tx.QueryRowContext(ctx,
+			`SELECT status FROM booking_reschedule_requests WHERE id = $1 AND booking_id = $2 FOR UPDATE`,
+			req.ID, req.BookingID,
+		).Scan(&status)
+		if err != nil {
+			switch {
+			case errors.Is(err, sql.ErrNoRows):
+				return ErrRecordNotFound
+			default:
+				return err
+			}
+		}
+		if status != RescheduleProposed {
+			return ErrInvalidTransition
+		}
+
+		moves, err := rescheduleMoves(ctx, tx, req)
+		if err != nil {
+			return err
+		}
+
+		for _, m := range moves {
+			bkStatus, err := lockReschedulable(ctx, tx, m.BookingID, maxReschedules)
+			if err != nil {
+				return err
+			}
+
+			_, err = tx.ExecContext(ctx, `
+				UPDATE bookings
+				SET start_time = $2, end_time = $3, reschedule_count = reschedule_count + 1
+				WHERE id = $1
+			`, m.BookingID, m.StartTime, m.EndTime)
+			if err != nil {
+				return bookingWriteError(err)
+			}
+
+			reason := fmt.Sprintf("rescheduled to %s - %s", m.StartTime.UTC().Format(time.RFC3339), m.EndTime.UTC().Format(time.RFC3339))
+			if _, err = insertBookingEvent(ctx, tx, m.BookingID, bkStatus, bkStatus, actor, actorID, reason); err != nil {
+				return err
+			}
+		}
+
+		err = tx.QueryRowContext(ctx, `
+			UPDATE booking_reschedule_requests
+			SET status = 'accepted', responded_by = $2, responded_at = NOW()
+			WHERE id = $1
+			RETURNING status, responded_at
+		`, req.ID, actorID).Scan(&req.Status, &req.RespondedAt)
+		if err != nil {
+			return err
+		}
+		req.RespondedBy = actorID
+		req.Moves = moves
+
+		return nil
+	})
+}
+
+// Close ends an open proposal without moving the booking, as declined by the
+// other party or withdrawn by the proposer.
+func (s *RescheduleStore) Close(ctx context.Context, req *RescheduleRequest, status string, actorID int64) error {
+	query := `
+		UPDATE booking_reschedule_requests
+		SET status = $3, responded_by = $4, responded_at = NOW()
+		WHERE id = $1 AND booking_id = $2 AND status = 'proposed'
+		RETURNING status, responded_at
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	err := s.db.QueryRowContext(ctx, query, req.ID, req.BookingID, status, actorID).Scan(&req.Status, &req.RespondedAt)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrInvalidTransition
+		default:
+			return err
+		}
+	}
+	req.RespondedBy = actorID
+
+	return nil
+}
+
+const rescheduleColumns = `
+	id, booking_id, COALESCE(proposed_by, 0), proposer, start_time, end_time, reason, scope, status,
+	COALESCE(responded_by, 0), responded_at, created_at
+`
+
+func scanReschedule(row interface{ Scan(...any) error }, req *RescheduleRequest) error {
+	return row.Scan(
+		&req.ID, &req.BookingID, &req.ProposedBy, &req.Proposer, &req.StartTime, &req.EndTime, &req.Reason, &req.Scope, &req.Status,
+		&req.RespondedBy, &req.RespondedAt, &req.CreatedAt,
+	)
+}
+
+// GetByID retrieves a reschedule request of a booking
+func (s *RescheduleStore) GetByID(ctx context.Context, bookingID, id int64) (*RescheduleRequest, error) {
+	query := `SELECT ` + rescheduleColumns + ` FROM booking_reschedule_requests WHERE id = $1 AND booking_id = $2`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	var req RescheduleRequest
+	if err := scanReschedule(s.db.QueryRowContext(ctx, query, id, bookingID), &req); err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &req, nil
+}
+
+// GetAllForBooking lists a booking's reschedule requests, newest first
+func (s *RescheduleStore) GetAllForBooking(ctx context.Context, bookingID int64) ([]RescheduleRequest, error) {
+	query := `SELECT ` + rescheduleColumns + ` FROM booking_reschedule_requests WHERE booking_id = $1 ORDER BY created_at DESC`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, bookingID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	requests := []RescheduleRequest{}
+	for rows.Next() {
+		var req RescheduleRequest
+		if err := scanReschedule(rows, &req); err != nil {
+			return nil, err
+		}
+		requests = append(requests, req)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return requests, nil
+}
@@ -0,0 +1,201 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"consult_app.cedrickewi/internal/validator"
+	"github.com/lib/pq"
+)
+
+// SupportedDurations are the session lengths (minutes) an expert may offer.
+var SupportedDurations = []int64{30, 45, 60, 90}
+
+// SchedulingRules are the per-expert limits applied to slot generation and
+// enforced by the enforce_booking_rules trigger.
+type SchedulingRules struct {
+	ExpertID            int64   `json:"expert_id"`
+	BufferBeforeMinutes int     `json:"buffer_before_minutes"`
+	BufferAfterMinutes  int     `json:"buffer_after_minutes"`
+	MinNoticeMinutes    int     `json:"min_notice_minutes"`
+	MaxHorizonDays      int     `json:"max_horizon_days"`
+	MaxSessionsPerDay   int     `json:"max_sessions_per_day"` // 0 means no cap
+	AllowedDurations    []int64 `json:"allowed_durations"`
+	MaxReschedules      int     `json:"max_reschedules"`
+	HoldMinutes         int     `json:"hold_minutes"` // how long an unpaid booking keeps its slot
+	RequiresApproval    bool    `json:"requires_approval"`
+	ApprovalHours       int     `json:"approval_hours"` // how long the expert has to answer a request
+	UpdatedAt           string  `json:"updated_at"`
+}
+
+// DefaultMaxReschedules is how many times a booking may be moved unless the
+// expert says otherwise.
+const DefaultMaxReschedules = 2
+
+// DefaultHoldMinutes is how long an unpaid booking holds its slot.
+const DefaultHoldMinutes = 15
+
+// DefaultApprovalHours is how long an expert has to answer a booking request.
+const DefaultApprovalHours = 24
+
+// DefaultSchedulingRules mirrors the column defaults of expert_scheduling_rules.
+func DefaultSchedulingRules(expertID int64) *SchedulingRules {
+	return &SchedulingRules{
+		ExpertID:         expertID,
+		MaxHorizonDays:   60,
+		AllowedDurations: append([]int64(nil), SupportedDurations...),
+		MaxReschedules:   DefaultMaxReschedules,
+		HoldMinutes:      DefaultHoldMinutes,
+		ApprovalHours:    DefaultApprovalHours,
+	}
+}
+
+func (r *SchedulingRules) BufferBefore() time.Duration {
+	return time.Duration(r.BufferBeforeMinutes) * time.Minute
+}
+
+func (r *SchedulingRules) BufferAfter() time.Duration {
+	return time.Duration(r.BufferAfterMinutes) * time.Minute
+}
+
+func (r *SchedulingRules) MinNotice() time.Duration {
+	return time.Duration(r.MinNoticeMinutes) * time.Minute
+}
+
+func (r *SchedulingRules) Horizon() time.Duration {
+	return time.Duration(r.MaxHorizonDays) * 24 * time.Hour
+}
+
+func (r *SchedulingRules) Hold() time.Duration {
+	return time.Duration(r.HoldMinutes) * time.Minute
+}
+
+// ApprovalDeadline is when a request made now for a session starting at
+// start is declined unless the expert answered it: ApprovalHours from now,
+// but never after the session starts.
+func (r *SchedulingRules) ApprovalDeadline(now, start time.Time) time.Time {
+	deadline := now.Add(time.Duration(r.ApprovalHours) * time.Hour)
+	if start.Before(deadline) {
+		return start
+	}
+	return deadline
+}
+
+// AllowsDuration reports whether a session of the given minutes may be booked.
+func (r *SchedulingRules) AllowsDuration(minutes int64) bool {
+	for _, d := range r.AllowedDurations {
+		if d == minutes {
+			return true
+		}
+	}
+	return false
+}
+
+func ValidateSchedulingRules(v *validator.Validator, r *SchedulingRules) {
+	v.Check(r.BufferBeforeMinutes >= 0 && r.BufferBeforeMinutes <= 240, "buffer_before_minutes", "must be between 0 and 240")
+	v.Check(r.BufferAfterMinutes >= 0 && r.BufferAfterMinutes <= 240, "buffer_after_minutes", "must be between 0 and 240")
+	v.Check(r.MinNoticeMinutes >= 0 && r.MinNoticeMinutes <= 30*24*60, "min_notice_minutes", "must be between 0 and 43200")
+	v.Check(r.MaxHorizonDays >= 1 && r.MaxHorizonDays <= 365, "max_horizon_days", "must be between 1 and 365")
+	v.Check(r.MaxSessionsPerDay >= 0 && r.MaxSessionsPerDay <= 48, "max_sessions_per_day", "must be between 0 and 48")
+	v.Check(r.MaxReschedules >= 0 && r.MaxReschedules <= 10, "max_reschedules", "must be between 0 and 10")
+	v.Check(r.HoldMinutes >= 5 && r.HoldMinutes <= 24*60, "hold_minutes", "must be between 5 and 1440")
+	v.Check(r.ApprovalHours >= 1 && r.ApprovalHours <= 7*24, "approval_hours", "must be between 1 and 168")
+	v.Check(len(r.AllowedDurations) > 0, "allowed_durations", "must contain at least one duration")
+
+	seen := make(map[int64]bool)
+	for _, d := range r.AllowedDurations {
+		supported := false
+		for _, s := range SupportedDurations {
+			if d == s {
+				supported = true
+			}
+		}
+		v.Check(supported, "allowed_durations", "must only contain 30, 45, 60 or 90")
+		v.Check(!seen[d], "allowed_durations", "must not contain duplicate values")
+		seen[d] = true
+	}
+}
+
+// GetSchedulingRules returns the expert's rules, or the defaults if none were saved
+func (s *ExpertsStore) GetSchedulingRules(ctx context.Context, expertID int64) (*SchedulingRules, error) {
+	query := `
+		SELECT expert_id, buffer_before_minutes, buffer_after_minutes, min_notice_minutes,
+			   max_horizon_days, COALESCE(max_sessions_per_day, 0), allowed_durations, max_reschedules, hold_minutes,
+			   requires_approval, approval_hours, updated_at
+		FROM expert_scheduling_rules
+		WHERE expert_id = $1
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	var rules SchedulingRules
+	err := s.db.QueryRowContext(ctx, query, expertID).Scan(
+		&rules.ExpertID,
+		&rules.BufferBeforeMinutes,
+		&rules.BufferAfterMinutes,
+		&rules.MinNoticeMinutes,
+		&rules.MaxHorizonDays,
+		&rules.MaxSessionsPerDay,
+		(*pq.Int64Array)(&rules.AllowedDurations),
+		&rules.MaxReschedules,
+		&rules.HoldMinutes,
+		&rules.RequiresApproval,
+		&rules.ApprovalHours,
+		&rules.UpdatedAt,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return DefaultSchedulingRules(expertID), nil
+		default:
+			return nil, err
+		}
+	}
+
+	return &rules, nil
+}
+
+// UpsertSchedulingRules creates or replaces the expert's rules
+func (s *ExpertsStore) UpsertSchedulingRules(ctx context.Context, rules *SchedulingRules) error {
+	query := `
+		INSERT INTO expert_scheduling_rules (
+			expert_id, buffer_before_minutes, buffer_after_minutes, min_notice_minutes,
+			max_horizon_days, max_sessions_per_day, allowed_durations, max_reschedules, hold_minutes,
+			requires_approval, approval_hours
+		)
+		VALUES ($1, $2, $3, $4, $5, NULLIF($6, 0), $7, $8, $9, $10, $11)
+		ON CONFLICT (expert_id) DO UPDATE SET
+			buffer_before_minutes = EXCLUDED.buffer_before_minutes,
+			buffer_after_minutes = EXCLUDED.buffer_after_minutes,
+			min_notice_minutes = EXCLUDED.min_notice_minutes,
+			max_horizon_days = EXCLUDED.max_horizon_days,
+			max_sessions_per_day = EXCLUDED.max_sessions_per_day,
+			allowed_durations = EXCLUDED.allowed_durations,
+			max_reschedules = EXCLUDED.max_reschedules,
+			hold_minutes = EXCLUDED.hold_minutes,
+			requires_approval = EXCLUDED.requires_approval,
+			approval_hours = EXCLUDED.approval_hours,
+			updated_at = NOW()
+		RETURNING updated_at
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	return s.db.QueryRowContext(ctx, query,
+		rules.ExpertID,
+		rules.BufferBeforeMinutes,
+		rules.BufferAfterMinutes,
+		rules.MinNoticeMinutes,
+		rules.MaxHorizonDays,
+		rules.MaxSessionsPerDay,
+		pq.Array(rules.AllowedDurations),
+		rules.MaxReschedules,
+		rules.HoldMinutes,
+		rules.RequiresApproval,
+		rules.ApprovalHours,
+	).Scan(&rules.UpdatedAt)
+}
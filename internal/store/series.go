@@ -0,0 +1,265 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"consult_app.cedrickewi/internal/validator"
+	"github.com/lib/pq"
+)
+
+// Series frequencies
+const (
+	SeriesWeekly   = "weekly"
+	SeriesBiweekly = "biweekly"
+)
+
+// MaxSeriesOccurrences caps how far ahead a series can book an expert
+const MaxSeriesOccurrences = 52
+
+// Reschedule scopes for bookings that belong to a series
+const (
+	ScopeThis      = "this"
+	ScopeFollowing = "following"
+)
+
+// BookingSeries is a recurring set of bookings with the same expert. Each
+// occurrence is a regular booking with its own Zoom meeting.
+type BookingSeries struct {
+	ID            int64     `json:"id"`
+	UserID        int64     `json:"user_id"`
+	ExpertID      int64     `json:"expert_id"`
+	Frequency     string    `json:"frequency"`
+	Occurrences   int       `json:"occurrences"`
+	SinglePayment bool      `json:"single_payment"`
+	CreatedAt     string    `json:"created_at"`
+	Bookings      []Booking `json:"bookings"`
+}
+
+// IntervalDays is the number of days between two occurrences
+func (s *BookingSeries) IntervalDays() int {
+	if s.Frequency == SeriesBiweekly {
+		return 14
+	}
+	return 7
+}
+
+func ValidateBookingSeries(v *validator.Validator, s *BookingSeries) {
+	v.Check(validator.In(s.Frequency, SeriesWeekly, SeriesBiweekly), "frequency", "must be weekly or biweekly")
+	v.Check(s.Occurrences >= 2, "occurrences", "must be at least 2")
+	v.Check(s.Occurrences <= MaxSeriesOccurrences, "occurrences", fmt.Sprintf("must not be more than %d", MaxSeriesOccurrences))
+}
+
+// OccurrenceError reports which occurrence of a series could not be booked
+type OccurrenceError struct {
+	Index     int
+	StartTime string
+	Err       error
+}
+
+func (e *OccurrenceError) Error() string {
+	return fmt.Sprintf("occurrence %d (%s): %v", e.Index, e.StartTime, e.Err)
+}
+
+func (e *OccurrenceError) Unwrap() error {
+	return e.Err
+}
+
+type SeriesStore struct {
+	db *sql.DB
+}
+
+// Create writes a series and all of its occurrences in one transaction. If any
+// occurrence breaks the expert's availability, rules or overlaps, nothing is
+// booked and the error names the occurrence.
+func (s *SeriesStore) Create(ctx context.Context, series *BookingSeries, bookings []*Booking) error {
+	query := `
+		INSERT INTO booking_series (user_id, expert_id, frequency, occurrences, single_payment)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING id, created_at
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	return withTx(s.db, ctx, func(tx *sql.Tx) error {
+		err := tx.QueryRowContext(ctx, query,
+			series.UserID, series.ExpertID, series.Frequency, series.Occurrences, series.SinglePayment,
+		).Scan(&series.ID, &series.CreatedAt)
+		if err != nil {
+			return err
+		}
+
+		series.Bookings = make([]Booking, 0, len(bookings))
+		for i, booking := range bookings {
+			booking.SeriesID = sql.NullInt64{Int64: series.ID, Valid: true}
+			booking.SeriesIndex = i + 1
+
+			if err := insertBookingTx(ctx, tx, booking); err != nil {
+				return &OccurrenceError{Index: i + 1, StartTime: booking.StartTime, Err: bookingWriteError(err)}
+			}
+			series.Bookings = append(series.Bookings, *booking)
+		}
+
+		return nil
+	})
+}
+
+// GetByID retrieves a series with its occurrences in order
+func (s *SeriesStore) GetByID(ctx context.Context, id int64) (*BookingSeries, error) {
+	query := `
+		SELECT id, user_id, expert_id, frequency, occurrences, single_payment, created_at
+		FROM booking_series
+		WHERE id = $1
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	var series BookingSeries
+	err := s.db.QueryRowContext(ctx, query, id).Scan(
+		&series.ID, &series.UserID, &series.ExpertID, &series.Frequency, &series.Occurrences, &series.SinglePayment, &series.CreatedAt,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	series.Bookings, err = s.getOccurrences(ctx, id, 0, false)
+	if err != nil {
+		return nil, err
+	}
+
+	return &series, nil
+}
+
+// GetFollowing lists the occurrences of a series from fromIndex onwards that
+// still hold their slot
+func (s *SeriesStore) GetFollowing(ctx context.Context, seriesID int64, fromIndex int) ([]Booking, error) {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	return s.getOccurrences(ctx, seriesID, fromIndex, true)
+}
+
+func (s *SeriesStore) getOccurrences(ctx context.Context, seriesID int64, fromIndex int, activeOnly bool) ([]Booking, error) {
+	query := `
+		SELECT id, user_id, expert_id, start_time, end_time, topic, additional_notes, amount_to_pay, currency,
+			payment_status, bk_status, zoom_meeting_id, hold_expires_at, series_id, series_index, transaction_id
+		FROM bookings
+		WHERE series_id = $1 AND series_index >= $2
+			AND (NOT $3 OR bk_status = ANY($4))
+		ORDER BY series_index
+	`
+
+	rows, err := s.db.QueryContext(ctx, query, seriesID, fromIndex, activeOnly, pq.Array(ActiveBookingStatuses))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	bookings := []Booking{}
+	for rows.Next() {
+		var b Booking
+		err := rows.Scan(
+			&b.ID, &b.UserID, &b.ExpertID, &b.StartTime, &b.EndTime, &b.Topic, &b.AdditionalNotes, &b.TotalAmount, &b.Currency,
+			&b.PaymentStatus, &b.BKStatus, &b.ZoomMeetingID, &b.HoldExpiresAt, &b.SeriesID, &b.SeriesIndex, &b.TransactionID,
+		)
+		if err != nil {
+			return nil, err
+		}
+		bookings = append(bookings, b)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return bookings, nil
+}
+
+// OutstandingAmount is what a single payment for the series still has to
+// cover: the price of every occurrence awaiting payment
+func (s *SeriesStore) OutstandingAmount(ctx context.Context, seriesID int64) (int, error) {
+	query := `
+		SELECT COALESCE(SUM(amount_to_pay), 0)
+		FROM bookings
+		WHERE series_id = $1 AND bk_status = 'awaiting_payment' AND payment_status <> 'success'
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	var amount int
+	err := s.db.QueryRowContext(ctx, query, seriesID).Scan(&amount)
+	return amount, err
+}
+
+// MarkPaid records a single series payment on every occurrence still awaiting
+// it and confirms them. It returns the confirmed booking IDs.
+func (s *SeriesStore) MarkPaid(ctx context.Context, seriesID int64) ([]int64, error) {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	var confirmed []int64
+	err := withTx(s.db, ctx, func(tx *sql.Tx) error {
+		rows, err := tx.QueryContext(ctx, `
+			UPDATE bookings
+			SET payment_status = 'success'
+			WHERE series_id = $1 AND bk_status = 'awaiting_payment'
+			RETURNING id
+		`, seriesID)
+		if err != nil {
+			return err
+		}
+
+		var ids []int64
+		for rows.Next() {
+			var id int64
+			if err := rows.Scan(&id); err != nil {
+				rows.Close()
+				return err
+			}
+			ids = append(ids, id)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+
+		for _, id := range ids {
+			if _, err := transitionTx(ctx, tx, id, StatusConfirmed, ActorSystem, 0, "series payment received"); err != nil {
+				return err
+			}
+		}
+
+		confirmed = ids
+		return nil
+	})
+
+	return confirmed, err
+}
+
+// SeriesPaymentLead is how long before its start an occurrence paid on its own
+// must be paid; until then the occurrence keeps its slot
+const SeriesPaymentLead = 24 * time.Hour
+
+// OccurrenceHold returns when the hold of an occurrence runs out. Occurrences
+// of a series paid at once share the first hold; otherwise later occurrences
+// are held until SeriesPaymentLead before they start.
+func (s *BookingSeries) OccurrenceHold(index int, start, firstHold time.Time) time.Time {
+	if s.SinglePayment || index == 1 {
+		return firstHold
+	}
+	if due := start.Add(-SeriesPaymentLead); due.After(firstHold) {
+		return due
+	}
+	return firstHold
+}
@@ -0,0 +1,177 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"consult_app.cedrickewi/internal/validator"
+)
+
+// ExpertService is an offering in an expert's catalogue, e.g. a
+// "30-min intro call" with a fixed price.
+type ExpertService struct {
+	ID              int64  `json:"id"`
+	ExpertID        int64  `json:"expert_id"`
+	Name            string `json:"name"`
+	Description     string `json:"description"`
+	DurationMinutes int    `json:"duration_minutes"`
+	Price           int    `json:"price"`
+	Currency        string `json:"currency"`
+	IsActive        bool   `json:"is_active"`
+	CreatedAt       string `json:"created_at"`
+	UpdatedAt       string `json:"updated_at"`
+	Version         int64  `json:"version"`
+}
+
+// SupportedCurrencies are the currencies the payment gateway accepts.
+var SupportedCurrencies = []string{"XAF", "XOF", "NGN", "USD", "EUR"}
+
+type ServiceStore struct {
+	db *sql.DB
+}
+
+func ValidateService(v *validator.Validator, service *ExpertService) {
+	v.Check(service.Name != "", "name", "must be provided")
+	v.Check(len(service.Name) <= 120, "name", "must not be more than 120 bytes long")
+	v.Check(len(service.Description) <= 2000, "description", "must not be more than 2000 bytes long")
+	v.Check(service.Price >= 0, "price", "must not be negative")
+	v.Check(validator.In(service.Currency, SupportedCurrencies...), "currency", "must be a supported currency")
+
+	supported := false
+	for _, d := range SupportedDurations {
+		if int64(service.DurationMinutes) == d {
+			supported = true
+		}
+	}
+	v.Check(supported, "duration_minutes", "must be 30, 45, 60 or 90")
+}
+
+// Insert adds a service to an expert's catalogue
+func (s *ServiceStore) Insert(ctx context.Context, service *ExpertService) error {
+	query := `
+		INSERT INTO expert_services (expert_id, name, description, duration_minutes, price, currency)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING id, is_active, created_at, updated_at, version
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	return s.db.QueryRowContext(ctx, query,
+		service.ExpertID, service.Name, service.Description, service.DurationMinutes, service.Price, service.Currency,
+	).Scan(&service.ID, &service.IsActive, &service.CreatedAt, &service.UpdatedAt, &service.Version)
+}
+
+// GetByID retrieves a service by its ID
+func (s *ServiceStore) GetByID(ctx context.Context, id int64) (*ExpertService, error) {
+	query := `
+		SELECT id, expert_id, name, description, duration_minutes, price, currency, is_active, created_at, updated_at, version
+		FROM expert_services
+		WHERE id = $1
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	var service ExpertService
+	err := s.db.QueryRowContext(ctx, query, id).Scan(
+		&service.ID,
+		&service.ExpertID,
+		&service.Name,
+		&service.Description,
+		&service.DurationMinutes,
+		&service.Price,
+		&service.Currency,
+		&service.IsActive,
+		&service.CreatedAt,
+		&service.UpdatedAt,
+		&service.Version,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &service, nil
+}
+
+// GetAllForExpert lists an expert's services, optionally only the active ones
+func (s *ServiceStore) GetAllForExpert(ctx context.Context, expertID int64, activeOnly bool) ([]ExpertService, error) {
+	query := `
+		SELECT id, expert_id, name, description, duration_minutes, price, currency, is_active, created_at, updated_at, version
+		FROM expert_services
+		WHERE expert_id = $1 AND (is_active OR NOT $2)
+		ORDER BY duration_minutes, price
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, expertID, activeOnly)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	services := []ExpertService{}
+	for rows.Next() {
+		var service ExpertService
+		err := rows.Scan(
+			&service.ID,
+			&service.ExpertID,
+			&service.Name,
+			&service.Description,
+			&service.DurationMinutes,
+			&service.Price,
+			&service.Currency,
+			&service.IsActive,
+			&service.CreatedAt,
+			&service.UpdatedAt,
+			&service.Version,
+		)
+		if err != nil {
+			return nil, err
+		}
+		services = append(services, service)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return services, nil
+}
+
+// Update edits a service; existing bookings keep their snapshotted price
+func (s *ServiceStore) Update(ctx context.Context, service *ExpertService) error {
+	query := `
+		UPDATE expert_services
+		SET name = $1, description = $2, duration_minutes = $3, price = $4, currency = $5, is_active = $6,
+			updated_at = NOW(), version = version + 1
+		WHERE id = $7 AND version = $8
+		RETURNING updated_at, version
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	err := s.db.QueryRowContext(ctx, query,
+		service.Name, service.Description, service.DurationMinutes, service.Price, service.Currency, service.IsActive,
+		service.ID, service.Version,
+	).Scan(&service.UpdatedAt, &service.Version)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrEditConflict
+		default:
+			return err
+		}
+	}
+
+	return nil
+}
@@ -5,6 +5,8 @@ import (
 	"database/sql"
 	"errors"
 	"time"
+
+	"consult_app.cedrickewi/internal/data"
 )
 
 var (
@@ -23,6 +25,10 @@ var (
 	ErrEndTimeBeforeStart    = errors.New("end time must be after start time")
 	ErrNoExpertOverlap       = errors.New("expert cannot double book the same time slot")
 	ErrNoUserOverlap         = errors.New("user cannot double book the same time slot")
+	ErrSchedulingRule        = errors.New("booking violates the expert's scheduling rules")
+	ErrInvalidTransition     = errors.New("invalid status transition")
+	ErrExpertNotBookable     = errors.New("expert is not accepting bookings")
+	ErrTransitionNotAllowed  = errors.New("not allowed to move the booking to this status")
 )
 
 type Storage struct {
@@ -34,6 +40,7 @@ type Storage struct {
 		GetByID(context.Context, int64) (*User, error)
 		Delete(context.Context, int64) error
 		UpdateUserImage(context.Context, int64, string) error
+		UpdateTimezone(context.Context, int64, string) error
 	}
 
 	Organisation interface {
@@ -79,6 +86,17 @@ type Storage struct {
 		GetExpertAvailability(context.Context, int64) (*[]ExpertAvailability, error)
 		AddExpertAvailability(ctx context.Context, availability *ExpertAvailability) error 
 		AddWeeklyAvailability(ctx context.Context, expertID int64, availabilities []ExpertAvailability) error
+		AddAvailabilityException(context.Context, *AvailabilityException) error
+		GetAvailabilityExceptions(ctx context.Context, expertID int64, from, to time.Time) ([]AvailabilityException, error)
+		DeleteAvailabilityException(ctx context.Context, expertID, exceptionID int64) error
+		GetSchedulingRules(context.Context, int64) (*SchedulingRules, error)
+		UpsertSchedulingRules(context.Context, *SchedulingRules) error
+		GetOnboardingProgress(context.Context, int64) (*OnboardingProgress, error)
+		UpdateOnboardingStatus(ctx context.Context, expertID int64, from []OnboardingStatus, to OnboardingStatus, reason string, reviewerID int64) error
+		AddCertification(context.Context, *Certification) error
+		GetCertifications(context.Context, int64) ([]Certification, error)
+		UpsertPayoutDetails(context.Context, *PayoutDetails) error
+		GetPayoutDetails(context.Context, int64) (*PayoutDetails, error)
 	}
 
 	Token interface {
@@ -107,26 +125,158 @@ type Storage struct {
 		Update(ctx context.Context, booking *Booking) error
 		Delete(context.Context, int64) error
 		GetByID(context.Context, int64) (*Booking, error)
-		GetAllUserBookings(context.Context, int64) (*[]CustomBooking, error)
+		List(context.Context, BookingFilter, data.Filters) ([]CustomBooking, data.Metadata, error)
 		GetBookingDetails(context.Context, int64) (*CustomBooking, error)
 		IsUserMeeting(context.Context, int64, int64) (bool, error)
 		UpdatePaymentStatus(context.Context, int64, string, int64) error
-		UpdateBookingStatus(context.Context, int64, string) error
 		IsExpertMeeting(context.Context, int64, int64) (bool, error)
-		UpdateInitTransactionID(ctx context.Context, bookingID, initTransx int64) error
-		UpdatePayunitPaymentID(ctx context.Context, bookingID, initTransx int64) error
-		UpdateTransactionID(ctx context.Context, bookingID int64, transactionID string) error 
 		GetByTransactionID(ctx context.Context, transactionID string) (*Booking, error)
+		SetZoomMeeting(ctx context.Context, bookingID, zoomMeetingID int64) (bool, error)
 		UpdateBookingReminders(ctx context.Context, bookingID int64, userReminder int, expertReminder int) error
+		GetExpertBusyRanges(ctx context.Context, expertID int64, from, to time.Time) ([]TimeRange, error)
+		Transition(ctx context.Context, bookingID int64, to BookingStatus, actor Actor, actorID int64, reason string) (*BookingEvent, error)
+		GetEvents(ctx context.Context, bookingID int64) ([]BookingEvent, error)
+		ExpireHold(ctx context.Context, bookingID int64) (bool, error)
+		Decide(ctx context.Context, bookingID int64, accept bool, expertUserID int64, message string, hold time.Duration) ([]Booking, error)
+		ExpireRequest(ctx context.Context, bookingID int64) ([]Booking, error)
+	}
+
+	Service interface {
+		Insert(context.Context, *ExpertService) error
+		GetByID(context.Context, int64) (*ExpertService, error)
+		GetAllForExpert(ctx context.Context, expertID int64, activeOnly bool) ([]ExpertService, error)
+		Update(context.Context, *ExpertService) error
+	}
+
+	Cancellation interface {
+		GetPolicy(ctx context.Context, expertID int64) (*CancellationPolicy, error)
+		UpsertExpertPolicy(context.Context, *CancellationPolicy) error
+		UpsertBranchPolicy(context.Context, *CancellationPolicy) error
+		Cancel(ctx context.Context, bookingID int64, to BookingStatus, actor Actor, actorID int64, reason string, refund *Refund) (*BookingEvent, error)
+	}
+
+	Reschedule interface {
+		Propose(ctx context.Context, req *RescheduleRequest, maxReschedules int) error
+		Accept(ctx context.Context, req *RescheduleRequest, actor Actor, actorID int64, maxReschedules int) error
+		Close(ctx context.Context, req *RescheduleRequest, status string, actorID int64) error
+		GetByID(ctx context.Context, bookingID, id int64) (*RescheduleRequest, error)
+		GetAllForBooking(ctx context.Context, bookingID int64) ([]RescheduleRequest, error)
+	}
+
+	Refund interface {
+		GetAllForBooking(ctx context.Context, bookingID int64) ([]Refund, error)
+		Refundable(ctx context.Context, bookingID int64) (int, error)
+		Create(ctx context.Context, refund *Refund) error
+		GetDue(ctx context.Context, limit int) ([]Refund, error)
+		GetByProviderReference(ctx context.Context, reference string) (*Refund, error)
+		GetByID(ctx context.Context, id int64) (*Refund, error)
+		GetManual(ctx context.Context) ([]Refund, error)
+		MarkManual(ctx context.Context, id int64, transactionID, reason string) error
+		RecordPayout(ctx context.Context, id int64, reference string) error
+		MarkIssued(ctx context.Context, id int64, transactionID, reference string) error
+		RecordAttempt(ctx context.Context, id int64, attemptErr string) (bool, error)
+		Settle(ctx context.Context, id int64, succeeded bool, reason string) (bool, error)
+	}
+
+	Series interface {
+		Create(ctx context.Context, series *BookingSeries, bookings []*Booking) error
+		GetByID(ctx context.Context, id int64) (*BookingSeries, error)
+		GetFollowing(ctx context.Context, seriesID int64, fromIndex int) ([]Booking, error)
+		OutstandingAmount(ctx context.Context, seriesID int64) (int, error)
+		MarkPaid(ctx context.Context, seriesID int64) ([]int64, error)
+	}
+
+	GroupSession interface {
+		Create(ctx context.Context, g *GroupSession) error
+		GetByID(ctx context.Context, id int64) (*GroupSession, error)
+		GetUpcomingForExpert(ctx context.Context, expertID int64) ([]GroupSession, error)
+		ReserveSeat(ctx context.Context, sessionID int64, booking *Booking) error
+		GetAttendees(ctx context.Context, sessionID int64) ([]Attendee, error)
+		SetZoomMeeting(ctx context.Context, sessionID, zoomMeetingID int64) (bool, error)
+		Cancel(ctx context.Context, sessionID int64) error
+	}
+
+	Waitlist interface {
+		Join(ctx context.Context, e *WaitlistEntry) error
+		Leave(ctx context.Context, userID, entryID int64) error
+		GetForUser(ctx context.Context, userID int64) ([]WaitlistEntry, error)
+		GetWaiting(ctx context.Context, expertID int64) ([]WaitlistEntry, error)
+		GetLiveOffers(ctx context.Context, expertID int64, from, to time.Time) ([]WaitlistOffer, error)
+		Offer(ctx context.Context, o *WaitlistOffer) (bool, error)
+		LapseExpired(ctx context.Context, expertID int64) error
+		Lapse(ctx context.Context, offerID int64) (*WaitlistOffer, bool, error)
+		Claim(ctx context.Context, booking *Booking) error
+	}
+
+	IntakeForm interface {
+		Save(ctx context.Context, f *IntakeForm) error
+		GetOwn(ctx context.Context, expertID, organisationID sql.NullInt64) (*IntakeForm, error)
+		GetForExpert(ctx context.Context, expertID int64) (*IntakeForm, error)
+		Deactivate(ctx context.Context, formID int64) error
+	}
+
+	Attachment interface {
+		Insert(ctx context.Context, a *Attachment) error
+		Count(ctx context.Context, bookingID int64) (int, error)
+		GetForBooking(ctx context.Context, bookingID int64) ([]Attachment, error)
+		GetByID(ctx context.Context, bookingID, id int64) (*Attachment, error)
+		Delete(ctx context.Context, id int64) error
+	}
+
+	Note interface {
+		IsClient(ctx context.Context, expertID, userID int64) (bool, error)
+		Insert(ctx context.Context, n *Note) error
+		GetByID(ctx context.Context, expertID, id int64) (*Note, error)
+		Update(ctx context.Context, n *Note) error
+		Delete(ctx context.Context, expertID, id int64) error
+		SaveSummary(ctx context.Context, sum *Summary) (bool, error)
+		GetSummary(ctx context.Context, bookingID int64) (*Summary, error)
+		Timeline(ctx context.Context, expertID, userID int64) ([]TimelineItem, error)
+	}
+
+	Attendance interface {
+		GetDue(ctx context.Context, grace time.Duration, limit int) ([]int64, error)
+		Measure(ctx context.Context, bookingID int64) (*Attendance, error)
+		Settle(ctx context.Context, booking *Booking, a *Attendance) (bool, error)
+		GetForBooking(ctx context.Context, bookingID int64) (*Attendance, error)
+	}
+
+	Calendar interface {
+		NewFeedToken(ctx context.Context, userID int64) (string, error)
+		DeleteFeedToken(ctx context.Context, userID int64) error
+		GetFeedUser(ctx context.Context, token string) (int64, error)
+		GetCalendarEntry(ctx context.Context, bookingID int64) (*CalendarEntry, error)
+		GetFeedEntries(ctx context.Context, userID int64) ([]CalendarEntry, error)
+	}
+
+	CalendarSync interface {
+		SaveConnection(ctx context.Context, c *CalendarConnection) error
+		GetConnection(ctx context.Context, expertID int64) (*CalendarConnection, error)
+		GetConnections(ctx context.Context) ([]CalendarConnection, error)
+		DeleteConnection(ctx context.Context, expertID int64) error
+		MarkSynced(ctx context.Context, connectionID int64, syncErr string) error
+		ReplaceImported(ctx context.Context, expertID int64, from time.Time, blocks []TimeRange) ([]TimeRange, error)
+		GetPendingPushes(ctx context.Context, expertID int64) ([]PendingPush, error)
+		SavePush(ctx context.Context, bookingID, connectionID int64, href string, sequence int) error
+		DeletePush(ctx context.Context, bookingID int64) error
+	}
+
+	Payment interface {
+		SaveTransaction(ctx context.Context, t *PaymentTransaction) error
+		GetTransaction(ctx context.Context, bookingID int64) (*PaymentTransaction, error)
+		SaveCharge(ctx context.Context, bookingID int64, chargeID, state string) error
+		SaveState(ctx context.Context, bookingID int64, transactionID, state string) error
+	}
+
+	PaymentEvent interface {
+		Record(ctx context.Context, e *PaymentEvent) (bool, error)
+		MarkProcessed(ctx context.Context, id int64, processErr string) error
 	}
 
-	PayUnit interface {
-		InsertInitializedTransaction(context.Context, *PayUnitResponse) (int64, error)
-		InsertPayunitPayment(context.Context, *PaymentResponse) (int64, error)
-		InsertPaymentStatus(context.Context, *PaymentStatusResponse) (int64, error)
-		UpdatePaymentStatus(context.Context, *PaymentStatusResponse) error
-		CheckPaymentStatusExists(context.Context, string) (bool, error) 
-		GetPayunitInitializationByTransactionID(ctx context.Context, bookingID int64) (*PayUnitResponse, error)
+	Reconciliation interface {
+		GetPendingPayments(ctx context.Context, from, to time.Time) ([]int64, error)
+		GetPaymentRecords(ctx context.Context, from, to time.Time) ([]PaymentRecord, error)
+		SaveReport(ctx context.Context, r *ReconciliationReport) error
 	}
 
 	Permissions interface {
@@ -151,7 +301,22 @@ func NewStorage(db *sql.DB) Storage {
 		MeetingParticipant: &MeetingParticipantStore{db: db},
 		Roles:              &RoleStore{db: db},
 		Permissions:        &PermissionStore{db: db},
-		PayUnit:            &PayunitStore{db: db},
+		Payment:            &PaymentStore{db: db},
+		Service:            &ServiceStore{db: db},
+		Cancellation:       &CancellationStore{db: db},
+		Refund:             &RefundStore{db: db},
+		Reschedule:         &RescheduleStore{db: db},
+		Series:             &SeriesStore{db: db},
+		GroupSession:       &GroupSessionStore{db: db},
+		Waitlist:           &WaitlistStore{db: db},
+		IntakeForm:         &IntakeFormStore{db: db},
+		Attachment:         &AttachmentStore{db: db},
+		Note:               &NoteStore{db: db},
+		Attendance:         &AttendanceStore{db: db},
+		Calendar:           &CalendarStore{db: db},
+		CalendarSync:       &CalendarSyncStore{db: db},
+		PaymentEvent:       &PaymentEventStore{db: db},
+		Reconciliation:     &ReconciliationStore{db: db},
 	}
 }
 
@@ -0,0 +1,68 @@
+package store
+
+import (
+	"time"
+)
+
+// DefaultTimezone is used for users and experts that never set a zone.
+const DefaultTimezone = "UTC"
+
+// LoadLocation resolves an IANA zone name, falling back to UTC when the
+// name is empty or unknown so a bad row never breaks a response.
+func LoadLocation(tz string) *time.Location {
+	if tz == "" {
+		return time.UTC
+	}
+	loc, err := time.LoadLocation(tz)
+	if err != nil {
+		return time.UTC
+	}
+	return loc
+}
+
+// convertTimestamp re-renders a timestamp scanned from postgres into loc.
+// Values that cannot be parsed are returned untouched.
+func convertTimestamp(ts string, loc *time.Location) string {
+	if ts == "" {
+		return ts
+	}
+	t, err := time.Parse(time.RFC3339Nano, ts)
+	if err != nil {
+		return ts
+	}
+	return t.In(loc).Format(time.RFC3339)
+}
+
+// Times parses the booking's start and end timestamps.
+func (b *Booking) Times() (start, end time.Time, err error) {
+	if start, err = time.Parse(time.RFC3339Nano, b.StartTime); err != nil {
+		return start, end, err
+	}
+	end, err = time.Parse(time.RFC3339Nano, b.EndTime)
+	return start, end, err
+}
+
+// InLocation converts the booking's timestamps into loc.
+func (b *Booking) InLocation(loc *time.Location) {
+	b.StartTime = convertTimestamp(b.StartTime, loc)
+	b.EndTime = convertTimestamp(b.EndTime, loc)
+	b.CreatedAt = convertTimestamp(b.CreatedAt, loc)
+}
+
+// InLocation converts the booking and its zoom meeting into loc.
+func (c *CustomBooking) InLocation(loc *time.Location) {
+	c.Booking.InLocation(loc)
+	if !c.ZoomMeeting.StartTime.IsZero() {
+		c.ZoomMeeting.StartTime = c.ZoomMeeting.StartTime.In(loc)
+	}
+	c.ZoomMeeting.TimeZone = loc.String()
+}
+
+// InLocation converts the consultation's booking and zoom meeting into loc.
+func (c *Consultation) InLocation(loc *time.Location) {
+	c.Booking.InLocation(loc)
+	if !c.ZoomMeeting.StartTime.IsZero() {
+		c.ZoomMeeting.StartTime = c.ZoomMeeting.StartTime.In(loc)
+	}
+	c.ZoomMeeting.TimeZone = loc.String()
+}
@@ -30,6 +30,7 @@ type User struct {
 	Role         string   `json:"role"`
 	ImageURL     string   `json:"image_url"`
 	IsExpert     bool     `json:"is_expert"`
+	Timezone     string   `json:"timezone"`
 }
 
 var AnonymousUser = &User{}
@@ -113,10 +114,28 @@ func (s *UserStore) UpdateUserImage(ctx context.Context, userID int64, imageurl
 	return nil
 }
 
+func (s *UserStore) UpdateTimezone(ctx context.Context, userID int64, timezone string) error {
+	query := `
+	UPDATE users
+	SET timezone = $1
+	WHERE id = $2
+	RETURNING timezone
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	err := s.db.QueryRowContext(ctx, query, timezone, userID).Scan(&timezone)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
 // Get user by email
 func (s *UserStore) GetByEmail(ctx context.Context, email string) (*User, error) {
 	query := `
-	SELECT id, created_at, username, email, password_hash, is_activated, phone, version
+	SELECT id, created_at, username, email, password_hash, is_activated, phone, version, timezone
 	FROM users
 	WHERE email = $1`
 
@@ -134,6 +153,7 @@ func (s *UserStore) GetByEmail(ctx context.Context, email string) (*User, error)
 		&user.IsActivated,
 		&user.Phone,
 		&user.Version,
+		&user.Timezone,
 	)
 
 	if err != nil {
@@ -186,7 +206,7 @@ func (s *UserStore) GetForToken(ctx context.Context, tokenScope, tokenPlainText
 
 	// Set up the SQL query.
 	query := `
-	SELECT users.id, users.created_at, users.username, users.email, users.password_hash, users.is_activated
+	SELECT users.id, users.created_at, users.username, users.email, users.password_hash, users.is_activated, users.timezone
 	FROM users
 	INNER JOIN tokens ON users.id = tokens.user_id
 	WHERE tokens.hash = $1
@@ -209,6 +229,7 @@ func (s *UserStore) GetForToken(ctx context.Context, tokenScope, tokenPlainText
 		&user.Email,
 		&user.Password.hash,
 		&user.IsActivated,
+		&user.Timezone,
 	)
 	if err != nil {
 		switch {
@@ -233,6 +254,15 @@ func ValidatePasswordPlaintext(v *validator.Validator, password string) {
 	v.Check(len(password) <= 72, "password", "must not be more than 72 bytes long")
 }
 
+// ValidateTimezone checks that tz is a known IANA zone name such as "Africa/Douala".
+func ValidateTimezone(v *validator.Validator, tz string) {
+	v.Check(tz != "", "timezone", "must be provided")
+	if tz != "" {
+		_, err := time.LoadLocation(tz)
+		v.Check(err == nil, "timezone", "must be a valid IANA timezone")
+	}
+}
+
 func ValidateUser(v *validator.Validator, user *User) {
 	v.Check(user.Name != "", "name", "must be provided")
 	v.Check(len(user.Name) <= 500, "name", "must not be more than 500 bytes long")
@@ -255,7 +285,7 @@ func ValidateUser(v *validator.Validator, user *User) {
 
 func (s *UserStore) GetByID(ctx context.Context, id int64) (*User, error) {
 	query := `
-	SELECT id, created_at, username, email, phone, role, is_activated, version
+	SELECT id, created_at, username, email, phone, role, is_activated, version, timezone
 	FROM users
 	WHERE id = $1
 	`
@@ -274,6 +304,7 @@ func (s *UserStore) GetByID(ctx context.Context, id int64) (*User, error) {
 		&user.Role,
 		&user.IsActivated,
 		&user.Version,
+		&user.Timezone,
 	)
 
 	if err != nil {
@@ -0,0 +1,416 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"consult_app.cedrickewi/internal/validator"
+	"github.com/lib/pq"
+)
+
+// Waitlist entry statuses
+const (
+	WaitlistWaiting   = "waiting"
+	WaitlistFulfilled = "fulfilled"
+	WaitlistLeft      = "left"
+)
+
+// Waitlist offer statuses
+const (
+	OfferOffered = "offered"
+	OfferClaimed = "claimed"
+	OfferLapsed  = "lapsed"
+)
+
+// WaitlistClaimWindow is how long a freed slot is held for the client it is
+// offered to before it goes to the next one in line
+const WaitlistClaimWindow = 30 * time.Minute
+
+// WaitlistLookahead is how far ahead new availability is offered to waiting clients
+const WaitlistLookahead = 14 * 24 * time.Hour
+
+var (
+	ErrAlreadyWaitlisted = errors.New("already on this expert's waitlist")
+	ErrSlotHeld          = errors.New("slot is held for a waitlisted client")
+)
+
+var weekdays = []string{"sunday", "monday", "tuesday", "wednesday", "thursday", "friday", "saturday"}
+
+// WaitlistEntry is a client waiting for a slot with a fully booked expert.
+// Preferred days are lowercase weekday names and the preferred times use the
+// "15:04" layout, both read in Timezone; empty preferences match any slot.
+type WaitlistEntry struct {
+	ID              int64          `json:"id"`
+	UserID          int64          `json:"user_id"`
+	ExpertID        int64          `json:"expert_id"`
+	DurationMinutes int            `json:"duration_minutes"`
+	PreferredDays   []string       `json:"preferred_days"`
+	PreferredFrom   string         `json:"preferred_from,omitempty"`
+	PreferredTo     string         `json:"preferred_to,omitempty"`
+	Timezone        string         `json:"timezone"`
+	Status          string         `json:"status"`
+	CreatedAt       string         `json:"created_at"`
+	Offer           *WaitlistOffer `json:"offer,omitempty"`
+}
+
+// Matches reports whether a slot falls within the entry's preferences
+func (e *WaitlistEntry) Matches(start, end time.Time) bool {
+	if end.Sub(start) != time.Duration(e.DurationMinutes)*time.Minute {
+		return false
+	}
+
+	loc := LoadLocation(e.Timezone)
+	start, end = start.In(loc), end.In(loc)
+
+	if len(e.PreferredDays) > 0 && !slices.Contains(e.PreferredDays, weekdays[start.Weekday()]) {
+		return false
+	}
+	if e.PreferredFrom != "" && start.Format("15:04") < e.PreferredFrom {
+		return false
+	}
+	if e.PreferredTo != "" && (end.Format("15:04") > e.PreferredTo || end.YearDay() != start.YearDay()) {
+		return false
+	}
+
+	return true
+}
+
+func ValidateWaitlistEntry(v *validator.Validator, e *WaitlistEntry) {
+	v.Check(e.DurationMinutes > 0, "duration_minutes", "must be provided")
+	v.Check(len(e.PreferredDays) <= 7, "preferred_days", "must not contain more than 7 days")
+	for i, day := range e.PreferredDays {
+		e.PreferredDays[i] = strings.ToLower(strings.TrimSpace(day))
+		v.Check(slices.Contains(weekdays, e.PreferredDays[i]), "preferred_days", fmt.Sprintf("%q is not a day of the week", day))
+	}
+
+	for key, clock := range map[string]string{"preferred_from": e.PreferredFrom, "preferred_to": e.PreferredTo} {
+		if clock == "" {
+			continue
+		}
+		_, err := time.Parse("15:04", clock)
+		v.Check(err == nil, key, "must use the HH:MM format")
+	}
+	v.Check(e.PreferredFrom == "" || e.PreferredTo == "" || e.PreferredTo > e.PreferredFrom, "preferred_to", "must be after preferred_from")
+
+	_, err := time.LoadLocation(e.Timezone)
+	v.Check(e.Timezone != "" && err == nil, "timezone", "must be a valid IANA timezone")
+}
+
+// WaitlistOffer holds a freed slot for one waitlisted client until ExpiresAt
+type WaitlistOffer struct {
+	ID        int64         `json:"id"`
+	EntryID   int64         `json:"entry_id"`
+	UserID    int64         `json:"user_id"`
+	ExpertID  int64         `json:"expert_id"`
+	StartTime time.Time     `json:"start_time"`
+	EndTime   time.Time     `json:"end_time"`
+	ExpiresAt time.Time     `json:"expires_at"`
+	Status    string        `json:"status"`
+	BookingID sql.NullInt64 `json:"booking_id"`
+	CreatedAt string        `json:"created_at"`
+}
+
+type WaitlistStore struct {
+	db *sql.DB
+}
+
+// Join puts a client at the end of an expert's waitlist
+func (s *WaitlistStore) Join(ctx context.Context, e *WaitlistEntry) error {
+	query := `
+		INSERT INTO waitlist_entries (user_id, expert_id, duration_minutes, preferred_days, preferred_from, preferred_to, timezone)
+		VALUES ($1, $2, $3, $4, NULLIF($5, '')::time, NULLIF($6, '')::time, $7)
+		RETURNING id, status, created_at
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	if e.PreferredDays == nil {
+		e.PreferredDays = []string{}
+	}
+
+	err := s.db.QueryRowContext(ctx, query,
+		e.UserID, e.ExpertID, e.DurationMinutes, pq.Array(e.PreferredDays), e.PreferredFrom, e.PreferredTo, e.Timezone,
+	).Scan(&e.ID, &e.Status, &e.CreatedAt)
+	if err != nil {
+		var pqErr *pq.Error
+		if errors.As(err, &pqErr) && pqErr.Code == "23505" {
+			return ErrAlreadyWaitlisted
+		}
+		return err
+	}
+
+	return nil
+}
+
+// Leave takes a client off a waitlist and releases any slot held for them
+func (s *WaitlistStore) Leave(ctx context.Context, userID, entryID int64) error {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	return withTx(s.db, ctx, func(tx *sql.Tx) error {
+		res, err := tx.ExecContext(ctx, `
+			UPDATE waitlist_entries
+			SET status = 'left'
+			WHERE id = $1 AND user_id = $2 AND status = 'waiting'
+		`, entryID, userID)
+		if err != nil {
+			return err
+		}
+
+		n, err := res.RowsAffected()
+		if err != nil {
+			return err
+		}
+		if n == 0 {
+			return ErrRecordNotFound
+		}
+
+		_, err = tx.ExecContext(ctx, `
+			UPDATE waitlist_offers
+			SET status = 'lapsed'
+			WHERE entry_id = $1 AND status = 'offered'
+		`, entryID)
+		return err
+	})
+}
+
+const waitlistEntryColumns = `
+	e.id, e.user_id, e.expert_id, e.duration_minutes, e.preferred_days,
+	COALESCE(to_char(e.preferred_from, 'HH24:MI'), ''), COALESCE(to_char(e.preferred_to, 'HH24:MI'), ''),
+	e.timezone, e.status, e.created_at
+`
+
+func scanWaitlistEntry(row interface{ Scan(...any) error }, e *WaitlistEntry, dest ...any) error {
+	return row.Scan(append([]any{
+		&e.ID, &e.UserID, &e.ExpertID, &e.DurationMinutes, pq.Array(&e.PreferredDays),
+		&e.PreferredFrom, &e.PreferredTo, &e.Timezone, &e.Status, &e.CreatedAt,
+	}, dest...)...)
+}
+
+// GetForUser lists the waitlists a client is on, with the slot currently
+// offered to them if any
+func (s *WaitlistStore) GetForUser(ctx context.Context, userID int64) ([]WaitlistEntry, error) {
+	query := `SELECT ` + waitlistEntryColumns + `,
+			o.id, o.start_time, o.end_time, o.expires_at
+		FROM waitlist_entries e
+		LEFT JOIN waitlist_offers o
+			ON o.entry_id = e.id AND o.status = 'offered' AND o.expires_at > NOW()
+		WHERE e.user_id = $1 AND e.status = 'waiting'
+		ORDER BY e.created_at`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	entries := []WaitlistEntry{}
+	for rows.Next() {
+		var e WaitlistEntry
+		var offerID sql.NullInt64
+		var start, end, expires sql.NullTime
+		if err := scanWaitlistEntry(rows, &e, &offerID, &start, &end, &expires); err != nil {
+			return nil, err
+		}
+		if offerID.Valid {
+			e.Offer = &WaitlistOffer{
+				ID: offerID.Int64, EntryID: e.ID, UserID: e.UserID, ExpertID: e.ExpertID,
+				StartTime: start.Time, EndTime: end.Time, ExpiresAt: expires.Time, Status: OfferOffered,
+			}
+		}
+		entries = append(entries, e)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return entries, nil
+}
+
+// GetWaiting lists an expert's waiting clients in the order they joined,
+// leaving out those who already hold an offer
+func (s *WaitlistStore) GetWaiting(ctx context.Context, expertID int64) ([]WaitlistEntry, error) {
+	query := `SELECT ` + waitlistEntryColumns + `
+		FROM waitlist_entries e
+		WHERE e.expert_id = $1 AND e.status = 'waiting'
+			AND NOT EXISTS (
+				SELECT 1 FROM waitlist_offers o
+				WHERE o.entry_id = e.id AND o.status = 'offered' AND o.expires_at > NOW()
+			)
+		ORDER BY e.created_at, e.id`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, expertID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	entries := []WaitlistEntry{}
+	for rows.Next() {
+		var e WaitlistEntry
+		if err := scanWaitlistEntry(rows, &e); err != nil {
+			return nil, err
+		}
+		entries = append(entries, e)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return entries, nil
+}
+
+// GetLiveOffers lists the unexpired offers holding an expert's slots between from and to
+func (s *WaitlistStore) GetLiveOffers(ctx context.Context, expertID int64, from, to time.Time) ([]WaitlistOffer, error) {
+	query := `
+		SELECT o.id, o.entry_id, e.user_id, o.expert_id, o.start_time, o.end_time, o.expires_at, o.status, o.booking_id, o.created_at
+		FROM waitlist_offers o
+		JOIN waitlist_entries e ON e.id = o.entry_id
+		WHERE o.expert_id = $1 AND o.status = 'offered' AND o.expires_at > NOW()
+			AND o.start_time < $3 AND o.end_time > $2
+		ORDER BY o.start_time
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, expertID, from, to)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	offers := []WaitlistOffer{}
+	for rows.Next() {
+		var o WaitlistOffer
+		err := rows.Scan(&o.ID, &o.EntryID, &o.UserID, &o.ExpertID, &o.StartTime, &o.EndTime, &o.ExpiresAt, &o.Status, &o.BookingID, &o.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		offers = append(offers, o)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return offers, nil
+}
+
+// Offer holds a slot for a waiting client. It reports false without offering
+// when the slot is already held, the client already holds a slot or let an
+// offer of this slot lapse, or is no longer waiting.
+func (s *WaitlistStore) Offer(ctx context.Context, o *WaitlistOffer) (bool, error) {
+	query := `
+		INSERT INTO waitlist_offers (entry_id, expert_id, start_time, end_time, expires_at)
+		SELECT e.id, e.expert_id, $2, $3, $4
+		FROM waitlist_entries e
+		WHERE e.id = $1 AND e.status = 'waiting'
+			AND NOT EXISTS (
+				SELECT 1 FROM waitlist_offers p
+				WHERE p.entry_id = e.id
+					AND ((p.status = 'offered' AND p.expires_at > NOW())
+						OR (p.status = 'lapsed' AND p.start_time < $3 AND p.end_time > $2))
+			)
+		RETURNING id, expert_id, status, created_at
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	err := s.db.QueryRowContext(ctx, query, o.EntryID, o.StartTime, o.EndTime, o.ExpiresAt).Scan(&o.ID, &o.ExpertID, &o.Status, &o.CreatedAt)
+	if err != nil {
+		var pqErr *pq.Error
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return false, nil
+		case errors.As(err, &pqErr) && pqErr.Constraint == "no_waitlist_offer_overlap":
+			return false, nil
+		default:
+			return false, err
+		}
+	}
+
+	return true, nil
+}
+
+// LapseExpired releases the expert's offers whose claim window has run out
+func (s *WaitlistStore) LapseExpired(ctx context.Context, expertID int64) error {
+	query := `
+		UPDATE waitlist_offers
+		SET status = 'lapsed'
+		WHERE expert_id = $1 AND status = 'offered' AND expires_at <= NOW()
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	_, err := s.db.ExecContext(ctx, query, expertID)
+	return err
+}
+
+// Lapse releases an offer once its claim window has run out. It reports
+// false when the offer was claimed or released already.
+func (s *WaitlistStore) Lapse(ctx context.Context, offerID int64) (*WaitlistOffer, bool, error) {
+	query := `
+		UPDATE waitlist_offers
+		SET status = 'lapsed'
+		WHERE id = $1 AND status = 'offered' AND expires_at <= NOW()
+		RETURNING id, entry_id, expert_id, start_time, end_time, expires_at, status, created_at
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	var o WaitlistOffer
+	err := s.db.QueryRowContext(ctx, query, offerID).Scan(&o.ID, &o.EntryID, &o.ExpertID, &o.StartTime, &o.EndTime, &o.ExpiresAt, &o.Status, &o.CreatedAt)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, false, nil
+		default:
+			return nil, false, err
+		}
+	}
+
+	return &o, true, nil
+}
+
+// Claim marks the client's offer overlapping a new booking as claimed and
+// takes them off the waitlist
+func (s *WaitlistStore) Claim(ctx context.Context, booking *Booking) error {
+	query := `
+		WITH claimed AS (
+			UPDATE waitlist_offers o
+			SET status = 'claimed', booking_id = $5
+			FROM waitlist_entries e
+			WHERE e.id = o.entry_id AND e.user_id = $1 AND o.expert_id = $2
+				AND o.status = 'offered' AND o.expires_at > NOW()
+				AND o.start_time < $4 AND o.end_time > $3
+			RETURNING o.entry_id
+		)
+		UPDATE waitlist_entries
+		SET status = 'fulfilled'
+		WHERE id IN (SELECT entry_id FROM claimed)
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	_, err := s.db.ExecContext(ctx, query, booking.UserID, booking.ExpertID, booking.StartTime, booking.EndTime, booking.ID)
+	return err
+}
@@ -130,8 +130,8 @@ func (s *ZoomMeetingStore) Delete(ctx context.Context, id int64) error {
 func (s *ZoomMeetingStore) Update(ctx context.Context, meeting *ZoomMeeting) error {
 	query := `
 		UPDATE zoom_meetings
-		SET topic = $1, agenda = $2, duration = $3, zoom_status = $4
-		WHERE id = $5
+		SET topic = $1, agenda = $2, duration = $3, zoom_status = $4, start_time = $5
+		WHERE id = $6
 		RETURNING id
 	`
 
@@ -139,7 +139,7 @@ func (s *ZoomMeetingStore) Update(ctx context.Context, meeting *ZoomMeeting) err
 	defer cancel()
 
 	err := s.db.QueryRowContext(ctx, query,
-		meeting.Topic, meeting.Agenda, meeting.Duration, meeting.Status,
+		meeting.Topic, meeting.Agenda, meeting.Duration, meeting.Status, meeting.StartTime,
 		meeting.ID,
 	).Scan(&meeting.ID)
 
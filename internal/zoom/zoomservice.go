@@ -252,6 +252,12 @@ func UpdateZoomMeeting(meetingID int64, zm store.ZoomMeeting) error {
 		},
 	}
 
+	// Move the meeting when the booking was rescheduled
+	if !zm.StartTime.IsZero() {
+		meetingPayload["start_time"] = zm.StartTime.UTC().Format(time.RFC3339)
+		meetingPayload["timezone"] = "UTC"
+	}
+
 	payloadBytes, err := json.Marshal(meetingPayload)
 	if err != nil {
 		return fmt.Errorf("error marshalling meeting payload: %w", err)